@@ -0,0 +1,395 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package analyzer provides a go/analysis Analyzer that checks
+// snakecharmer tagged structs at build time, reporting the mistakes
+// that would otherwise make (*SnakeCharmer).AddFlags() panic at runtime.
+// It can be used with go vet:
+//
+//	go install github.com/asokolov365/snakecharmer/cmd/snakecharmer-vet@latest
+//	go vet -vettool=$(which snakecharmer-vet) ./...
+package analyzer
+
+import (
+	"flag"
+	"go/ast"
+	"go/types"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const doc = `check snakecharmer struct tags
+
+The snakecharmer analyzer checks structs having fields with the flag usage
+or ENV var tags for missing usage tags, unsupported field types,
+duplicate keys, invalid field tag options and invalid oneof, min, max
+and maxlen tags.`
+
+// Analyzer checks snakecharmer tagged structs.
+var Analyzer = newAnalyzer()
+
+// The field tag options snakecharmer and mapstructure understand.
+var knownTagOptions = []string{
+	"omitempty",
+	"required",
+	"squash",
+	"remain",
+	"relpath",
+	"secret",
+	"percent",
+	"persist",
+	"count",
+	"noflag",
+	"indexed",
+}
+
+type config struct {
+	// The tag name that snakecharmer reads for field names
+	fieldTagName string
+	// The tag name that snakecharmer reads for setting ENV var name
+	envTagName string
+	// The tag name that snakecharmer reads for flag usage help
+	flagHelpTagName string
+}
+
+func newAnalyzer() *analysis.Analyzer {
+	cfg := &config{}
+	fs := flag.NewFlagSet("snakecharmer", flag.ExitOnError)
+	fs.StringVar(&cfg.fieldTagName, "fieldtag", "mapstructure", "the tag name that snakecharmer reads for field names")
+	fs.StringVar(&cfg.envTagName, "envtag", "env", "the tag name that snakecharmer reads for setting ENV var name")
+	fs.StringVar(&cfg.flagHelpTagName, "usagetag", "usage", "the tag name that snakecharmer reads for flag usage help")
+	return &analysis.Analyzer{
+		Name:     "snakecharmer",
+		Doc:      doc,
+		Flags:    *fs,
+		Run:      cfg.run,
+		Requires: []*analysis.Analyzer{inspect.Analyzer},
+	}
+}
+
+func (cfg *config) run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	insp.Preorder([]ast.Node{(*ast.StructType)(nil)}, func(n ast.Node) {
+		st := n.(*ast.StructType)
+		if cfg.isCharmed(st) {
+			cfg.checkStruct(pass, st)
+		}
+	})
+	return nil, nil
+}
+
+// isCharmed returns true if any of the struct fields
+// has the flag usage or the ENV var tag.
+func (cfg *config) isCharmed(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		tag := fieldTag(field)
+		if _, ok := tag.Lookup(cfg.flagHelpTagName); ok {
+			return true
+		}
+		if _, ok := tag.Lookup(cfg.envTagName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *config) checkStruct(pass *analysis.Pass, st *ast.StructType) {
+	keys := make(map[string]bool)
+	for _, field := range st.Fields.List {
+		tag := fieldTag(field)
+		value, ok := tag.Lookup(cfg.fieldTagName)
+		if !ok || value == "-" {
+			continue
+		}
+		parts := strings.Split(value, ",")
+		key := parts[0]
+		for _, opt := range parts[1:] {
+			if !isKnownTagOption(strings.TrimSpace(opt)) {
+				pass.Reportf(field.Pos(), "unknown %s tag option %q", cfg.fieldTagName, opt)
+			}
+		}
+		if len(key) == 0 {
+			if strings.Contains(value, "squash") {
+				// Squashed struct, its fields are checked separately
+				continue
+			}
+			pass.Reportf(field.Pos(), "empty key in %s tag", cfg.fieldTagName)
+		} else if keys[key] {
+			pass.Reportf(field.Pos(), "duplicate key %q in %s tag", key, cfg.fieldTagName)
+		}
+		keys[key] = true
+
+		typ := pass.TypesInfo.TypeOf(field.Type)
+		if typ == nil {
+			continue
+		}
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if _, ok := typ.Underlying().(*types.Struct); ok && !isTextUnmarshaler(typ) && !isNetType(typ) && !isFlagValue(typ) {
+			// Nested struct, its fields are checked separately
+			continue
+		}
+		if isStructSlice(typ) || isStructMap(typ) {
+			// Config-only slice or map of structs, it has no flag
+			checkCollectionTags(pass, field, tag, isStructMap(typ))
+			continue
+		}
+		if !isSupportedType(typ) && !isTextUnmarshaler(typ) && !isNetType(typ) && !isFlagValue(typ) {
+			pass.Reportf(field.Pos(), "unsupported field type %s", typ.String())
+			continue
+		}
+		if len(tag.Get(cfg.flagHelpTagName)) == 0 {
+			pass.Reportf(field.Pos(), "%s tag is not specified", cfg.flagHelpTagName)
+		}
+		if _, ok := tag.Lookup("maxlen"); ok {
+			pass.Reportf(field.Pos(), "maxlen tag is set for non slice of structs field")
+		}
+		checkOneOfTag(pass, field, tag, typ)
+		checkRangeTags(pass, field, tag, typ)
+	}
+}
+
+// checkCollectionTags reports the tags of the slice or map of structs field,
+// which snakecharmer rejects, since the field has no flag of its own.
+func checkCollectionTags(pass *analysis.Pass, field *ast.Field, tag reflect.StructTag, isMap bool) {
+	for _, name := range []string{"oneof", "min", "max"} {
+		if _, ok := tag.Lookup(name); ok {
+			pass.Reportf(field.Pos(), "%s tag is set for slice or map of structs field", name)
+		}
+	}
+	if maxLen, ok := tag.Lookup("maxlen"); ok {
+		if isMap {
+			pass.Reportf(field.Pos(), "maxlen tag is set for map of structs field")
+		} else if n, err := strconv.Atoi(maxLen); err != nil || n <= 0 {
+			pass.Reportf(field.Pos(), "invalid maxlen tag %q: must be a positive integer", maxLen)
+		}
+	}
+}
+
+// checkOneOfTag reports the oneof tag of the non-scalar field,
+// and the empty values listed in it.
+func checkOneOfTag(pass *analysis.Pass, field *ast.Field, tag reflect.StructTag, typ types.Type) {
+	oneOf, ok := tag.Lookup("oneof")
+	if !ok {
+		return
+	}
+	switch typ.Underlying().(type) {
+	case *types.Slice, *types.Map, *types.Struct:
+		pass.Reportf(field.Pos(), "oneof tag is set for non-scalar field")
+		return
+	}
+	for _, value := range strings.Split(oneOf, ",") {
+		if len(strings.TrimSpace(value)) == 0 {
+			pass.Reportf(field.Pos(), "empty value in oneof tag %q", oneOf)
+			return
+		}
+	}
+}
+
+// checkRangeTags reports the min and max tags of the field, which do not
+// parse as the values of its numeric type, overflow it, or make
+// the empty range.
+func checkRangeTags(pass *analysis.Pass, field *ast.Field, tag reflect.StructTag, typ types.Type) {
+	minValue, hasMin := tag.Lookup("min")
+	maxValue, hasMax := tag.Lookup("max")
+	if !hasMin && !hasMax {
+		return
+	}
+	if isByteSize(typ) {
+		// The byte sizes, e.g. "1MiB", are checked at runtime
+		return
+	}
+	b, ok := typ.Underlying().(*types.Basic)
+	if !ok || b.Info()&(types.IsInteger|types.IsFloat) == 0 {
+		pass.Reportf(field.Pos(), "min or max tag is set for non-numeric field type %s", typ.String())
+		return
+	}
+	bits := int(pass.TypesSizes.Sizeof(typ) * 8)
+	bounds := []*big.Float{}
+	for _, t := range []struct {
+		name, value string
+		ok          bool
+	}{{"min", minValue, hasMin}, {"max", maxValue, hasMax}} {
+		if !t.ok {
+			continue
+		}
+		bound, err := parseBound(b, isDuration(typ), bits, strings.TrimSpace(t.value))
+		if err != nil {
+			pass.Reportf(field.Pos(), "invalid %s tag %q for field type %s", t.name, t.value, typ.String())
+			return
+		}
+		bounds = append(bounds, bound)
+	}
+	if len(bounds) == 2 && bounds[0].Cmp(bounds[1]) > 0 {
+		pass.Reportf(field.Pos(), "min tag %q is greater than max tag %q", minValue, maxValue)
+	}
+}
+
+// parseBound parses the value of the min or max tag as the value
+// of the basic type of the given size, durations are parsed
+// as time.ParseDuration does, e.g. "5s".
+func parseBound(b *types.Basic, duration bool, bits int, value string) (*big.Float, error) {
+	if duration {
+		if d, err := time.ParseDuration(value); err == nil {
+			return new(big.Float).SetInt64(int64(d)), nil
+		}
+	}
+	switch {
+	case b.Info()&types.IsUnsigned != 0:
+		n, err := strconv.ParseUint(value, 0, bits)
+		return new(big.Float).SetUint64(n), err
+	case b.Info()&types.IsInteger != 0:
+		n, err := strconv.ParseInt(value, 0, bits)
+		return new(big.Float).SetInt64(n), err
+	default:
+		n, err := strconv.ParseFloat(value, bits)
+		return new(big.Float).SetFloat64(n), err
+	}
+}
+
+// isSupportedType returns true if snakecharmer can create a flag for the type.
+func isSupportedType(typ types.Type) bool {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		// uintptr is an integer, but snakecharmer has no flag of it
+		return t.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat|types.IsString) != 0 &&
+			t.Info()&types.IsUntyped == 0 && t.Kind() != types.Uintptr
+	case *types.Slice:
+		elem, ok := t.Elem().(*types.Basic)
+		if !ok {
+			return false
+		}
+		switch elem.Kind() {
+		case types.String, types.Int, types.Int32, types.Int64, types.Uint,
+			types.Float32, types.Float64, types.Bool:
+			return true
+		}
+	case *types.Map:
+		elem, ok := t.Elem().(*types.Basic)
+		return ok && isBasic(t.Key(), types.String) &&
+			elem.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat|types.IsString) != 0 &&
+			elem.Kind() != types.Uintptr
+	}
+	return false
+}
+
+// isTextUnmarshaler returns true if the pointer to the type
+// implements encoding.TextUnmarshaler, e.g. big.Int or decimal.Decimal.
+func isTextUnmarshaler(typ types.Type) bool {
+	sel := types.NewMethodSet(types.NewPointer(typ)).Lookup(nil, "UnmarshalText")
+	return sel != nil
+}
+
+// isStructSlice returns true if the type is a slice of structs
+// or pointers to them, e.g. []UpstreamConfig.
+func isStructSlice(typ types.Type) bool {
+	s, ok := typ.Underlying().(*types.Slice)
+	if !ok {
+		return false
+	}
+	elem := s.Elem()
+	if ptr, ok := elem.(*types.Pointer); ok {
+		elem = ptr.Elem()
+	}
+	_, ok = elem.Underlying().(*types.Struct)
+	return ok && !isTextUnmarshaler(elem) && !isNetType(elem) && !isFlagValue(elem)
+}
+
+// isStructMap returns true if the type is a map of structs or pointers
+// to them keyed by strings, e.g. map[string]DestinationConfig.
+func isStructMap(typ types.Type) bool {
+	m, ok := typ.Underlying().(*types.Map)
+	if !ok || !isBasic(m.Key(), types.String) {
+		return false
+	}
+	elem := m.Elem()
+	if ptr, ok := elem.(*types.Pointer); ok {
+		elem = ptr.Elem()
+	}
+	_, ok = elem.Underlying().(*types.Struct)
+	return ok && !isTextUnmarshaler(elem) && !isNetType(elem) && !isFlagValue(elem)
+}
+
+// isFlagValue returns true if the pointer to the type
+// implements pflag.Value, e.g. tri-state bools or enums.
+func isFlagValue(typ types.Type) bool {
+	mset := types.NewMethodSet(types.NewPointer(typ))
+	for _, name := range []string{"Set", "String", "Type"} {
+		if mset.Lookup(nil, name) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isNetType returns true if the type is net.IP, net.IPNet or net.HardwareAddr.
+func isNetType(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "net" {
+		return false
+	}
+	switch named.Obj().Name() {
+	case "IP", "IPNet", "HardwareAddr":
+		return true
+	}
+	return false
+}
+
+// isDuration returns true if the type is time.Duration.
+func isDuration(typ types.Type) bool {
+	return isNamed(typ, "time", "Duration")
+}
+
+// isByteSize returns true if the type is snakecharmer.ByteSize.
+func isByteSize(typ types.Type) bool {
+	return isNamed(typ, "github.com/asokolov365/snakecharmer", "ByteSize")
+}
+
+func isNamed(typ types.Type, pkg, name string) bool {
+	named, ok := typ.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == pkg && named.Obj().Name() == name
+}
+
+func isBasic(typ types.Type, kind types.BasicKind) bool {
+	b, ok := typ.(*types.Basic)
+	return ok && b.Kind() == kind
+}
+
+func isKnownTagOption(opt string) bool {
+	for _, known := range knownTagOptions {
+		if opt == known {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(tag)
+}
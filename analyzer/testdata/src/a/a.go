@@ -0,0 +1,77 @@
+package a
+
+import (
+	"net"
+	"time"
+)
+
+type Limits struct {
+	Warn  *uint `mapstructure:"warn" usage:"Limit warn messages per sec"`
+	Error *uint `mapstructure:"error"` // want `usage tag is not specified`
+}
+
+type Decimal struct {
+	value string
+}
+
+func (d *Decimal) UnmarshalText(text []byte) error {
+	d.value = string(text)
+	return nil
+}
+
+type TriState struct {
+	value *bool
+}
+
+func (t *TriState) Set(s string) error { return nil }
+func (t *TriState) String() string     { return "" }
+func (t *TriState) Type() string       { return "triState" }
+
+type Config struct {
+	Workers  *int                `mapstructure:"workers,omitempty" env:"WORKERS" usage:"Number of workers"`
+	Burst    float64             `mapstructure:"workers" usage:"Max burst"`       // want `duplicate key "workers" in mapstructure tag`
+	APIKey   string              `mapstructure:"api-key,requird" usage:"API key"` // want `unknown mapstructure tag option "requird"`
+	Timeouts []float64           `mapstructure:"timeouts" usage:"Timeouts"`
+	CertFile string              `mapstructure:"cert-file,relpath" usage:"Cert file"`
+	Labels   map[string]string   `mapstructure:"labels" usage:"Labels"`
+	Weights  map[string]int      `mapstructure:"weights" usage:"Weights"`
+	Groups   map[string][]string `mapstructure:"groups" usage:"Groups"`   // want `unsupported field type map\[string\]\[\]string`
+	Handler  func()              `mapstructure:"handler" usage:"Handler"` // want `unsupported field type func\(\)`
+	Limits   *Limits             `mapstructure:"limit"`
+	Price    Decimal             `mapstructure:"price" usage:"Price"`
+	Fee      *Decimal            `mapstructure:"fee"` // want `usage tag is not specified`
+	BindAddr *net.IP             `mapstructure:"bind-addr" usage:"Addr to bind"`
+	Trusted  net.IPNet           `mapstructure:"trusted"` // want `usage tag is not specified`
+	MAC      net.HardwareAddr    `mapstructure:"mac" usage:"MAC address"`
+	Feature  TriState            `mapstructure:"feature" usage:"Feature"`
+	Beta     *TriState           `mapstructure:"beta"` // want `usage tag is not specified`
+	Backends []Limits            `mapstructure:"backends"`
+	Sinks    *map[string]Limits  `mapstructure:"sinks"`
+	Common   Limits              `mapstructure:",squash"`
+	Ignored  chan int            `mapstructure:"-"`
+	internal bool
+}
+
+type Checked struct {
+	Level     string            `mapstructure:"level" oneof:"debug,info,warn" usage:"Log level"`
+	Format    string            `mapstructure:"format" oneof:"json,,text" usage:"Log format"` // want `empty value in oneof tag "json,,text"`
+	Tags      []string          `mapstructure:"tags" oneof:"a,b" usage:"Tags"`                // want `oneof tag is set for non-scalar field`
+	Port      uint16            `mapstructure:"port" min:"1" max:"65535" usage:"Port"`
+	Workers   int8              `mapstructure:"workers" max:"300" usage:"Workers"`       // want `invalid max tag "300" for field type int8`
+	Ratio     float64           `mapstructure:"ratio" min:"0.5" max:"0.1" usage:"Ratio"` // want `min tag "0.5" is greater than max tag "0.1"`
+	Retries   uint              `mapstructure:"retries" min:"-1" usage:"Retries"`        // want `invalid min tag "-1" for field type uint`
+	Name      string            `mapstructure:"name" min:"1" usage:"Name"`               // want `min or max tag is set for non-numeric field type string`
+	Timeout   time.Duration     `mapstructure:"timeout" min:"1s" max:"1m" usage:"Timeout"`
+	Interval  time.Duration     `mapstructure:"interval" min:"1m" max:"1s" usage:"Interval"` // want `min tag "1m" is greater than max tag "1s"`
+	Hosts     []string          `mapstructure:"hosts" maxlen:"4" usage:"Hosts"`              // want `maxlen tag is set for non slice of structs field`
+	Upstreams []Limits          `mapstructure:"upstreams" maxlen:"4"`
+	Mirrors   []Limits          `mapstructure:"mirrors" maxlen:"none"`   // want `invalid maxlen tag "none": must be a positive integer`
+	Sinks     []Limits          `mapstructure:"sinks" min:"1"`           // want `min tag is set for slice or map of structs field`
+	Routes    map[string]Limits `mapstructure:"routes" maxlen:"2"`       // want `maxlen tag is set for map of structs field`
+	Pointer   uintptr           `mapstructure:"pointer" usage:"Pointer"` // want `unsupported field type uintptr`
+}
+
+// NotCharmed has no usage nor env tags, so it is not checked.
+type NotCharmed struct {
+	Handler func() `mapstructure:"handler"`
+}
@@ -0,0 +1,92 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SSMClient reads the parameters of AWS Systems Manager Parameter Store,
+// e.g. an adapter of the ssm.Client of the AWS SDK, see WithSSM.
+type SSMClient interface {
+	// GetParameter returns the value of the parameter,
+	// the SecureString ones are decrypted.
+	GetParameter(ctx context.Context, name string) (string, error)
+}
+
+// SecretsManagerClient reads the secrets of AWS Secrets Manager,
+// e.g. an adapter of the secretsmanager.Client of the AWS SDK,
+// see WithSecretsManager.
+type SecretsManagerClient interface {
+	// GetSecretValue returns the SecretString of the secret.
+	GetSecretValue(ctx context.Context, secretID string) (string, error)
+}
+
+// ssmPrefix and awsSecretsManagerPrefix are the prefixes
+// of the references resolved by the AWS clients.
+const (
+	ssmPrefix               = "ssm://"
+	awsSecretsManagerPrefix = "aws-sm://"
+)
+
+// ssmResolver resolves "ssm:///app/db/password" as the parameter "/app/db/password".
+type ssmResolver struct {
+	client SSMClient
+}
+
+func (r *ssmResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	if len(ref) == 0 {
+		return "", fmt.Errorf("SSM parameter name is an empty string")
+	}
+	return r.client.GetParameter(ctx, ref)
+}
+
+// secretsManagerResolver resolves "aws-sm://name" as the secret "name",
+// and "aws-sm://name#field" as the field of the JSON secret "name".
+type secretsManagerResolver struct {
+	client SecretsManagerClient
+}
+
+func (r *secretsManagerResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	name, field, hasField := strings.Cut(ref, "#")
+	if len(name) == 0 {
+		return "", fmt.Errorf("secret name is an empty string")
+	}
+	secret, err := r.client.GetSecretValue(ctx, name)
+	if err != nil || !hasField {
+		return secret, err
+	}
+	return jsonField(secret, field)
+}
+
+// jsonField returns the field of the JSON object as a string.
+func jsonField(doc, field string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
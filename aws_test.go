@@ -0,0 +1,134 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testAWSClient map[string]string
+
+func (c testAWSClient) GetParameter(ctx context.Context, name string) (string, error) {
+	if value, ok := c[name]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("parameter %q is not found", name)
+}
+
+func (c testAWSClient) GetSecretValue(ctx context.Context, secretID string) (string, error) {
+	return c.GetParameter(ctx, secretID)
+}
+
+type testRefStruct struct {
+	Workers int `snakecharmer:"workers" usage:"Number of workers" default:"8"`
+	DB      struct {
+		User     string `snakecharmer:"user" usage:"DB user" ref:"aws-sm://app/db#user"`
+		Password string `snakecharmer:"password,secret" usage:"DB password" ref:"aws-sm://app/db#password"`
+	} `snakecharmer:"db"`
+	Token string   `snakecharmer:"token,secret" usage:"API token"`
+	Hosts []string `snakecharmer:"hosts" usage:"Hosts" default:"localhost"`
+}
+
+func Test_AWSValueResolvers(t *testing.T) {
+	ssm := testAWSClient{
+		"/app/config.yaml": "workers: 16\ntoken: ssm:///app/token\n",
+		"/app/token":       "t0k3n",
+		"/app/host":        "db.example.com",
+	}
+	sm := testAWSClient{
+		"app/db": `{"user": "admin", "password": "s3cr3t"}`,
+	}
+	f := func(configFile string, args ...string) *testRefStruct {
+		t.Helper()
+		result := &testRefStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(configFile),
+			WithSSM(ssm),
+			WithSecretsManager(sm),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		require.NoError(t, charmer.UnmarshalExact())
+		require.Contains(t, charmer.PrecedenceOrder(), SourceProvider)
+		return result
+	}
+
+	// The whole config is a reference
+	result := f("ssm:///app/config.yaml")
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "t0k3n", result.Token)
+	require.Equal(t, "admin", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// The references in the config file and flags
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("hosts: [ssm:///app/host, localhost]\ndb:\n  user: root\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result = f(config, "--token", "ssm:///app/token", "--db.password", "plain")
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, "t0k3n", result.Token)
+	require.Equal(t, []string{"db.example.com", "localhost"}, result.Hosts)
+	require.Equal(t, "admin", result.DB.User)
+	require.Equal(t, "plain", result.DB.Password)
+}
+
+func Test_ValueResolverErrors(t *testing.T) {
+	f := func(args ...string) {
+		t.Helper()
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testRefStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithSSM(testAWSClient{}),
+			WithSecretsManager(testAWSClient{"app/db": "not json"}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		require.Error(t, charmer.UnmarshalExact())
+	}
+
+	// The secret is not a JSON object
+	f()
+	// The parameter is not found
+	f("--db.user", "u", "--db.password", "p", "--token", "ssm:///app/missing")
+
+	_, err := NewSnakeCharmer(WithSSM(nil))
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithValueResolver("", ValueResolverFunc(nil)))
+	require.Error(t, err)
+}
@@ -0,0 +1,150 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Backend is the layered config store snakecharmer merges the values into.
+// It resolves every key from the layers in the priority order:
+// flag (if changed) > ENV var (if set) > config > default.
+// The config files are read, parsed, merged and written by snakecharmer
+// itself with viper's codecs, the backend holds the result in its config
+// layer. So a custom backend replaces the value store only, the module
+// depends on viper regardless of it.
+// The viper based one is used by default, see WithBackend,
+// the koanf based one is github.com/asokolov365/snakecharmer/koanfbackend.
+type Backend interface {
+	// SetDefault sets the default value of the key.
+	SetDefault(key string, value interface{})
+	// BindFlag binds the key to the flag, whose value is used if it is changed.
+	BindFlag(key string, flag *pflag.Flag) error
+	// BindEnv binds the key to the ENV vars, the first one set wins.
+	BindEnv(key string, envs ...string) error
+	// MergeFile replaces the config layer with the settings
+	// merged from the config files, file is the last one of them.
+	MergeFile(file string, settings map[string]interface{}) error
+	// MergeConfigMap deep-merges the settings into the config layer.
+	MergeConfigMap(settings map[string]interface{}) error
+	// InConfig returns true if the key is set in the config layer.
+	InConfig(key string) bool
+	// AllSettings returns the resolved values of all the keys as nested maps.
+	AllSettings() map[string]interface{}
+}
+
+// LayeredBackend is the Backend which exposes the values of its layers,
+// it is required to customize the precedence of them, see WithPrecedence.
+type LayeredBackend interface {
+	Backend
+	// ConfigValue returns the value of the key in the config layer.
+	ConfigValue(key string) (interface{}, bool)
+	// DefaultValue returns the default value of the key.
+	DefaultValue(key string) (interface{}, bool)
+}
+
+// viperBackend is the Backend based on viper.Viper.
+type viperBackend struct {
+	v *viper.Viper
+	// The config file type, see WithConfigFileType
+	configType string
+	// The copies of the config layer and the defaults,
+	// since viper does not expose them
+	config   map[string]interface{}
+	defaults map[string]interface{}
+}
+
+// NewViperBackend returns the Backend based on the given viper instance.
+// Its config type follows WithConfigFileType.
+func NewViperBackend(v *viper.Viper) Backend {
+	return &viperBackend{v: v}
+}
+
+func (b *viperBackend) SetDefault(key string, value interface{}) {
+	if b.defaults == nil {
+		b.defaults = map[string]interface{}{}
+	}
+	b.defaults[strings.ToLower(key)] = value
+	b.v.SetDefault(key, value)
+}
+
+func (b *viperBackend) BindFlag(key string, flag *pflag.Flag) error { return b.v.BindPFlag(key, flag) }
+
+func (b *viperBackend) BindEnv(key string, envs ...string) error {
+	return b.v.BindEnv(append([]string{key}, envs...)...)
+}
+
+func (b *viperBackend) MergeFile(file string, settings map[string]interface{}) error {
+	// viper has no API to clear the config, reading an empty YAML does it
+	b.v.SetConfigType("yaml")
+	if err := b.v.ReadConfig(strings.NewReader("")); err != nil {
+		return err
+	}
+	b.v.SetConfigType(b.configType)
+	b.v.SetConfigFile(file)
+	b.config = nil
+	return b.MergeConfigMap(settings)
+}
+
+func (b *viperBackend) MergeConfigMap(settings map[string]interface{}) error {
+	if err := b.v.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	if b.config == nil {
+		b.config = map[string]interface{}{}
+	}
+	mergeSettings(b.config, settings)
+	return nil
+}
+
+func (b *viperBackend) ConfigValue(key string) (interface{}, bool) {
+	parent, name := settingsParent(b.config, key)
+	if parent == nil {
+		return nil, false
+	}
+	value, ok := parent[name]
+	return value, ok
+}
+
+func (b *viperBackend) DefaultValue(key string) (interface{}, bool) {
+	value, ok := b.defaults[strings.ToLower(key)]
+	return value, ok
+}
+
+// mergeSettings deep-merges the src settings into dst
+// with the keys lower-cased, like viper does.
+func mergeSettings(dst, src map[string]interface{}) {
+	for k, value := range src {
+		k = strings.ToLower(k)
+		if m, ok := normalizeValue(value).(map[string]interface{}); ok {
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				mergeSettings(d, m)
+				continue
+			}
+			d := map[string]interface{}{}
+			mergeSettings(d, m)
+			dst[k] = d
+			continue
+		}
+		dst[k] = value
+	}
+}
+
+func (b *viperBackend) InConfig(key string) bool { return b.v.InConfig(key) }
+
+func (b *viperBackend) AllSettings() map[string]interface{} { return b.v.AllSettings() }
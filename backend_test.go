@@ -0,0 +1,147 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// testMapBackend is the minimal Backend keeping the layers in flat maps.
+type testMapBackend struct {
+	defaults map[string]interface{}
+	flags    map[string]*pflag.Flag
+	envs     map[string][]string
+	config   map[string]interface{}
+}
+
+func newTestMapBackend() *testMapBackend {
+	return &testMapBackend{
+		defaults: map[string]interface{}{},
+		flags:    map[string]*pflag.Flag{},
+		envs:     map[string][]string{},
+		config:   map[string]interface{}{},
+	}
+}
+
+func (b *testMapBackend) SetDefault(key string, value interface{}) {
+	b.defaults[strings.ToLower(key)] = value
+}
+
+func (b *testMapBackend) BindFlag(key string, flag *pflag.Flag) error {
+	b.flags[strings.ToLower(key)] = flag
+	return nil
+}
+
+func (b *testMapBackend) BindEnv(key string, envs ...string) error {
+	b.envs[strings.ToLower(key)] = envs
+	return nil
+}
+
+func (b *testMapBackend) MergeFile(file string, settings map[string]interface{}) error {
+	b.config = map[string]interface{}{}
+	return b.MergeConfigMap(settings)
+}
+
+func (b *testMapBackend) MergeConfigMap(settings map[string]interface{}) error {
+	for _, key := range flattenKeys("", settings) {
+		parent, name := settingsParent(settings, key)
+		b.config[key] = parent[name]
+	}
+	return nil
+}
+
+func (b *testMapBackend) InConfig(key string) bool {
+	_, ok := b.config[strings.ToLower(key)]
+	return ok
+}
+
+func (b *testMapBackend) AllSettings() map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range b.defaults {
+		if v, ok := b.config[key]; ok {
+			value = v
+		}
+		for _, env := range b.envs[key] {
+			if v, ok := os.LookupEnv(env); ok {
+				value = v
+				break
+			}
+		}
+		if flag, ok := b.flags[key]; ok && flag.Changed {
+			value = flag.Value.String()
+		}
+		path := strings.Split(key, ".")
+		m := result
+		for _, name := range path[:len(path)-1] {
+			if _, ok := m[name]; !ok {
+				m[name] = map[string]interface{}{}
+			}
+			m = m[name].(map[string]interface{})
+		}
+		m[path[len(path)-1]] = value
+	}
+	return result
+}
+
+func Test_WithBackend(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 256\nlog:\n  level: warn\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testMultiDocStruct{}
+	cmd := &cobra.Command{}
+	backend := newTestMapBackend()
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+		WithBackend(backend),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Equal(t, "0.0.0.0", backend.defaults["bind-addr"])
+	require.Nil(t, charmer.viper)
+
+	if err = cmd.ParseFlags([]string{"--bind-addr", "127.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 256, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+	require.Equal(t, "127.0.0.1", result.BindAddr)
+
+	_, err = NewSnakeCharmer(WithBackend(nil))
+	require.EqualError(t, err, "backend is nil")
+
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(&testMultiDocStruct{}),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFileType("json"),
+		WithBackend(NewViperBackend(viper.New())),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "json", charmer.backend.(*viperBackend).configType)
+}
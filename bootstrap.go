@@ -0,0 +1,63 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import "fmt"
+
+// loadBootstrap is the first stage of the two-stage load (see WithBootstrap).
+// It decodes the bootstrap struct from flags, ENV vars, config files
+// and defaults, and creates the providers configured by it.
+func (sch *SnakeCharmer) loadBootstrap() error {
+	sch.bootstrapped = nil
+	if sch.bootstrap == nil {
+		return nil
+	}
+	err := decode(sch.backend.AllSettings(), sch.bootstrap, false, sch.decoderOptions()...)
+	if err != nil {
+		return fmt.Errorf("while unmarshalling bootstrap config: %w", sch.redactError(err, sch.backend.AllSettings()))
+	}
+	if sch.newProviders == nil {
+		return nil
+	}
+	if sch.bootstrapped, err = sch.newProviders(); err != nil {
+		return fmt.Errorf("while creating providers from bootstrap config: %w", err)
+	}
+	return nil
+}
+
+// withoutBootstrapKeys removes the keys of the bootstrap struct
+// from the settings, so they are not decoded into the result struct.
+// The nested maps left empty are removed as well.
+func (sch *SnakeCharmer) withoutBootstrapKeys(settings map[string]interface{}) map[string]interface{} {
+	for _, key := range sch.bootstrapKeys {
+		deleteSetting(settings, key)
+	}
+	return settings
+}
+
+// deleteSetting removes the dotted key from the nested settings map,
+// it returns true if the map is left empty.
+func deleteSetting(settings map[string]interface{}, key string) bool {
+	parent, name := settingsParent(settings, key)
+	if parent == nil {
+		return false
+	}
+	delete(parent, name)
+	if len(parent) > 0 || len(key) == len(name) {
+		return len(settings) == 0
+	}
+	// Remove the parent map if it is empty
+	return deleteSetting(settings, key[:len(key)-len(name)-1])
+}
@@ -0,0 +1,163 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+)
+
+// ByteSize is the size in bytes that is set from human-readable strings
+// like "512MiB", "2GB" or "1.5GiB" in flags, ENV vars and config files.
+// Decimal units (KB, MB, GB, TB, PB) are powers of 1000,
+// binary units (KiB, MiB, GiB, TiB, PiB) are powers of 1024,
+// units are case-insensitive and plain numbers are bytes.
+type ByteSize int64
+
+// Byte sizes
+const (
+	Byte ByteSize = 1
+
+	KB ByteSize = 1000 * Byte
+	MB ByteSize = 1000 * KB
+	GB ByteSize = 1000 * MB
+	TB ByteSize = 1000 * GB
+	PB ByteSize = 1000 * TB
+
+	KiB ByteSize = 1024 * Byte
+	MiB ByteSize = 1024 * KiB
+	GiB ByteSize = 1024 * MiB
+	TiB ByteSize = 1024 * GiB
+	PiB ByteSize = 1024 * TiB
+)
+
+var byteSizeType = reflect.TypeOf(ByteSize(0))
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KB,
+	"kb":  KB,
+	"m":   MB,
+	"mb":  MB,
+	"g":   GB,
+	"gb":  GB,
+	"t":   TB,
+	"tb":  TB,
+	"p":   PB,
+	"pb":  PB,
+	"kib": KiB,
+	"mib": MiB,
+	"gib": GiB,
+	"tib": TiB,
+	"pib": PiB,
+}
+
+// The units String uses, from the largest
+var byteSizeFormatUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"PiB", PiB}, {"PB", PB}, {"TiB", TiB}, {"TB", TB}, {"GiB", GiB},
+	{"GB", GB}, {"MiB", MiB}, {"MB", MB}, {"KiB", KiB}, {"KB", KB},
+}
+
+// ParseByteSize parses the human-readable size like "512MiB" or "2GB".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	number, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", s, s[i:])
+	}
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if n > math.MaxInt64/int64(multiplier) || n < math.MinInt64/int64(multiplier) {
+			return 0, fmt.Errorf("invalid byte size %q: out of range", s)
+		}
+		return ByteSize(n) * multiplier, nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	f *= float64(multiplier)
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("invalid byte size %q: out of range", s)
+	}
+	return ByteSize(f), nil
+}
+
+// String returns the size in the largest unit it is a multiple of,
+// e.g. "512MiB", "2GB" or "1000B".
+func (b ByteSize) String() string {
+	if b != 0 {
+		for _, u := range byteSizeFormatUnits {
+			if b%u.size == 0 {
+				return strconv.FormatInt(int64(b/u.size), 10) + u.name
+			}
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// Set implements pflag.Value.
+func (b *ByteSize) Set(s string) error {
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// Type implements pflag.Value.
+func (b *ByteSize) Type() string { return "byteSize" }
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) { return []byte(b.String()), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error { return b.Set(string(text)) }
+
+// applyByteSizeSetting adds the byte size flag
+// and sets the default viper config param.
+func (sch *SnakeCharmer) applyByteSizeSetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) {
+	value := ByteSize(rv.Int())
+	fs.Var(&value, name, help)
+	sch.backend.SetDefault(name, value.String())
+}
+
+// byteSizeHookFunc returns a mapstructure.DecodeHookFunc that converts
+// human-readable sizes into ByteSize. Numbers are decoded as bytes as is.
+func byteSizeHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != byteSizeType {
+			return data, nil
+		}
+		return ParseByteSize(reflect.ValueOf(data).String())
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseByteSize(t *testing.T) {
+	f := func(s string, want ByteSize) {
+		t.Helper()
+		got, err := ParseByteSize(s)
+		if err != nil {
+			t.Fatalf("unexpected error in ParseByteSize(%q): %s", s, err.Error())
+		}
+		require.Equal(t, want, got)
+	}
+	f("0", 0)
+	f("1024", KiB)
+	f("10B", 10)
+	f("512MiB", 512*MiB)
+	f("512 mib", 512*MiB)
+	f("2GB", 2*GB)
+	f("2g", 2*GB)
+	f("1.5GiB", 1536*MiB)
+	f("1TiB", TiB)
+
+	for _, s := range []string{"", "MiB", "12XB", "1.2.3KB", "9000000PiB"} {
+		_, err := ParseByteSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func Test_ByteSizeString(t *testing.T) {
+	require.Equal(t, "0B", ByteSize(0).String())
+	require.Equal(t, "1KB", ByteSize(1000).String())
+	require.Equal(t, "512MiB", (512 * MiB).String())
+	require.Equal(t, "2GB", (2 * GB).String())
+	require.Equal(t, "1001B", ByteSize(1001).String())
+}
+
+type testByteSizeStruct struct {
+	MaxBodySize   ByteSize  `snakecharmer:"max-body-size" env:"TEST_MAX_BODY_SIZE" usage:"Max request body size" default:"4MiB"`
+	MaxCacheSize  *ByteSize `snakecharmer:"max-cache-size" usage:"Max cache size" default:"1GB"`
+	MaxUploadSize ByteSize  `snakecharmer:"max-upload-size" usage:"Max upload size"`
+}
+
+func Test_ByteSizeFields(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("max-cache-size: 2GiB\nmax-upload-size: 1048576\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(args ...string) (*testByteSizeStruct, error) {
+		t.Helper()
+		result := &testByteSizeStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.Equal(t, "4MiB", cmd.PersistentFlags().Lookup("max-body-size").DefValue)
+		if err = cmd.ParseFlags(args); err != nil {
+			return nil, err
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, 4*MiB, result.MaxBodySize)
+	require.Equal(t, 2*GiB, *result.MaxCacheSize)
+	require.Equal(t, MiB, result.MaxUploadSize)
+
+	t.Setenv("TEST_MAX_BODY_SIZE", "10MB")
+	result, err = f("--max-upload-size", "1.5GiB")
+	require.NoError(t, err)
+	require.Equal(t, 10*MB, result.MaxBodySize)
+	require.Equal(t, 1536*MiB, result.MaxUploadSize)
+
+	_, err = f("--max-upload-size", "lots")
+	require.Error(t, err)
+
+	t.Setenv("TEST_MAX_BODY_SIZE", "10 furlongs")
+	_, err = f()
+	require.Error(t, err)
+}
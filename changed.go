@@ -0,0 +1,83 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"sort"
+	"strings"
+)
+
+// WasSet returns true if the value of the field is configured explicitly,
+// i.e. by the flag, ENV var, config file or any other source but the
+// defaults (see SourceKind). The key of the nested struct is set if
+// any of its fields is set. It returns false for the unknown keys.
+// It requires AddFlags to be called, otherwise the fields are unknown,
+// and the sources loaded by Unmarshal, e.g. providers, are known after it.
+// After the first run of Unmarshal it reports the keys as of its last run,
+// and it does not wait for the running one, so it may be called by
+// the subscribers and the validators, see Subscribe.
+func (sch *SnakeCharmer) WasSet(key string) bool {
+	key = strings.ToLower(key)
+	if v := sch.loadView(); v != nil {
+		for _, k := range v.changed {
+			if k == key || strings.HasPrefix(k, key+".") {
+				return true
+			}
+		}
+		return false
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	for _, b := range sch.bindings {
+		k := strings.ToLower(b.key)
+		if (k == key || strings.HasPrefix(k, key+".")) && sch.wasSet(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedKeys returns the sorted keys of the fields, which values
+// are configured explicitly (see WasSet).
+func (sch *SnakeCharmer) ChangedKeys() []string {
+	if v := sch.loadView(); v != nil {
+		return append([]string{}, v.changed...)
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	keys := []string{}
+	for _, b := range sch.bindings {
+		if sch.wasSet(b) {
+			keys = append(keys, strings.ToLower(b.key))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// wasSet returns true if the value of the field does not come
+// from the defaults. The slice of structs is set by its indexed flags as well.
+func (sch *SnakeCharmer) wasSet(b fieldBinding) bool {
+	if sch.sourceOf(b) != SourceDefault {
+		return true
+	}
+	key := strings.ToLower(b.key)
+	for _, f := range sch.indexedFlags {
+		if f.key == key && f.flag.Changed {
+			return true
+		}
+	}
+	return false
+}
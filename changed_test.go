@@ -0,0 +1,115 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WasSet(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("password: s3cr3t\nlog:\n  json: false\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_DUMP_LOG_LEVEL", "debug")
+
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--workers", "8"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	f := func(key string, expected bool) {
+		t.Helper()
+		require.Equal(t, expected, charmer.WasSet(key))
+	}
+	// The values equal to the defaults are set explicitly
+	f("workers", true)
+	f("log.json", true)
+	f("log.level", true)
+	f("LOG", true)
+	f("password", true)
+	f("unknown", false)
+	f("work", false)
+	require.Equal(t, []string{"log.json", "log.level", "password", "workers"}, charmer.ChangedKeys())
+
+	t.Setenv("TEST_DUMP_LOG_LEVEL", "")
+	os.Unsetenv("TEST_DUMP_LOG_LEVEL")
+	// The keys are known as of the last run of Unmarshal
+	f("log.level", true)
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	f("log.level", false)
+	require.Equal(t, []string{"log.json", "password", "workers"}, charmer.ChangedKeys())
+}
+
+func Test_WasSetInCallbacks(t *testing.T) {
+	cmd := &cobra.Command{}
+	var validated, notified []bool
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	err = charmer.Set(WithCrossFieldValidator(func(cfg interface{}) error {
+		validated = append(validated, charmer.WasSet("workers"))
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error in Set(): %s", err.Error())
+	}
+	charmer.Subscribe("changed", func() error {
+		notified = append(notified, charmer.WasSet("workers"))
+		require.Equal(t, []string{"workers"}, charmer.ChangedKeys())
+		return nil
+	})
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--workers", "8"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- charmer.UnmarshalExact() }()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("UnmarshalExact() deadlocked calling WasSet() from the callbacks")
+	}
+	require.Equal(t, []bool{true}, validated)
+	require.Equal(t, []bool{true}, notified)
+}
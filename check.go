@@ -0,0 +1,69 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+// addCheckConfigFlag registers the boolean flag (see WithCheckConfigFlag)
+// and wraps the PersistentPreRunE of the cobra command, so that when the flag
+// is set, the config is loaded and validated, the report is printed and
+// the process exits with 0 or 1 without running the command.
+// Note, cobra runs the PersistentPreRun of the nearest command only,
+// so subcommands defining their own PersistentPreRun skip the check.
+func (sch *SnakeCharmer) addCheckConfigFlag() {
+	sch.flags().Bool(sch.checkConfigFlag, false,
+		"Load and validate the config, print the report and exit")
+
+	preRunE := sch.cmd.PersistentPreRunE
+	preRun := sch.cmd.PersistentPreRun
+	sch.cmd.PersistentPreRun = nil
+	sch.cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if check, err := sch.flags().GetBool(sch.checkConfigFlag); err == nil && check {
+			err = sch.checkUnmarshal()
+			if err != nil {
+				sch.printCheckReport(cmd.ErrOrStderr(), err)
+				sch.exit(1)
+				return nil
+			}
+			sch.printCheckReport(cmd.OutOrStdout(), nil)
+			sch.exit(0)
+			return nil
+		}
+		if preRunE != nil {
+			return preRunE(cmd, args)
+		}
+		if preRun != nil {
+			preRun(cmd, args)
+		}
+		return nil
+	}
+}
+
+// printCheckReport prints the result of the config check.
+func (sch *SnakeCharmer) printCheckReport(w io.Writer, err error) {
+	for _, file := range sch.FilesUsed() {
+		fmt.Fprintf(w, "config file: %s\n", file)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "config is invalid: %s\n", err.Error())
+		return
+	}
+	fmt.Fprintln(w, "config is valid")
+}
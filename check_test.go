@@ -0,0 +1,76 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CheckConfigFlag(t *testing.T) {
+	f := func(configPath string, args ...string) (code int, out string, ran bool) {
+		t.Helper()
+		code = -1
+		cmd := &cobra.Command{
+			Use: "app",
+			Run: func(cmd *cobra.Command, args []string) { ran = true },
+		}
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(initTestStruct()),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithIgnoreUntaggedFields(true),
+			WithConfigFilePath(configPath),
+			WithCheckConfigFlag("check-config"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.exit = func(c int) { panic(c) }
+		charmer.AddFlags()
+		cmd.SetArgs(args)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					code = r.(int)
+				}
+			}()
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+			}
+		}()
+		return code, buf.String(), ran
+	}
+
+	code, out, ran := f("./test-config.json", "--check-config")
+	require.Equal(t, 0, code)
+	require.Equal(t, "config file: ./test-config.json\nconfig is valid\n", out)
+	require.False(t, ran)
+
+	code, out, ran = f("./no-such-config.json", "--check-config")
+	require.Equal(t, 1, code)
+	require.Contains(t, out, "config is invalid: ")
+	require.False(t, ran)
+
+	code, _, ran = f("./test-config.json")
+	require.Equal(t, -1, code)
+	require.True(t, ran)
+}
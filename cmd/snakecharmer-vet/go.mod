@@ -0,0 +1,15 @@
+module github.com/asokolov365/snakecharmer/cmd/snakecharmer-vet
+
+go 1.21
+
+require (
+	github.com/asokolov365/snakecharmer/analyzer v0.0.0
+	golang.org/x/tools v0.24.1
+)
+
+require (
+	golang.org/x/mod v0.20.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+)
+
+replace github.com/asokolov365/snakecharmer/analyzer => ../../analyzer
@@ -0,0 +1,26 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command snakecharmer-vet checks snakecharmer tagged structs.
+// It can be run standalone or with go vet:
+//
+//	go vet -vettool=$(which snakecharmer-vet) ./...
+package main
+
+import (
+	"github.com/asokolov365/snakecharmer/analyzer"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() { singlechecker.Main(analyzer.Analyzer) }
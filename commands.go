@@ -0,0 +1,193 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// AttachEnvCommand adds the "env" subcommand to the parent command.
+// The subcommand prints all supported ENV vars along with
+// the corresponding config key, type, default value,
+// and whether the ENV var is currently set.
+// With --format json it prints the BindingsDocument (see DumpBindings).
+// Note, it must be called after AddFlags.
+func (sch *SnakeCharmer) AttachEnvCommand(parent *cobra.Command) {
+	var format string
+	envCmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print supported environment variables",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch format {
+			case "text":
+				return sch.printEnv(cmd.OutOrStdout())
+			case "json":
+				return sch.DumpBindings(cmd.OutOrStdout())
+			default:
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+			}
+		},
+	}
+	envCmd.Flags().StringVar(&format, "format", "text", "Output format: text or json")
+	parent.AddCommand(envCmd)
+}
+
+func (sch *SnakeCharmer) printEnv(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENV\tKEY\tTYPE\tDEFAULT\tSET")
+	for _, b := range sch.bindings {
+		defaultValue := b.defaultValue
+		if b.secret {
+			defaultValue = redacted
+		}
+		for _, env := range b.envs {
+			_, set := sch.lookupEnv(env)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%v\t%t\n", env, b.key, b.typ.String(), defaultValue, set)
+		}
+	}
+	return tw.Flush()
+}
+
+// AttachConfigSubcommands adds the "config" subcommand to the parent command
+// with the following subcommands:
+//   - "config print" prints the effective config (see DumpEffectiveConfig),
+//   - "config validate" loads and validates the config,
+//     with --format json it prints the ValidationReport,
+//   - "config sample" prints the sample YAML config with default values
+//     and flag usage help as comments.
+//
+// Note, it must be called after AddFlags.
+func (sch *SnakeCharmer) AttachConfigSubcommands(parent *cobra.Command) {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+
+	var format string
+	var withSource bool
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := sch.UnmarshalExact(); err != nil {
+				return err
+			}
+			dumpFormat := format
+			if withSource {
+				dumpFormat += "+source"
+			}
+			return sch.DumpEffectiveConfig(cmd.OutOrStdout(), dumpFormat)
+		},
+	}
+	printCmd.Flags().StringVar(&format, "format", "yaml", "Output format: yaml or json")
+	printCmd.Flags().BoolVar(&withSource, "source", false, "Annotate every key with the source of its value")
+
+	var validateFormat string
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Load and validate the configuration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch validateFormat {
+			case "text", "json":
+			default:
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", validateFormat)
+			}
+			err := sch.checkUnmarshal()
+			if validateFormat == "json" {
+				// Keep the output machine-readable
+				cmd.SilenceUsage = true
+				if werr := writeJSON(cmd.OutOrStdout(), sch.validationReport(err)); werr != nil {
+					return werr
+				}
+				return err
+			}
+			if err != nil {
+				return err
+			}
+			sch.printCheckReport(cmd.OutOrStdout(), nil)
+			return nil
+		},
+	}
+	validateCmd.Flags().StringVar(&validateFormat, "format", "text", "Output format: text or json")
+
+	sampleCmd := &cobra.Command{
+		Use:   "sample",
+		Short: "Print the sample configuration with default values",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return sch.printSample(cmd.OutOrStdout())
+		},
+	}
+
+	configCmd.AddCommand(printCmd, validateCmd, sampleCmd)
+	parent.AddCommand(configCmd)
+}
+
+// printSample prints the sample YAML config with default values
+// and flag usage help as comments. Secret default values are omitted.
+func (sch *SnakeCharmer) printSample(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, b := range sch.bindings {
+		value := &yaml.Node{}
+		defaultValue := b.defaultValue
+		if b.secret {
+			defaultValue = reflect.Zero(b.typ).Interface()
+		}
+		if b.percent {
+			defaultValue = formatPercent(reflect.ValueOf(defaultValue).Float())
+		}
+		if isStructSlice(b.typ) || isStructMap(b.typ) {
+			defaultValue = sch.structSettings(defaultValue)
+		}
+		if err := value.Encode(defaultValue); err != nil {
+			return fmt.Errorf("while encoding default value of %q: %w", b.key, err)
+		}
+		path := strings.Split(b.key, ".")
+		parent := root
+		for _, name := range path[:len(path)-1] {
+			parent = sampleMapping(parent, name)
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[len(path)-1], HeadComment: b.help}
+		parent.Content = append(parent.Content, key, value)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// sampleMapping returns the nested mapping node by name, adding it if missing.
+func sampleMapping(parent *yaml.Node, name string) *yaml.Node {
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == name {
+			return parent.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, child)
+	return child
+}
@@ -0,0 +1,103 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AttachEnvCommand(t *testing.T) {
+	cmd := &cobra.Command{Use: "app"}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(initTestStruct()),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithIgnoreUntaggedFields(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	charmer.AttachEnvCommand(cmd)
+
+	t.Setenv("TEST_LOG_LEVEL", "debug")
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"env"})
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 8)
+	require.Equal(t, []string{"ENV", "KEY", "TYPE", "DEFAULT", "SET"}, strings.Fields(lines[0]))
+	require.Equal(t, []string{"TEST_MAX_BURST", "max-burst", "float64", "1.25", "false"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"TEST_LOG_LEVEL", "log.level", "string", "info", "true"}, strings.Fields(lines[4]))
+}
+
+func Test_AttachConfigSubcommands(t *testing.T) {
+	f := func(args ...string) (string, error) {
+		t.Helper()
+		cmd := &cobra.Command{Use: "app"}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testDumpStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		charmer.AttachConfigSubcommands(cmd)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs(args)
+		err = cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := f("config", "print", "--format", "json", "--workers", "4")
+	require.NoError(t, err)
+	require.Contains(t, out, `"workers": 4`)
+
+	out, err = f("config", "print", "--source", "--password", "s3cr3t")
+	require.NoError(t, err)
+	require.Contains(t, out, "password: '***' # source: flag\n")
+
+	out, err = f("config", "validate")
+	require.NoError(t, err)
+	require.Equal(t, "config is valid\n", out)
+
+	out, err = f("config", "sample")
+	require.NoError(t, err)
+	require.Equal(t, `# Number of workers to run
+workers: 8
+# Password
+password: ""
+log:
+  # Log level
+  level: info
+  # Log in JSON format
+  json: false
+`, out)
+}
@@ -0,0 +1,83 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+)
+
+// stdinConfigPath is the config file path meaning the config is read from stdin,
+// e.g. `--config -`.
+const stdinConfigPath = "-"
+
+// configDocument is the config document set with WithConfigBytes or WithConfigReader.
+type configDocument struct {
+	data   []byte
+	format string
+}
+
+// hasConfig returns true if any config document or config file is set.
+func (sch *SnakeCharmer) hasConfig() bool {
+	return len(sch.configDocs) > 0 || len(sch.configFiles()) > 0
+}
+
+// readStdinConfig reads the config document from stdin. It is read
+// only once, the reload pipeline reuses the document read before.
+func (sch *SnakeCharmer) readStdinConfig() (map[string]interface{}, error) {
+	if sch.stdinConfig == nil {
+		data, err := io.ReadAll(sch.stdin)
+		if err != nil {
+			return nil, fmt.Errorf("while reading config from stdin: %w", err)
+		}
+		sch.stdinConfig = data
+	}
+	return sch.readConfigBytes("stdin", sch.stdinConfig, sch.configFileType)
+}
+
+// readConfigBytes reads the config document of the given format into the settings map,
+// name is used in the error messages. The documents of multi-document YAML
+// are merged, see yamlDocumentsSettings.
+func (sch *SnakeCharmer) readConfigBytes(name string, data []byte, format string) (map[string]interface{}, error) {
+	if sch.limits.MaxFileSize > 0 && int64(len(data)) > sch.limits.MaxFileSize {
+		return nil, &LimitError{Limit: "MaxFileSize", Key: name, Value: int64(len(data)), Max: sch.limits.MaxFileSize}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		if sch.strictEmptyConfig {
+			return nil, fmt.Errorf("%w: %q", ErrEmptyConfig, name)
+		}
+		// Treat it as no config
+		return map[string]interface{}{}, nil
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("while reading config %q: %w", name, err)
+	}
+	settings := v.AllSettings()
+	if format == "yaml" || format == "yml" {
+		docSettings, ok, err := sch.yamlDocumentsSettings(name, data)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			settings = docSettings
+		}
+	}
+	return settings, nil
+}
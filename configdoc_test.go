@@ -0,0 +1,83 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ConfigBytes(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 16\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(opts ...CharmingOption) (*testMultiDocStruct, *SnakeCharmer) {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.NoError(t, charmer.UnmarshalExact())
+		return result, charmer
+	}
+
+	// The config file overrides the config documents merged in order
+	result, _ := f(
+		WithConfigBytes([]byte("workers: 4\nkind: base\nlog:\n  level: warn\n"), ""),
+		WithConfigReader(strings.NewReader(`{"kind": "override"}`), "json"),
+		WithConfigFilePath(config),
+	)
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "override", result.Kind)
+	require.Equal(t, "warn", result.Log.Level)
+
+	_, err := NewSnakeCharmer(WithConfigBytes([]byte("workers: 4"), "docx"))
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithConfigReader(nil, "yaml"))
+	require.Error(t, err)
+}
+
+func Test_StdinConfig(t *testing.T) {
+	result := &testMultiDocStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath("-"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.stdin = strings.NewReader("workers: 32\n")
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 32, result.Workers)
+
+	// The document read from stdin is reused
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, 32, result.Workers)
+}
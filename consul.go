@@ -0,0 +1,140 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// consulWaitTime is the max time of the Consul blocking query.
+const consulWaitTime = "5m"
+
+// consulTokenEnv is the ENV var holding the ACL token of Consul.
+const consulTokenEnv = "CONSUL_HTTP_TOKEN"
+
+// consulSource is the RemoteSource reading the config document
+// from the Consul KV store via the HTTP API. The ACL token is taken
+// from the CONSUL_HTTP_TOKEN ENV var, see consulToken.
+type consulSource struct {
+	client   *http.Client
+	endpoint string
+	key      string
+	// The function returning the ACL token, it is called on every request
+	token func() string
+
+	mu sync.Mutex
+	// The X-Consul-Index of the last read, used by the blocking queries
+	index uint64
+}
+
+// newConsulSource returns the Consul KV source of the key,
+// the endpoint is the Consul agent URL, e.g. "http://127.0.0.1:8500".
+func newConsulSource(client *http.Client, endpoint, key string, token func() string) *consulSource {
+	return &consulSource{
+		client:   client,
+		endpoint: endpoint,
+		key:      strings.TrimPrefix(key, "/"),
+		token:    token,
+	}
+}
+
+// consulToken returns the function looking up the ACL token of Consul
+// in the CONSUL_HTTP_TOKEN ENV var the same way the ENV vars of the fields
+// are looked up (see WithEnvLookup). There is no token if the ENV is
+// disabled with WithEnvDisabled.
+func (sch *SnakeCharmer) consulToken() func() string {
+	if sch.envDisabled {
+		return func() string { return "" }
+	}
+	lookup := sch.envLookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	return func() string {
+		token, _ := lookup(consulTokenEnv)
+		return token
+	}
+}
+
+// Read returns the raw value of the key.
+func (s *consulSource) Read(ctx context.Context) ([]byte, error) {
+	data, index, err := s.get(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.index = index
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Watch runs the blocking queries until the index of the key changes.
+func (s *consulSource) Watch(ctx context.Context) error {
+	s.mu.Lock()
+	last := s.index
+	s.mu.Unlock()
+	for {
+		query := url.Values{}
+		query.Set("index", strconv.FormatUint(last, 10))
+		query.Set("wait", consulWaitTime)
+		_, index, err := s.get(ctx, query)
+		if err != nil {
+			return err
+		}
+		// The index going backwards means the Consul state was reset
+		if index != last {
+			return nil
+		}
+	}
+}
+
+// get requests the raw value of the key, it returns the value
+// along with the X-Consul-Index header.
+func (s *consulSource) get(ctx context.Context, query url.Values) ([]byte, uint64, error) {
+	query.Set("raw", "")
+	u := fmt.Sprintf("%s/v1/kv/%s?%s", s.endpoint, s.key, query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if token := s.token(); len(token) > 0 {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, index, fmt.Errorf("consul key %q is not found", s.key)
+	case resp.StatusCode != http.StatusOK:
+		return nil, index, fmt.Errorf("consul responded with %q: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, index, nil
+}
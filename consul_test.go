@@ -0,0 +1,182 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testConsulServer emulates the Consul KV HTTP API for a single key.
+type testConsulServer struct {
+	mu      sync.Mutex
+	key     string
+	value   string
+	index   uint64
+	changed chan struct{}
+	// The ACL token of the last request
+	token string
+}
+
+func newTestConsulServer(t *testing.T, key, value string) (*testConsulServer, string) {
+	s := &testConsulServer{key: key, value: value, index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func (s *testConsulServer) set(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value = value
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *testConsulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.token = r.Header.Get("X-Consul-Token")
+	s.mu.Unlock()
+	if r.URL.Path != "/v1/kv/"+s.key {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	index, changed := s.index, s.changed
+	s.mu.Unlock()
+	if wait := r.URL.Query().Get("index"); wait == strconv.FormatUint(index, 10) {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(s.index, 10))
+	_, _ = w.Write([]byte(s.value))
+}
+
+func Test_ConsulRemoteConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 8\nbind-addr: 127.0.0.1\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	consul, endpoint := newTestConsulServer(t, "app/config.json", `{"workers": 32, "log": {"level": "warn"}}`)
+
+	result := &testMultiDocStruct{}
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+		WithRemoteConfig("consul", endpoint, "app/config.json"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	defer charmer.Close()
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--log.level", "debug"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 32, result.Workers)
+	require.Equal(t, "127.0.0.1", result.BindAddr)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, []SourceKind{SourceFlag, SourceEnv, SourceRemote, SourceConfigFile, SourceDefault}, charmer.PrecedenceOrder())
+
+	reloaded := make(chan error, 1)
+	require.NoError(t, charmer.WatchRemoteConfig(context.Background(), func(err error) {
+		reloaded <- err
+	}))
+	consul.set(`{"workers": 64}`)
+	select {
+	case err = <-reloaded:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("remote config is not reloaded")
+	}
+	require.Equal(t, 64, result.Workers)
+	require.Equal(t, "127.0.0.1", result.BindAddr)
+
+	// Close stops watching
+	require.NoError(t, charmer.Close())
+}
+
+func Test_ConsulToken(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_TOKEN", "process")
+	f := func(opts ...CharmingOption) string {
+		t.Helper()
+		consul, endpoint := newTestConsulServer(t, "app/config.json", `{"workers": 32}`)
+		opts = append([]CharmingOption{
+			WithResultStruct(&testMultiDocStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFileRequired(false),
+			WithRemoteConfig("consul", endpoint, "app/config.json"),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		defer charmer.Close()
+		charmer.AddFlags()
+		require.NoError(t, charmer.UnmarshalExact())
+		consul.mu.Lock()
+		defer consul.mu.Unlock()
+		return consul.token
+	}
+	require.Equal(t, "process", f())
+	require.Equal(t, "lookup", f(WithEnvLookup(func(key string) (string, bool) {
+		return map[string]string{"CONSUL_HTTP_TOKEN": "lookup"}[key], key == "CONSUL_HTTP_TOKEN"
+	})))
+	require.Empty(t, f(WithEnvDisabled(true)))
+}
+
+func Test_RemoteConfigErrors(t *testing.T) {
+	f := func(opts ...CharmingOption) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(&testMultiDocStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)...)
+		if err != nil {
+			return
+		}
+		charmer.AddFlags()
+		require.Error(t, charmer.UnmarshalExact())
+	}
+
+	_, endpoint := newTestConsulServer(t, "app/config.yaml", "workers: [")
+	f(WithRemoteConfig("zookeeper", endpoint, "app/config.yaml"))
+	f(WithRemoteConfig("consul", "", "app/config.yaml"))
+	f(WithRemoteConfig("consul", endpoint, "app/missing.yaml"))
+	f(WithRemoteConfig("consul", endpoint, "app/config.yaml"))
+	f(WithRemoteSource(nil))
+}
@@ -0,0 +1,63 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// UnmarshalExactContext is UnmarshalExact bounded by the context:
+// the config URL and remote config reads, the value resolvers
+// (e.g. the exec resolver) and the providers implementing ContextProvider
+// get ctx, and the unmarshal pipeline stops between its stages
+// once ctx is done, so the startup can be bounded by a deadline
+// and cancelled cleanly. The error wraps ctx.Err() then.
+// The result struct is not updated if the pipeline is cancelled.
+func (sch *SnakeCharmer) UnmarshalExactContext(ctx context.Context) error {
+	if ctx == nil {
+		return fmt.Errorf("context is nil")
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	sch.runCtx = ctx
+	defer func() { sch.runCtx = nil }()
+	err := sch.unmarshalExact(false)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		// The error of the read cancelled by ctx, e.g. of the remote config
+		err = fmt.Errorf("while unmarshalling config: %w: %w", ctx.Err(), err)
+	}
+	return err
+}
+
+// runContext returns the context of the running unmarshal pipeline,
+// i.e. the one given to UnmarshalExactContext, or the context
+// the background goroutines are tied to (see WithContext).
+func (sch *SnakeCharmer) runContext() context.Context {
+	if sch.runCtx != nil {
+		return sch.runCtx
+	}
+	return sch.ctx
+}
+
+// checkContext returns the error if the context
+// of the running unmarshal pipeline is done.
+func (sch *SnakeCharmer) checkContext() error {
+	if err := sch.runContext().Err(); err != nil {
+		return fmt.Errorf("while unmarshalling config: %w", err)
+	}
+	return nil
+}
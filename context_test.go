@@ -0,0 +1,83 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testContextProvider blocks until ctx is done if block is true
+type testContextProvider struct {
+	testProvider
+	block bool
+}
+
+func (p *testContextProvider) LoadContext(ctx context.Context) ([]ProvidedValue, error) {
+	if p.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return p.Load()
+}
+
+func Test_UnmarshalExactContext(t *testing.T) {
+	f := func(ctx context.Context, provider Provider) (*testSecretStruct, error) {
+		t.Helper()
+		result := &testSecretStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithProvider(provider),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExactContext(ctx)
+	}
+	values := []ProvidedValue{{Key: "db.password", Value: "s3cr3t"}}
+
+	result, err := f(context.Background(), &testContextProvider{testProvider: testProvider{values: values}})
+	require.NoError(t, err)
+	require.Equal(t, "admin", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// The plain provider is loaded as well
+	result, err = f(context.Background(), &testProvider{values: values})
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = f(ctx, &testProvider{values: values})
+	require.True(t, errors.Is(err, context.Canceled), err)
+	require.Empty(t, result.DB.User)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err = f(ctx, &testContextProvider{testProvider: testProvider{values: values}, block: true})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	require.Empty(t, result.DB.Password)
+
+	_, err = f(nil, &testProvider{values: values})
+	require.Error(t, err)
+}
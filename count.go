@@ -0,0 +1,37 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/spf13/pflag"
+)
+
+// applyCountSetting adds the count flag (see pflag.CountP), e.g. -v -v -v,
+// for the integer field with the count modifier
+// and sets the default viper config param.
+// Note, the flag counts from 0 regardless of the default value.
+func (sch *SnakeCharmer) applyCountSetting(fs *pflag.FlagSet, rv reflect.Value, name, shorthand, help string) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	default:
+		return fmt.Errorf("BUG: count modifier is set for non-int flag %q (%s)", name, rv.Type())
+	}
+	fs.CountP(name, shorthand, help)
+	sch.backend.SetDefault(name, rv.Int())
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testCountStruct struct {
+	Verbosity *int `snakecharmer:"verbose,count" short:"v" env:"TEST_VERBOSE" usage:"Verbosity level"`
+	Quiet     int  `snakecharmer:"quiet,count" usage:"Quietness level" default:"1"`
+}
+
+func Test_CountFlags(t *testing.T) {
+	f := func(args ...string) *testCountStruct {
+		t.Helper()
+		result := &testCountStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	result := f()
+	require.Equal(t, 0, *result.Verbosity)
+	require.Equal(t, 1, result.Quiet)
+
+	result = f("-v", "-v", "-v", "--quiet", "--quiet")
+	require.Equal(t, 3, *result.Verbosity)
+	require.Equal(t, 2, result.Quiet)
+
+	require.Equal(t, 2, *f("-vv").Verbosity)
+	require.Equal(t, 4, *f("--verbose=4").Verbosity)
+
+	t.Setenv("TEST_VERBOSE", "2")
+	require.Equal(t, 2, *f().Verbosity)
+	require.Equal(t, 1, *f("-v").Verbosity)
+}
@@ -0,0 +1,131 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseDefaultValue parses the value of the default tag
+// into a new value of the given type.
+// Slices are expected as sep separated values, e.g. "80,443",
+// maps are expected as comma separated key=value pairs, e.g. "a=1,b=2".
+func parseDefaultValue(t reflect.Type, s, sep string) (reflect.Value, error) {
+	rv := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Bool:
+		value, err := strconv.ParseBool(s)
+		if err != nil {
+			return rv, err
+		}
+		rv.SetBool(value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return rv, err
+		}
+		rv.SetUint(value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return rv, err
+		}
+		rv.SetInt(value)
+
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return rv, err
+		}
+		rv.SetFloat(value)
+
+	case reflect.String:
+		rv.SetString(s)
+
+	case reflect.Slice:
+		if len(s) == 0 {
+			return reflect.MakeSlice(t, 0, 0), nil
+		}
+		parts := []string{s}
+		if len(sep) > 0 {
+			parts = strings.Split(s, sep)
+		}
+		rv = reflect.MakeSlice(t, 0, len(parts))
+		for _, part := range parts {
+			elem, err := parseDefaultValue(t.Elem(), strings.TrimSpace(part), sep)
+			if err != nil {
+				return rv, err
+			}
+			rv = reflect.Append(rv, elem)
+		}
+
+	case reflect.Map:
+		rv = reflect.MakeMap(t)
+		if len(s) == 0 {
+			return rv, nil
+		}
+		for _, pair := range strings.Split(s, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return rv, fmt.Errorf("%q must be formatted as key=value", pair)
+			}
+			key, err := parseDefaultValue(t.Key(), strings.TrimSpace(kv[0]), sep)
+			if err != nil {
+				return rv, err
+			}
+			elem, err := parseDefaultValue(t.Elem(), strings.TrimSpace(kv[1]), sep)
+			if err != nil {
+				return rv, err
+			}
+			rv.SetMapIndex(key, elem)
+		}
+
+	default:
+		return rv, fmt.Errorf("unsupported type: %q", t.Kind().String())
+	}
+	return rv, nil
+}
+
+// setDefaultValues sets the default values of WithDefaults,
+// they take precedence over the defaults of the fields.
+func (sch *SnakeCharmer) setDefaultValues() {
+	for _, d := range sch.defaultValues {
+		sch.backend.SetDefault(d.key, d.value)
+	}
+}
+
+// withoutDefaultOnlyKeys removes the keys set with WithDefaults,
+// which have no fields in the result struct, from the settings,
+// so they are not decoded into the result struct and are not unknown.
+func (sch *SnakeCharmer) withoutDefaultOnlyKeys(settings map[string]interface{}) map[string]interface{} {
+	if len(sch.defaultValues) == 0 {
+		return settings
+	}
+	unknown := map[string]bool{}
+	for _, k := range sch.unknownKeys(settings) {
+		unknown[k.Key] = true
+	}
+	for _, d := range sch.defaultValues {
+		if unknown[d.key] {
+			deleteSetting(settings, d.key)
+		}
+	}
+	return settings
+}
@@ -0,0 +1,59 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithDefaults(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("code: abc\nlabels:\n  team: core\nfeature:\n  beta: true\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testOverridesStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+		WithDefaults(map[string]interface{}{
+			"workers": 2,
+			"log":     map[string]interface{}{"level": "warn"},
+			"labels":  map[string]interface{}{"zone": "eu"},
+			// The forward-compatible keys without fields
+			"feature.beta":  false,
+			"feature.alpha": false,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+	require.Equal(t, []string{"localhost"}, result.Hosts)
+	require.Equal(t, map[string]string{"team": "core", "zone": "eu"}, result.Labels)
+	require.Equal(t, map[string]interface{}{"alpha": false, "beta": true}, charmer.RedactedSettings()["feature"])
+
+	_, err = NewSnakeCharmer(WithDefaults(map[string]interface{}{"": 1}))
+	require.ErrorContains(t, err, `invalid default key ""`)
+}
@@ -0,0 +1,111 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mergeInDotEnv loads the values of the ENV vars from the dotenv file
+// (see WithDotEnvFile) and merges them in above the config file.
+// The ENV vars set in the real environment take precedence,
+// so such values are skipped. A missing dotenv file is ignored.
+func (sch *SnakeCharmer) mergeInDotEnv() error {
+	vars, err := readDotEnvFile(sch.dotEnvFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("while reading dotenv file %q: %w", sch.dotEnvFile, err)
+	}
+	sch.filesUsed = append(sch.filesUsed, sch.dotEnvFile)
+	for _, b := range sch.bindings {
+		if sch.envSet(b.envs) {
+			continue
+		}
+		for _, env := range b.envs {
+			value, ok := vars[env]
+			if !ok {
+				continue
+			}
+			if err = sch.backend.MergeConfigMap(nestedMap(b.key, value)); err != nil {
+				return err
+			}
+			sch.setLayerSource(b.key, value, SourceDotEnv)
+			break
+		}
+	}
+	return nil
+}
+
+// readDotEnvFile reads KEY=VALUE pairs from the dotenv file.
+func readDotEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDotEnv(f)
+}
+
+// parseDotEnv parses KEY=VALUE pairs, one per line.
+// Empty lines and lines starting with # are skipped, the "export " prefix
+// is allowed. Values can be single-quoted (taken literally),
+// double-quoted (escape sequences are interpreted) or unquoted,
+// in which case the trailing " #comment" is stripped.
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("invalid line %d: %q", lineNum, line)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value at line %d: %w", lineNum, err)
+			}
+			value = unquoted
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseDotEnv(t *testing.T) {
+	vars, err := parseDotEnv(strings.NewReader(`
+# comment
+WORKERS=4
+export LOG_LEVEL = debug # inline comment
+SINGLE='a # b'
+DOUBLE="line1\nline2"
+EMPTY=
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"WORKERS":   "4",
+		"LOG_LEVEL": "debug",
+		"SINGLE":    "a # b",
+		"DOUBLE":    "line1\nline2",
+		"EMPTY":     "",
+	}, vars)
+
+	_, err = parseDotEnv(strings.NewReader("WORKERS"))
+	require.Error(t, err)
+}
+
+func Test_WithDotEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	dotEnv := filepath.Join(dir, ".env")
+	if err := os.WriteFile(dotEnv, []byte("WORKERS=4\nLOG_LEVEL=debug\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	config := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 2\nlog:\n  level: warn\n  limit:\n    warn: 5\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(path string) (*testEnvStruct, *SnakeCharmer) {
+		t.Helper()
+		result := &testEnvStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(config),
+			WithDerivedEnvNames(true),
+			WithDotEnvFile(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result, charmer
+	}
+
+	// The dotenv file takes precedence over the config file
+	result, charmer := f(dotEnv)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, uint(5), result.Log.Limit.Warn)
+	require.Equal(t, []string{config, dotEnv}, charmer.FilesUsed())
+
+	// The real environment takes precedence over the dotenv file
+	t.Setenv("LOG_LEVEL", "error")
+	result, _ = f(dotEnv)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "error", result.Log.Level)
+
+	// A missing dotenv file is ignored
+	result, charmer = f(filepath.Join(dir, "missing.env"))
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, []string{config}, charmer.FilesUsed())
+}
+
+func Test_WithDotEnvFileReload(t *testing.T) {
+	dotEnv := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnv, []byte("WORKERS=4\nLOG_LEVEL=debug\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testEnvStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithDerivedEnvNames(true),
+		WithDotEnvFile(dotEnv),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+
+	// The values removed from the dotenv file are not kept by the reload
+	if err = os.WriteFile(dotEnv, []byte("WORKERS=4\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+}
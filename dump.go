@@ -0,0 +1,193 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DumpEffectiveConfig writes the effective configuration, i.e. the values
+// of the result struct fields decoded by the last UnmarshalExact (or merged from
+// flags, ENV vars, config files and defaults if it was not called yet),
+// in the given format: "yaml" or "json". The values are written as they are
+// set in config files, e.g. "1m0s" of time.Duration, the values of secret
+// fields are redacted.
+// The "yaml+source" and "json+source" formats annotate every key with
+// its source (see SourceKind): flag, env, dotenv, provider, config file or default.
+// YAML keys are annotated with line comments, JSON is written as
+// the ProvenanceDocument, i.e. {"schemaVersion": 1, "kind": "provenance",
+// "config": {...}, "sources": {"log.level": "env", ...}}.
+func (sch *SnakeCharmer) DumpEffectiveConfig(w io.Writer, format string) error {
+	var settings map[string]interface{}
+	var sources map[string]string
+	if v := sch.loadView(); v != nil {
+		settings, sources = normalizeValue(v.effective).(map[string]interface{}), v.sources
+	} else {
+		sch.mu.Lock()
+		settings, sources = sch.redactSettings(sch.effectiveSettings(true)), sch.sources()
+		sch.mu.Unlock()
+	}
+
+	format, withSource := strings.CutSuffix(strings.ToLower(strings.TrimSpace(format)), "+source")
+	switch format {
+	case "yaml", "yml":
+		var node yaml.Node
+		if err := node.Encode(settings); err != nil {
+			return err
+		}
+		if withSource {
+			annotateSources(&node, "", sources)
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+
+	case "json":
+		var doc interface{} = settings
+		if withSource {
+			doc = ProvenanceDocument{
+				SchemaVersion: SchemaVersion,
+				Kind:          KindProvenance,
+				Config:        settings,
+				Sources:       sources,
+			}
+		}
+		return writeJSON(w, doc)
+
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of: yaml, json, yaml+source, json+source", format)
+	}
+}
+
+// effectiveSettings returns the values of the fields of the result struct
+// and the tenant structs by their config keys, as they are set in config files
+// (see configValue), or the merged settings if UnmarshalExact was not called yet.
+// The fields that cannot be set in config, e.g. `config:"-"`, are skipped
+// unless noConfig is true.
+func (sch *SnakeCharmer) effectiveSettings(noConfig bool) map[string]interface{} {
+	if sch.settings == nil {
+		return sch.backend.AllSettings()
+	}
+	return sch.fieldSettings(noConfig)
+}
+
+// fieldSettings returns the values of the fields of the result struct
+// and the tenant structs, see effectiveSettings.
+func (sch *SnakeCharmer) fieldSettings(noConfig bool) map[string]interface{} {
+	values := map[string]reflect.Value{}
+	sch.addFieldValues(values, reflect.ValueOf(sch.resultStruct), "")
+	for _, g := range sch.tenantGroups {
+		for _, name := range g.names {
+			sch.addFieldValues(values, g.result.MapIndex(reflect.ValueOf(name)), joinKey(g.prefix, name))
+		}
+	}
+	settings := map[string]interface{}{}
+	for _, b := range sch.bindings {
+		if b.noConfig && !noConfig {
+			continue
+		}
+		key := strings.ToLower(b.key)
+		fieldValue, ok := values[key]
+		if !ok {
+			// e.g. the field of the bootstrap struct
+			continue
+		}
+		var value interface{}
+		if isStructSlice(b.typ) || isStructMap(b.typ) {
+			value = sch.structSettings(fieldValue.Interface())
+		} else if fieldValue = reflect.Indirect(fieldValue); fieldValue.IsValid() {
+			value = configValue(fieldValue.Interface())
+		}
+		if value != nil {
+			setSetting(settings, key, value)
+		}
+	}
+	return settings
+}
+
+// addFieldValues adds the values of the fields of the struct nested
+// under the prefix by their lower-cased config keys, the fields
+// of the nested structs are added instead of them, like addFlags does.
+func (sch *SnakeCharmer) addFieldValues(values map[string]reflect.Value, v reflect.Value, prefix string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for _, fp := range sch.structPlan(v.Type()) {
+		if fp.skip || len(fp.invalid) > 0 {
+			continue
+		}
+		fieldValue := v.Field(fp.index)
+		if !fieldValue.CanInterface() {
+			// e.g. the fields of the unexported embedded struct
+			continue
+		}
+		key := fp.keyAt(prefix)
+		elem := fieldValue
+		for (elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface) && !elem.IsNil() {
+			elem = elem.Elem()
+		}
+		if t := elem.Type(); t.Kind() == reflect.Struct && !isTextStruct(t) && !isNetType(t) && !isFlagValue(t) {
+			sch.addFieldValues(values, elem, key)
+			continue
+		}
+		values[strings.ToLower(key)] = fieldValue
+	}
+}
+
+// sources returns the sources of the values of all the fields by config key.
+func (sch *SnakeCharmer) sources() map[string]string {
+	result := make(map[string]string, len(sch.bindings))
+	for _, b := range sch.bindings {
+		result[strings.ToLower(b.key)] = sch.sourceOf(b).String()
+	}
+	return result
+}
+
+// annotateSources adds the line comments with the value sources
+// to the keys of the YAML mapping node.
+func annotateSources(node *yaml.Node, prefix string, sources map[string]string) {
+	if node.Kind == yaml.DocumentNode {
+		for _, n := range node.Content {
+			annotateSources(n, prefix, sources)
+		}
+		return
+	}
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := joinKey(prefix, keyNode.Value)
+		if source, ok := sources[key]; ok {
+			keyNode.LineComment = "source: " + source
+			continue
+		}
+		annotateSources(valueNode, key, sources)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testDumpStruct struct {
+	Workers  int    `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Password string `snakecharmer:"password,secret" usage:"Password"`
+	Log      struct {
+		Level string `snakecharmer:"level" env:"TEST_DUMP_LOG_LEVEL" usage:"Log level" default:"info"`
+		JSON  bool   `snakecharmer:"json" usage:"Log in JSON format"`
+	} `snakecharmer:"log"`
+}
+
+func Test_DumpEffectiveConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("password: s3cr3t\nlog:\n  json: true\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_DUMP_LOG_LEVEL", "debug")
+
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--workers", "16"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	f := func(format, expected string) {
+		t.Helper()
+		var out bytes.Buffer
+		require.NoError(t, charmer.DumpEffectiveConfig(&out, format))
+		require.Equal(t, expected, out.String())
+	}
+
+	f("yaml", `log:
+  json: true
+  level: debug
+password: '***'
+workers: 16
+`)
+	f("yaml+source", `log:
+  json: true # source: config file
+  level: debug # source: env
+password: '***' # source: config file
+workers: 16 # source: flag
+`)
+	f("json", `{
+  "log": {
+    "json": true,
+    "level": "debug"
+  },
+  "password": "***",
+  "workers": 16
+}
+`)
+	f("json+source", `{
+  "schemaVersion": 1,
+  "kind": "provenance",
+  "config": {
+    "log": {
+      "json": true,
+      "level": "debug"
+    },
+    "password": "***",
+    "workers": 16
+  },
+  "sources": {
+    "log.json": "config file",
+    "log.level": "env",
+    "password": "config file",
+    "workers": "flag"
+  }
+}
+`)
+	require.Error(t, charmer.DumpEffectiveConfig(&bytes.Buffer{}, "toml"))
+}
+
+type testDumpTypedStruct struct {
+	Flags   []bool             `snakecharmer:"flags" usage:"Flags"`
+	Ints    []int              `snakecharmer:"ints" env:"TEST_DUMP_INTS" usage:"Ints"`
+	Floats  []float32          `snakecharmer:"floats" env:"TEST_DUMP_FLOATS" usage:"Floats"`
+	Enabled map[string]bool    `snakecharmer:"enabled" env:"TEST_DUMP_ENABLED" usage:"Enabled"`
+	Limits  map[string]int     `snakecharmer:"limits" usage:"Limits"`
+	Labels  map[string]string  `snakecharmer:"labels" env:"TEST_DUMP_LABELS" usage:"Labels"`
+	Weights map[string]float64 `snakecharmer:"weights" env:"TEST_DUMP_WEIGHTS" usage:"Weights"`
+}
+
+func Test_DumpEffectiveConfig_Typed(t *testing.T) {
+	t.Setenv("TEST_DUMP_INTS", "1,2,3")
+	t.Setenv("TEST_DUMP_FLOATS", "1.5,2.5")
+	t.Setenv("TEST_DUMP_ENABLED", "a=true,b=false")
+	t.Setenv("TEST_DUMP_LABELS", "env=prod")
+	t.Setenv("TEST_DUMP_WEIGHTS", "x=0.5")
+
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpTypedStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--flags", "true,false", "--limits", "a=1,b=2"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&out, "yaml"))
+	require.Equal(t, `enabled:
+  a: true
+  b: false
+flags:
+  - true
+  - false
+floats:
+  - 1.5
+  - 2.5
+ints:
+  - 1
+  - 2
+  - 3
+labels:
+  env: prod
+limits:
+  a: 1
+  b: 2
+weights:
+  x: 0.5
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, charmer.DumpEffectiveConfig(&out, "json"))
+	require.JSONEq(t, `{
+  "enabled": {"a": true, "b": false},
+  "flags": [true, false],
+  "floats": [1.5, 2.5],
+  "ints": [1, 2, 3],
+  "labels": {"env": "prod"},
+  "limits": {"a": 1, "b": 2},
+  "weights": {"x": 0.5}
+}`, out.String())
+}
@@ -0,0 +1,90 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// parseOneOf splits the allowed values of the oneof tag, e.g. "debug,info,warn".
+func parseOneOf(tag string) []string {
+	if len(strings.TrimSpace(tag)) == 0 {
+		return nil
+	}
+	values := strings.Split(tag, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
+// oneOfUsage appends the allowed values to the flag usage help.
+func oneOfUsage(help string, values []string) string {
+	if len(values) == 0 {
+		return help
+	}
+	return fmt.Sprintf("%s (one of: %s)", help, strings.Join(values, ", "))
+}
+
+// registerOneOfCompletion makes shells complete the allowed values of the flag.
+func (sch *SnakeCharmer) registerOneOfCompletion(cmd *cobra.Command, name string, values []string) error {
+	return cmd.RegisterFlagCompletionFunc(name,
+		func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return values, cobra.ShellCompDirectiveNoFileComp
+		})
+}
+
+// checkOneOf verifies that the values of the fields with the oneof tag
+// are among the allowed ones. The empty value is allowed,
+// use the "required" tag option to reject it.
+// It returns FieldError per invalid value.
+func (sch *SnakeCharmer) checkOneOf(settings map[string]interface{}) []error {
+	errs := []error{}
+	for _, b := range sch.bindings {
+		if len(b.oneOf) == 0 {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		value, ok := parent[name]
+		if !ok || value == nil {
+			continue
+		}
+		s := fmt.Sprint(value)
+		if len(s) == 0 || isOneOf(s, b.oneOf) {
+			continue
+		}
+		if b.secret {
+			s = redacted
+		}
+		errs = append(errs, sch.newFieldError(b.key,
+			fmt.Errorf("invalid value %q of %q: must be one of %s", s, b.key, strings.Join(b.oneOf, ", "))))
+	}
+	return errs
+}
+
+func isOneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnumStruct struct {
+	Level  string `snakecharmer:"level" env:"TEST_ENUM_LEVEL" usage:"Log level" oneof:"debug,info,warn,error" default:"info"`
+	Format string `snakecharmer:"format" usage:"Output format" oneof:"json, text"`
+	Shards int    `snakecharmer:"shards" usage:"Number of shards" oneof:"1,2,4,8" default:"1"`
+}
+
+func Test_OneOf(t *testing.T) {
+	f := func(args ...string) (*testEnumStruct, *cobra.Command, error) {
+		t.Helper()
+		result := &testEnumStruct{}
+		cmd := &cobra.Command{Use: "test", Run: func(cmd *cobra.Command, args []string) {}}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	result, cmd, err := f()
+	require.NoError(t, err)
+	require.Equal(t, "info", result.Level)
+	require.Equal(t, "", result.Format)
+	require.Equal(t, "Log level (one of: debug, info, warn, error) (env: TEST_ENUM_LEVEL, config: level)", cmd.PersistentFlags().Lookup("level").Usage)
+
+	completion, ok := cmd.GetFlagCompletionFunc("level")
+	require.True(t, ok)
+	values, directive := completion(cmd, nil, "")
+	require.Equal(t, []string{"debug", "info", "warn", "error"}, values)
+	require.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	result, _, err = f("--format", "text", "--shards", "4")
+	require.NoError(t, err)
+	require.Equal(t, "text", result.Format)
+	require.Equal(t, 4, result.Shards)
+
+	_, _, err = f("--shards", "3")
+	require.EqualError(t, err, `invalid value "3" of "shards": must be one of 1, 2, 4, 8`)
+
+	t.Setenv("TEST_ENUM_LEVEL", "verbose")
+	_, _, err = f()
+	require.EqualError(t, err, `invalid value "verbose" of "level": must be one of debug, info, warn, error`)
+}
@@ -0,0 +1,157 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEnvKeyReplacer is used for deriving ENV var names from config keys,
+// e.g. "log.limit.warn" -> "LOG_LIMIT_WARN", unless WithAutomaticEnv sets another one.
+var defaultEnvKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// envNames returns the ENV var names the field is bound to in the lookup order.
+// The name is taken from the env tag and, if WithAutomaticEnv is enabled,
+// derived from the config key. If WithDerivedEnvNames is enabled,
+// the name is derived only for the fields without env tag.
+// The env prefix (if set) is prepended.
+// It returns nil if the field is not bound to an ENV var
+// or the ENV binding is disabled with WithEnvDisabled.
+func (sch *SnakeCharmer) envNames(env, key string) []string {
+	if sch.envDisabled {
+		return nil
+	}
+	names := []string{}
+	if len(env) > 0 {
+		names = append(names, sch.prefixEnv(env))
+	}
+	if sch.automaticEnv || (sch.derivedEnvNames && len(env) == 0) {
+		derived := sch.prefixEnv(sch.deriveEnv(key))
+		if len(names) == 0 || names[0] != derived {
+			names = append(names, derived)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// deriveEnv derives the ENV var name from the config key.
+func (sch *SnakeCharmer) deriveEnv(key string) string {
+	replacer := sch.envKeyReplacer
+	if replacer == nil {
+		replacer = defaultEnvKeyReplacer
+	}
+	return strings.ToUpper(replacer.Replace(key))
+}
+
+// prefixEnv prepends the env prefix (if set) to the ENV var name.
+func (sch *SnakeCharmer) prefixEnv(env string) string {
+	if len(sch.envPrefix) == 0 {
+		return env
+	}
+	return strings.TrimSuffix(sch.envPrefix, "_") + "_" + env
+}
+
+// lookupEnv looks up the ENV var with the function set by WithEnvLookup,
+// or in the process environment.
+func (sch *SnakeCharmer) lookupEnv(env string) (string, bool) {
+	if sch.envLookup != nil {
+		return sch.envLookup(env)
+	}
+	return os.LookupEnv(env)
+}
+
+// envSet returns true if any of the ENV vars is set.
+func (sch *SnakeCharmer) envSet(envs []string) bool {
+	for _, env := range envs {
+		if _, ok := sch.lookupEnv(env); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeInLookupEnvs merges the values of the ENV vars looked up with
+// the function set by WithEnvLookup in above the config file, since they
+// are not bound to viper. The flags take precedence over them.
+// With WithPrecedence, the ENV vars are applied by applyPrecedence instead.
+func (sch *SnakeCharmer) mergeInLookupEnvs() error {
+	if sch.envLookup == nil || sch.precedence != nil {
+		return nil
+	}
+	for _, b := range sch.bindings {
+		for _, env := range b.envs {
+			value, ok := sch.envLookup(env)
+			if !ok {
+				continue
+			}
+			if err := sch.backend.MergeConfigMap(nestedMap(b.key, value)); err != nil {
+				return fmt.Errorf("while merging ENV var %s: %w", env, err)
+			}
+			sch.setLayerSource(b.key, value, SourceEnv)
+			break
+		}
+	}
+	return nil
+}
+
+// structEnv binds the nested struct, or the slice of structs,
+// to the ENV var holding the whole struct (slice) as JSON or YAML.
+type structEnv struct {
+	// The config key of the nested struct
+	key string
+	// The ENV var name
+	env string
+	// The format of the ENV var value, "json" or "yaml"
+	format string
+}
+
+// mergeInStructEnvs parses the ENV vars holding the whole nested structs
+// and merges them in above the config file. The ENV vars and flags
+// of the struct fields take precedence over them.
+func (sch *SnakeCharmer) mergeInStructEnvs() error {
+	for _, se := range sch.structEnvs {
+		value, ok := sch.lookupEnv(se.env)
+		if !ok || len(strings.TrimSpace(value)) == 0 {
+			continue
+		}
+		// The nested struct is a map, the slice of structs is a list of them
+		var settings interface{}
+		var err error
+		switch se.format {
+		case "json":
+			err = json.Unmarshal([]byte(value), &settings)
+		case "", "yaml", "yml":
+			err = yaml.Unmarshal([]byte(value), &settings)
+		default:
+			err = fmt.Errorf("unsupported format %q", se.format)
+		}
+		if err != nil {
+			return fmt.Errorf("while parsing ENV var %s: %w", se.env, err)
+		}
+		if err = sch.backend.MergeConfigMap(nestedMap(se.key, settings)); err != nil {
+			return fmt.Errorf("while merging ENV var %s: %w", se.env, err)
+		}
+		sch.setLayerSource(se.key, settings, SourceEnv)
+	}
+	return nil
+}
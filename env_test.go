@@ -0,0 +1,393 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testEnvStruct struct {
+	Workers int `snakecharmer:"workers" env:"WORKERS" usage:"Number of workers to run"`
+	Log     struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+		Limit struct {
+			Warn uint `snakecharmer:"warn" usage:"Limit warn messages per sec"`
+		} `snakecharmer:"limit"`
+	} `snakecharmer:"log"`
+}
+
+func Test_EnvPrefix(t *testing.T) {
+	f := func(opts ...CharmingOption) *testEnvStruct {
+		t.Helper()
+		result := &testEnvStruct{}
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	t.Setenv("WORKERS", "4")
+	t.Setenv("MYAPP_WORKERS", "8")
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("MYAPP_LOG_LEVEL", "debug")
+	t.Setenv("MYAPP_LOG_LIMIT_WARN", "10")
+
+	result := f()
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+
+	result = f(WithEnvPrefix("MYAPP"))
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+
+	result = f(WithDerivedEnvNames(true))
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+	require.Equal(t, uint(0), result.Log.Limit.Warn)
+
+	result = f(WithEnvPrefix("MYAPP_"), WithDerivedEnvNames(true))
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, uint(10), result.Log.Limit.Warn)
+}
+
+func Test_EnvDisabled(t *testing.T) {
+	t.Setenv("WORKERS", "4")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	result := &testEnvStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithDerivedEnvNames(true),
+		WithEnvDisabled(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	require.True(t, charmer.EnvDisabled())
+	charmer.AddFlags()
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, 0, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+}
+
+func Test_AutomaticEnv(t *testing.T) {
+	f := func(opts ...CharmingOption) *testEnvStruct {
+		t.Helper()
+		result := &testEnvStruct{}
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.True(t, charmer.AutomaticEnv())
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	t.Setenv("APP_WORKERS", "4")
+	t.Setenv("APP_LOG__LEVEL", "warn")
+	t.Setenv("APP_LOG__LIMIT__WARN", "10")
+
+	result := f(WithEnvPrefix("APP"), WithAutomaticEnv(nil))
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+
+	result = f(WithEnvPrefix("APP_"), WithAutomaticEnv(strings.NewReplacer(".", "__")))
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+	require.Equal(t, uint(10), result.Log.Limit.Warn)
+}
+
+type testStructEnvLog struct {
+	Level string `snakecharmer:"level" env:"TEST_BLOB_LOG_LEVEL" usage:"Log level" default:"info"`
+	JSON  bool   `snakecharmer:"json" usage:"Log in JSON format"`
+	Limit struct {
+		Warn uint `snakecharmer:"warn" usage:"Limit warn messages per sec"`
+	} `snakecharmer:"limit"`
+}
+
+type testStructEnvStruct struct {
+	Log testStructEnvLog `snakecharmer:"log" env:"TEST_BLOB_LOGGING_JSON,format=json"`
+	Out testStructEnvLog `snakecharmer:"out" env:"TEST_BLOB_OUTPUT"`
+}
+
+func Test_StructEnv(t *testing.T) {
+	f := func() (*testStructEnvStruct, error) {
+		t.Helper()
+		result := &testStructEnvStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	t.Setenv("TEST_BLOB_LOGGING_JSON", `{"level": "debug", "json": true, "limit": {"warn": 10}}`)
+	t.Setenv("TEST_BLOB_OUTPUT", "json: true\nlimit:\n  warn: 20\n")
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, "debug", result.Log.Level)
+	require.True(t, result.Log.JSON)
+	require.Equal(t, uint(10), result.Log.Limit.Warn)
+	require.Equal(t, "info", result.Out.Level)
+	require.True(t, result.Out.JSON)
+	require.Equal(t, uint(20), result.Out.Limit.Warn)
+
+	// The ENV var of the field takes precedence
+	t.Setenv("TEST_BLOB_LOG_LEVEL", "error")
+	result, err = f()
+	require.NoError(t, err)
+	require.Equal(t, "error", result.Log.Level)
+	require.Equal(t, "error", result.Out.Level)
+
+	t.Setenv("TEST_BLOB_LOGGING_JSON", `{"level": `)
+	_, err = f()
+	require.Error(t, err)
+}
+
+func Test_StructEnvReload(t *testing.T) {
+	t.Setenv("TEST_BLOB_LOGGING_JSON", `{"level": "debug", "json": true}`)
+	result := &testStructEnvStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, "debug", result.Log.Level)
+	require.True(t, result.Log.JSON)
+
+	// The values removed from the ENV var are not kept by the reload
+	t.Setenv("TEST_BLOB_LOGGING_JSON", `{"json": true}`)
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, "info", result.Log.Level)
+	require.True(t, result.Log.JSON)
+
+	t.Setenv("TEST_BLOB_LOGGING_JSON", "")
+	require.NoError(t, charmer.Reload())
+	require.False(t, result.Log.JSON)
+}
+
+type testMapEnvStruct struct {
+	Destinations map[string]string `snakecharmer:"dst" env:"TEST_MAP_LOG_DST" usage:"Log to multiple destinations" default:"info=/dev/stdout"`
+}
+
+func Test_MapEnv(t *testing.T) {
+	f := func(opts ...CharmingOption) (*testMapEnvStruct, error) {
+		t.Helper()
+		result := &testMapEnvStruct{}
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"info": "/dev/stdout"}, result.Destinations)
+
+	t.Setenv("TEST_MAP_LOG_DST", "error=/var/log/e.log,debug=/var/log/d.log")
+	result, err = f()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"error": "/var/log/e.log", "debug": "/var/log/d.log"}, result.Destinations)
+
+	t.Setenv("TEST_MAP_LOG_DST", "error:/var/log/e.log;debug:/var/log/d.log")
+	result, err = f(WithMapSeparators(";", ":"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"error": "/var/log/e.log", "debug": "/var/log/d.log"}, result.Destinations)
+
+	t.Setenv("TEST_MAP_LOG_DST", "error")
+	_, err = f()
+	require.Error(t, err)
+
+	_, err = NewSnakeCharmer(WithMapSeparators(",", ","))
+	require.Error(t, err)
+}
+
+type testSliceEnvStruct struct {
+	Upstreams []string `snakecharmer:"upstreams" env:"TEST_SLICE_UPSTREAMS" usage:"List of upstream urls" default:"http://localhost/"`
+	Ports     []int    `snakecharmer:"ports" env:"TEST_SLICE_PORTS" usage:"Ports" default:"80"`
+}
+
+func Test_SliceEnv(t *testing.T) {
+	f := func(opts ...CharmingOption) *testSliceEnvStruct {
+		t.Helper()
+		result := &testSliceEnvStruct{}
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	t.Setenv("TEST_SLICE_UPSTREAMS", "a,b,c")
+	t.Setenv("TEST_SLICE_PORTS", "80,443")
+	result := f()
+	require.Equal(t, []string{"a", "b", "c"}, result.Upstreams)
+	require.Equal(t, []int{80, 443}, result.Ports)
+
+	t.Setenv("TEST_SLICE_UPSTREAMS", "http://a/?x=1,2;http://b/")
+	t.Setenv("TEST_SLICE_PORTS", "80;443;8080")
+	result = f(WithSliceSeparator(";"))
+	require.Equal(t, []string{"http://a/?x=1,2", "http://b/"}, result.Upstreams)
+	require.Equal(t, []int{80, 443, 8080}, result.Ports)
+}
+
+type testEnvLookupStruct struct {
+	Workers int    `snakecharmer:"workers" env:"WORKERS" usage:"Number of workers to run" default:"8"`
+	Path    string `snakecharmer:"path" env:"PATH" usage:"Search path"`
+	Log     struct {
+		Level string `snakecharmer:"level" env:"LOG_LEVEL" usage:"Log level" default:"info"`
+		JSON  bool   `snakecharmer:"json" usage:"Log in JSON format"`
+	} `snakecharmer:"log" env:"LOGGING,format=json"`
+}
+
+func Test_WithEnvLookup(t *testing.T) {
+	f := func(t *testing.T, env map[string]string, args ...string) *testEnvLookupStruct {
+		t.Helper()
+		result := &testEnvLookupStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithEnvLookup(func(key string) (string, bool) {
+				value, ok := env[key]
+				return value, ok
+			}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	// The lookups do not touch the process environment, so the tests can run in parallel
+	t.Run("process env", func(t *testing.T) {
+		t.Parallel()
+		result := f(t, map[string]string{})
+		require.Empty(t, result.Path)
+		require.Equal(t, 8, result.Workers)
+	})
+	t.Run("env", func(t *testing.T) {
+		t.Parallel()
+		result := f(t, map[string]string{"WORKERS": "16", "PATH": "/opt/bin", "LOG_LEVEL": "debug"})
+		require.Equal(t, 16, result.Workers)
+		require.Equal(t, "/opt/bin", result.Path)
+		require.Equal(t, "debug", result.Log.Level)
+	})
+	t.Run("flags", func(t *testing.T) {
+		t.Parallel()
+		result := f(t, map[string]string{"WORKERS": "16"}, "--workers", "4")
+		require.Equal(t, 4, result.Workers)
+	})
+	t.Run("struct env", func(t *testing.T) {
+		t.Parallel()
+		result := f(t, map[string]string{"LOGGING": `{"level": "warn", "json": true}`, "LOG_LEVEL": "error"})
+		require.Equal(t, "error", result.Log.Level)
+		require.True(t, result.Log.JSON)
+	})
+}
+
+func Test_WithEnvLookupReload(t *testing.T) {
+	env := map[string]string{"WORKERS": "16", "LOG_LEVEL": "debug"}
+	var mu sync.Mutex
+	result := &testEnvLookupStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithEnvLookup(func(key string) (string, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			value, ok := env[key]
+			return value, ok
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+
+	// The ENV var removed from the lookup is not kept by the reload
+	mu.Lock()
+	delete(env, "WORKERS")
+	mu.Unlock()
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+}
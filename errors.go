@@ -0,0 +1,146 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// FieldError is the error of the value of the config key,
+// e.g. a type mismatch or a failed validation.
+type FieldError struct {
+	// Key is the full config key, e.g. "db.port"
+	Key string
+	// Err is the error, its message names the key
+	Err error
+	// File, Line and Column are the position of the value
+	// in the YAML config file, if it comes from one
+	File   string
+	Line   int
+	Column int
+}
+
+// Error implements the error interface. The message is prefixed with
+// the position of the value, e.g. "config.yaml:3:12: ", if it is known.
+func (e *FieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Err.Error())
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// UnsupportedFieldTypeError is the panic value of AddFlags, and the error
+// of CompilePlan, when the type of the result struct field is not supported,
+// e.g. a slice of time.Time.
+type UnsupportedFieldTypeError struct {
+	// Path is the config key of the field, e.g. "server.timeouts"
+	Path string
+	// Kind is the kind of the field type
+	Kind reflect.Kind
+	// Type is the field type
+	Type reflect.Type
+}
+
+func newUnsupportedFieldTypeError(path string, t reflect.Type) *UnsupportedFieldTypeError {
+	return &UnsupportedFieldTypeError{Path: path, Kind: t.Kind(), Type: t}
+}
+
+// Error implements the error interface.
+func (e *UnsupportedFieldTypeError) Error() string {
+	return fmt.Sprintf("unsupported type %s of field %q", e.Type, e.Path)
+}
+
+// ConfigErrors is returned by the unmarshal pipeline when the config has
+// more than one error, i.e. the type mismatches, the unknown keys
+// (see UnknownKeysError) and the failed validations are collected
+// in one pass, so they can be fixed at once.
+// The single error is returned as is.
+type ConfigErrors struct {
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *ConfigErrors) Error() string {
+	points := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		points = append(points, "* "+strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	}
+	return fmt.Sprintf("%d config errors:\n%s", len(e.Errors), strings.Join(points, "\n"))
+}
+
+// Unwrap returns the collected errors for errors.Is and errors.As.
+func (e *ConfigErrors) Unwrap() []error { return e.Errors }
+
+// joinConfigErrors returns nil if there are no errors, the single error
+// as is, or ConfigErrors otherwise.
+func joinConfigErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &ConfigErrors{Errors: errs}
+}
+
+// decodeErrors splits the mapstructure decoding error into FieldError
+// per key, e.g. "'db.port' expected type 'int', got ...", the values
+// of secret fields are redacted, and the positions of the values
+// in the YAML config file are added. The keys already reported are skipped.
+func (sch *SnakeCharmer) decodeErrors(err error, settings map[string]interface{}, reported []error) []error {
+	var merr *mapstructure.Error
+	if !errors.As(err, &merr) {
+		return []error{errors.New(sch.redactString(err.Error(), settings))}
+	}
+	seen := map[string]bool{}
+	for _, r := range reported {
+		var ferr *FieldError
+		if errors.As(r, &ferr) {
+			seen[ferr.Key] = true
+		}
+	}
+	result := []error{}
+	for _, msg := range merr.Errors {
+		key := decodeErrorKey(msg)
+		if seen[key] {
+			continue
+		}
+		result = append(result, sch.newFieldError(key, errors.New(sch.redactString(msg, settings))))
+	}
+	return result
+}
+
+// decodeErrorKey returns the key of the mapstructure error message,
+// which is the first quoted one, e.g. "db.port" of
+// "'db.port' expected type 'int', got ..." or "cannot parse 'db.port' as int: ...".
+func decodeErrorKey(msg string) string {
+	_, rest, ok := strings.Cut(msg, "'")
+	if !ok {
+		return ""
+	}
+	key, _, ok := strings.Cut(rest, "'")
+	if !ok {
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,161 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testErrorsStruct struct {
+	Workers int     `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Level   string  `snakecharmer:"level" usage:"Log level" oneof:"debug,info" default:"info"`
+	MaxCPU  float64 `snakecharmer:"max-cpu,percent" usage:"Max CPU usage" default:"80%"`
+	APIKey  string  `snakecharmer:"api-key,required" usage:"API key"`
+	DB      struct {
+		Port    int  `snakecharmer:"port" usage:"DB port" default:"5432"`
+		Verbose bool `snakecharmer:"verbose" usage:"Verbose DB logging"`
+	} `snakecharmer:"db"`
+}
+
+func Test_ConfigErrors(t *testing.T) {
+	f := func(config string) (*testErrorsStruct, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testErrorsStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("api-key: k\nworkers: 4\n")
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+
+	// The single error is returned as is
+	_, err = f("api-key: k\nlevel: verbose\n")
+	var ferr *FieldError
+	require.True(t, errors.As(err, &ferr))
+	require.Equal(t, "level", ferr.Key)
+	require.EqualError(t, ferr.Err, `invalid value "verbose" of "level": must be one of debug, info`)
+
+	result, err = f(`workers: many
+level: verbose
+max-cpu: lots
+db:
+  port: x
+  verbos: true
+`)
+	var cerr *ConfigErrors
+	require.True(t, errors.As(err, &cerr), err)
+	require.Len(t, cerr.Errors, 6, err)
+	require.ErrorContains(t, err, "6 config errors:")
+	require.ErrorContains(t, err, "required config params are not set: api-key")
+	require.ErrorContains(t, err, `invalid value of "max-cpu"`)
+	require.ErrorContains(t, err, `invalid value "verbose" of "level"`)
+	var uerr *UnknownKeysError
+	require.True(t, errors.As(err, &uerr))
+	require.Equal(t, "db.verbos", uerr.Keys[0].Key)
+	keys := []string{}
+	for _, e := range cerr.Errors {
+		if errors.As(e, &ferr) {
+			keys = append(keys, ferr.Key)
+		}
+	}
+	// The type mismatch of max-cpu is reported once
+	require.Equal(t, []string{"max-cpu", "level", "workers", "db.port"}, keys)
+	// The result struct is not updated
+	require.Equal(t, 0, result.Workers)
+
+	// The type mismatches are collected as well
+	_, err = f("api-key: k\nworkers: many\ndb:\n  port: x\n")
+	require.True(t, errors.As(err, &cerr), err)
+	require.Len(t, cerr.Errors, 2)
+}
+
+func Test_TypedErrors(t *testing.T) {
+	f := func(opts ...CharmingOption) error {
+		t.Helper()
+		opts = append([]CharmingOption{
+			WithResultStruct(&testErrorsStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return charmer.UnmarshalExact()
+	}
+
+	err := f(WithConfigFilePath(filepath.Join(t.TempDir(), "config.yaml")))
+	require.True(t, errors.Is(err, ErrConfigFileNotFound), err)
+
+	err = f(WithConfigBytes([]byte("api-key: k\nworkerz: 4\n"), "yaml"))
+	var key UnknownKey
+	require.True(t, errors.As(err, &key), err)
+	require.Equal(t, "workerz", key.Key)
+	require.Equal(t, "workers", key.Suggestion)
+
+	loadErr := errors.New("vault is sealed")
+	err = f(WithProvider(&testProvider{err: loadErr, calls: 1}))
+	require.True(t, errors.Is(err, loadErr), err)
+
+	_, err = CompilePlan(reflect.TypeOf(struct {
+		Events chan int `snakecharmer:"events" usage:"Events"`
+	}{}), WithFieldTagName("snakecharmer"))
+	var uerr *UnsupportedFieldTypeError
+	require.True(t, errors.As(err, &uerr), err)
+	require.Equal(t, "events", uerr.Path)
+	require.Equal(t, reflect.Chan, uerr.Kind)
+	require.EqualError(t, uerr, `unsupported type chan int of field "events"`)
+
+	// AddFlags panics with the same error
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&struct {
+			Events chan int `snakecharmer:"events" usage:"Events"`
+		}{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	require.NoError(t, err)
+	func() {
+		defer func() {
+			perr, ok := recover().(error)
+			require.True(t, ok)
+			require.True(t, errors.As(perr, &uerr), perr)
+			require.Equal(t, "events", uerr.Path)
+		}()
+		charmer.AddFlags()
+	}()
+}
@@ -0,0 +1,153 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// etcdSource is the RemoteSource reading the config document
+// from the etcd v3 key/value store via the gRPC gateway JSON API.
+type etcdSource struct {
+	client   *http.Client
+	endpoint string
+	key      string
+
+	mu sync.Mutex
+	// The store revision of the last read, the watch starts after it
+	revision int64
+}
+
+// etcdRangeResponse is the response of the /v3/kv/range endpoint.
+// The int64 values are encoded as strings by the gateway.
+type etcdRangeResponse struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Kvs []struct {
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+// etcdWatchResponse is the message of the /v3/watch stream.
+type etcdWatchResponse struct {
+	Result struct {
+		Events       []json.RawMessage `json:"events"`
+		Canceled     bool              `json:"canceled"`
+		CancelReason string            `json:"cancel_reason"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newEtcdSource returns the etcd source of the key,
+// the endpoint is the etcd URL, e.g. "https://127.0.0.1:2379".
+func newEtcdSource(client *http.Client, endpoint, key string) *etcdSource {
+	return &etcdSource{
+		client:   client,
+		endpoint: endpoint,
+		key:      key,
+	}
+}
+
+// Read returns the value of the key.
+func (s *etcdSource) Read(ctx context.Context) ([]byte, error) {
+	resp, err := s.post(ctx, "/v3/kv/range", map[string]interface{}{"key": []byte(s.key)})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result etcdRangeResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("while decoding etcd response: %w", err)
+	}
+	if len(result.Kvs) == 0 {
+		return nil, fmt.Errorf("etcd key %q is not found", s.key)
+	}
+	revision, _ := strconv.ParseInt(result.Header.Revision, 10, 64)
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return result.Kvs[0].Value, nil
+}
+
+// Watch watches the key starting after the revision of the last read
+// until it is changed or deleted.
+func (s *etcdSource) Watch(ctx context.Context) error {
+	s.mu.Lock()
+	start := s.revision + 1
+	s.mu.Unlock()
+	resp, err := s.post(ctx, "/v3/watch", map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            []byte(s.key),
+			"start_revision": strconv.FormatInt(start, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg etcdWatchResponse
+		if err = dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("etcd watch stream is closed")
+			}
+			return err
+		}
+		switch {
+		case msg.Error != nil:
+			return fmt.Errorf("etcd watch error: %s", msg.Error.Message)
+		case msg.Result.Canceled:
+			return fmt.Errorf("etcd watch is canceled: %s", msg.Result.CancelReason)
+		case len(msg.Result.Events) > 0:
+			return nil
+		}
+	}
+}
+
+// post sends the JSON request to the gateway endpoint.
+// The []byte values are base64 encoded, as the gateway expects.
+func (s *etcdSource) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("etcd responded with %q: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testEtcdServer emulates the etcd v3 gRPC gateway for a single key.
+type testEtcdServer struct {
+	mu       sync.Mutex
+	key      string
+	value    string
+	revision int64
+	changed  chan struct{}
+}
+
+func (s *testEtcdServer) set(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value = value
+	s.revision++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *testEtcdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key           []byte `json:"key"`
+		CreateRequest struct {
+			Key           []byte `json:"key"`
+			StartRevision string `json:"start_revision"`
+		} `json:"create_request"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	revision, value, changed := s.revision, s.value, s.changed
+	s.mu.Unlock()
+	enc := json.NewEncoder(w)
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		resp := map[string]interface{}{"header": map[string]string{"revision": strconv.FormatInt(revision, 10)}}
+		if string(req.Key) == s.key {
+			resp["kvs"] = []map[string][]byte{{"key": req.Key, "value": []byte(value)}}
+		}
+		_ = enc.Encode(resp)
+	case "/v3/watch":
+		_ = enc.Encode(map[string]interface{}{"result": map[string]bool{"created": true}})
+		w.(http.Flusher).Flush()
+		if start, _ := strconv.ParseInt(req.CreateRequest.StartRevision, 10, 64); start > revision {
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		_ = enc.Encode(map[string]interface{}{"result": map[string]interface{}{
+			"events": []map[string]string{{"type": "PUT"}},
+		}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func Test_EtcdRemoteConfig(t *testing.T) {
+	f := func(opts ...CharmingOption) {
+		t.Helper()
+		etcd := &testEtcdServer{key: "/app/config", value: "workers: 32\n", revision: 5, changed: make(chan struct{})}
+		srv := httptest.NewTLSServer(etcd)
+		defer srv.Close()
+
+		result := &testMultiDocStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithRemoteConfig("etcd3", srv.Listener.Addr().String(), "/app/config"),
+			WithRemoteTLSConfig(srv.Client().Transport.(*http.Transport).TLSClientConfig),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		defer charmer.Close()
+		charmer.AddFlags()
+		require.NoError(t, charmer.UnmarshalExact())
+		require.Equal(t, 32, result.Workers)
+		require.Equal(t, "info", result.Log.Level)
+
+		reloaded := make(chan error, 1)
+		require.NoError(t, charmer.WatchRemoteConfig(context.Background(), func(err error) {
+			reloaded <- err
+		}))
+		etcd.set("workers: 64\nlog:\n  level: warn\n")
+		select {
+		case err = <-reloaded:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("remote config is not reloaded")
+		}
+		require.Equal(t, 64, result.Workers)
+		require.Equal(t, "warn", result.Log.Level)
+	}
+
+	// Watching
+	f()
+	// Polling
+	f(WithRemotePollInterval(10 * time.Millisecond))
+}
+
+func Test_RemoteSourceWithoutWatch(t *testing.T) {
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testMultiDocStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithRemoteSource(testRemoteSource("workers: 4\n")),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	defer charmer.Close()
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Error(t, charmer.WatchRemoteConfig(context.Background(), nil))
+}
+
+type testRemoteSource string
+
+func (s testRemoteSource) Read(ctx context.Context) ([]byte, error) { return []byte(s), nil }
@@ -0,0 +1,151 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// execPrefix is the prefix of the references resolved by running the command.
+const execPrefix = "exec:"
+
+// execResolver resolves "exec:/usr/bin/get-token --json" as the stdout
+// of the command without the trailing newline. The command is run
+// without a shell.
+type execResolver struct {
+	timeout time.Duration
+	// The allowed commands, no command is allowed if it is empty
+	allowed []string
+}
+
+func (r *execResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	args, err := splitCommand(ref)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("command is an empty string")
+	}
+	if !stringsContain(r.allowed, args[0]) {
+		return "", fmt.Errorf("command %q is not allowed", args[0])
+	}
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return "", fmt.Errorf("command %q failed: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("command %q failed: %w", args[0], err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(stdout.String(), "\n"), "\r"), nil
+}
+
+// execTrusted returns true if the "exec:" reference of the config key comes
+// from a trusted source: the command line, the ENV vars or the code, i.e.
+// the defaults, the overrides and the ref tags. Otherwise, it returns
+// the source the value comes from, e.g. a config file, a remote config
+// or the state file, as anyone able to write them could run the allowed commands.
+func (sch *SnakeCharmer) execTrusted(key, value string) (SourceKind, bool) {
+	b := sch.bindingOfKey(key)
+	if b == nil {
+		return SourceConfigFile, false
+	}
+	source := sch.sourceOf(*b)
+	switch source {
+	case SourceFlag, SourceSet, SourcePatch, SourceOverride, SourceEnv, SourceDefault:
+		return source, true
+	case SourceProvider:
+		// The reference of the ref tag
+		return source, strings.EqualFold(key, b.key) && value == b.ref
+	}
+	return source, false
+}
+
+// splitCommand splits the command line into the arguments separated
+// by whitespace. The single-quoted parts are taken literally,
+// the double-quoted parts allow escaping with the backslash.
+func splitCommand(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// stringsContain returns true if the slice contains the string.
+func stringsContain(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecResolver(t *testing.T) {
+	f := func(password string, opts ...CharmingOption) (*testSecretsDirStruct, error) {
+		t.Helper()
+		result := &testSecretsDirStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags([]string{"--db.password", password}); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f(`exec:echo "s3cr3t  token"`, WithExecResolver(time.Second, "echo"))
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t  token", result.DB.Password)
+
+	result, err = f("exec:echo -n t0k3n", WithExecResolver(time.Second, "echo"))
+	require.NoError(t, err)
+	require.Equal(t, "t0k3n", result.DB.Password)
+
+	// Disabled by default
+	result, err = f("exec:echo t0k3n")
+	require.NoError(t, err)
+	require.Equal(t, "exec:echo t0k3n", result.DB.Password)
+
+	// Not allowed
+	_, err = f("exec:echo t0k3n", WithExecResolver(time.Second, "/usr/bin/get-token"))
+	require.Error(t, err)
+	// Timeout
+	_, err = f("exec:sleep 5", WithExecResolver(50*time.Millisecond, "sleep"))
+	require.Error(t, err)
+	// Failure
+	_, err = f("exec:false", WithExecResolver(time.Second, "false"))
+	require.Error(t, err)
+	// The failure of the command is wrapped along with its stderr
+	_, err = f(`exec:sh -c "echo oops >&2; exit 3"`, WithExecResolver(time.Second, "sh"))
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), err)
+	require.Equal(t, 3, exitErr.ExitCode())
+	require.ErrorContains(t, err, `command "sh" failed: exit status 3: oops`)
+	// Unterminated quote
+	_, err = f("exec:echo 'token", WithExecResolver(time.Second, "echo"))
+	require.Error(t, err)
+	// The allowlist is mandatory
+	require.EqualError(t, WithExecResolver(time.Second)(&SnakeCharmer{}),
+		"exec resolver requires at least one allowed command")
+}
+
+func Test_ExecResolverUntrustedSources(t *testing.T) {
+	f := func(opts ...CharmingOption) (*testSecretsDirStruct, error) {
+		t.Helper()
+		result := &testSecretsDirStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithExecResolver(time.Second, "echo"),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("db:\n  password: exec:echo t0k3n\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	_, err := f(WithConfigFilePath(config))
+	require.EqualError(t, err,
+		`while resolving "exec:echo t0k3n" of "db.password": values from config file cannot run commands`)
+
+	provider := &testProvider{values: []ProvidedValue{{Key: "db.password", Value: "exec:echo t0k3n"}}}
+	_, err = f(WithProvider(provider))
+	require.EqualError(t, err,
+		`while resolving "exec:echo t0k3n" of "db.password": values from provider cannot run commands`)
+
+	// The ENV vars are trusted
+	t.Setenv("TEST_SECRETS_DB_USER", "exec:echo admin")
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, "admin", result.DB.User)
+}
+
+func Test_splitCommand(t *testing.T) {
+	f := func(s string, expected ...string) {
+		t.Helper()
+		args, err := splitCommand(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, args)
+	}
+
+	f("")
+	f("/usr/bin/get-token --json", "/usr/bin/get-token", "--json")
+	f(`  cmd  'a b'  "c \"d\""  e\ f `, "cmd", "a b", `c "d"`, "e f")
+	f(`cmd '' 'it\s'`, "cmd", "", `it\s`)
+}
+
+func Test_ExecResolverStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(stateFile, []byte(`{"project": "exec:echo acme"}`), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testStateStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithStateFile(stateFile),
+		WithExecResolver(time.Second, "echo"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.EqualError(t, charmer.UnmarshalExact(),
+		`while resolving "exec:echo acme" of "project": values from state file cannot run commands`)
+}
@@ -0,0 +1,95 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"reflect"
+
+	"github.com/spf13/pflag"
+)
+
+// FieldInfo describes the config key, flag and ENV vars of a result struct field.
+type FieldInfo struct {
+	// Key is the dotted config key, e.g. "log.level"
+	Key string
+	// Flag is the flag name, empty if the field has no flag
+	Flag string
+	// Shorthand is the one-letter flag shorthand, empty if there is none
+	Shorthand string
+	// Envs are the ENV var names in the lookup order, empty if not bound
+	Envs []string
+	// Type is the field type
+	Type reflect.Type
+	// Default is the default value, "***" for the secret fields
+	Default interface{}
+	// Usage is the flag usage help
+	Usage string
+	// Secret is true if the value must not be revealed
+	Secret bool
+	// Required is true if the value must be provided explicitly
+	Required bool
+	// OneOf are the allowed values, empty if any value is allowed
+	OneOf []string
+}
+
+// Fields returns the descriptions of the result struct fields
+// in the order of their declaration.
+// Note, it must be called after AddFlags.
+func (sch *SnakeCharmer) Fields() []FieldInfo {
+	fields := make([]FieldInfo, 0, len(sch.bindings))
+	for _, b := range sch.bindings {
+		defaultValue := b.defaultValue
+		if b.secret {
+			defaultValue = redacted
+		}
+		field := FieldInfo{
+			Key:      b.key,
+			Envs:     append([]string{}, b.envs...),
+			Type:     b.typ,
+			Default:  defaultValue,
+			Usage:    b.help,
+			Secret:   b.secret,
+			Required: b.required,
+			OneOf:    b.oneOf,
+		}
+		if flag := sch.bindingFlag(b); flag != nil {
+			field.Flag = flag.Name
+			field.Shorthand = flag.Shorthand
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// bindingFlag returns the flag the field is bound to, or nil
+// if the field has no flag, e.g. `flag:"-"`.
+func (sch *SnakeCharmer) bindingFlag(b fieldBinding) *pflag.Flag {
+	if b.noFlag {
+		return nil
+	}
+	return sch.lookupFlag(b.key)
+}
+
+// Walk calls fn for every result struct field in the order of their
+// declaration, it stops and returns the error returned by fn.
+// Note, it must be called after AddFlags.
+func (sch *SnakeCharmer) Walk(fn func(FieldInfo) error) error {
+	for _, field := range sch.Fields() {
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
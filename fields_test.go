@@ -0,0 +1,82 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testFieldsStruct struct {
+	Workers  int    `snakecharmer:"workers" env:"TEST_FIELDS_WORKERS" usage:"Number of workers to run" default:"8"`
+	Password string `snakecharmer:"password,secret" usage:"Password" default:"s3cr3t"`
+	APIKey   string `snakecharmer:"api-key,noflag,required" usage:"API key"`
+	Log      struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info" oneof:"debug,info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_Fields(t *testing.T) {
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testFieldsStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	fields := charmer.Fields()
+	require.Len(t, fields, 4)
+	require.Equal(t, FieldInfo{
+		Key:     "workers",
+		Flag:    "workers",
+		Envs:    []string{"TEST_FIELDS_WORKERS"},
+		Type:    reflect.TypeOf(0),
+		Default: 8,
+		Usage:   "Number of workers to run",
+	}, fields[0])
+	require.Equal(t, "password", fields[1].Key)
+	require.True(t, fields[1].Secret)
+	require.Equal(t, "***", fields[1].Default)
+	require.Equal(t, "api-key", fields[2].Key)
+	require.Empty(t, fields[2].Flag)
+	require.True(t, fields[2].Required)
+	require.Equal(t, "log.level", fields[3].Key)
+	require.Equal(t, []string{"debug", "info"}, fields[3].OneOf)
+
+	keys := []string{}
+	require.NoError(t, charmer.Walk(func(field FieldInfo) error {
+		keys = append(keys, field.Key)
+		return nil
+	}))
+	require.Equal(t, []string{"workers", "password", "api-key", "log.level"}, keys)
+
+	stop := errors.New("stop")
+	keys = []string{}
+	require.ErrorIs(t, charmer.Walk(func(field FieldInfo) error {
+		keys = append(keys, field.Key)
+		if field.Secret {
+			return stop
+		}
+		return nil
+	}), stop)
+	require.Equal(t, []string{"workers", "password"}, keys)
+}
@@ -0,0 +1,124 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// fileKeySuffixes are the suffixes of the sibling keys holding the path
+// of the file the value is read from, e.g. "password_file" for "password".
+var fileKeySuffixes = []string{"_file", "-file"}
+
+// fileValue returns the content of the file without the trailing newline,
+// which is kept by the editors and `kubectl create secret --from-file`.
+// The file is read from the filesystem set with WithFilesystem, if any.
+func (sch *SnakeCharmer) fileValue(path string) (string, error) {
+	data, err := sch.readFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+// fileValueHookFunc returns a mapstructure.DecodeHookFunc that replaces
+// the string values starting with "@", e.g. "@/run/secrets/db_password",
+// with the content of the file. The "@@" prefix escapes the literal "@".
+func (sch *SnakeCharmer) fileValueHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		s := reflect.ValueOf(data).String()
+		if !strings.HasPrefix(s, "@") {
+			return data, nil
+		}
+		if strings.HasPrefix(s, "@@") {
+			return s[1:], nil
+		}
+		value, err := sch.fileValue(s[1:])
+		if err != nil {
+			return nil, fmt.Errorf("while reading value file: %w", err)
+		}
+		return value, nil
+	}
+}
+
+// resolveFileKeys replaces the sibling keys holding the file path,
+// e.g. "db.password_file", with the key of the field, e.g. "db.password",
+// holding the content of the file. The file takes precedence over the value
+// of the same or lower precedence source, e.g. "password_file" in the config
+// file does not override the --password flag, and is dropped.
+func (sch *SnakeCharmer) resolveFileKeys(settings map[string]interface{}) error {
+	var order []SourceKind
+	for _, b := range sch.bindings {
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		for _, suffix := range fileKeySuffixes {
+			path, ok := parent[name+suffix]
+			if !ok {
+				continue
+			}
+			delete(parent, name+suffix)
+			if order == nil {
+				order = sch.precedenceOrder()
+			}
+			if _, set := parent[name]; set &&
+				sourceRank(order, sch.fileKeySource(b.key+suffix)) > sourceRank(order, sch.sourceOf(b)) {
+				continue
+			}
+			value, err := sch.fileValue(fmt.Sprint(path))
+			if err != nil {
+				return fmt.Errorf("while reading file of %q: %w", b.key, err)
+			}
+			parent[name] = value
+		}
+	}
+	return nil
+}
+
+// fileKeySource returns the source of the sibling key holding the file path,
+// which has no field, so it is set in the config layer, e.g. by the config
+// file, by the overrides or by the defaults.
+func (sch *SnakeCharmer) fileKeySource(key string) SourceKind {
+	if source, ok := sch.overrideSource(key); ok {
+		return source
+	}
+	if source, ok := sch.layerSources[strings.ToLower(key)]; ok {
+		return source
+	}
+	if sch.backend.InConfig(key) {
+		return SourceConfigFile
+	}
+	return SourceDefault
+}
+
+// sourceRank returns the index of the source in the precedence order,
+// the lower the index the higher the precedence. The sources
+// not in the order rank the lowest.
+func sourceRank(order []SourceKind, source SourceKind) int {
+	for i, k := range order {
+		if k == source {
+			return i
+		}
+	}
+	return len(order)
+}
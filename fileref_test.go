@@ -0,0 +1,127 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FileValues(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		return path
+	}
+	password := writeFile("db_password", "s3cr3t\n")
+	workers := writeFile("workers", "16")
+	user := writeFile("db_user", "root\n")
+
+	f := func(enable bool, config string, args ...string) (*testSecretsDirStruct, error) {
+		t.Helper()
+		result := &testSecretsDirStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(writeFile("config.yaml", config)),
+			WithFileValues(enable),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f(true, "workers: '@"+workers+"'\ndb:\n  user_file: "+user+"\n", "--db.password", "@"+password)
+	require.NoError(t, err)
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "root", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// The escaped "@"
+	result, err = f(true, "db:\n  password: '@@p4ss'\n")
+	require.NoError(t, err)
+	require.Equal(t, "@p4ss", result.DB.Password)
+
+	// Disabled by default
+	result, err = f(false, "db:\n  password: '@"+password+"'\n")
+	require.NoError(t, err)
+	require.Equal(t, "@"+password, result.DB.Password)
+	_, err = f(false, "db:\n  password_file: "+password+"\n")
+	require.Error(t, err)
+
+	// Missing files
+	_, err = f(true, "db:\n  password: '@"+filepath.Join(dir, "missing")+"'\n")
+	require.Error(t, err)
+	_, err = f(true, "db:\n  password-file: "+filepath.Join(dir, "missing")+"\n")
+	require.Error(t, err)
+
+	// The file key takes precedence over the value of the same source only
+	result, err = f(true, "db:\n  password: p4ss\n  password_file: "+password+"\n")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+	result, err = f(true, "db:\n  password_file: "+password+"\n", "--db.password", "fl4g")
+	require.NoError(t, err)
+	require.Equal(t, "fl4g", result.DB.Password)
+	t.Setenv("TEST_SECRETS_DB_USER", "env")
+	result, err = f(true, "db:\n  user_file: "+user+"\n")
+	require.NoError(t, err)
+	require.Equal(t, "env", result.DB.User)
+}
+
+func Test_FileValuesFilesystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"run/secrets/db_password": {Data: []byte("s3cr3t\n")},
+		"run/secrets/db_user":     {Data: []byte("root\n")},
+		"config.yaml":             {Data: []byte("workers: '@/run/secrets/workers'\ndb:\n  user_file: /run/secrets/db_user\n")},
+		"run/secrets/workers":     {Data: []byte("16")},
+	}
+	result := &testSecretsDirStruct{}
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithFilesystem(fsys),
+		WithConfigFilePath("/config.yaml"),
+		WithFileValues(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--db.password", "@/run/secrets/db_password"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "root", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+}
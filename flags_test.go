@@ -0,0 +1,116 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LocalFlags(t *testing.T) {
+	result := &testMultiDocStruct{}
+	root := &cobra.Command{Use: "app"}
+	sub := &cobra.Command{Use: "sub", Run: func(cmd *cobra.Command, args []string) {}}
+	root.AddCommand(sub)
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(root),
+		WithLocalFlags(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	require.True(t, charmer.LocalFlags())
+	charmer.AddFlags()
+
+	require.NotNil(t, root.LocalNonPersistentFlags().Lookup("workers"))
+	require.Nil(t, root.PersistentFlags().Lookup("workers"))
+	require.Nil(t, sub.Flag("workers"))
+
+	if err = root.ParseFlags([]string{"--workers", "16"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 16, result.Workers)
+}
+
+func Test_AddFlagsTo(t *testing.T) {
+	result := &testMultiDocStruct{}
+	cmd := &cobra.Command{Use: "app"}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	fs := pflag.NewFlagSet("app", pflag.ContinueOnError)
+	charmer.AddFlagsTo(fs)
+
+	require.False(t, cmd.HasAvailableFlags())
+	if err = fs.Parse([]string{"--log.level", "debug"}); err != nil {
+		t.Fatalf("unexpected error in (*pflag.FlagSet).Parse(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, 128, result.Workers)
+}
+
+func Test_ExistingFlags(t *testing.T) {
+	f := func(opts ...CharmingOption) (*testMultiDocStruct, *SnakeCharmer, *cobra.Command) {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		root := &cobra.Command{Use: "app"}
+		root.PersistentFlags().String("kind", "manual", "Kind defined manually")
+		cmd := &cobra.Command{Use: "sub"}
+		root.AddCommand(cmd)
+		cmd.Flags().IntP("workers", "w", 1, "Workers defined manually")
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		return result, charmer, cmd
+	}
+
+	result, charmer, cmd := f()
+	require.False(t, charmer.StrictFlags())
+	require.NotPanics(t, charmer.AddFlags)
+	require.Nil(t, cmd.PersistentFlags().Lookup("workers"))
+	require.Nil(t, cmd.PersistentFlags().Lookup("kind"))
+
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 128, result.Workers)
+	require.Equal(t, "", result.Kind)
+
+	if err := cmd.ParseFlags([]string{"-w", "16", "--kind", "client"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "client", result.Kind)
+
+	_, charmer, _ = f(WithStrictFlags(true))
+	require.Panics(t, charmer.AddFlags)
+}
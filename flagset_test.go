@@ -0,0 +1,96 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithFlagSet(t *testing.T) {
+	result := &testMultiDocStruct{}
+	fs := pflag.NewFlagSet("app", pflag.ContinueOnError)
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithFlagSet(fs),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = fs.Parse([]string{"--workers", "16", "--log.json"}); err != nil {
+		t.Fatalf("unexpected error in (*pflag.FlagSet).Parse(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+	require.True(t, result.Log.JSON)
+
+	_, err = NewSnakeCharmer(
+		WithResultStruct(&testMultiDocStruct{}),
+		WithFlagSet(pflag.NewFlagSet("app", pflag.ContinueOnError)),
+		WithCheckConfigFlag("check-config"),
+	)
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithResultStruct(&testMultiDocStruct{}), WithFlagSet(nil))
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithResultStruct(&testMultiDocStruct{}))
+	require.Error(t, err)
+}
+
+func Test_WithGoFlagSet(t *testing.T) {
+	f := func(result interface{}, args ...string) {
+		t.Helper()
+		fs := flag.NewFlagSet("app", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithGoFlagSet(fs),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = fs.Parse(args); err != nil {
+			t.Fatalf("unexpected error in (*flag.FlagSet).Parse(): %s", err.Error())
+		}
+		require.NoError(t, charmer.UnmarshalExact())
+	}
+
+	result := &testMultiDocStruct{}
+	f(result, "-workers", "16", "--log.level=debug", "-log.json")
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+	require.True(t, result.Log.JSON)
+	require.Equal(t, "0.0.0.0", result.BindAddr)
+
+	result = &testMultiDocStruct{}
+	f(result)
+	require.Equal(t, 128, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+
+	counts := &testCountStruct{}
+	f(counts, "-v", "-verbose", "-quiet=3")
+	require.NotNil(t, counts.Verbosity)
+	require.Equal(t, 2, *counts.Verbosity)
+	require.Equal(t, 3, counts.Quiet)
+}
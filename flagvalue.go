@@ -0,0 +1,100 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+)
+
+var flagValueType = reflect.TypeOf((*pflag.Value)(nil)).Elem()
+
+// isFlagValue returns true if the pointer to the type implements pflag.Value,
+// e.g. tri-state bools or enums. Such fields are registered as flags directly,
+// so they keep their own parsing and String() rendering.
+// ByteSize has its own handling, see applyByteSizeSetting.
+func isFlagValue(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t != byteSizeType && reflect.PtrTo(t).Implements(flagValueType)
+}
+
+// parseFlagValue parses the text into the value of the type t,
+// the pointer to which implements pflag.Value.
+func parseFlagValue(t reflect.Type, text string) (reflect.Value, error) {
+	v := reflect.New(t)
+	if err := v.Interface().(pflag.Value).Set(text); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// applyFlagValueSetting adds the flag of the field implementing pflag.Value
+// and sets the default viper config param to its String() rendering.
+func (sch *SnakeCharmer) applyFlagValueSetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) {
+	value := reflect.New(rv.Type())
+	value.Elem().Set(rv)
+	fv := value.Interface().(pflag.Value)
+	flag := fs.VarPF(fv, name, "", help)
+	if bv, ok := fv.(interface{ IsBoolFlag() bool }); ok && bv.IsBoolFlag() {
+		// The flag may be passed without the value, e.g. --feature
+		flag.NoOptDefVal = "true"
+	}
+	sch.backend.SetDefault(name, fv.String())
+}
+
+// flagValueHookFunc returns a mapstructure.DecodeHookFunc that converts
+// strings, bools and numbers into the types implementing pflag.Value
+// (see isFlagValue) or pointers to them by their Set method.
+// The numbers and bools are converted only to the struct types,
+// since the other ones are decoded from them as is.
+func flagValueHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		target, ptr := t, false
+		if target.Kind() == reflect.Ptr {
+			target, ptr = target.Elem(), true
+		}
+		if !isFlagValue(target) {
+			return data, nil
+		}
+		var text string
+		switch v := data.(type) {
+		case string:
+			text = v
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			if target.Kind() != reflect.Struct {
+				return data, nil
+			}
+			text = fmt.Sprint(v)
+		case float64:
+			if target.Kind() != reflect.Struct {
+				return data, nil
+			}
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return data, nil
+		}
+		v, err := parseFlagValue(target, text)
+		if err != nil {
+			return nil, err
+		}
+		if ptr {
+			return v.Addr().Interface(), nil
+		}
+		return v.Interface(), nil
+	}
+}
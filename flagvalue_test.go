@@ -0,0 +1,130 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testTriState is the bool which may be unset.
+type testTriState struct {
+	value *bool
+}
+
+func (t *testTriState) Set(s string) error {
+	switch s {
+	case "true", "false":
+		value := s == "true"
+		t.value = &value
+	case "unset":
+		t.value = nil
+	default:
+		return fmt.Errorf("invalid tri-state %q", s)
+	}
+	return nil
+}
+
+func (t *testTriState) String() string {
+	if t.value == nil {
+		return "unset"
+	}
+	return fmt.Sprint(*t.value)
+}
+
+func (t *testTriState) Type() string { return "triState" }
+
+func (t *testTriState) IsBoolFlag() bool { return true }
+
+// testColor is the enum of colors.
+type testColor string
+
+func (c *testColor) Set(s string) error {
+	switch s {
+	case "red", "green", "blue":
+		*c = testColor(s)
+		return nil
+	}
+	return fmt.Errorf("must be one of: red, green, blue")
+}
+
+func (c *testColor) String() string { return string(*c) }
+
+func (c *testColor) Type() string { return "color" }
+
+type testFlagValueStruct struct {
+	Feature testTriState  `snakecharmer:"feature" usage:"Feature"`
+	Beta    *testTriState `snakecharmer:"beta" env:"TEST_FLAG_VALUE_BETA" usage:"Beta" default:"false"`
+	Color   testColor     `snakecharmer:"color" usage:"Color" default:"red"`
+}
+
+func Test_FlagValue(t *testing.T) {
+	f := func(config string, args ...string) (*testFlagValueStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testFlagValueStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			return nil, cmd, err
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// The defaults
+	result, cmd, err := f("")
+	require.NoError(t, err)
+	require.Equal(t, "unset", result.Feature.String())
+	require.Equal(t, "false", result.Beta.String())
+	require.Equal(t, testColor("red"), result.Color)
+	require.Equal(t, "triState", cmd.Flag("feature").Value.Type())
+	require.Equal(t, "unset", cmd.Flag("feature").DefValue)
+	require.Equal(t, "red", cmd.Flag("color").DefValue)
+
+	// The flags keep their own parsing
+	result, _, err = f("", "--feature", "--color", "blue")
+	require.NoError(t, err)
+	require.Equal(t, "true", result.Feature.String())
+	require.Equal(t, testColor("blue"), result.Color)
+	_, _, err = f("", "--color", "pink")
+	require.ErrorContains(t, err, "must be one of: red, green, blue")
+
+	// The config values and ENV vars are parsed by Set as well
+	t.Setenv("TEST_FLAG_VALUE_BETA", "unset")
+	result, _, err = f("feature: false\ncolor: green\n")
+	require.NoError(t, err)
+	require.Equal(t, "false", result.Feature.String())
+	require.Equal(t, "unset", result.Beta.String())
+	require.Equal(t, testColor("green"), result.Color)
+	_, _, err = f("color: pink\n")
+	require.ErrorContains(t, err, "must be one of: red, green, blue")
+}
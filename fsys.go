@@ -0,0 +1,52 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fsPath converts the config file path to the name in the filesystem
+// set by WithFilesystem, which is slash separated and unrooted,
+// e.g. "/etc/app/config.yaml" -> "etc/app/config.yaml".
+func fsPath(path string) string {
+	name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+	if len(name) == 0 {
+		return "."
+	}
+	return name
+}
+
+// statFile returns the info of the config file, or the directory
+// it is searched in, in the filesystem set by WithFilesystem
+// or in the OS filesystem.
+func (sch *SnakeCharmer) statFile(path string) (fs.FileInfo, error) {
+	if sch.fsys != nil {
+		return fs.Stat(sch.fsys, fsPath(path))
+	}
+	return os.Stat(path)
+}
+
+// readFile reads the config file from the filesystem set
+// by WithFilesystem or from the OS filesystem.
+func (sch *SnakeCharmer) readFile(path string) ([]byte, error) {
+	if sch.fsys != nil {
+		return fs.ReadFile(sch.fsys, fsPath(path))
+	}
+	return os.ReadFile(path)
+}
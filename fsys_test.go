@@ -0,0 +1,78 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithFilesystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/app/config.yaml": {Data: []byte("workers: 4\nlog:\n  level: debug\n")},
+		"etc/app/prod.json":   {Data: []byte(`{"workers": 16}`)},
+		"etc/app/multi.yaml":  {Data: []byte("workers: 2\n---\nlog:\n  json: true\n")},
+		"etc/app/empty.yaml":  {Data: []byte("\n")},
+	}
+	f := func(path string) (*testDumpStruct, error) {
+		t.Helper()
+		result := &testDumpStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+			WithFilesystem(fsys),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("/etc/app/config.yaml")
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+
+	// The config file is searched in the directory
+	result, err = f("etc/app")
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+
+	result, err = f("etc/app/prod.json")
+	require.NoError(t, err)
+	require.Equal(t, 16, result.Workers)
+
+	result, err = f("etc/app/multi.yaml")
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Workers)
+	require.True(t, result.Log.JSON)
+
+	result, err = f("etc/app/empty.yaml")
+	require.NoError(t, err)
+	require.Equal(t, 8, result.Workers)
+
+	// The OS filesystem is not used
+	_, err = f(t.TempDir())
+	require.True(t, errors.Is(err, ErrConfigFileNotFound))
+	_, err = f("etc/other")
+	require.True(t, errors.Is(err, ErrConfigFileNotFound))
+}
@@ -0,0 +1,70 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"flag"
+
+	"github.com/spf13/pflag"
+)
+
+// goFlagValue is the flag.Value of the pflag exported
+// to the standard library flagset, see WithGoFlagSet.
+type goFlagValue struct {
+	fs   *pflag.FlagSet
+	flag *pflag.Flag
+}
+
+// String returns the current value of the pflag.
+func (v *goFlagValue) String() string {
+	if v == nil || v.flag == nil {
+		return ""
+	}
+	return v.flag.Value.String()
+}
+
+// Set sets the value via the pflag.FlagSet, so the flag is marked
+// as changed and overrides the config file and ENV vars.
+func (v *goFlagValue) Set(value string) error {
+	if v.flag.Value.Type() == "count" && value == "true" {
+		// The count flag given without a value, e.g. "-v"
+		value = "+1"
+	}
+	return v.fs.Set(v.flag.Name, value)
+}
+
+// IsBoolFlag makes the flag package accept the flag without a value, e.g. "-json".
+func (v *goFlagValue) IsBoolFlag() bool {
+	switch v.flag.Value.Type() {
+	case "bool", "count":
+		return true
+	}
+	return false
+}
+
+// exportGoFlags defines the flags of the pflag.FlagSet on the standard
+// library flagset, along with the shorthands of the flags, e.g. "-v".
+// The flags already defined on the standard library flagset are skipped.
+func exportGoFlags(fs *pflag.FlagSet, goFS *flag.FlagSet) {
+	fs.VisitAll(func(f *pflag.Flag) {
+		value := &goFlagValue{fs: fs, flag: f}
+		if goFS.Lookup(f.Name) == nil {
+			goFS.Var(value, f.Name, f.Usage)
+		}
+		if len(f.Shorthand) > 0 && goFS.Lookup(f.Shorthand) == nil {
+			goFS.Var(value, f.Shorthand, "Shorthand for -"+f.Name)
+		}
+	})
+}
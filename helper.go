@@ -14,7 +14,38 @@
 
 package snakecharmer
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// tagOptions is the list of options of a field tag,
+// e.g. "omitempty,required" in `snakecharmer:"api-key,omitempty,required"`
+type tagOptions []string
+
+// Has returns true if the option is in the list.
+func (o tagOptions) Has(opt string) bool {
+	for _, v := range o {
+		if v == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFieldTag splits the field tag into the key and the tag options.
+func parseFieldTag(tag string) (string, tagOptions) {
+	parts := strings.Split(tag, ",")
+	opts := make(tagOptions, 0, len(parts)-1)
+	for _, opt := range parts[1:] {
+		opts = append(opts, strings.TrimSpace(opt))
+	}
+	return parts[0], opts
+}
 
 func fileExtSupported(ext string) bool {
 	for _, se := range viper.SupportedExts {
@@ -24,3 +55,60 @@ func fileExtSupported(ext string) bool {
 	}
 	return false
 }
+
+// flagSliceHookFunc returns a mapstructure.DecodeHookFunc that converts
+// the string representation of a pflag slice value (e.g. "[1,2,3]")
+// into a slice of the target type.
+func flagSliceHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t.Kind() != reflect.Slice {
+			return data, nil
+		}
+		s := reflect.ValueOf(data).String()
+		if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+			return data, nil
+		}
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		parts := []string{}
+		if len(s) > 0 {
+			parts = strings.Split(s, ",")
+		}
+		result := reflect.New(t)
+		if err := mapstructure.WeakDecode(parts, result.Interface()); err != nil {
+			return nil, err
+		}
+		return result.Elem().Interface(), nil
+	}
+}
+
+// stringToMapHookFunc returns a mapstructure.DecodeHookFunc that converts
+// the string like "error=/var/log/e.log,debug=/var/log/d.log" (e.g. an ENV var value)
+// into a map of the target type, splitting entries by entrySep
+// and keys from values by pairSep. The pflag representation of
+// a map value (e.g. "[a=1,b=2]") is supported as well.
+func stringToMapHookFunc(entrySep, pairSep string) mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t.Kind() != reflect.Map {
+			return data, nil
+		}
+		s := strings.TrimSpace(reflect.ValueOf(data).String())
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		}
+		entries := map[string]string{}
+		if len(s) > 0 {
+			for _, entry := range strings.Split(s, entrySep) {
+				key, value, ok := strings.Cut(entry, pairSep)
+				if !ok {
+					return nil, fmt.Errorf("invalid map entry %q, must be key%svalue", entry, pairSep)
+				}
+				entries[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		result := reflect.New(t)
+		if err := mapstructure.WeakDecode(entries, result.Interface()); err != nil {
+			return nil, err
+		}
+		return result.Elem().Interface(), nil
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeHooksNamedString(t *testing.T) {
+	// The values of named string types, e.g. of WithDefaults or Set,
+	// are handled as strings
+	type name string
+	f := func(hook mapstructure.DecodeHookFunc, data interface{}, target interface{}) interface{} {
+		t.Helper()
+		fn, ok := hook.(func(reflect.Type, reflect.Type, interface{}) (interface{}, error))
+		require.True(t, ok)
+		out, err := fn(reflect.TypeOf(data), reflect.TypeOf(target), data)
+		require.NoError(t, err)
+		return out
+	}
+	require.Equal(t, []int{1, 2}, f(flagSliceHookFunc(), name("[1,2]"), []int{}))
+	require.Equal(t, map[string]int{"a": 1}, f(stringToMapHookFunc(",", "="), name("a=1"), map[string]int{}))
+	require.Equal(t, ByteSize(1024), f(byteSizeHookFunc(), name("1KiB"), ByteSize(0)))
+	require.Equal(t, net.ParseIP("127.0.0.1"), f(netHookFunc(), name("127.0.0.1"), net.IP{}))
+}
@@ -0,0 +1,134 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// keyAlias is the legacy config key of the renamed one.
+type keyAlias struct {
+	old string
+	new string
+}
+
+// aliasFlagValue is the value of the hidden flag of the legacy key,
+// which sets the flag of the renamed key.
+type aliasFlagValue struct {
+	pflag.Value
+	target *pflag.Flag
+	warn   func()
+}
+
+// Set sets the value of the flag of the renamed key and marks it as changed,
+// so it overrides the config file and ENV vars.
+func (v *aliasFlagValue) Set(s string) error {
+	if err := v.Value.Set(s); err != nil {
+		return err
+	}
+	v.target.Changed = true
+	v.warn()
+	return nil
+}
+
+// aliasedKeys returns the legacy keys of the fields set with WithKeyAlias
+// and the alias tag. The alias of a nested struct key, e.g. "logging" of "log",
+// covers all its fields, e.g. "logging.level" of "log.level".
+func (sch *SnakeCharmer) aliasedKeys() []keyAlias {
+	aliases := append([]keyAlias{}, sch.keyAliases...)
+	for _, b := range sch.bindings {
+		for _, old := range b.aliases {
+			aliases = append(aliases, keyAlias{old: old, new: b.key})
+		}
+	}
+	result := []keyAlias{}
+	for _, a := range aliases {
+		for _, b := range sch.bindings {
+			if b.key == a.new {
+				result = append(result, a)
+			} else if strings.HasPrefix(b.key, a.new+".") {
+				result = append(result, keyAlias{old: a.old + b.key[len(a.new):], new: b.key})
+			}
+		}
+	}
+	return result
+}
+
+// applyKeyAliases moves the values of the legacy keys in the config settings
+// to the renamed keys, warning about the deprecation. The value of the renamed
+// key wins if both are set.
+func (sch *SnakeCharmer) applyKeyAliases(settings map[string]interface{}) {
+	for _, a := range sch.aliasedKeys() {
+		old, name := settingsParent(settings, a.old)
+		if old == nil {
+			continue
+		}
+		value, ok := old[name]
+		if !ok {
+			continue
+		}
+		deleteSetting(settings, a.old)
+		if parent, name := settingsParent(settings, a.new); parent != nil {
+			if _, ok = parent[name]; ok {
+				sch.warn("config key %q is deprecated and ignored, since %q is set", a.old, a.new)
+				continue
+			}
+		}
+		setSetting(settings, a.new, value)
+		sch.warn("config key %q is deprecated, use %q instead", a.old, a.new)
+	}
+}
+
+// addAliasFlags adds the hidden flags of the legacy keys,
+// which set the flags of the renamed keys.
+func (sch *SnakeCharmer) addAliasFlags() {
+	for _, a := range sch.aliasedKeys() {
+		target := sch.lookupFlag(a.new)
+		if target == nil {
+			continue
+		}
+		_, fs := sch.fieldFlags(a.new)
+		if fs.Lookup(a.old) != nil {
+			continue
+		}
+		a := a
+		fs.AddFlag(&pflag.Flag{
+			Name:        a.old,
+			Usage:       fmt.Sprintf("Deprecated, use --%s instead", a.new),
+			Value:       &aliasFlagValue{Value: target.Value, target: target, warn: func() { sch.warn("flag --%s is deprecated, use --%s instead", a.old, a.new) }},
+			DefValue:    target.DefValue,
+			NoOptDefVal: target.NoOptDefVal,
+			Hidden:      true,
+		})
+	}
+}
+
+// setSetting sets the value of the dotted key in the nested settings map,
+// creating the parent maps if needed.
+func setSetting(settings map[string]interface{}, key string, value interface{}) {
+	path := strings.Split(key, ".")
+	for _, k := range path[:len(path)-1] {
+		m, ok := settings[k].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			settings[k] = m
+		}
+		settings = m
+	}
+	settings[path[len(path)-1]] = value
+}
@@ -0,0 +1,90 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testKeyAliasStruct struct {
+	Workers int `snakecharmer:"workers" alias:"threads" usage:"Number of workers to run" default:"8"`
+	Log     struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+		JSON  bool   `snakecharmer:"json" usage:"Log in JSON format"`
+	} `snakecharmer:"log"`
+}
+
+func Test_KeyAlias(t *testing.T) {
+	f := func(config string, args []string) (*testKeyAliasStruct, []string) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		warnings := []string{}
+		result := &testKeyAliasStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+			WithKeyAlias("logging", "log"),
+			WithWarnFunc(func(msg string) { warnings = append(warnings, msg) }),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result, warnings
+	}
+
+	// The legacy config keys populate the renamed fields
+	result, warnings := f("threads: 4\nlogging:\n  level: debug\n", nil)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, []string{
+		`config key "logging.level" is deprecated, use "log.level" instead`,
+		`config key "threads" is deprecated, use "workers" instead`,
+	}, warnings)
+
+	// The renamed key wins
+	result, warnings = f("threads: 4\nworkers: 2\n", nil)
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, []string{`config key "threads" is deprecated and ignored, since "workers" is set`}, warnings)
+
+	// The legacy flags set the renamed fields and override the config file
+	result, warnings = f("workers: 2\n", []string{"--threads", "16", "--logging.json"})
+	require.Equal(t, 16, result.Workers)
+	require.True(t, result.Log.JSON)
+	require.Equal(t, []string{
+		"flag --threads is deprecated, use --workers instead",
+		"flag --logging.json is deprecated, use --log.json instead",
+	}, warnings)
+
+	_, err := NewSnakeCharmer(WithKeyAlias("workers", "workers"))
+	require.Error(t, err)
+}
@@ -0,0 +1,262 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package koanfbackend provides the snakecharmer.Backend based on koanf,
+// for the applications standardized on koanf instead of viper.
+//
+// It replaces the store the values are merged and resolved in only.
+// snakecharmer still reads, parses, merges and writes the config files,
+// including the remote ones, with viper's codecs, and its API refers
+// to viper types, e.g. viper.DecoderConfigOption, so viper stays
+// a dependency of the applications using this backend.
+//
+// Usage:
+//
+//	charmer, err := snakecharmer.NewSnakeCharmer(
+//		snakecharmer.WithResultStruct(&cfg),
+//		snakecharmer.WithCobraCommand(cmd),
+//		snakecharmer.WithBackend(koanfbackend.New()),
+//	)
+package koanfbackend
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+)
+
+// delim is the delimiter of the nested keys, the same as snakecharmer uses.
+const delim = "."
+
+// Backend is the snakecharmer.LayeredBackend based on koanf.Koanf.
+// Every layer is a separate koanf instance, AllSettings merges them
+// in the order: flag default < default < config < ENV var < changed flag.
+// The keys are lower-cased, like the viper based backend does.
+type Backend struct {
+	defaults *koanf.Koanf
+	config   *koanf.Koanf
+	// The flags and the ENV vars bound to the keys
+	flags map[string]*pflag.Flag
+	envs  map[string][]string
+	// The function looking up the ENV vars, see WithEnvLookup
+	lookupEnv func(string) (string, bool)
+}
+
+// Option configures the Backend.
+type Option func(b *Backend)
+
+// WithEnvLookup sets the function the bound ENV vars are looked up with.
+// This defaults to os.LookupEnv.
+func WithEnvLookup(lookup func(string) (string, bool)) Option {
+	return func(b *Backend) {
+		if lookup != nil {
+			b.lookupEnv = lookup
+		}
+	}
+}
+
+// New returns the empty Backend.
+func New(opts ...Option) *Backend {
+	b := &Backend{
+		defaults:  koanf.New(delim),
+		config:    koanf.New(delim),
+		flags:     map[string]*pflag.Flag{},
+		envs:      map[string][]string{},
+		lookupEnv: os.LookupEnv,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// SetDefault sets the default value of the key.
+func (b *Backend) SetDefault(key string, value interface{}) {
+	key = strings.ToLower(key)
+	b.defaults.Delete(key)
+	_ = b.defaults.Set(key, value)
+}
+
+// BindFlag binds the key to the flag, whose value is used if it is changed.
+func (b *Backend) BindFlag(key string, flag *pflag.Flag) error {
+	b.flags[strings.ToLower(key)] = flag
+	return nil
+}
+
+// BindEnv binds the key to the ENV vars, the first one set wins.
+func (b *Backend) BindEnv(key string, envs ...string) error {
+	key = strings.ToLower(key)
+	if len(envs) == 0 {
+		envs = []string{strings.ToUpper(key)}
+	}
+	b.envs[key] = envs
+	return nil
+}
+
+// MergeFile replaces the config layer with the settings
+// merged from the config files.
+func (b *Backend) MergeFile(_ string, settings map[string]interface{}) error {
+	b.config = koanf.New(delim)
+	return b.MergeConfigMap(settings)
+}
+
+// MergeConfigMap deep-merges the settings into the config layer.
+func (b *Backend) MergeConfigMap(settings map[string]interface{}) error {
+	return b.config.Load(settingsProvider(lowerKeys(settings)), nil)
+}
+
+// InConfig returns true if the key is set in the config layer.
+func (b *Backend) InConfig(key string) bool {
+	return b.config.Exists(strings.ToLower(key))
+}
+
+// ConfigValue returns the value of the key in the config layer.
+func (b *Backend) ConfigValue(key string) (interface{}, bool) {
+	key = strings.ToLower(key)
+	if !b.config.Exists(key) {
+		return nil, false
+	}
+	return b.config.Get(key), true
+}
+
+// DefaultValue returns the default value of the key.
+func (b *Backend) DefaultValue(key string) (interface{}, bool) {
+	key = strings.ToLower(key)
+	if !b.defaults.Exists(key) {
+		return nil, false
+	}
+	return b.defaults.Get(key), true
+}
+
+// AllSettings returns the resolved values of all the keys as nested maps.
+func (b *Backend) AllSettings() map[string]interface{} {
+	out := koanf.New(delim)
+	for key, flag := range b.flags {
+		if !b.defaults.Exists(key) {
+			_ = out.Set(key, flagValue(flag))
+		}
+	}
+	_ = out.Merge(b.defaults)
+	_ = out.Merge(b.config)
+	for key, envs := range b.envs {
+		for _, env := range envs {
+			// Empty ENV vars are ignored, like viper does
+			if value, ok := b.lookupEnv(env); ok && value != "" {
+				out.Delete(key)
+				_ = out.Set(key, value)
+				break
+			}
+		}
+	}
+	for key, flag := range b.flags {
+		if flag.Changed {
+			out.Delete(key)
+			_ = out.Set(key, flagValue(flag))
+		}
+	}
+	return out.Raw()
+}
+
+// flagValue returns the value of the flag converted by its type,
+// the same way viper does.
+func flagValue(flag *pflag.Flag) interface{} {
+	value := flag.Value.String()
+	switch flag.Value.Type() {
+	case "int", "int8", "int16", "int32", "int64":
+		return cast.ToInt(value)
+	case "bool":
+		return cast.ToBool(value)
+	case "stringSlice", "stringArray":
+		res, _ := readAsCSV(trimBrackets(value))
+		return res
+	case "intSlice":
+		res, _ := readAsCSV(trimBrackets(value))
+		return cast.ToIntSlice(res)
+	case "durationSlice":
+		return cast.ToDurationSlice(strings.Split(trimBrackets(value), ","))
+	case "stringToString":
+		res := map[string]interface{}{}
+		for k, v := range stringToMap(value) {
+			res[k] = v
+		}
+		return res
+	case "stringToInt":
+		res := map[string]interface{}{}
+		for k, v := range stringToMap(value) {
+			res[k] = cast.ToInt(v)
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+func trimBrackets(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
+
+func readAsCSV(s string) ([]string, error) {
+	if s == "" {
+		return []string{}, nil
+	}
+	return csv.NewReader(strings.NewReader(s)).Read()
+}
+
+// stringToMap parses the "[a=1,b=2]" value of the map flags.
+func stringToMap(s string) map[string]string {
+	res := map[string]string{}
+	fields, err := readAsCSV(trimBrackets(s))
+	if err != nil {
+		return res
+	}
+	for _, field := range fields {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// lowerKeys returns the copy of the settings with the keys lower-cased.
+func lowerKeys(settings map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(settings))
+	for k, value := range settings {
+		switch m := value.(type) {
+		case map[string]interface{}:
+			value = lowerKeys(m)
+		case map[interface{}]interface{}:
+			nested := make(map[string]interface{}, len(m))
+			for mk, mv := range m {
+				nested[cast.ToString(mk)] = mv
+			}
+			value = lowerKeys(nested)
+		}
+		res[strings.ToLower(k)] = value
+	}
+	return res
+}
+
+// settingsProvider is the koanf.Provider of the parsed settings.
+type settingsProvider map[string]interface{}
+
+func (p settingsProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("settings provider does not support ReadBytes")
+}
+
+func (p settingsProvider) Read() (map[string]interface{}, error) { return p, nil }
@@ -0,0 +1,104 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package koanfbackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asokolov365/snakecharmer"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+var _ snakecharmer.LayeredBackend = (*Backend)(nil)
+
+type testStruct struct {
+	Workers  int               `snakecharmer:"workers" usage:"Number of workers to run" default:"128"`
+	BindAddr string            `snakecharmer:"bind-addr" usage:"Addr to bind" default:"0.0.0.0"`
+	Hosts    []string          `snakecharmer:"hosts" usage:"Hosts to connect"`
+	Labels   map[string]string `snakecharmer:"labels" usage:"Labels to attach"`
+	Log      struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+		JSON  bool   `snakecharmer:"json" env:"LOG_JSON" usage:"Log in JSON format"`
+	} `snakecharmer:"log"`
+}
+
+func Test_Backend(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 256\nhosts: [a, b]\nLog:\n  Level: warn\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_LOG_JSON", "true")
+
+	result := &testStruct{}
+	cmd := &cobra.Command{}
+	backend := New()
+	charmer, err := snakecharmer.NewSnakeCharmer(
+		snakecharmer.WithResultStruct(result),
+		snakecharmer.WithFieldTagName("snakecharmer"),
+		snakecharmer.WithEnvPrefix("TEST"),
+		snakecharmer.WithCobraCommand(cmd),
+		snakecharmer.WithConfigFilePath(config),
+		snakecharmer.WithBackend(backend),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = cmd.ParseFlags([]string{"--bind-addr", "127.0.0.1", "--labels", "env=prod,tier=web"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 256, result.Workers)
+	require.Equal(t, "127.0.0.1", result.BindAddr)
+	require.Equal(t, []string{"a", "b"}, result.Hosts)
+	require.Equal(t, map[string]string{"env": "prod", "tier": "web"}, result.Labels)
+	require.Equal(t, "warn", result.Log.Level)
+	require.True(t, result.Log.JSON)
+
+	value, ok := backend.ConfigValue("log.level")
+	require.True(t, ok)
+	require.Equal(t, "warn", value)
+	value, ok = backend.DefaultValue("workers")
+	require.True(t, ok)
+	require.EqualValues(t, 128, value)
+	require.False(t, backend.InConfig("bind-addr"))
+
+	// The values removed from the config are not kept on reload
+	if err := os.WriteFile(config, []byte("hosts: [c]\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 128, result.Workers)
+	require.Equal(t, []string{"c"}, result.Hosts)
+	require.Equal(t, "info", result.Log.Level)
+}
+
+func Test_WithEnvLookup(t *testing.T) {
+	backend := New(WithEnvLookup(func(key string) (string, bool) {
+		return map[string]string{"LOG_LEVEL": "debug", "EMPTY": ""}[key], true
+	}))
+	backend.SetDefault("log.level", "info")
+	backend.SetDefault("name", "default")
+	require.NoError(t, backend.BindEnv("log.level", "LOG_LEVEL"))
+	require.NoError(t, backend.BindEnv("name", "EMPTY"))
+	require.Equal(t, map[string]interface{}{
+		"log":  map[string]interface{}{"level": "debug"},
+		"name": "default",
+	}, backend.AllSettings())
+}
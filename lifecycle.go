@@ -0,0 +1,52 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+// Close stops the config subsystem: it cancels the context the background
+// goroutines are tied to (see WithContext), stops the refresh of expiring
+// provided values and waits for the running reloads to finish.
+// After Close, Reload returns ErrClosed, while the result struct keeps
+// the last loaded values. Close is idempotent and always returns nil,
+// it implements io.Closer. It may be called by the refresh error handler
+// (see WithRefreshErrorHandler), which Close does not wait for,
+// but not by the subscribers and the validators (see Subscribe).
+func (sch *SnakeCharmer) Close() error {
+	sch.mu.Lock()
+	if sch.closed {
+		sch.mu.Unlock()
+		return nil
+	}
+	sch.closed = true
+	sch.cancel()
+	sch.stopRefresh()
+	sch.mu.Unlock()
+
+	sch.wg.Wait()
+	return nil
+}
+
+// goBackground runs fn in the goroutine Close waits for.
+// It returns false if the config subsystem is closed. The caller must hold sch.mu.
+func (sch *SnakeCharmer) goBackground(fn func()) bool {
+	if sch.closed {
+		return false
+	}
+	sch.wg.Add(1)
+	go func() {
+		defer sch.wg.Done()
+		fn()
+	}()
+	return true
+}
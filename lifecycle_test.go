@@ -0,0 +1,97 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Close(t *testing.T) {
+	f := func(opts ...CharmingOption) (*SnakeCharmer, *testProvider) {
+		t.Helper()
+		provider := &testProvider{
+			values: []ProvidedValue{
+				{Key: "db.password", Value: "s3cr3t", TTL: 200 * time.Millisecond},
+			},
+		}
+		opts = append([]CharmingOption{
+			WithResultStruct(&testSecretStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithProvider(provider),
+			WithRefreshWindow(100 * time.Millisecond),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return charmer, provider
+	}
+	calls := func(p *testProvider) int {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.calls
+	}
+
+	// Close stops the refresh of expiring values
+	charmer, provider := f()
+	charmer.HandleSIGHUP(context.Background(), nil)
+	require.NoError(t, charmer.Close())
+	require.NoError(t, charmer.Close())
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, 1, calls(provider))
+	require.ErrorIs(t, charmer.Reload(), ErrClosed)
+
+	// The canceled context stops the refresh as well
+	ctx, cancel := context.WithCancel(context.Background())
+	charmer, provider = f(WithContext(ctx))
+	cancel()
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, 1, calls(provider))
+	require.NoError(t, charmer.Close())
+
+	// The refresh runs until closed
+	charmer, provider = f()
+	require.Eventually(t, func() bool { return calls(provider) > 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, charmer.Close())
+
+	// The refresh error handler may close the charmer
+	var closer *SnakeCharmer
+	closed := make(chan error, 1)
+	charmer, provider = f(WithRefreshErrorHandler(func(keys []string, err error) {
+		closed <- closer.Close()
+	}))
+	provider.mu.Lock()
+	closer = charmer
+	provider.err = errors.New("vault is sealed")
+	provider.mu.Unlock()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close() called by the refresh error handler deadlocked")
+	}
+	require.ErrorIs(t, charmer.Reload(), ErrClosed)
+}
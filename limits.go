@@ -0,0 +1,116 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConfigLimits are the limits enforced on the loaded config before decoding,
+// protecting from pathological inputs, e.g. user supplied config files.
+// Zero value of a limit means no limit.
+type ConfigLimits struct {
+	// MaxFileSize is the max size of the config file in bytes
+	MaxFileSize int64
+	// MaxDepth is the max nesting depth of the config values,
+	// e.g. the depth of {"log": {"limit": {"warn": 10}}} is 3
+	MaxDepth int
+	// MaxLen is the max length of slices and maps in the config values
+	MaxLen int
+}
+
+// LimitError is returned when the loaded config exceeds ConfigLimits.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. "MaxDepth"
+	Limit string
+	// Key is the config key, or the config file path for MaxFileSize
+	Key string
+	// Value is the actual value
+	Value int64
+	// Max is the limit value
+	Max int64
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded for %q: %d > %d", e.Limit, e.Key, e.Value, e.Max)
+}
+
+// checkConfigFileSize verifies the size of the config file that is about to be read.
+func (sch *SnakeCharmer) checkConfigFileSize(file string) error {
+	if sch.limits.MaxFileSize <= 0 {
+		return nil
+	}
+	fileInfo, err := sch.statFile(file)
+	if err != nil {
+		// Let the reader report the error
+		return nil
+	}
+	return sch.checkFileSize(file, fileInfo.Size())
+}
+
+// checkFileSize verifies the size of the file that is about to be read.
+func (sch *SnakeCharmer) checkFileSize(file string, size int64) error {
+	if sch.limits.MaxFileSize > 0 && size > sch.limits.MaxFileSize {
+		return &LimitError{Limit: "MaxFileSize", Key: file, Value: size, Max: sch.limits.MaxFileSize}
+	}
+	return nil
+}
+
+// checkLimits verifies the nesting depth and the length
+// of slices and maps of the merged config values.
+func (sch *SnakeCharmer) checkLimits() error {
+	if sch.limits.MaxDepth <= 0 && sch.limits.MaxLen <= 0 {
+		return nil
+	}
+	return sch.checkValueLimits("", sch.backend.AllSettings(), 1)
+}
+
+func (sch *SnakeCharmer) checkValueLimits(key string, value interface{}, depth int) error {
+	var children map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		children = v
+	case []interface{}:
+		children = make(map[string]interface{}, len(v))
+		for i, elem := range v {
+			children[fmt.Sprintf("%d", i)] = elem
+		}
+	default:
+		return nil
+	}
+	// The length of the root map is not limited, as it is defined by the result struct
+	if sch.limits.MaxLen > 0 && depth > 1 && len(children) > sch.limits.MaxLen {
+		return &LimitError{Limit: "MaxLen", Key: key, Value: int64(len(children)), Max: int64(sch.limits.MaxLen)}
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	if sch.limits.MaxDepth > 0 && depth > sch.limits.MaxDepth {
+		return &LimitError{Limit: "MaxDepth", Key: key, Value: int64(depth), Max: int64(sch.limits.MaxDepth)}
+	}
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := sch.checkValueLimits(joinKey(key, name), children[name], depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ConfigLimits(t *testing.T) {
+	f := func(path string, limits ConfigLimits, expected *LimitError) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(initTestStruct()),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithIgnoreUntaggedFields(true),
+			WithConfigFilePath(path),
+			WithConfigFileBaseName("test-config"),
+			WithConfigLimits(limits),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		err = charmer.UnmarshalExact()
+		if expected == nil {
+			require.NoError(t, err)
+			return
+		}
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("expecting *LimitError in UnmarshalExact(), got: %v", err)
+		}
+		require.Equal(t, expected, limitErr)
+	}
+
+	f("./test-config.json", ConfigLimits{}, nil)
+	f("./test-config.json", ConfigLimits{MaxFileSize: 1024, MaxDepth: 3, MaxLen: 4}, nil)
+	f("./test-config.json", ConfigLimits{MaxFileSize: 100},
+		&LimitError{Limit: "MaxFileSize", Key: "./test-config.json", Value: 353, Max: 100})
+	absPath, err := filepath.Abs("test-config.json")
+	require.NoError(t, err)
+	f("./", ConfigLimits{MaxFileSize: 100},
+		&LimitError{Limit: "MaxFileSize", Key: absPath, Value: 353, Max: 100})
+	f("./test-config.json", ConfigLimits{MaxDepth: 2},
+		&LimitError{Limit: "MaxDepth", Key: "log.limit", Value: 3, Max: 2})
+	f("./test-config.json", ConfigLimits{MaxLen: 3},
+		&LimitError{Limit: "MaxLen", Key: "log", Value: 4, Max: 3})
+}
@@ -0,0 +1,302 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DiagnosticSeverity is the severity of the problem found by LintConfig.
+type DiagnosticSeverity int
+
+const (
+	// SeverityError is the problem UnmarshalExact fails on.
+	SeverityError DiagnosticSeverity = iota
+	// SeverityWarning is the problem UnmarshalExact tolerates,
+	// e.g. the deprecated key.
+	SeverityWarning
+)
+
+// String returns the severity name.
+func (s DiagnosticSeverity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// MarshalText implements encoding.TextMarshaler, so the severity
+// is encoded by its name, e.g. in JSON.
+func (s DiagnosticSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// The codes of the problems found by LintConfig, see Diagnostic.Code.
+const (
+	// DiagnosticSyntax is the config that cannot be parsed.
+	DiagnosticSyntax = "syntax"
+	// DiagnosticMigration is the failed config migration, see WithMigration.
+	DiagnosticMigration = "migration"
+	// DiagnosticUnknownKey is the key that does not exist in the result struct.
+	DiagnosticUnknownKey = "unknown-key"
+	// DiagnosticDeprecatedKey is the legacy key of the renamed one, see WithKeyAlias.
+	DiagnosticDeprecatedKey = "deprecated-key"
+	// DiagnosticTypeMismatch is the value that cannot be decoded into the field.
+	DiagnosticTypeMismatch = "type-mismatch"
+	// DiagnosticInvalidValue is the value that fails the validation,
+	// e.g. of the oneof tag.
+	DiagnosticInvalidValue = "invalid-value"
+)
+
+// Diagnostic is the problem found in the config by LintConfig.
+type Diagnostic struct {
+	Severity DiagnosticSeverity `json:"severity"`
+	// Code is the kind of the problem, e.g. DiagnosticUnknownKey
+	Code string `json:"code"`
+	// Key is the config key, e.g. "db.port", empty if the problem
+	// is not of a key, e.g. the syntax error
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+	// Line and Column are the position of the value in the YAML config,
+	// zero if it is unknown
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// String returns the diagnostic like "3:9: error: <message> (type-mismatch)".
+func (d Diagnostic) String() string {
+	pos := ""
+	if d.Line > 0 {
+		pos = fmt.Sprintf("%d:%d: ", d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s%s: %s (%s)", pos, d.Severity, d.Message, d.Code)
+}
+
+// lintConfigName is the name of the linted config in the error messages
+const lintConfigName = "config"
+
+// LintConfig checks the config document in the given format, e.g. "yaml",
+// against the result struct, like UnmarshalExact does, but without merging
+// it into the config: the flags, ENV vars, providers and the other sources
+// are not involved, and neither the settings nor the result struct change.
+// It returns the diagnostics of all the problems found, i.e. the syntax
+// errors, unknown keys, deprecated keys, keys that cannot be set in config,
+// type mismatches and the values failing the oneof, min, max and percent
+// tags, or none if the config passes them, e.g. for linting the configs in CI.
+// If the config has no errors, it is decoded over the defaults into a copy
+// of the result struct, and the struct validator (see WithStructValidator)
+// and the cross-field validators (see WithCrossFieldValidator) are run on it.
+// The required keys are not checked, since the values may come from other
+// sources, so the config passing LintConfig may still be rejected by UnmarshalExact.
+// The references to the value resolvers are not resolved,
+// and the profiles (see WithProfileFlag) are not checked.
+// It requires AddFlags to be called, otherwise the schema is unknown.
+func (sch *SnakeCharmer) LintConfig(data []byte, format string) []Diagnostic {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	if !fileExtSupported(format) {
+		return []Diagnostic{{
+			Severity: SeverityError,
+			Code:     DiagnosticSyntax,
+			Message:  fmt.Sprintf("unsupported config format %q", format),
+		}}
+	}
+	settings, err := sch.readConfigBytes(lintConfigName, data, format)
+	if err != nil {
+		return []Diagnostic{{Severity: SeverityError, Code: DiagnosticSyntax, Message: err.Error()}}
+	}
+	l := &configLinter{positions: map[string]keyPosition{}}
+	if format == "yaml" || format == "yml" {
+		sch.readYAMLPositions(l.positions, lintConfigName, data)
+	}
+	if err = sch.migrateConfig(lintConfigName, settings); err != nil {
+		l.add(SeverityError, DiagnosticMigration, "", err.Error())
+		return l.diagnostics
+	}
+	if len(sch.profileFlag) > 0 {
+		delete(settings, profilesKey)
+	}
+	sch.lintKeyAliases(l, settings)
+	for _, b := range sch.bindings {
+		if b.noConfig && hasSetting(settings, b.key) {
+			l.add(SeverityError, DiagnosticInvalidValue, b.key,
+				fmt.Sprintf("config param %q cannot be set in config file", b.key))
+			deleteSetting(settings, b.key)
+		}
+	}
+	settings = sch.withoutBootstrapKeys(settings)
+	settings = sch.withoutDefaultOnlyKeys(settings)
+	for _, k := range sch.unknownKeys(settings) {
+		l.add(SeverityError, DiagnosticUnknownKey, k.Key, k.Error())
+		deleteSetting(settings, k.Key)
+	}
+	errs := sch.normalizePercents(settings)
+	errs = append(errs, sch.checkOneOf(settings)...)
+	errs = append(errs, sch.checkRanges(settings)...)
+	for _, err := range errs {
+		l.addFieldError(DiagnosticInvalidValue, err)
+	}
+	// The tenant configs are decoded into their own structs
+	for _, g := range sch.tenantGroups {
+		for _, name := range g.names {
+			key := joinKey(g.prefix, name)
+			sub := nestedSettings(settings, strings.ToLower(key))
+			if sub == nil {
+				continue
+			}
+			tenant := reflect.New(g.result.Type().Elem().Elem()).Interface()
+			if err = decode(sub, tenant, true, sch.decoderOptions()...); err != nil {
+				for _, err := range sch.decodeErrors(err, settings, nil) {
+					var ferr *FieldError
+					if errors.As(err, &ferr) {
+						ferr.Key = joinKey(strings.ToLower(key), ferr.Key)
+					}
+					l.addFieldError(DiagnosticTypeMismatch, err)
+				}
+			}
+		}
+		deleteSetting(settings, g.prefix)
+	}
+	result := reflect.New(reflect.TypeOf(sch.resultStruct).Elem()).Interface()
+	if err = decode(settings, result, true, sch.decoderOptions()...); err != nil {
+		for _, err := range sch.decodeErrors(err, settings, errs) {
+			l.addFieldError(DiagnosticTypeMismatch, err)
+		}
+	}
+	if !l.hasErrors() {
+		sch.lintValidators(l, settings)
+	}
+	return l.diagnostics
+}
+
+// lintValidators decodes the settings over the defaults into a copy
+// of the result struct and reports the failures of the struct validator
+// and the cross-field validators.
+func (sch *SnakeCharmer) lintValidators(l *configLinter, settings map[string]interface{}) {
+	if sch.structValidator == nil && len(sch.crossFieldValidators) == 0 {
+		return
+	}
+	merged := map[string]interface{}{}
+	for _, b := range sch.bindings {
+		value := b.defaultValue
+		for _, d := range sch.defaultValues {
+			if d.key == b.key {
+				value = d.value
+			}
+		}
+		if value != nil {
+			setSetting(merged, b.key, value)
+		}
+	}
+	merged = sch.withoutBootstrapKeys(merged)
+	for _, g := range sch.tenantGroups {
+		deleteSetting(merged, g.prefix)
+	}
+	mergeSettings(merged, settings)
+	result := reflect.New(reflect.TypeOf(sch.resultStruct).Elem()).Interface()
+	if err := decode(merged, result, true, sch.decoderOptions()...); err != nil {
+		l.addFieldError(DiagnosticTypeMismatch, sch.redactError(err, settings))
+		return
+	}
+	err := sch.validateStruct(result)
+	if err == nil {
+		err = sch.validateCrossFields(result)
+	}
+	var cerr *ConfigErrors
+	if errors.As(err, &cerr) {
+		for _, err := range cerr.Errors {
+			l.addFieldError(DiagnosticInvalidValue, err)
+		}
+	} else if err != nil {
+		l.addFieldError(DiagnosticInvalidValue, err)
+	}
+}
+
+// lintKeyAliases reports the legacy keys of the renamed ones
+// and moves their values the same way as applyKeyAliases does.
+func (sch *SnakeCharmer) lintKeyAliases(l *configLinter, settings map[string]interface{}) {
+	for _, a := range sch.aliasedKeys() {
+		old, name := settingsParent(settings, a.old)
+		if old == nil {
+			continue
+		}
+		value, ok := old[name]
+		if !ok {
+			continue
+		}
+		deleteSetting(settings, a.old)
+		if hasSetting(settings, a.new) {
+			l.add(SeverityWarning, DiagnosticDeprecatedKey, a.old,
+				fmt.Sprintf("config key %q is deprecated and ignored, since %q is set", a.old, a.new))
+			continue
+		}
+		setSetting(settings, a.new, value)
+		l.add(SeverityWarning, DiagnosticDeprecatedKey, a.old,
+			fmt.Sprintf("config key %q is deprecated, use %q instead", a.old, a.new))
+		// The problems of the value are reported at the legacy key
+		if pos, ok := l.positions[strings.ToLower(a.old)]; ok {
+			l.positions[strings.ToLower(a.new)] = pos
+		}
+	}
+}
+
+// hasSetting returns true if the settings have the dotted key.
+func hasSetting(settings map[string]interface{}, key string) bool {
+	parent, name := settingsParent(settings, key)
+	if parent == nil {
+		return false
+	}
+	_, ok := parent[name]
+	return ok
+}
+
+// configLinter collects the diagnostics of LintConfig.
+type configLinter struct {
+	// The positions of the values in the YAML config
+	positions   map[string]keyPosition
+	diagnostics []Diagnostic
+}
+
+func (l *configLinter) add(severity DiagnosticSeverity, code, key, msg string) {
+	d := Diagnostic{Severity: severity, Code: code, Key: key, Message: msg}
+	if pos, ok := l.positions[strings.ToLower(key)]; ok {
+		d.Line, d.Column = pos.line, pos.column
+	}
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// hasErrors returns true if any of the diagnostics is an error.
+func (l *configLinter) hasErrors() bool {
+	for _, d := range l.diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// addFieldError adds the diagnostic of FieldError, or of the plain error.
+func (l *configLinter) addFieldError(code string, err error) {
+	var ferr *FieldError
+	if !errors.As(err, &ferr) {
+		l.add(SeverityError, code, "", err.Error())
+		return
+	}
+	l.add(SeverityError, code, ferr.Key, ferr.Err.Error())
+}
@@ -0,0 +1,128 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LintConfig(t *testing.T) {
+	result := &testErrorsStruct{}
+	var warnings []string
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithKeyAlias("concurrency", "workers"),
+		WithWarnFunc(func(msg string) { warnings = append(warnings, msg) }),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	f := func(data, format string, expected ...string) []Diagnostic {
+		t.Helper()
+		diags := charmer.LintConfig([]byte(data), format)
+		var actual []string
+		for _, d := range diags {
+			actual = append(actual, d.String())
+		}
+		require.Equal(t, expected, actual)
+		return diags
+	}
+
+	f("workers: 4\nlevel: debug\n", "yaml")
+	f(`{"workers": 4, "db": {"port": 5433}}`, "json")
+
+	diags := f(`concurrency: many
+level: verbose
+max-cpu: 50%
+db:
+  port: x
+  verbos: true
+`, "yaml",
+		`1:14: warning: config key "concurrency" is deprecated, use "workers" instead (deprecated-key)`,
+		`6:11: error: unknown config key "db.verbos" (did you mean "db.verbose"?) (unknown-key)`,
+		`2:8: error: invalid value "verbose" of "level": must be one of debug, info (invalid-value)`,
+		`1:14: error: cannot parse 'workers' as int: strconv.ParseInt: parsing "many": invalid syntax (type-mismatch)`,
+		`5:9: error: cannot parse 'db.port' as int: strconv.ParseInt: parsing "x": invalid syntax (type-mismatch)`,
+	)
+	require.Equal(t, "workers", diags[3].Key)
+	data, err := json.Marshal(diags[1])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"severity": "error", "code": "unknown-key", "key": "db.verbos",
+		"message": "unknown config key \"db.verbos\" (did you mean \"db.verbose\"?)", "line": 6, "column": 11}`, string(data))
+
+	// The later documents win
+	f("workers: 4\n---\nworkers: x\n", "yaml",
+		`3:10: error: cannot parse 'workers' as int: strconv.ParseInt: parsing "x": invalid syntax (type-mismatch)`)
+
+	f("workers: [", "yaml", `error: while reading config "config": While parsing config: yaml: line 1: did not find expected node content (syntax)`)
+	f("workers = 4", "ini2", `error: unsupported config format "ini2" (syntax)`)
+
+	// Neither the settings nor the result struct are touched
+	require.Empty(t, warnings)
+	require.Equal(t, 0, result.Workers)
+	require.EqualValues(t, 8, charmer.RedactedSettings()["workers"])
+}
+
+func Test_LintConfigValidators(t *testing.T) {
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testCrossFieldStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithStructValidator(testValidatorFunc(func(result interface{}) ([]FieldViolation, error) {
+			if cfg := result.(*testCrossFieldStruct); cfg.Limits.Error > 100 {
+				return []FieldViolation{{Field: "Limits.Error", Message: `failed the "max=100" validation`}}, nil
+			}
+			return nil, nil
+		})),
+		WithCrossFieldValidator(func(cfg interface{}) error {
+			if c := cfg.(*testCrossFieldStruct); c.Limits.Warn > c.Limits.Error {
+				return &FieldError{Key: "limits.warn", Err: errors.New("must not exceed limits.error")}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	f := func(data string, expected ...string) {
+		t.Helper()
+		var actual []string
+		for _, d := range charmer.LintConfig([]byte(data), "yaml") {
+			actual = append(actual, d.String())
+		}
+		require.Equal(t, expected, actual)
+	}
+
+	f("limits:\n  warn: 85\n")
+	// The value is checked against the default of limits.error
+	f("limits:\n  warn: 95\n",
+		`2:9: error: invalid value of "limits.warn": must not exceed limits.error (invalid-value)`)
+	f("limits:\n  error: 200\n",
+		`2:10: error: invalid value of "limits.error": failed the "max=100" validation (invalid-value)`)
+	// The validators are not run on the config having errors
+	f("limits:\n  warn: 95\n  error: x\n",
+		`3:10: error: cannot parse 'limits.error' as int: strconv.ParseInt: parsing "x": invalid syntax (type-mismatch)`)
+}
@@ -0,0 +1,60 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// debug emits the debug event of the binding trace with the logger
+// set with WithLogger, it does nothing if there is none.
+func (sch *SnakeCharmer) debug(msg string, args ...any) {
+	if sch.logger == nil {
+		return
+	}
+	sch.logger.Debug(msg, args...)
+}
+
+// debugBinding emits the debug events of the result struct field
+// registered by AddFlags: the flag, the ENV vars and the default value.
+// The default values of secret fields are redacted.
+func (sch *SnakeCharmer) debugBinding(b fieldBinding, flag string) {
+	if sch.logger == nil {
+		return
+	}
+	if len(flag) > 0 {
+		sch.debug("flag registered", slog.String("key", b.key), slog.String("flag", "--"+flag))
+	}
+	if len(b.envs) > 0 {
+		sch.debug("env bound", slog.String("key", b.key), slog.String("envs", strings.Join(b.envs, ",")))
+	}
+	var value interface{} = b.defaultValue
+	if b.secret {
+		value = redacted
+	}
+	sch.debug("default set", slog.String("key", b.key), slog.Any("value", value))
+}
+
+// debugMergedKeys emits the debug event per key of the settings
+// merged in from the source, e.g. the config file.
+func (sch *SnakeCharmer) debugMergedKeys(settings map[string]interface{}, source SourceKind, args ...any) {
+	if sch.logger == nil {
+		return
+	}
+	for _, key := range flattenKeys("", settings) {
+		sch.debug("key merged", append([]any{slog.String("key", key), slog.String("source", source.String())}, args...)...)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testLoggerStruct struct {
+	Workers  int    `snakecharmer:"workers" env:"TEST_LOGGER_WORKERS" usage:"Number of workers to run" default:"8"`
+	Password string `snakecharmer:"password,secret" usage:"Password" default:"s3cr3t"`
+	Log      struct {
+		Level string `snakecharmer:"level,noflag" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_WithLogger(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("password: pa55w0rd\nlog:\n  level: debug\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testLoggerStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+		WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	require.Equal(t, []string{
+		`level=DEBUG msg="flag registered" key=workers flag=--workers`,
+		`level=DEBUG msg="env bound" key=workers envs=TEST_LOGGER_WORKERS`,
+		`level=DEBUG msg="default set" key=workers value=8`,
+		`level=DEBUG msg="flag registered" key=password flag=--password`,
+		`level=DEBUG msg="default set" key=password value=***`,
+		`level=DEBUG msg="default set" key=log.level value=info`,
+		`level=DEBUG msg="config file chosen" path=` + config,
+		`level=DEBUG msg="key merged" key=log.level source="config file" file=` + config,
+		`level=DEBUG msg="key merged" key=password source="config file" file=` + config,
+	}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+	require.NotContains(t, out.String(), "pa55w0rd")
+	require.NotContains(t, out.String(), "s3cr3t")
+
+	require.Error(t, WithLogger(nil)(&SnakeCharmer{}))
+}
@@ -0,0 +1,102 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// isScalarMap returns true if the type is a map keyed by strings holding
+// the builtin bool, numeric or string values, e.g. map[string]bool.
+func isScalarMap(t reflect.Type) bool {
+	if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String || len(t.Elem().PkgPath()) > 0 {
+		return false
+	}
+	switch t.Elem().Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// mapValue is the pflag.Value of the map field the pflag has no flag for,
+// e.g. map[string]bool or map[string]float64. It is set like the
+// StringToString flag, e.g. --features=beta=true,alpha=false,
+// the repeated flags add the entries.
+type mapValue struct {
+	value   reflect.Value
+	changed bool
+}
+
+// newMapValue returns the mapValue holding the copy of the map.
+func newMapValue(rv reflect.Value) *mapValue {
+	value := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		value.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return &mapValue{value: value}
+}
+
+// Set parses the comma separated key=value entries. The first call
+// replaces the default entries, the next ones add to them.
+func (v *mapValue) Set(s string) error {
+	t := v.value.Type()
+	entries := reflect.MakeMap(t)
+	for _, entry := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("%q must be formatted as key=value", entry)
+		}
+		elem, err := parseDefaultValue(t.Elem(), strings.TrimSpace(value), ",")
+		if err != nil {
+			return err
+		}
+		entries.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)).Convert(t.Key()), elem)
+	}
+	if !v.changed {
+		v.value = entries
+		v.changed = true
+		return nil
+	}
+	iter := entries.MapRange()
+	for iter.Next() {
+		v.value.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return nil
+}
+
+// String returns the entries sorted by key in the pflag format, e.g. "[a=true,b=false]".
+func (v *mapValue) String() string {
+	entries := make([]string, 0, v.value.Len())
+	iter := v.value.MapRange()
+	for iter.Next() {
+		entries = append(entries, fmt.Sprintf("%v=%v", iter.Key().Interface(), iter.Value().Interface()))
+	}
+	sort.Strings(entries)
+	return "[" + strings.Join(entries, ",") + "]"
+}
+
+// Type returns the type name in the pflag style, e.g. "stringToBool".
+func (v *mapValue) Type() string {
+	kind := v.value.Type().Elem().Kind().String()
+	return "stringTo" + strings.ToUpper(kind[:1]) + kind[1:]
+}
@@ -0,0 +1,92 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testMapFlagStruct struct {
+	RateLimits map[string]int     `snakecharmer:"rate-limits" usage:"Rate limits per route" default:"api=100,web=10"`
+	Quotas     map[string]int64   `snakecharmer:"quotas" usage:"Quotas" default:"disk=1024"`
+	Features   map[string]bool    `snakecharmer:"features" usage:"Feature gates" default:"beta=false"`
+	Ratios     map[string]float64 `snakecharmer:"ratios" usage:"Ratios"`
+}
+
+func Test_MapFlags(t *testing.T) {
+	f := func(config string, args ...string) (*testMapFlagStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testMapFlagStruct{Ratios: map[string]float64{"canary": 0.1}}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			return result, cmd, err
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// The defaults
+	result, cmd, err := f("")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"api": 100, "web": 10}, result.RateLimits)
+	require.Equal(t, map[string]int64{"disk": 1024}, result.Quotas)
+	require.Equal(t, map[string]bool{"beta": false}, result.Features)
+	require.Equal(t, map[string]float64{"canary": 0.1}, result.Ratios)
+	require.Equal(t, "stringToInt", cmd.Flag("rate-limits").Value.Type())
+	require.Equal(t, "stringToInt64", cmd.Flag("quotas").Value.Type())
+	require.Equal(t, "stringToBool", cmd.Flag("features").Value.Type())
+	require.Equal(t, "[beta=false]", cmd.Flag("features").DefValue)
+	require.Equal(t, "stringToFloat64", cmd.Flag("ratios").Value.Type())
+
+	// The flags override the config file, the repeated flags add entries
+	result, _, err = f("rate-limits:\n  api: 50\nfeatures:\n  beta: true\n",
+		"--rate-limits", "api=200", "--quotas", "disk=2048,mem=512",
+		"--features", "alpha=true", "--features", "beta=false",
+		"--ratios", "canary=0.25")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"api": 200}, result.RateLimits)
+	require.Equal(t, map[string]int64{"disk": 2048, "mem": 512}, result.Quotas)
+	require.Equal(t, map[string]bool{"alpha": true, "beta": false}, result.Features)
+	require.Equal(t, map[string]float64{"canary": 0.25}, result.Ratios)
+
+	// The config file sets the map
+	result, _, err = f("features:\n  beta: true\n")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"beta": true}, result.Features)
+
+	// The invalid values are rejected by the flag
+	_, _, err = f("", "--features", "beta=maybe")
+	require.ErrorContains(t, err, "maybe")
+	_, _, err = f("", "--ratios", "canary")
+	require.ErrorContains(t, err, "key=value")
+}
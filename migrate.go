@@ -0,0 +1,59 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+
+	"github.com/spf13/cast"
+)
+
+// configVersionKey is the top-level config key of the config format version,
+// see WithMigration.
+const configVersionKey = "config_version"
+
+// MigrationFunc upgrades the raw config settings from one version
+// of the config format to the next one in place.
+type MigrationFunc func(settings map[string]interface{}) error
+
+// migrateConfig upgrades the raw settings of the config source
+// by the migrations set with WithMigration, starting with the version
+// in the config_version key (0 if it is not set). The config_version key
+// is removed from the settings, unless the result struct has the field of it.
+func (sch *SnakeCharmer) migrateConfig(name string, settings map[string]interface{}) error {
+	if len(sch.migrations) == 0 {
+		return nil
+	}
+	version := 0
+	if value, ok := settings[configVersionKey]; ok {
+		v, err := cast.ToIntE(value)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid %s %v in %s", configVersionKey, value, name)
+		}
+		version = v
+	}
+	for ; sch.migrations[version] != nil; version++ {
+		if err := sch.migrations[version](settings); err != nil {
+			return fmt.Errorf("while migrating %s from version %d: %w", name, version, err)
+		}
+	}
+	delete(settings, configVersionKey)
+	for _, b := range sch.bindings {
+		if b.key == configVersionKey {
+			settings[configVersionKey] = version
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testMigrateStruct struct {
+	Workers int `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Log     struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_Migration(t *testing.T) {
+	// Version 0 had the flat "threads" and "log_level" keys,
+	// version 1 renamed "threads" to "workers",
+	// version 2 moved "log_level" to "log.level".
+	migrations := []CharmingOption{
+		WithMigration(0, func(settings map[string]interface{}) error {
+			if v, ok := settings["threads"]; ok {
+				settings["workers"] = v
+				delete(settings, "threads")
+			}
+			return nil
+		}),
+		WithMigration(1, func(settings map[string]interface{}) error {
+			if v, ok := settings["log_level"]; ok {
+				settings["log"] = map[string]interface{}{"level": v}
+				delete(settings, "log_level")
+			}
+			return nil
+		}),
+	}
+	f := func(config string, opts ...CharmingOption) (*testMigrateStruct, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testMigrateStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("threads: 4\nlog_level: debug\n", migrations...)
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "debug", result.Log.Level)
+
+	result, err = f("config_version: 1\nworkers: 2\nlog_level: warn\n", migrations...)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+
+	result, err = f("config_version: 2\nworkers: 2\nlog:\n  level: error\n", migrations...)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, "error", result.Log.Level)
+
+	_, err = f("config_version: x\n", migrations...)
+	require.Error(t, err)
+	_, err = f("threads: 4\n", WithMigration(0, func(map[string]interface{}) error {
+		return fmt.Errorf("broken")
+	}))
+	require.ErrorContains(t, err, "from version 0: broken")
+	// Without migrations the config_version key is not known
+	_, err = f("config_version: 2\nworkers: 2\n")
+	require.Error(t, err)
+
+	_, err = NewSnakeCharmer(append(migrations, WithMigration(1, func(map[string]interface{}) error { return nil }))...)
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithMigration(-1, func(map[string]interface{}) error { return nil }))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+)
+
+var (
+	ipType           = reflect.TypeOf(net.IP{})
+	ipNetType        = reflect.TypeOf(net.IPNet{})
+	hardwareAddrType = reflect.TypeOf(net.HardwareAddr{})
+)
+
+// isNetType returns true if the type is net.IP, net.IPNet or net.HardwareAddr.
+// Such fields are registered as IP, IPNet and string flags respectively
+// rather than slices or nested structs.
+func isNetType(t reflect.Type) bool {
+	return t == ipType || t == ipNetType || t == hardwareAddrType
+}
+
+// parseNetValue parses the text into the value of the net type t.
+// The empty text gives the zero value.
+func parseNetValue(t reflect.Type, text string) (reflect.Value, error) {
+	if len(text) == 0 {
+		return reflect.Zero(t), nil
+	}
+	switch t {
+	case ipType:
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return reflect.Value{}, fmt.Errorf("invalid IP address %q", text)
+		}
+		return reflect.ValueOf(ip), nil
+	case ipNetType:
+		_, ipNet, err := net.ParseCIDR(text)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(*ipNet), nil
+	case hardwareAddrType:
+		mac, err := net.ParseMAC(text)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(mac), nil
+	}
+	return reflect.Value{}, fmt.Errorf("BUG: unsupported net type %s", t.String())
+}
+
+// formatNetValue returns the text representation of the net value,
+// the zero value is formatted as the empty string.
+func formatNetValue(rv reflect.Value) string {
+	switch v := rv.Interface().(type) {
+	case net.IP:
+		if len(v) == 0 {
+			return ""
+		}
+		return v.String()
+	case net.IPNet:
+		if v.IP == nil {
+			return ""
+		}
+		return v.String()
+	case net.HardwareAddr:
+		return v.String()
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+// applyNetSetting adds the IP, IPNet or string flag for the net field
+// and sets the default viper config param to its text representation.
+func (sch *SnakeCharmer) applyNetSetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) {
+	switch v := rv.Interface().(type) {
+	case net.IP:
+		fs.IP(name, v, help)
+	case net.IPNet:
+		fs.IPNet(name, v, help)
+	default:
+		fs.String(name, formatNetValue(rv), help)
+	}
+	sch.backend.SetDefault(name, formatNetValue(rv))
+}
+
+// netHookFunc returns a mapstructure.DecodeHookFunc that converts strings
+// (e.g. ENV var values or config params) into net.IP, net.IPNet
+// and net.HardwareAddr or pointers to them, failing on invalid input.
+// The empty string gives the zero value, so pointers to net.IP
+// and net.HardwareAddr stay nil.
+func netHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		target := t
+		if target.Kind() == reflect.Ptr {
+			target = target.Elem()
+		}
+		if f.Kind() != reflect.String || !isNetType(target) {
+			return data, nil
+		}
+		v, err := parseNetValue(target, reflect.ValueOf(data).String())
+		if err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testNetStruct struct {
+	BindAddr  *net.IP          `snakecharmer:"bind-addr" env:"TEST_NET_BIND_ADDR" usage:"Addr to bind" default:"0.0.0.0"`
+	Gateway   *net.IP          `snakecharmer:"gateway" usage:"Gateway addr"`
+	Trusted   net.IPNet        `snakecharmer:"trusted" env:"TEST_NET_TRUSTED" usage:"Trusted network" default:"10.0.0.0/8"`
+	Allowed   *net.IPNet       `snakecharmer:"allowed" usage:"Allowed network"`
+	Interface net.HardwareAddr `snakecharmer:"mac" env:"TEST_NET_MAC" usage:"MAC address"`
+}
+
+func Test_NetFields(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("allowed: 192.168.0.0/16\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(args ...string) (*testNetStruct, error) {
+		t.Helper()
+		result := &testNetStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.Equal(t, "ip", cmd.PersistentFlags().Lookup("bind-addr").Value.Type())
+		require.Equal(t, "ipNet", cmd.PersistentFlags().Lookup("trusted").Value.Type())
+		if err = cmd.ParseFlags(args); err != nil {
+			return nil, err
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0", result.BindAddr.String())
+	require.Nil(t, result.Gateway)
+	require.Equal(t, "10.0.0.0/8", result.Trusted.String())
+	require.Equal(t, "192.168.0.0/16", result.Allowed.String())
+	require.Nil(t, result.Interface)
+
+	t.Setenv("TEST_NET_TRUSTED", "172.16.0.0/12")
+	t.Setenv("TEST_NET_MAC", "00:00:5e:00:53:01")
+	result, err = f("--bind-addr", "127.0.0.1", "--gateway", "::1")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", result.BindAddr.String())
+	require.Equal(t, "::1", result.Gateway.String())
+	require.Equal(t, "172.16.0.0/12", result.Trusted.String())
+	require.Equal(t, "00:00:5e:00:53:01", result.Interface.String())
+
+	// Invalid flag values fail on parsing
+	_, err = f("--bind-addr", "localhost")
+	require.Error(t, err)
+
+	// Invalid ENV var values fail on decoding
+	t.Setenv("TEST_NET_BIND_ADDR", "300.0.0.1")
+	_, err = f()
+	require.Error(t, err)
+}
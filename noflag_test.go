@@ -0,0 +1,135 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testNoFlagStruct struct {
+	Workers int               `snakecharmer:"workers" usage:"Number of workers" default:"4"`
+	APIKey  string            `snakecharmer:"api-key,noflag,secret" env:"TEST_NOFLAG_API_KEY" usage:"API key"`
+	Routes  map[string]string `snakecharmer:"routes" flag:"-" usage:"Routes" default:"a=b"`
+}
+
+func Test_NoFlag(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("routes:\n  /api: backend:8080\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(config string, args ...string) (*testNoFlagStruct, *cobra.Command) {
+		t.Helper()
+		result := &testNoFlagStruct{}
+		cmd := &cobra.Command{}
+		opts := []CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}
+		if len(config) > 0 {
+			opts = append(opts, WithConfigFilePath(config))
+		}
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result, cmd
+	}
+
+	result, cmd := f("")
+	require.NotNil(t, cmd.PersistentFlags().Lookup("workers"))
+	require.Nil(t, cmd.PersistentFlags().Lookup("api-key"))
+	require.Nil(t, cmd.PersistentFlags().Lookup("routes"))
+	require.Equal(t, "", result.APIKey)
+	require.Equal(t, map[string]string{"a": "b"}, result.Routes)
+
+	t.Setenv("TEST_NOFLAG_API_KEY", "s3cr3t")
+	result, _ = f(config)
+	require.Equal(t, "s3cr3t", result.APIKey)
+	require.Equal(t, map[string]string{"/api": "backend:8080"}, result.Routes)
+
+	cmd = &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testNoFlagStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Error(t, cmd.ParseFlags([]string{"--api-key", "s3cr3t"}))
+}
+
+type testSourceMarkersStruct struct {
+	Workers  int    `snakecharmer:"workers" env:"TEST_MARKERS_WORKERS" usage:"Number of workers" default:"4"`
+	Token    string `snakecharmer:"token" env:"-" usage:"Token"`
+	Password string `snakecharmer:"password" env:"TEST_MARKERS_PASSWORD" config:"-" usage:"Password"`
+}
+
+func Test_NoEnvNoConfig(t *testing.T) {
+	f := func(config string, args ...string) (*testSourceMarkersStruct, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testSourceMarkersStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+			WithAutomaticEnv(nil),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	// Neither the env tag nor the derived name is bound
+	t.Setenv("TOKEN", "from-env")
+	t.Setenv("TEST_MARKERS_PASSWORD", "s3cr3t")
+	result, err := f("token: from-config\n")
+	require.NoError(t, err)
+	require.Equal(t, "from-config", result.Token)
+	require.Equal(t, "s3cr3t", result.Password)
+
+	result, err = f("", "--token", "from-flag", "--password", "from-flag")
+	require.NoError(t, err)
+	require.Equal(t, "from-flag", result.Token)
+	require.Equal(t, "from-flag", result.Password)
+
+	_, err = f("password: s3cr3t\n")
+	require.EqualError(t, err, `config param "password" cannot be set in config file`)
+}
@@ -0,0 +1,109 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Optional is the field value which tells "unset" from the zero value,
+// e.g. Optional[bool] tells whether false is set explicitly:
+//
+//	type Config struct {
+//		Compress snakecharmer.Optional[bool] `snakecharmer:"compress" usage:"Compress the output"`
+//	}
+//
+// The value is left unset unless the flag, ENV var, config file or
+// default tag sets it. The flag of Optional[bool] may be passed without
+// the value, e.g. --compress. The empty text and null leave it unset.
+// T is a bool, numeric, string or time.Duration type.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+// Some returns the Optional holding the value.
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{value: value, set: true}
+}
+
+// Get returns the value and true if it is set.
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set
+}
+
+// IsSet returns true if the value is set.
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// ValueOr returns the value if it is set, or the fallback otherwise.
+func (o Optional[T]) ValueOr(fallback T) T {
+	if o.set {
+		return o.value
+	}
+	return fallback
+}
+
+// String returns the text of the value, or "" if it is unset.
+func (o Optional[T]) String() string {
+	if !o.set {
+		return ""
+	}
+	return fmt.Sprint(o.value)
+}
+
+// Set parses the text into the value, the empty text unsets it.
+// It implements pflag.Value.
+func (o *Optional[T]) Set(text string) error {
+	if len(text) == 0 {
+		*o = Optional[T]{}
+		return nil
+	}
+	t := reflect.TypeOf(&o.value).Elem()
+	var rv reflect.Value
+	var err error
+	if t == durationType {
+		var d time.Duration
+		d, err = time.ParseDuration(text)
+		rv = reflect.ValueOf(d)
+	} else {
+		rv, err = parseDefaultValue(t, text, ",")
+	}
+	if err != nil {
+		return err
+	}
+	o.value, o.set = rv.Interface().(T), true
+	return nil
+}
+
+// Type returns the name of the value type, e.g. "bool". It implements pflag.Value.
+func (o *Optional[T]) Type() string {
+	t := reflect.TypeOf(&o.value).Elem()
+	if t == durationType {
+		return "duration"
+	}
+	return t.Kind().String()
+}
+
+// IsBoolFlag returns true for Optional[bool], so its flag
+// may be passed without the value, e.g. --compress.
+func (o *Optional[T]) IsBoolFlag() bool {
+	return reflect.TypeOf(&o.value).Elem().Kind() == reflect.Bool
+}
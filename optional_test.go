@@ -0,0 +1,98 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testOptionalStruct struct {
+	Compress Optional[bool]          `snakecharmer:"compress" env:"TEST_OPTIONAL_COMPRESS" usage:"Compress the output"`
+	Workers  Optional[int]           `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Timeout  Optional[time.Duration] `snakecharmer:"timeout" usage:"Timeout"`
+	Name     *Optional[string]       `snakecharmer:"name" usage:"Name"`
+}
+
+func Test_Optional(t *testing.T) {
+	f := func(config string, args ...string) (*testOptionalStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testOptionalStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			return result, cmd, err
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// Unset unless the default tag is set
+	result, cmd, err := f("")
+	require.NoError(t, err)
+	require.False(t, result.Compress.IsSet())
+	require.True(t, result.Compress.ValueOr(true))
+	require.Equal(t, Some(8), result.Workers)
+	require.False(t, result.Timeout.IsSet())
+	require.False(t, result.Name.IsSet())
+	require.Equal(t, "bool", cmd.Flag("compress").Value.Type())
+	require.Equal(t, "duration", cmd.Flag("timeout").Value.Type())
+	require.Equal(t, "8", cmd.Flag("workers").DefValue)
+
+	// The explicit false and zero values are set
+	result, _, err = f("compress: false\nworkers: 0\ntimeout: 0s\nname: \"\"\n")
+	require.NoError(t, err)
+	require.Equal(t, Some(false), result.Compress)
+	require.Equal(t, Some(0), result.Workers)
+	require.Equal(t, Some(time.Duration(0)), result.Timeout)
+	require.False(t, result.Name.IsSet())
+
+	// The flags take precedence, the bool flag is passed without the value
+	result, _, err = f("compress: false\ntimeout: 5s\n", "--compress", "--name", "main")
+	require.NoError(t, err)
+	require.Equal(t, Some(true), result.Compress)
+	require.Equal(t, Some(5*time.Second), result.Timeout)
+	value, ok := result.Name.Get()
+	require.True(t, ok)
+	require.Equal(t, "main", value)
+
+	t.Setenv("TEST_OPTIONAL_COMPRESS", "false")
+	result, _, err = f("")
+	require.NoError(t, err)
+	require.Equal(t, Some(false), result.Compress)
+
+	// The invalid values are rejected
+	_, _, err = f("", "--workers", "many")
+	require.ErrorContains(t, err, "many")
+	_, _, err = f("workers: many\n")
+	require.ErrorContains(t, err, "workers")
+}
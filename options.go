@@ -15,13 +15,20 @@
 package snakecharmer
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"reflect"
 	"strings"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -35,8 +42,9 @@ type CharmingOption func(*SnakeCharmer) error
 // WithResultStruct sets the pointer to the struct that will contain
 // the decoded config parameters.
 // REQUIRED
-// NOTE: the struct must be initialized with default values
-// which will be used as flags
+// NOTE: the struct fields must be either initialized with default values
+// or have the default tag (see WithDefaultTagName), these values
+// will be used as flag defaults
 func WithResultStruct(rs interface{}) CharmingOption {
 	timeType := reflect.TypeOf(time.Time{})
 	v := reflect.ValueOf(rs)
@@ -90,6 +98,144 @@ func WithEnvTagName(s string) CharmingOption {
 	}
 }
 
+// WithEnvPrefix sets the prefix prepended to ENV var names,
+// e.g. WithEnvPrefix("MYAPP") makes `env:"WORKERS"` bound to MYAPP_WORKERS.
+func WithEnvPrefix(prefix string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.envPrefix = strings.TrimSpace(prefix)
+		return nil
+	}
+}
+
+// WithEnvDisabled makes snakecharmer ignore the environment entirely:
+// no field is bound to an ENV var, env tags are ignored, and the ACL token
+// of Consul is not taken from CONSUL_HTTP_TOKEN.
+// The resulting priority of values is: flags, config file, defaults.
+func WithEnvDisabled(disabled bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.envDisabled = disabled
+		if len(sch.remoteProvider) > 0 {
+			// Recreate the source looking up the Consul token
+			sch.remote = nil
+		}
+		return nil
+	}
+}
+
+// WithDotEnvFile sets the dotenv file, e.g. ".env", KEY=VALUE pairs
+// from which are loaded as ENV var values. They take precedence over
+// the config file and providers, but the ENV vars set in the real
+// environment take precedence over them. A missing dotenv file is ignored.
+func WithDotEnvFile(path string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.dotEnvFile = strings.TrimSpace(path)
+		return nil
+	}
+}
+
+// WithFileValues makes snakecharmer read the value of the field
+// from the file when the value is "@" followed by the file path,
+// e.g. "@/run/secrets/db_password" ("@@" escapes the literal "@"),
+// or when the sibling key with the "_file" or "-file" suffix is set,
+// e.g. "password_file: /run/secrets/db_password" for "password".
+// The trailing newline of the file content is trimmed.
+// This defaults to false.
+func WithFileValues(enable bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.fileValues = enable
+		return nil
+	}
+}
+
+// WithKubernetesSecretsDir sets the directory, e.g. "/var/run/secrets/app",
+// every file of which holds the value of the field, as the projected
+// Kubernetes Secret or ConfigMap volumes do. The file name is either
+// the config key, e.g. "db.password", or the ENV var name of the field,
+// e.g. "DB_PASSWORD". The values take precedence over the config file
+// and providers, but ENV vars and flags take precedence over them.
+// A missing directory is ignored.
+func WithKubernetesSecretsDir(dir string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.secretsDir = strings.TrimSpace(dir)
+		return nil
+	}
+}
+
+// WithStateFile sets the file, e.g. "/var/lib/myapp/state.json",
+// the effective values of the fields with the persist tag option,
+// e.g. `mapstructure:"project,persist"`, are saved into after every
+// successful UnmarshalExact. The saved values are used as defaults
+// by the next run, i.e. flags, ENV vars and config files take precedence.
+// The state file is not written by the dry runs, i.e. the check config flag
+// (see WithCheckConfigFlag) and the "config validate" command. The state file
+// is written in plaintext, so the persist tag option panics for secret fields
+// and the fields with the ref tag, and the values holding references,
+// e.g. "ssm:///app/project", are not saved.
+func WithStateFile(path string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.stateFile = strings.TrimSpace(path)
+		return nil
+	}
+}
+
+// WithSliceSeparator sets the separator used for parsing slice values from
+// strings, e.g. with WithSliceSeparator(";") TEST_UPSTREAMS="a;b;c" yields
+// three elements. It is used for the default tags of slice fields as well.
+// This defaults to ",".
+func WithSliceSeparator(sep string) CharmingOption {
+	if len(sep) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid slice separator: %q", sep)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.sliceSep = sep
+		return nil
+	}
+}
+
+// WithMapSeparators sets the separators used for parsing map values from
+// strings, e.g. ENV vars: entrySep separates map entries, pairSep separates
+// keys from values. E.g. with WithMapSeparators(";", ":")
+// TEST_LOG_DST="error:/var/log/e.log;debug:/var/log/d.log".
+// These default to "," and "=".
+func WithMapSeparators(entrySep, pairSep string) CharmingOption {
+	if len(entrySep) == 0 || len(pairSep) == 0 || entrySep == pairSep {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid map separators: %q, %q", entrySep, pairSep)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.mapEntrySep = entrySep
+		sch.mapPairSep = pairSep
+		return nil
+	}
+}
+
+// WithAutomaticEnv binds every field to an ENV var derived from its config key
+// with the replacer and uppercased, e.g. with strings.NewReplacer(".", "__")
+// "log.limit" is bound to LOG__LIMIT. The fields with env tag are bound to both
+// ENV vars, the one from the env tag takes precedence.
+// If replacer is nil, dots and dashes are replaced with underscores.
+func WithAutomaticEnv(replacer *strings.Replacer) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.automaticEnv = true
+		sch.envKeyReplacer = replacer
+		return nil
+	}
+}
+
+// WithDerivedEnvNames makes the fields without env tag bound to ENV vars
+// derived from their config keys, e.g. "log.limit.warn" is bound to
+// LOG_LIMIT_WARN, or MYAPP_LOG_LIMIT_WARN if WithEnvPrefix("MYAPP") is set.
+// The replacer set by WithAutomaticEnv is used for deriving the names as well.
+func WithDerivedEnvNames(on bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.derivedEnvNames = on
+		return nil
+	}
+}
+
 // WithFlagHelpTagName sets the tag name that snakecharmer reads for flag usage help.
 // This defaults to "usage"
 func WithFlagHelpTagName(s string) CharmingOption {
@@ -105,6 +251,44 @@ func WithFlagHelpTagName(s string) CharmingOption {
 	}
 }
 
+// WithDefaultTagName sets the tag name that snakecharmer reads for field default values.
+// The tag value is parsed according to the field type, e.g.
+// `default:"8080"` for int, `default:"80,443"` for []int,
+// `default:"error=/var/log/error.log"` for map[string]string.
+// If set, the tag value takes precedence over the value the field
+// was initialized with.
+// This defaults to "default"
+func WithDefaultTagName(s string) CharmingOption {
+	tag := strings.TrimSpace(s)
+	if len(tag) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid default tag name: %q", s)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.defaultTagName = tag
+		return nil
+	}
+}
+
+// WithTagDialect sets the struct tag syntax snakecharmer reads,
+// so structs already tagged for envconfig or kong can be used as is.
+// See TagDialectSnakeCharmer, TagDialectEnvconfig, TagDialectKong.
+// This defaults to TagDialectSnakeCharmer
+func WithTagDialect(d TagDialect) CharmingOption {
+	switch d {
+	case TagDialectSnakeCharmer, TagDialectEnvconfig, TagDialectKong:
+		return func(sch *SnakeCharmer) error {
+			sch.tagDialect = d
+			return nil
+		}
+	default:
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid tag dialect: %s", d)
+		}
+	}
+}
+
 // WithConfigFileType sets the type that will be passed to viper.SetConfigType().
 // REQUIRED in case if the config file does not have the extension or
 // if the config file extension is not in the list of supported extensions.
@@ -126,6 +310,11 @@ func WithConfigFileType(s string) CharmingOption {
 // WithConfigFilePath sets the config file path that will be passed to
 // viper.AddConfigPath() if path is a directory,
 // or to viper.SetConfigFile() if path is a file.
+// The path "-" reads the config of the config file type from stdin.
+// The path can also be an http(s) URL, the document is fetched and merged
+// like a file, its format is taken from the Content-Type, the URL path
+// extension or the config file type. See WithConfigURLTimeout,
+// WithConfigURLRetries and WatchConfigURLs.
 // This defaults to "", which means config file won't be used.
 func WithConfigFilePath(s string) CharmingOption {
 	return func(sch *SnakeCharmer) error {
@@ -134,6 +323,216 @@ func WithConfigFilePath(s string) CharmingOption {
 	}
 }
 
+// WithConfigBytes adds the config document of the given format, e.g. "yaml",
+// e.g. the embedded (go:embed) defaults. The config documents are merged
+// in order before the config files, i.e. the config files override them.
+// The format defaults to the config file type if empty.
+func WithConfigBytes(data []byte, format string) CharmingOption {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if len(format) > 0 && !fileExtSupported(format) {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("unsupported config format %q", format)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		doc := configDocument{data: data, format: format}
+		if len(doc.format) == 0 {
+			doc.format = sch.configFileType
+		}
+		sch.configDocs = append(sch.configDocs, doc)
+		return nil
+	}
+}
+
+// WithConfigReader works like WithConfigBytes, but reads the config document
+// from the reader. The reader is read once, when the option is applied.
+// Note, the config file path "-", e.g. `--config -`, reads the config from stdin.
+func WithConfigReader(r io.Reader, format string) CharmingOption {
+	if r == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("config reader is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("while reading config: %w", err)
+		}
+		return WithConfigBytes(data, format)(sch)
+	}
+}
+
+// WithConfigURLTimeout sets the timeout of fetching the config file path
+// which is an http(s) URL, see WithConfigFilePath.
+// This defaults to 10s.
+func WithConfigURLTimeout(timeout time.Duration) CharmingOption {
+	if timeout <= 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("config URL timeout must be positive: %s", timeout)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.configURLTimeout = timeout
+		return nil
+	}
+}
+
+// WithConfigURLRetries sets the number of retries of fetching the config
+// file path which is an http(s) URL, and the delay between them.
+// Only network errors and 5xx/429 responses are retried.
+// This defaults to 0, which means no retries.
+func WithConfigURLRetries(retries int, delay time.Duration) CharmingOption {
+	if retries < 0 || delay < 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("config URL retries or delay is negative: %d, %s", retries, delay)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.configURLRetries = retries
+		sch.configURLRetryDelay = delay
+		return nil
+	}
+}
+
+// WithMigration adds the migration of the config format from the version
+// to the next one. The migrations are applied to the raw settings of every
+// config source, before they are merged and decoded, one by one starting
+// with the version in the top-level config_version key. The config without
+// the config_version key is of version 0. The config_version key is removed
+// from the settings, unless the result struct has the field of it, which is
+// set to the version the config is upgraded to.
+func WithMigration(fromVersion int, fn MigrationFunc) CharmingOption {
+	if fromVersion < 0 || fn == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid config migration from version %d", fromVersion)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		if sch.migrations == nil {
+			sch.migrations = map[int]MigrationFunc{}
+		}
+		if sch.migrations[fromVersion] != nil {
+			return fmt.Errorf("config migration from version %d is already set", fromVersion)
+		}
+		sch.migrations[fromVersion] = fn
+		return nil
+	}
+}
+
+// WithKeyAlias makes the values supplied under the legacy config key or flag,
+// e.g. "old.name", populate the field of the renamed key, e.g. "new.name",
+// with a deprecation warning (see WithWarnFunc). The value of the renamed
+// key wins if both are set. The alias of a nested struct key covers
+// all its fields. The `alias:"old.name"` tag of the field does the same.
+// Note, it must be set before AddFlags for the flags to be aliased.
+func WithKeyAlias(oldKey, newKey string) CharmingOption {
+	oldKey = strings.ToLower(strings.TrimSpace(oldKey))
+	newKey = strings.ToLower(strings.TrimSpace(newKey))
+	if len(oldKey) == 0 || len(newKey) == 0 || oldKey == newKey {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid key alias %q of %q", oldKey, newKey)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.keyAliases = append(sch.keyAliases, keyAlias{old: oldKey, new: newKey})
+		return nil
+	}
+}
+
+// WithStrictness sets how UnmarshalExact and Reload handle the config keys
+// that do not exist in the result struct: StrictnessStrict fails
+// with UnknownKeysError, StrictnessWarn skips them with a warning
+// (see WithWarnFunc), StrictnessIgnore skips them silently.
+// This defaults to StrictnessStrict.
+func WithStrictness(s Strictness) CharmingOption {
+	if s < StrictnessStrict || s > StrictnessIgnore {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid strictness %s", s)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.strictness = s
+		return nil
+	}
+}
+
+// WithWarnFunc sets the function the warnings are reported with,
+// e.g. about the unknown config keys skipped (see WithStrictness).
+// This defaults to nil, which means log.Printf of the standard logger.
+func WithWarnFunc(fn func(msg string)) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.warnFunc = fn
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the binding trace, the debug events
+// of every flag registered, ENV var bound, default value set, config file
+// chosen and key merged, e.g. slog.New(slog.NewTextHandler(os.Stderr,
+// &slog.HandlerOptions{Level: slog.LevelDebug})). It answers "why is
+// this value X?". The default values of secret fields are redacted,
+// the values merged in are not logged at all.
+func WithLogger(logger *slog.Logger) CharmingOption {
+	if logger == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("logger <*slog.Logger> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.logger = logger
+		return nil
+	}
+}
+
+// WithConfigFileRequired sets whether the missing config file is an error.
+// Disable it when the config file path is the built-in default location,
+// so the missing file is silently skipped, and keep it enabled when
+// the path is supplied by the user, e.g. with the --config flag.
+// The error wraps ErrConfigFileNotFound.
+// This defaults to true.
+func WithConfigFileRequired(required bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.configFileRequired = required
+		return nil
+	}
+}
+
+// WithStandardConfigPaths makes snakecharmer search the config file
+// with the config file base name (see WithConfigFileBaseName)
+// in the standard config directories of the application in order:
+// $XDG_CONFIG_HOME/app, ~/.config/app, /etc/app and the working directory
+// (%APPDATA%\app and the working directory on Windows). The first one found
+// is used unless the config file path is set (see WithConfigFilePath).
+// If there is none, the config file is not used.
+func WithStandardConfigPaths(app string) CharmingOption {
+	app = strings.TrimSpace(app)
+	if len(app) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("application name is an empty string")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.standardConfigApp = app
+		return nil
+	}
+}
+
+// WithConfigFilePaths sets the config file paths that are merged in order,
+// later files winning, e.g. WithConfigFilePaths("/etc/app/base.yaml", "./override.yaml").
+// A path can be a file or a directory, the same way as in WithConfigFilePath.
+// The config file path set with WithConfigFilePath is merged last.
+func WithConfigFilePaths(paths ...string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.configFilePaths = make([]string, 0, len(paths))
+		for _, path := range paths {
+			if path = strings.TrimSpace(path); len(path) > 0 {
+				sch.configFilePaths = append(sch.configFilePaths, path)
+			}
+		}
+		return nil
+	}
+}
+
 // WithConfigFileBaseName sets the base name of the config file (without extension)
 // that will be passed to viper.SetConfigName().
 // REQUIRED in case of the config file path is a directory, otherwise ignored.
@@ -164,6 +563,24 @@ func WithDecoderConfigOption(opt viper.DecoderConfigOption) CharmingOption {
 	}
 }
 
+// WithDecodeHook adds the mapstructure.DecodeHookFunc converting
+// the config values while decoding them into the result struct,
+// e.g. the strings into the custom types. The hooks are run in the order
+// they are added, before the built-in ones, which convert strings
+// into time.Duration, slices, maps, net types, ByteSize and
+// encoding.TextUnmarshaler implementations.
+func WithDecodeHook(hook mapstructure.DecodeHookFunc) CharmingOption {
+	if hook == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("decode hook is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.decodeHooks = append(sch.decodeHooks, hook)
+		return nil
+	}
+}
+
 // WithIgnoreUntaggedFields allows to ignore all struct fields without
 // explicit fieldTagName, comparable to `mapstructure:"-"` as default behaviour.
 // See WithFieldTagName
@@ -181,6 +598,7 @@ func WithIgnoreUntaggedFields(on bool) CharmingOption {
 }
 
 // WithViper sets the pointer to the viper.Viper instance
+// the default backend is based on, it is unused if WithBackend is set.
 // This defaults to viper.New()
 func WithViper(viper *viper.Viper) CharmingOption {
 	return func(sch *SnakeCharmer) error {
@@ -189,11 +607,716 @@ func WithViper(viper *viper.Viper) CharmingOption {
 	}
 }
 
+// WithBackend sets the config store the values are merged into,
+// e.g. koanfbackend.New() from github.com/asokolov365/snakecharmer/koanfbackend.
+// No viper instance is created for the values then, but the config files
+// are still read and written with viper's codecs, so viper stays
+// a dependency, see Backend.
+// This defaults to the one based on the viper instance (see WithViper).
+func WithBackend(b Backend) CharmingOption {
+	if b == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("backend is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.backend = b
+		return nil
+	}
+}
+
 // WithCobraCommand sets the pointer to the cobra.Command instance
-// REQUIRED
+// REQUIRED unless WithFlagSet or WithGoFlagSet is used
 func WithCobraCommand(cmd *cobra.Command) CharmingOption {
 	return func(sch *SnakeCharmer) error {
 		sch.cmd = cmd
 		return nil
 	}
 }
+
+// WithFlagSet sets the pflag.FlagSet the flags are added to,
+// so snakecharmer can be used without cobra. The cobra command
+// is not required then, see WithCobraCommand.
+func WithFlagSet(fs *pflag.FlagSet) CharmingOption {
+	if fs == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("flagset <*pflag.FlagSet> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.flagSet = fs
+		return nil
+	}
+}
+
+// WithFilesystem sets the filesystem the config files are looked up
+// and read from instead of the OS one (see WithConfigFilePath), e.g.
+// the embed.FS or fstest.MapFS, for hermetic tests or the configs
+// shipped with the binary. The config file paths are taken relative
+// to its root, e.g. "/etc/app/config.yaml" is "etc/app/config.yaml".
+// The config URLs, stdin and the files of the other sources, e.g. the
+// dotenv file or the secrets dir, are read as before.
+func WithFilesystem(fsys fs.FS) CharmingOption {
+	if fsys == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("filesystem <fs.FS> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.fsys = fsys
+		return nil
+	}
+}
+
+// WithEnvLookup sets the function looking up the ENV vars instead of
+// os.LookupEnv, e.g. the one reading from a map in tests, so they do not
+// have to modify the process environment and can run in parallel.
+// The ENV vars of the fields are not bound to viper then, snakecharmer
+// merges their values in with the same precedence instead.
+// The ACL token of Consul (see WithRemoteConfig) is looked up with it too.
+func WithEnvLookup(lookup func(key string) (string, bool)) CharmingOption {
+	if lookup == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("env lookup <func(key string) (string, bool)> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.envLookup = lookup
+		if len(sch.remoteProvider) > 0 {
+			// Recreate the source looking up the Consul token
+			sch.remote = nil
+		}
+		return nil
+	}
+}
+
+// WithPlan sets the plan of the result struct compiled by CompilePlan,
+// so AddFlags uses the struct tags checked by it rather than reading them.
+// NewSnakeCharmer fails if the result struct is of another type,
+// or the tag settings, e.g. WithFieldTagName, differ from the ones
+// the plan is compiled with.
+func WithPlan(plan *Plan) CharmingOption {
+	if plan == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("plan <*Plan> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.plan = plan
+		return nil
+	}
+}
+
+// WithStructValidator sets the validator run on the result struct after
+// every unmarshal, e.g. validation.New() checking the validate tags
+// (see the validation sub-package). The violations are returned as
+// FieldError of the config keys of the fields, and the previous config
+// is restored, like for the subscribers rejecting it (see Subscribe).
+// It is called holding the charmer lock, with the same constraints
+// on the charmer methods it may call as the subscribers.
+func WithStructValidator(v StructValidator) CharmingOption {
+	if v == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("struct validator <StructValidator> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.structValidator = v
+		return nil
+	}
+}
+
+// WithCrossFieldValidator adds the validator of the constraints between
+// the fields of the result struct, e.g. "the warn limit must not exceed
+// the error limit" or "tls.cert and tls.key must both be set". It is called
+// with the pointer to the result struct after every unmarshal, once the fields
+// are decoded and pass the struct validator (see WithStructValidator).
+// The errors are attached to the config keys when returned as FieldError,
+// e.g. &FieldError{Key: "tls.key", Err: errors.New("must be set along with tls.cert")},
+// several of them can be returned with errors.Join. On error the previous config
+// is restored, like for the subscribers rejecting it (see Subscribe).
+// The validators are called by the unmarshal pipeline holding the charmer
+// lock, so like the subscribers they may call the read-only accessors,
+// e.g. WasSet, FilesUsed or PrecedenceOrder, while calling the other methods
+// taking the lock, e.g. Set or Reload, deadlocks.
+func WithCrossFieldValidator(fn func(cfg interface{}) error) CharmingOption {
+	if fn == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("cross-field validator <func(cfg interface{}) error> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.crossFieldValidators = append(sch.crossFieldValidators, fn)
+		return nil
+	}
+}
+
+// WithUsageTemplate sets the text/template of the suffix appended
+// to the flag usage help, DefaultUsageTemplate by default, e.g.
+// " (env: TEST_WORKERS, config: workers)". The template is executed
+// with UsageData, the join function is strings.Join.
+// The empty template disables the suffix.
+func WithUsageTemplate(text string) CharmingOption {
+	if len(text) == 0 {
+		return func(sch *SnakeCharmer) error {
+			sch.usageTemplate = nil
+			return nil
+		}
+	}
+	tmpl, err := parseUsageTemplate(text)
+	if err != nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid usage template: %w", err)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.usageTemplate = tmpl
+		return nil
+	}
+}
+
+// WithGoFlagSet makes AddFlags add the flags to the standard library
+// flag.FlagSet, so snakecharmer can be used without cobra and pflag.
+// The flags are defined on an internal pflag.FlagSet and exported
+// to the given flagset, e.g. "-log.level debug" or "--log.level=debug".
+// The shorthands of count flags, e.g. "-v", are exported as well.
+func WithGoFlagSet(fs *flag.FlagSet) CharmingOption {
+	if fs == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("flagset <*flag.FlagSet> is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.goFlagSet = fs
+		sch.flagSet = pflag.NewFlagSet(fs.Name(), pflag.ContinueOnError)
+		return nil
+	}
+}
+
+// WithLocalFlags makes AddFlags add the flags to the local flagset
+// of the cobra command (cmd.Flags()) rather than the persistent one
+// (cmd.PersistentFlags()), so they are not inherited by subcommands.
+// See AddFlagsTo for adding the flags to an arbitrary pflag.FlagSet.
+// This defaults to false.
+func WithLocalFlags(enable bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.localFlags = enable
+		return nil
+	}
+}
+
+// WithStrictFlags makes AddFlags panic if the flag of a field
+// is already defined on the command, instead of reusing it.
+// This defaults to false.
+func WithStrictFlags(enable bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.strictFlags = enable
+		return nil
+	}
+}
+
+// WithProvider adds a Provider that supplies config values
+// from an external source, e.g. a secret backend.
+// Provided values are merged at the config file priority.
+func WithProvider(p Provider) CharmingOption {
+	if p == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("provider is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.providers = append(sch.providers, p)
+		return nil
+	}
+}
+
+// WithRemoteConfig makes snakecharmer read the config document
+// from the remote key/value store, e.g.
+// WithRemoteConfig("consul", "127.0.0.1:8500", "myapp/config.yaml").
+// The document format is taken from the key extension or the config
+// file type (see WithConfigFileType). It is merged over the config files,
+// i.e. flags > env > remote > config file > defaults.
+// See WatchRemoteConfig for reloading the config on changes.
+// Supported providers: "consul" and "etcd3" (via the etcd v3 gRPC gateway).
+// The endpoint scheme defaults to http, or https if WithRemoteTLSConfig is set.
+func WithRemoteConfig(provider, endpoint, path string) CharmingOption {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if !isRemoteProvider(provider) {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("unsupported remote config provider %q", provider)
+		}
+	}
+	if len(strings.TrimSpace(endpoint)) == 0 || len(strings.TrimSpace(path)) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("remote config endpoint or path is an empty string")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.remoteProvider = provider
+		sch.remoteEndpoint = strings.TrimSpace(endpoint)
+		sch.remotePath = strings.TrimSpace(path)
+		sch.remote = nil
+		return nil
+	}
+}
+
+// WithRemoteTLSConfig sets the TLS config of the client of the remote
+// config store, e.g. the client certificates and the CA of etcd,
+// see WithRemoteConfig.
+func WithRemoteTLSConfig(cfg *tls.Config) CharmingOption {
+	if cfg == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("remote TLS config is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.remoteTLS = cfg
+		if len(sch.remoteProvider) > 0 {
+			// Recreate the client
+			sch.remote = nil
+		}
+		return nil
+	}
+}
+
+// WithRemotePollInterval makes WatchRemoteConfig poll the remote config
+// with the given interval instead of watching it, the config is reloaded
+// when the document changes. This defaults to 0, which means watching.
+func WithRemotePollInterval(interval time.Duration) CharmingOption {
+	if interval < 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("remote poll interval is negative: %s", interval)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.remotePollInterval = interval
+		return nil
+	}
+}
+
+// WithRemoteSource sets the custom RemoteSource the config document
+// is read from, like WithRemoteConfig does. The document format
+// is the config file type, see WithConfigFileType.
+func WithRemoteSource(src RemoteSource) CharmingOption {
+	if src == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("remote source is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.remoteProvider = ""
+		sch.remotePath = ""
+		sch.remote = src
+		return nil
+	}
+}
+
+// WithValueResolver makes snakecharmer resolve the config values,
+// which are strings starting with the prefix, e.g. "ssm://", with the resolver
+// before decoding. The values of all sources are resolved, so the precedence
+// is preserved, e.g. a flag overrides the reference in the config file.
+// The config file path with the prefix is resolved into the whole config document.
+// The ref tag, e.g. `ref:"ssm:///app/db/password"`, sets the reference
+// of the field at the provider priority. See WithSSM and WithSecretsManager.
+func WithValueResolver(prefix string, r ValueResolver) CharmingOption {
+	if len(prefix) == 0 || r == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("value resolver prefix is an empty string or resolver is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.addResolver(prefix, r)
+		return nil
+	}
+}
+
+// WithSSM makes snakecharmer resolve the "ssm://" references,
+// e.g. "ssm:///app/db/password", as AWS SSM Parameter Store parameters,
+// see WithValueResolver.
+func WithSSM(client SSMClient) CharmingOption {
+	if client == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("SSM client is nil")
+		}
+	}
+	return WithValueResolver(ssmPrefix, &ssmResolver{client: client})
+}
+
+// WithSecretsManager makes snakecharmer resolve the "aws-sm://" references,
+// e.g. "aws-sm://app/db" or "aws-sm://app/db#password" for the field
+// of the JSON secret, as AWS Secrets Manager secrets, see WithValueResolver.
+func WithSecretsManager(client SecretsManagerClient) CharmingOption {
+	if client == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("secrets manager client is nil")
+		}
+	}
+	return WithValueResolver(awsSecretsManagerPrefix, &secretsManagerResolver{client: client})
+}
+
+// WithExecResolver makes snakecharmer resolve the "exec:" references,
+// e.g. "exec:/usr/bin/get-token --json", as the stdout of the command
+// without the trailing newline, see WithValueResolver. The command is run
+// without a shell, the arguments can be quoted. The command is killed
+// after the timeout, 0 means no timeout. Only the allowed commands,
+// e.g. "/usr/bin/get-token", can be run, at least one must be given.
+// Note, only the values of flags, ENV vars, defaults, overrides and ref tags
+// are resolved. The references in config files, remote configs, providers,
+// dotenv files, secrets dirs and the state file are rejected, so the ones
+// able to write them cannot run commands.
+func WithExecResolver(timeout time.Duration, allowed ...string) CharmingOption {
+	if timeout < 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("exec resolver timeout is negative: %s", timeout)
+		}
+	}
+	if len(allowed) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("exec resolver requires at least one allowed command")
+		}
+	}
+	return WithValueResolver(execPrefix, &execResolver{timeout: timeout, allowed: allowed})
+}
+
+// WithVault makes snakecharmer resolve the "vault:" references,
+// e.g. "vault:secret/data/app#api_key" or the `vault:"secret/data/app#api_key"`
+// tag, as HashiCorp Vault secrets, see WithValueResolver.
+func WithVault(client VaultClient) CharmingOption {
+	if client == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("vault client is nil")
+		}
+	}
+	return WithValueResolver(vaultPrefix, &vaultResolver{client: client})
+}
+
+// WithTenants instantiates the same config struct under the prefix for every
+// tenant name, e.g. with WithTenants("tenants", []string{"a", "b"}, &tenants),
+// where tenants is map[string]*UpstreamConfig, AddFlags adds flags
+// like --tenants.a.workers and --tenants.b.workers (ENV vars are bound
+// if WithDerivedEnvNames or WithAutomaticEnv is enabled), and UnmarshalExact
+// decodes the "tenants.a" and "tenants.b" config sections into tenants["a"]
+// and tenants["b"]. The prefix must not overlap with the result struct keys.
+func WithTenants(prefix string, names []string, result interface{}) CharmingOption {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Map ||
+		v.Elem().Type().Key().Kind() != reflect.String ||
+		v.Elem().Type().Elem().Kind() != reflect.Ptr ||
+		v.Elem().Type().Elem().Elem().Kind() != reflect.Struct {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("tenants result must be a pointer to a map of struct pointers. Got <%T>", result)
+		}
+	}
+	prefix = strings.TrimSpace(prefix)
+	if len(prefix) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("tenants prefix is an empty string")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.tenantGroups = append(sch.tenantGroups, tenantGroup{
+			prefix: prefix,
+			names:  append([]string(nil), names...),
+			result: v.Elem(),
+		})
+		return nil
+	}
+}
+
+// WithBootstrap enables the two-stage load for providers needing
+// their own config, e.g. credentials of a secret backend.
+// The bootstrap struct (a pointer to a struct, tagged the same way
+// as the result struct, its keys must not overlap with the result struct keys)
+// gets its flags and ENV vars registered by AddFlags.
+// UnmarshalExact decodes it first from flags, ENV vars, config files and defaults,
+// then calls newProviders, which creates the providers configured by it,
+// and loads the main config with these providers in addition to
+// the ones set with WithProvider.
+//
+//	bootstrap := &struct {
+//		VaultAddr  string `mapstructure:"vault-addr" env:"VAULT_ADDR" usage:"Vault address"`
+//		VaultToken string `mapstructure:"vault-token,secret" env:"VAULT_TOKEN" usage:"Vault token"`
+//	}{}
+//	charmer, err := NewSnakeCharmer(
+//		WithResultStruct(result),
+//		WithCobraCommand(cmd),
+//		WithBootstrap(bootstrap, func() ([]Provider, error) {
+//			return []Provider{newVaultProvider(bootstrap.VaultAddr, bootstrap.VaultToken)}, nil
+//		}),
+//	)
+func WithBootstrap(bootstrap interface{}, newProviders func() ([]Provider, error)) CharmingOption {
+	v := reflect.ValueOf(bootstrap)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("bootstrap struct must be a pointer to a struct. Got <%T>", bootstrap)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.bootstrap = bootstrap
+		sch.newProviders = newProviders
+		return nil
+	}
+}
+
+// WithContext ties the background goroutines, i.e. the refresh of expiring
+// provided values and the SIGHUP handler, to the given context:
+// they stop when it is done. Close cancels it as well.
+// This defaults to context.Background().
+func WithContext(ctx context.Context) CharmingOption {
+	if ctx == nil {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("context is nil")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		if sch.cancel != nil {
+			sch.cancel()
+		}
+		sch.ctx, sch.cancel = context.WithCancel(ctx)
+		return nil
+	}
+}
+
+// WithRefreshWindow sets how long before the expiration of provided values
+// (see ProvidedValue.TTL) the reload pipeline is run to refresh them.
+// This defaults to 1 minute
+func WithRefreshWindow(d time.Duration) CharmingOption {
+	if d <= 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid refresh window: %s", d)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.refreshWindow = d
+		return nil
+	}
+}
+
+// WithRefreshErrorHandler sets the function that is called when the refresh
+// of expiring provided values fails. It receives the keys that are about
+// to expire and the reload error, so the application can react before
+// the credentials go stale. The refresh is retried until the values expire.
+// The handler is called after the failed refresh is done, so it may call
+// Close, e.g. to shut down the application, which does not wait for it.
+func WithRefreshErrorHandler(f func(keys []string, err error)) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.refreshErrorHandler = f
+		return nil
+	}
+}
+
+// WithStrictEmptyConfig makes UnmarshalExact return ErrEmptyConfig
+// if the config file is empty or whitespace-only.
+// By default, such a config file is treated as no config.
+func WithStrictEmptyConfig(strict bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.strictEmptyConfig = strict
+		return nil
+	}
+}
+
+// WithFreeze makes the configuration frozen after the first successful
+// UnmarshalExact, i.e. any further Set() is rejected. This protects
+// against accidental runtime mutation of the configuration state.
+// Options of a frozen configuration can still be changed via Reload().
+func WithFreeze(on bool) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.freeze = on
+		return nil
+	}
+}
+
+// WithConfigLimits sets the limits enforced on the loaded config
+// (file size, nesting depth, slice and map lengths) before decoding.
+// If any limit is exceeded, UnmarshalExact returns *LimitError.
+// This defaults to no limits.
+func WithConfigLimits(limits ConfigLimits) CharmingOption {
+	if limits.MaxFileSize < 0 || limits.MaxDepth < 0 || limits.MaxLen < 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid config limits: %+v", limits)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.limits = limits
+		return nil
+	}
+}
+
+// WithConfigPatchFlag makes AddFlags register the flag with the given name,
+// e.g. "config-patch", that passes a JSON patch (RFC 6902), e.g.
+// --config-patch='[{"op":"replace","path":"/log/level","value":"debug"}]'
+// The patch is applied to the config merged from all the sources
+// (flags, ENV vars, config file, defaults) before decoding.
+// This defaults to "", which means the flag is not registered.
+func WithConfigPatchFlag(name string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.configPatchFlag = strings.TrimSpace(name)
+		return nil
+	}
+}
+
+// WithPrecedence sets the precedence of the layers the config values come from,
+// from the highest priority to the lowest one, e.g.
+//
+//	WithPrecedence(SourceFlag, SourceConfigFile, SourceEnv, SourceDefault)
+//
+// makes the config files win over the ENV vars. The layers are SourceFlag,
+// SourceEnv, SourceConfigFile and SourceDefault, the omitted ones are ignored.
+// The config file layer includes all the sources merged into the config,
+// i.e. remote configs, providers, dotenv files and secrets dirs,
+// keeping their order. The overrides (see WithOverrides and WithSetFlag)
+// and JSON patches stay on top. This defaults to the flag, ENV var,
+// config file and default order. The backend must implement LayeredBackend.
+func WithPrecedence(layers ...SourceKind) CharmingOption {
+	seen := map[SourceKind]bool{}
+	for _, layer := range layers {
+		switch layer {
+		case SourceFlag, SourceEnv, SourceConfigFile, SourceDefault:
+		default:
+			return func(sch *SnakeCharmer) error {
+				return fmt.Errorf("invalid precedence layer %q, must be one of: flag, env, config file, default", layer)
+			}
+		}
+		if seen[layer] {
+			return func(sch *SnakeCharmer) error {
+				return fmt.Errorf("precedence layer %q is repeated", layer)
+			}
+		}
+		seen[layer] = true
+	}
+	if len(layers) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("no precedence layers are set")
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.precedence = append([]SourceKind{}, layers...)
+		return nil
+	}
+}
+
+// WithDefaults sets the default values of the config keys, e.g.
+//
+//	WithDefaults(map[string]interface{}{
+//		"workers": 4,
+//		"log":     map[string]interface{}{"level": "info"},
+//	})
+//
+// They take precedence over the default tags and the initialized values
+// of the result struct fields, but the flag help shows the latter ones.
+// The keys may be dotted, e.g. "log.level", and may have no fields yet,
+// e.g. the forward-compatible keys. Such keys are not decoded into
+// the result struct and are not reported as unknown, their values are
+// available in the config settings, e.g. RedactedSettings.
+// The values of repeated calls are merged, the last one wins.
+func WithDefaults(values map[string]interface{}) CharmingOption {
+	defaults := flattenValues("", values, SourceDefault)
+	for _, d := range defaults {
+		if !validSetKey(d.key) {
+			return func(sch *SnakeCharmer) error {
+				return fmt.Errorf("invalid default key %q", d.key)
+			}
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.defaultValues = append(sch.defaultValues, defaults...)
+		return nil
+	}
+}
+
+// WithOverrides forces the config values at the top of the precedence stack,
+// above flags, JSON patches and the --set flag (see WithSetFlag), e.g.
+//
+//	WithOverrides(map[string]interface{}{
+//		"workers": 1,
+//		"log":     map[string]interface{}{"level": "debug"},
+//	})
+//
+// The keys may be dotted, e.g. "log.level", the nested maps are merged
+// with the other sources rather than replacing them. It is useful
+// for the embedding applications, e.g. tests, to set the values
+// without faking flags or ENV vars. The values of repeated calls
+// are merged, the last one wins.
+func WithOverrides(values map[string]interface{}) CharmingOption {
+	overrides := flattenValues("", values, SourceOverride)
+	for _, o := range overrides {
+		if !validSetKey(o.key) {
+			return func(sch *SnakeCharmer) error {
+				return fmt.Errorf("invalid override key %q", o.key)
+			}
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.overrideValues = append(sch.overrideValues, overrides...)
+		return nil
+	}
+}
+
+// WithSetFlag makes AddFlags register the repeatable flag with the given name,
+// e.g. "set", that sets the config values above flags and JSON patches,
+// only the WithOverrides values win over them, e.g.
+//
+//	--set log.level=debug --set workers=16 --set hosts={a,b,c}
+//
+// The key is dot-notated, the value is converted to the field type.
+// The values of the keys without fields, e.g. of map fields, are coerced
+// to bools, integers and nil (for null), lists are passed in braces.
+// This defaults to "", which means the flag is not registered.
+func WithSetFlag(name string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.setFlag = strings.TrimSpace(name)
+		return nil
+	}
+}
+
+// WithProfileFlag makes AddFlags register the flag with the given name,
+// e.g. "profile", selecting the profile from the top-level "profiles" map
+// of the config file, e.g.
+//
+//	log:
+//	  level: info
+//	profiles:
+//	  dev:
+//	    log:
+//	      level: debug
+//
+// The selected profile's subtree is deep-merged over the base config keys.
+// The "profiles" map itself is never decoded into the result struct.
+// This defaults to "", which means the flag is not registered.
+func WithProfileFlag(name string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.profileFlag = strings.TrimSpace(name)
+		return nil
+	}
+}
+
+// WithCheckConfigFlag makes AddFlags register the boolean flag with the given name,
+// e.g. "check-config". When the flag is set, the command loads and validates
+// the config, prints the report and exits with 0 if the config is valid,
+// or 1 otherwise, without running the command's Run function.
+// This defaults to "", which means the flag is not registered.
+func WithCheckConfigFlag(name string) CharmingOption {
+	return func(sch *SnakeCharmer) error {
+		sch.checkConfigFlag = strings.TrimSpace(name)
+		return nil
+	}
+}
+
+// WithYAMLDocumentSelector makes snakecharmer use only the document
+// of a multi-document YAML config file having the top-level key
+// with the given value, e.g. WithYAMLDocumentSelector("kind", "server").
+// The selector key itself is removed from the document before decoding.
+// By default, all the documents are merged in order, later documents winning.
+func WithYAMLDocumentSelector(key, value string) CharmingOption {
+	k := strings.TrimSpace(key)
+	if len(k) == 0 {
+		return func(sch *SnakeCharmer) error {
+			return fmt.Errorf("invalid YAML document selector key: %q", key)
+		}
+	}
+	return func(sch *SnakeCharmer) error {
+		sch.yamlSelectorKey = k
+		sch.yamlSelectorValue = value
+		return nil
+	}
+}
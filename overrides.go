@@ -0,0 +1,191 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyValue is the value of the config key from the source,
+// e.g. the override of --set key=value, or WithDefaults.
+type keyValue struct {
+	value  interface{}
+	key    string
+	source SourceKind
+}
+
+// loadOverrides collects the overrides in the order they are applied,
+// i.e. the last one wins: the --set entries, then the WithOverrides values.
+func (sch *SnakeCharmer) loadOverrides() error {
+	sch.overrides = nil
+	if err := sch.loadSetFlag(); err != nil {
+		return err
+	}
+	sch.overrides = append(sch.overrides, sch.overrideValues...)
+	return nil
+}
+
+// loadSetFlag collects the overrides passed with the --set flag.
+func (sch *SnakeCharmer) loadSetFlag() error {
+	if len(sch.setFlag) == 0 {
+		return nil
+	}
+	flag := sch.flags().Lookup(sch.setFlag)
+	if flag == nil || !flag.Changed {
+		return nil
+	}
+	entries, err := sch.flags().GetStringArray(sch.setFlag)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || !validSetKey(key) {
+			return fmt.Errorf("invalid --%s entry %q, expected key=value", sch.setFlag, entry)
+		}
+		sch.overrides = append(sch.overrides, keyValue{key: key, value: parseSetValue(sch.keyType(key), value), source: SourceSet})
+	}
+	return nil
+}
+
+// keyType returns the type of the field of the key, or the value type
+// of the map field holding the key. It returns nil if it is unknown.
+func (sch *SnakeCharmer) keyType(key string) reflect.Type {
+	for _, b := range sch.bindings {
+		if b.key == key {
+			return b.typ
+		}
+		if b.typ.Kind() == reflect.Map && strings.HasPrefix(key, b.key+".") &&
+			!strings.Contains(key[len(b.key)+1:], ".") && b.typ.Elem().Kind() != reflect.Interface {
+			return b.typ.Elem()
+		}
+	}
+	return nil
+}
+
+// flattenValues returns the values of the leaf keys
+// of the nested map sorted by key, e.g. "log.level" of
+// {"log": {"level": "debug"}}. The keys may be dotted as well.
+func flattenValues(prefix string, values map[string]interface{}, source SourceKind) []keyValue {
+	result := []keyValue{}
+	for name, value := range values {
+		key := joinKey(prefix, strings.ToLower(strings.TrimSpace(name)))
+		if m, ok := normalizeValue(value).(map[string]interface{}); ok && len(m) > 0 {
+			result = append(result, flattenValues(key, m, source)...)
+			continue
+		}
+		result = append(result, keyValue{key: key, value: normalizeValue(value), source: source})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+	return result
+}
+
+// validSetKey returns true if the dotted key has no empty segments.
+func validSetKey(key string) bool {
+	for _, k := range strings.Split(key, ".") {
+		if len(k) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSetValue parses the value of the --set entry. The list is passed
+// in braces, e.g. {a,b,c}. The value of the known type is converted to it.
+// Otherwise, e.g. for the keys of map[string]interface{} fields,
+// true/false, integers and null are coerced.
+func parseSetValue(typ reflect.Type, s string) interface{} {
+	if len(s) >= 2 && s[0] == '{' && s[len(s)-1] == '}' {
+		var elem reflect.Type
+		if typ != nil && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			elem = typ.Elem()
+		}
+		items := []interface{}{}
+		if inner := s[1 : len(s)-1]; len(inner) > 0 {
+			for _, item := range strings.Split(inner, ",") {
+				items = append(items, parseSetValue(elem, strings.TrimSpace(item)))
+			}
+		}
+		return items
+	}
+	if typ != nil {
+		return convertSetValue(typ, s)
+	}
+	switch s {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// Keep the values with leading zeros as strings, e.g. "007"
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && (n == 0 || !strings.HasPrefix(strings.TrimPrefix(s, "-"), "0")) {
+		return n
+	}
+	return s
+}
+
+// applyOverrides sets the overridden values in the settings.
+func (sch *SnakeCharmer) applyOverrides(settings map[string]interface{}) {
+	for _, o := range sch.overrides {
+		setSetting(settings, o.key, o.value)
+	}
+}
+
+// overrideSource returns the source of the last override of the key,
+// or of its parent or nested keys.
+func (sch *SnakeCharmer) overrideSource(key string) (SourceKind, bool) {
+	key = strings.ToLower(key)
+	for i := len(sch.overrides) - 1; i >= 0; i-- {
+		k := sch.overrides[i].key
+		if k == key || strings.HasPrefix(key, k+".") || strings.HasPrefix(k, key+".") {
+			return sch.overrides[i].source, true
+		}
+	}
+	return SourceDefault, false
+}
+
+// convertSetValue converts the value to the builtin bool or numeric type.
+// Other values, e.g. of time.Duration, and the invalid ones are kept as is,
+// the decode hooks convert them to the field type or report the error.
+func convertSetValue(typ reflect.Type, s string) interface{} {
+	if len(typ.PkgPath()) > 0 {
+		return s
+	}
+	var value interface{}
+	var err error
+	switch typ.Kind() {
+	case reflect.Bool:
+		value, err = strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err = strconv.ParseInt(s, 0, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err = strconv.ParseUint(s, 0, 64)
+	case reflect.Float32, reflect.Float64:
+		value, err = strconv.ParseFloat(s, 64)
+	default:
+		return s
+	}
+	if err != nil {
+		return s
+	}
+	return value
+}
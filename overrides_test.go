@@ -0,0 +1,171 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testOverridesStruct struct {
+	Workers int               `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Code    string            `snakecharmer:"code" usage:"Code" required:"true"`
+	Hosts   []string          `snakecharmer:"hosts" usage:"Hosts" default:"localhost"`
+	Labels  map[string]string `snakecharmer:"labels" flag:"-" usage:"Labels" default:"team=none"`
+	Log     struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_SetFlag(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("log:\n  level: warn\nlabels:\n  team: core\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(args ...string) (*testOverridesStruct, *SnakeCharmer, error) {
+		t.Helper()
+		result := &testOverridesStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+			WithSetFlag("set"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer, charmer.UnmarshalExact()
+	}
+
+	result, charmer, err := f("--workers", "4",
+		"--set", "workers=16",
+		"--set", "code=007",
+		"--set", "hosts={a, b}",
+		"--set", "log.level=debug",
+		"--set", "labels.replicas=3",
+		"--set", "labels.canary=true",
+		"--set", "labels.zone=eu,west",
+	)
+	require.NoError(t, err)
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "007", result.Code)
+	require.Equal(t, []string{"a", "b"}, result.Hosts)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, map[string]string{
+		"team":     "core",
+		"replicas": "3",
+		"canary":   "true",
+		"zone":     "eu,west",
+	}, result.Labels)
+
+	var out bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&out, "yaml+source"))
+	require.Contains(t, out.String(), "workers: 16 # source: set\n")
+
+	// The last entry wins
+	result, _, err = f("--set", "code=a", "--set", "code=b")
+	require.NoError(t, err)
+	require.Equal(t, "b", result.Code)
+
+	_, _, err = f("--set", "code")
+	require.ErrorContains(t, err, `invalid --set entry "code", expected key=value`)
+	_, _, err = f("--set", "code=a", "--set", "log..level=debug")
+	require.Error(t, err)
+	_, _, err = f("--set", "workers=many", "--set", "code=a")
+	require.Error(t, err)
+}
+
+func Test_parseSetValue(t *testing.T) {
+	f := func(typ reflect.Type, s string, expected interface{}) {
+		t.Helper()
+		require.Equal(t, expected, parseSetValue(typ, s))
+	}
+	f(nil, "abc", "abc")
+	f(nil, "true", true)
+	f(nil, "false", false)
+	f(nil, "null", nil)
+	f(nil, "42", int64(42))
+	f(nil, "-42", int64(-42))
+	f(nil, "0", int64(0))
+	f(nil, "007", "007")
+	f(nil, "1.5", "1.5")
+	f(nil, "{}", []interface{}{})
+	f(nil, "{a, 1, true}", []interface{}{"a", int64(1), true})
+	f(reflect.TypeOf(""), "42", "42")
+	f(reflect.TypeOf(0), "42", int64(42))
+	f(reflect.TypeOf(0), "many", "many")
+	f(reflect.TypeOf(true), "1", true)
+	f(reflect.TypeOf(time.Second), "1", "1")
+	f(reflect.TypeOf([]string{}), "{1,2}", []interface{}{"1", "2"})
+}
+
+func Test_WithOverrides(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("code: abc\nlog:\n  level: warn\nlabels:\n  team: core\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testOverridesStruct{}
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+		WithSetFlag("set"),
+		WithOverrides(map[string]interface{}{
+			"Workers": 2,
+			"labels":  map[string]string{"zone": "eu"},
+		}),
+		WithOverrides(map[string]interface{}{
+			"log.level": "debug",
+			"hosts":     []string{"a", "b"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--workers", "4", "--set", "workers=16", "--set", "code=xyz"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 2, result.Workers)
+	require.Equal(t, "xyz", result.Code)
+	require.Equal(t, []string{"a", "b"}, result.Hosts)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, map[string]string{"team": "core", "zone": "eu"}, result.Labels)
+	require.Equal(t, []SourceKind{SourceOverride, SourceSet, SourceFlag, SourceEnv, SourceConfigFile, SourceDefault},
+		charmer.PrecedenceOrder())
+
+	var out bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&out, "yaml+source"))
+	require.Contains(t, out.String(), "workers: 2 # source: override\n")
+
+	_, err = NewSnakeCharmer(WithOverrides(map[string]interface{}{"log..level": "debug"}))
+	require.ErrorContains(t, err, `invalid override key "log..level"`)
+}
@@ -0,0 +1,283 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is a JSON patch (RFC 6902) operation.
+type patchOperation struct {
+	Value *json.RawMessage `json:"value"`
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+}
+
+// configPatch returns the JSON patch passed with the config patch flag.
+func (sch *SnakeCharmer) configPatch() string {
+	if len(sch.configPatchFlag) == 0 {
+		return ""
+	}
+	flag := sch.flags().Lookup(sch.configPatchFlag)
+	if flag == nil {
+		return ""
+	}
+	return flag.Value.String()
+}
+
+// applyJSONPatch applies the JSON patch (RFC 6902) to a copy of the settings.
+// Keys in the paths are case insensitive, as viper keys are.
+func applyJSONPatch(settings map[string]interface{}, patch string) (map[string]interface{}, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	var doc interface{} = normalizeValue(settings)
+	var err error
+	for i, op := range ops {
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("while applying JSON patch operation #%d (%s %q): %w", i, op.Op, op.Path, err)
+		}
+	}
+	result, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON patch result must be an object, got %T", doc)
+	}
+	return result, nil
+}
+
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		if err = json.Unmarshal(*op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return setPatchValue(doc, path, value, true)
+	case "replace":
+		return setPatchValue(doc, path, value, false)
+	case "remove":
+		doc, _, err = removePatchValue(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			doc, value, err = removePatchValue(doc, from)
+		} else {
+			value, err = getPatchValue(doc, from)
+			value = normalizeValue(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return setPatchValue(doc, path, value, true)
+	case "test":
+		actual, err := getPatchValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		a, _ := json.Marshal(actual)
+		b, _ := json.Marshal(value)
+		if !bytes.Equal(a, b) {
+			return nil, fmt.Errorf("test failed: %s != %s", a, b)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits the JSON pointer (RFC 6901) into reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getPatchValue(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[strings.ToLower(token)]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			node = child
+		case []interface{}:
+			idx, err := patchIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("cannot get %q of %T", token, node)
+		}
+	}
+	return node, nil
+}
+
+// setPatchValue sets the value at the path and returns the updated node.
+// If insert is true, the value is added (JSON patch "add"),
+// otherwise the existing value is replaced (JSON patch "replace").
+func setPatchValue(node interface{}, path []string, value interface{}, insert bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		token = strings.ToLower(token)
+		child, ok := n[token]
+		if !ok && (len(rest) > 0 || !insert) {
+			return nil, fmt.Errorf("%q not found", token)
+		}
+		child, err := setPatchValue(child, rest, value, insert)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if len(rest) == 0 && insert {
+			idx := len(n)
+			if token != "-" {
+				var err error
+				if idx, err = patchIndex(token, len(n)); err != nil {
+					return nil, err
+				}
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+		idx, err := patchIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		if n[idx], err = setPatchValue(n[idx], rest, value, insert); err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q of %T", token, node)
+	}
+}
+
+// removePatchValue removes the value at the path,
+// and returns the updated node and the removed value.
+func removePatchValue(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the root")
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		token = strings.ToLower(token)
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%q not found", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := removePatchValue(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []interface{}:
+		idx, err := patchIndex(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[idx]
+			return append(n[:idx], n[idx+1:]...), removed, nil
+		}
+		child, removed, err := removePatchValue(n[idx], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[idx] = child
+		return n, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("cannot remove %q of %T", token, node)
+	}
+}
+
+func patchIndex(token string, max int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > max {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+// normalizeValue returns a deep copy of the value with all the maps
+// converted to map[string]interface{} and all the slices to []interface{}.
+func normalizeValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		result := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = normalizeValue(iter.Value().Interface())
+		}
+		return result
+	case reflect.Slice:
+		if rv.IsNil() {
+			return []interface{}{}
+		}
+		result := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			result[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_applyJSONPatch(t *testing.T) {
+	f := func(patch string, expected map[string]interface{}) {
+		t.Helper()
+		settings := map[string]interface{}{
+			"workers": 128,
+			"hosts":   []string{"a", "b"},
+			"log":     map[string]interface{}{"level": "info", "dst": map[string]string{"error": "e.log"}},
+		}
+		result, err := applyJSONPatch(settings, patch)
+		if expected == nil {
+			if err == nil {
+				t.Fatalf("expecting non-nil error in applyJSONPatch(%q)", patch)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error in applyJSONPatch(%q): %s", patch, err.Error())
+		}
+		require.Equal(t, expected, result)
+	}
+
+	f(`[]`, map[string]interface{}{
+		"workers": 128,
+		"hosts":   []interface{}{"a", "b"},
+		"log":     map[string]interface{}{"level": "info", "dst": map[string]interface{}{"error": "e.log"}},
+	})
+	f(`[
+		{"op":"replace","path":"/log/level","value":"debug"},
+		{"op":"add","path":"/hosts/-","value":"c"},
+		{"op":"add","path":"/hosts/0","value":"z"},
+		{"op":"remove","path":"/workers"},
+		{"op":"copy","from":"/log/dst/error","path":"/log/dst/debug"},
+		{"op":"move","from":"/hosts/1","path":"/log/host"},
+		{"op":"test","path":"/log/level","value":"debug"}
+	]`, map[string]interface{}{
+		"hosts": []interface{}{"z", "b", "c"},
+		"log": map[string]interface{}{
+			"level": "debug",
+			"host":  "a",
+			"dst":   map[string]interface{}{"error": "e.log", "debug": "e.log"},
+		},
+	})
+
+	f(`{}`, nil)
+	f(`[{"op":"replace","path":"/log/format","value":"json"}]`, nil)
+	f(`[{"op":"remove","path":"/hosts/2"}]`, nil)
+	f(`[{"op":"test","path":"/workers","value":64}]`, nil)
+	f(`[{"op":"add","path":"log","value":1}]`, nil)
+	f(`[{"op":"replace","path":"/workers"}]`, nil)
+	f(`[{"op":"merge","path":"/workers","value":1}]`, nil)
+}
+
+func Test_ConfigPatchFlag(t *testing.T) {
+	var charmer *SnakeCharmer
+	var err error
+
+	result := initTestStruct()
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePath("./test-config.json"),
+		WithConfigPatchFlag("config-patch"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	cmd.SetArgs([]string{
+		"--max-burst=3.5",
+		`--config-patch=[
+			{"op":"replace","path":"/log/level","value":"error"},
+			{"op":"replace","path":"/max-burst","value":2.5},
+			{"op":"remove","path":"/upstreams/0"}
+		]`,
+	})
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.Equal(t, "error", *result.Logging.Level)
+	require.Equal(t, 2.5, *result.MaxBurst)
+	require.Equal(t, []string{"http://www.example2.com/", "http://www.example3.com/"}, *result.UpstreamURls)
+}
@@ -0,0 +1,104 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// parsePercent parses the percent value, e.g. "85%" or "0.85",
+// into the ratio in the range [0, 1], e.g. 0.85.
+func parsePercent(value interface{}) (float64, error) {
+	var ratio float64
+	switch v := value.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		percent := strings.HasSuffix(s, "%")
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot parse %q as percent", v)
+		}
+		ratio = f
+		if percent {
+			ratio = f / 100
+		}
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			ratio = rv.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ratio = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			ratio = float64(rv.Uint())
+		default:
+			return 0, fmt.Errorf("cannot parse %T as percent", value)
+		}
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("%v is out of range [0%%, 100%%]", value)
+	}
+	return ratio, nil
+}
+
+// formatPercent formats the ratio as percent, e.g. 0.85 -> "85%".
+func formatPercent(ratio float64) string {
+	return strconv.FormatFloat(ratio*100, 'f', -1, 64) + "%"
+}
+
+// applyPercentSetting adds the string flag accepting "85%" or "0.85"
+// for the float field with the percent modifier
+// and sets the default viper config param.
+func (sch *SnakeCharmer) applyPercentSetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) error {
+	if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+		return fmt.Errorf("BUG: percent modifier is set for non-float flag %q (%s)", name, rv.Type())
+	}
+	value := rv.Float()
+	fs.String(name, formatPercent(value), help)
+	sch.backend.SetDefault(name, value)
+	return nil
+}
+
+// normalizePercents converts the values of the fields with the percent modifier,
+// e.g. `mapstructure:"max-cpu,percent"`, into the ratio in the range [0, 1].
+// It returns FieldError per invalid value.
+func (sch *SnakeCharmer) normalizePercents(settings map[string]interface{}) []error {
+	errs := []error{}
+	for _, b := range sch.bindings {
+		if !b.percent {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		value, ok := parent[name]
+		if !ok {
+			continue
+		}
+		ratio, err := parsePercent(value)
+		if err != nil {
+			errs = append(errs, sch.newFieldError(b.key, fmt.Errorf("invalid value of %q: %w", b.key, err)))
+			continue
+		}
+		parent[name] = ratio
+	}
+	return errs
+}
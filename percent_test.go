@@ -0,0 +1,98 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parsePercent(t *testing.T) {
+	f := func(value interface{}, expected float64) {
+		t.Helper()
+		ratio, err := parsePercent(value)
+		require.NoError(t, err)
+		require.InDelta(t, expected, ratio, 1e-9)
+	}
+	f("85%", 0.85)
+	f(" 12.5 % ", 0.125)
+	f("0.85", 0.85)
+	f(0.5, 0.5)
+	f(1, 1)
+	f(float32(0.25), 0.25)
+
+	fail := func(value interface{}) {
+		t.Helper()
+		_, err := parsePercent(value)
+		require.Error(t, err)
+	}
+	fail("85")
+	fail("101%")
+	fail("-1%")
+	fail("abc%")
+	fail(true)
+}
+
+type testPercentStruct struct {
+	MaxCPU    float64 `snakecharmer:"max-cpu,percent" env:"TEST_MAX_CPU" usage:"Max CPU usage" default:"80%"`
+	MaxMemory float32 `snakecharmer:"max-memory,percent" usage:"Max memory usage"`
+	Sampling  float64 `snakecharmer:"sampling,percent" usage:"Sampling ratio" default:"0.1"`
+}
+
+func Test_PercentModifier(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("max-memory: 75%\nsampling: 0.5\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(args ...string) (*testPercentStruct, error) {
+		t.Helper()
+		result := &testPercentStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.Equal(t, "80%", cmd.PersistentFlags().Lookup("max-cpu").DefValue)
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f()
+	require.NoError(t, err)
+	require.InDelta(t, 0.8, result.MaxCPU, 1e-9)
+	require.InDelta(t, 0.75, result.MaxMemory, 1e-6)
+	require.InDelta(t, 0.5, result.Sampling, 1e-9)
+
+	t.Setenv("TEST_MAX_CPU", "0.9")
+	result, err = f("--sampling", "5%")
+	require.NoError(t, err)
+	require.InDelta(t, 0.9, result.MaxCPU, 1e-9)
+	require.InDelta(t, 0.05, result.Sampling, 1e-9)
+
+	_, err = f("--max-cpu", "120%")
+	require.Error(t, err)
+}
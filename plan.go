@@ -0,0 +1,226 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+// Plan is the compiled plan of the result struct type: the settings
+// of its fields read from the struct tags, which are checked
+// for errors. See CompilePlan and WithPlan.
+type Plan struct {
+	// The key of the plan of the result struct
+	key planKey
+	// The field plans of the result struct and the nested struct types
+	fields map[planKey][]fieldPlan
+}
+
+// Type returns the result struct type the plan is compiled for.
+func (p *Plan) Type() reflect.Type { return p.key.typ }
+
+// CompilePlan reads the struct tags of the result struct type t
+// (or the pointer to it), including the nested structs, and checks them
+// as AddFlags does, e.g. for the missing usage tags or the invalid defaults.
+// It returns all the errors found rather than panicking at the first one,
+// so the tags can be checked once at program init or in a unit test:
+//
+//	plan, err := snakecharmer.CompilePlan(reflect.TypeOf(Config{}), snakecharmer.WithFieldTagName("snakecharmer"))
+//
+// The options set the tag settings, e.g. WithFieldTagName or WithTagDialect,
+// the plan is passed to NewSnakeCharmer with the same ones (see WithPlan).
+// The initialized values of the result struct are not known to the plan,
+// so the checks depending on them are skipped: the nil slices and maps
+// get the empty flags, as in AddFlags, and the interface fields are not
+// walked through, since the types of their values are not known.
+func CompilePlan(t reflect.Type, opts ...CharmingOption) (*Plan, error) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type must be a struct or a pointer to it, got %v", t)
+	}
+	opts = append(opts[:len(opts):len(opts)],
+		WithResultStruct(reflect.New(t).Interface()),
+		WithFlagSet(pflag.NewFlagSet(t.String(), pflag.ContinueOnError)),
+	)
+	sch, err := NewSnakeCharmer(opts...)
+	if err != nil {
+		return nil, err
+	}
+	errs := []error{}
+	sch.plan = &Plan{key: sch.planKey(t), fields: map[planKey][]fieldPlan{}}
+	sch.planErrors = &errs
+	sch.addFlags(sch.resultStruct, "")
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return sch.plan, nil
+}
+
+// checkPlan returns the error if the plan set with WithPlan
+// does not match the result struct or the tag settings.
+func (sch *SnakeCharmer) checkPlan() error {
+	t := reflect.TypeOf(sch.resultStruct)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != sch.plan.key.typ {
+		return fmt.Errorf("plan is compiled for %s, but the result struct is %s", sch.plan.key.typ, t)
+	}
+	if sch.planKey(t) != sch.plan.key {
+		return fmt.Errorf("plan of %s is compiled with other tag settings", t)
+	}
+	return nil
+}
+
+// recoverPlanError collects the error of the invalid field
+// while compiling the plan, see CompilePlan.
+func (sch *SnakeCharmer) recoverPlanError() {
+	r := recover()
+	if err, ok := r.(error); ok {
+		*sch.planErrors = append(*sch.planErrors, err)
+	} else if r != nil {
+		*sch.planErrors = append(*sch.planErrors, errors.New(strings.TrimPrefix(fmt.Sprint(r), "BUG: ")))
+	}
+}
+
+// fieldPlan is the handling of the struct field derived from its type
+// and tags only, so it is shared by the SnakeCharmers of the same
+// struct type, see structPlan.
+type fieldPlan struct {
+	// The index of the field in the struct
+	index int
+	// squash is true if the fields of the struct field
+	// are registered at the parent level, see isSquashed
+	squash bool
+	// embedded is true if the field is the plain embedded struct
+	// squashed with the native tag dialect
+	embedded bool
+	// skip is true if the field is skipped, e.g. `kong:"-"`
+	skip bool
+	// The error of the invalid tags, e.g. of the untagged field,
+	// it is reported when the field is added, see addField
+	invalid string
+	// The settings read from the field tags, the key is relative
+	// to the parent struct, see keyAt.
+	tags fieldTags
+}
+
+// keyAt returns the config key of the field of the struct nested under
+// the prefix. The squashed field has the key of the parent only.
+func (fp fieldPlan) keyAt(prefix string) string {
+	if fp.squash {
+		return prefix
+	}
+	return joinKey(prefix, fp.tags.key)
+}
+
+// tagsAt returns the settings of the field of the struct nested
+// under the prefix, with the full config key and ENV var name.
+func (fp fieldPlan) tagsAt(prefix string) fieldTags {
+	ft := fp.tags
+	ft.key = fp.keyAt(prefix)
+	if ft.deriveEnv {
+		ft.env = strings.ToUpper(strings.ReplaceAll(ft.key, ".", "_"))
+	}
+	return ft
+}
+
+// planKey identifies the plan of the struct type, along with the settings
+// the tags are read with. The prefix of the nested struct is not the part
+// of it, so the cache is bounded by the struct types of the program.
+type planKey struct {
+	typ                  reflect.Type
+	tagDialect           TagDialect
+	fieldTagName         string
+	envTagName           string
+	flagHelpTagName      string
+	defaultTagName       string
+	sliceSep             string
+	ignoreUntaggedFields bool
+}
+
+// planCache holds the field plans by planKey, so the struct tags are read
+// once per process rather than by every AddFlags call, e.g. of the
+// short-lived commands created for every request or test.
+var planCache sync.Map
+
+// structPlan returns the plans of the fields of the struct type,
+// their keys are relative to the struct (see keyAt). It reads the tags
+// on the first call only, the plan must not be modified.
+// The plan set with WithPlan is used first.
+func (sch *SnakeCharmer) structPlan(t reflect.Type) []fieldPlan {
+	key := sch.planKey(t)
+	if sch.plan != nil {
+		if plan, ok := sch.plan.fields[key]; ok {
+			return plan
+		}
+	}
+	var plan []fieldPlan
+	if cached, ok := planCache.Load(key); ok {
+		plan = cached.([]fieldPlan)
+	} else {
+		plan = make([]fieldPlan, t.NumField())
+		for i := range plan {
+			sf := t.Field(i)
+			fp := fieldPlan{index: i}
+			fp.squash, fp.embedded = sch.squashed(sf)
+			if !fp.squash {
+				fp.tags, fp.skip, fp.invalid = sch.readPlannedTags(sf)
+			}
+			plan[i] = fp
+		}
+		cached, _ = planCache.LoadOrStore(key, plan)
+		plan = cached.([]fieldPlan)
+	}
+	if sch.planErrors != nil {
+		sch.plan.fields[key] = plan
+	}
+	return plan
+}
+
+// planKey returns the key of the plan of the struct type.
+func (sch *SnakeCharmer) planKey(t reflect.Type) planKey {
+	return planKey{
+		typ:                  t,
+		tagDialect:           sch.tagDialect,
+		fieldTagName:         sch.fieldTagName,
+		envTagName:           sch.envTagName,
+		flagHelpTagName:      sch.flagHelpTagName,
+		defaultTagName:       sch.defaultTagName,
+		sliceSep:             sch.sliceSep,
+		ignoreUntaggedFields: sch.ignoreUntaggedFields,
+	}
+}
+
+// readPlannedTags works like readFieldTags, but it returns the panic
+// message of the invalid tags rather than panicking, so the plan
+// of the rest of the fields is read. It returns true if the field is skipped.
+func (sch *SnakeCharmer) readPlannedTags(sf reflect.StructField) (ft fieldTags, skip bool, invalid string) {
+	defer func() {
+		if r := recover(); r != nil {
+			ft, skip, invalid = fieldTags{}, false, fmt.Sprint(r)
+		}
+	}()
+	ft, ok := sch.readFieldTags(sf)
+	return ft, !ok, ""
+}
@@ -0,0 +1,141 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_StructPlan(t *testing.T) {
+	f := func(opts ...CharmingOption) (*SnakeCharmer, *cobra.Command) {
+		t.Helper()
+		cmd := &cobra.Command{}
+		opts = append([]CharmingOption{WithResultStruct(&testDumpStruct{}), WithCobraCommand(cmd)}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return charmer, cmd
+	}
+	typ := reflect.TypeOf(testDumpStruct{})
+	logTyp := typ.Field(2).Type
+
+	// The plan is read once and shared by the charmers of the same struct type
+	first, cmd1 := f(WithFieldTagName("snakecharmer"))
+	second, cmd2 := f(WithFieldTagName("snakecharmer"))
+	plan := first.structPlan(typ)
+	require.Same(t, &plan[0], &second.structPlan(typ)[0])
+	require.Len(t, plan, 3)
+	require.Equal(t, "workers", plan[0].tags.key)
+	require.True(t, plan[1].tags.secret)
+	require.Equal(t, "level", first.structPlan(logTyp)[0].tags.key)
+	require.Equal(t, "log.level", first.structPlan(logTyp)[0].keyAt("log"))
+	require.Equal(t, cmd1.Flag("log.level").DefValue, cmd2.Flag("log.level").DefValue)
+	require.Equal(t, first.bindings, second.bindings)
+
+	// The plan of the struct type is shared by all the prefixes,
+	// the ones of other tag settings are separate
+	third, _ := f(WithFieldTagName("snakecharmer"), WithEnvTagName("envvar"))
+	require.NotSame(t, &plan[0], &third.structPlan(typ)[0])
+	require.Equal(t, "TEST_DUMP_LOG_LEVEL", first.structPlan(logTyp)[0].tags.env)
+	require.Empty(t, third.structPlan(logTyp)[0].tags.env)
+
+	// The nested struct under other prefix gets the keys of it
+	type twoLogs struct {
+		Access struct {
+			Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+		} `snakecharmer:"access"`
+		Error struct {
+			Level string `snakecharmer:"level" usage:"Log level" default:"warn"`
+		} `snakecharmer:"error"`
+	}
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(WithResultStruct(&twoLogs{}), WithCobraCommand(cmd), WithFieldTagName("snakecharmer"))
+	require.NoError(t, err)
+	charmer.AddFlags()
+	require.Equal(t, "info", cmd.Flag("access.level").DefValue)
+	require.Equal(t, "warn", cmd.Flag("error.level").DefValue)
+}
+
+func Test_CompilePlan(t *testing.T) {
+	type invalidStruct struct {
+		Workers  int      `snakecharmer:"workers" default:"eight" usage:"Number of workers to run"`
+		Level    string   `snakecharmer:"level"`
+		Hosts    []string `snakecharmer:"hosts" oneof:"a,b" usage:"Hosts"`
+		Untagged string
+		Log      struct {
+			JSON bool `snakecharmer:"json" default:"maybe" usage:"Log in JSON format"`
+		} `snakecharmer:"log"`
+	}
+	_, err := CompilePlan(reflect.TypeOf(invalidStruct{}), WithFieldTagName("snakecharmer"))
+	require.Error(t, err)
+	require.ErrorContains(t, err, `invalid default tag for field "Workers"`)
+	require.ErrorContains(t, err, `usage tag is not specified for field: "Level"`)
+	require.ErrorContains(t, err, `oneof tag is set for non-scalar field: "Hosts"`)
+	require.ErrorContains(t, err, `got untagged field: Untagged`)
+	require.ErrorContains(t, err, `invalid default tag for field "JSON"`)
+	require.NotContains(t, err.Error(), "BUG")
+
+	_, err = CompilePlan(reflect.TypeOf(0))
+	require.Error(t, err)
+
+	// The struct accepted by AddFlags compiles with its zero value:
+	// the nil pointers of slices and maps, and the nil interface
+	plan, err := CompilePlan(reflect.TypeOf(testStruct{}), WithFieldTagName("snakecharmer"), WithIgnoreUntaggedFields(true))
+	require.NoError(t, err)
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(initTestStruct()),
+		WithCobraCommand(&cobra.Command{}),
+		WithFieldTagName("snakecharmer"),
+		WithIgnoreUntaggedFields(true),
+		WithPlan(plan),
+	)
+	require.NoError(t, err)
+	charmer.AddFlags()
+	type ifaceStruct struct {
+		Log interface{} `snakecharmer:"log"`
+	}
+	_, err = CompilePlan(reflect.TypeOf(ifaceStruct{}), WithFieldTagName("snakecharmer"))
+	require.NoError(t, err)
+
+	plan, err = CompilePlan(reflect.TypeOf(&testDumpStruct{}), WithFieldTagName("snakecharmer"))
+	require.NoError(t, err)
+	require.Equal(t, reflect.TypeOf(testDumpStruct{}), plan.Type())
+
+	f := func(result interface{}, opts ...CharmingOption) (*SnakeCharmer, error) {
+		t.Helper()
+		opts = append([]CharmingOption{WithResultStruct(result), WithCobraCommand(&cobra.Command{})}, opts...)
+		return NewSnakeCharmer(opts...)
+	}
+	result := &testDumpStruct{}
+	charmer, err = f(result, WithFieldTagName("snakecharmer"), WithPlan(plan))
+	require.NoError(t, err)
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, "info", result.Log.Level)
+
+	_, err = f(&testSnapshotStruct{}, WithFieldTagName("snakecharmer"), WithPlan(plan))
+	require.ErrorContains(t, err, "plan is compiled for")
+	_, err = f(&testDumpStruct{}, WithFieldTagName("snakecharmer"), WithEnvTagName("envvar"), WithPlan(plan))
+	require.ErrorContains(t, err, "other tag settings")
+	_, err = f(&testDumpStruct{}, WithPlan(nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,327 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// SourceKind is a kind of the source of config values.
+type SourceKind int
+
+const (
+	// SourceDefault is the default value from the default tag
+	// or the initialized result struct.
+	SourceDefault SourceKind = iota
+	// SourceConfigFile is a config file, see WithConfigFilePath and WithConfigFilePaths.
+	SourceConfigFile
+	// SourceProvider is a Provider, see WithProvider and WithBootstrap.
+	SourceProvider
+	// SourceDotEnv is a dotenv file, see WithDotEnvFile.
+	SourceDotEnv
+	// SourceEnv is an ENV var.
+	SourceEnv
+	// SourceFlag is a command line flag.
+	SourceFlag
+	// SourcePatch is a JSON patch, see WithConfigPatchFlag.
+	SourcePatch
+	// SourceRemote is a remote config store, see WithRemoteConfig.
+	// It overrides config files, but not providers.
+	SourceRemote
+	// SourceSecretsDir is a Kubernetes secrets directory, see WithKubernetesSecretsDir.
+	// It overrides providers, but not dotenv files.
+	SourceSecretsDir
+	// SourceSet is the --set flag, see WithSetFlag.
+	// It overrides flags and JSON patches.
+	SourceSet
+	// SourceOverride is the value set with WithOverrides.
+	// It overrides all the other sources, including the --set flag.
+	SourceOverride
+	// SourceStateFile is the value saved into the state file by the previous run,
+	// see WithStateFile. It overrides the defaults only.
+	SourceStateFile
+)
+
+// String returns the source kind name.
+func (k SourceKind) String() string {
+	switch k {
+	case SourceDefault:
+		return "default"
+	case SourceConfigFile:
+		return "config file"
+	case SourceProvider:
+		return "provider"
+	case SourceDotEnv:
+		return "dotenv"
+	case SourceEnv:
+		return "env"
+	case SourceFlag:
+		return "flag"
+	case SourcePatch:
+		return "patch"
+	case SourceRemote:
+		return "remote"
+	case SourceSecretsDir:
+		return "secrets dir"
+	case SourceSet:
+		return "set"
+	case SourceOverride:
+		return "override"
+	case SourceStateFile:
+		return "state file"
+	default:
+		return fmt.Sprintf("SourceKind(%d)", int(k))
+	}
+}
+
+// PrecedenceOrder returns the kinds of the configured sources of config values
+// from the highest priority to the lowest one, e.g.
+// [flag env config file default] if only a config file is set.
+func (sch *SnakeCharmer) PrecedenceOrder() []SourceKind {
+	if v := sch.loadView(); v != nil {
+		return append([]SourceKind{}, v.precedence...)
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.precedenceOrder()
+}
+
+// precedenceOrder is PrecedenceOrder without locking.
+func (sch *SnakeCharmer) precedenceOrder() []SourceKind {
+	order := []SourceKind{}
+	if len(sch.overrideValues) > 0 {
+		order = append(order, SourceOverride)
+	}
+	if len(sch.setFlag) > 0 {
+		order = append(order, SourceSet)
+	}
+	if len(sch.configPatchFlag) > 0 {
+		order = append(order, SourcePatch)
+	}
+	order = append(order, SourceFlag)
+	if !sch.envDisabled {
+		order = append(order, SourceEnv)
+	}
+	if len(sch.dotEnvFile) > 0 {
+		order = append(order, SourceDotEnv)
+	}
+	if len(sch.secretsDir) > 0 {
+		order = append(order, SourceSecretsDir)
+	}
+	hasRefs := false
+	for _, b := range sch.bindings {
+		hasRefs = hasRefs || len(b.ref) > 0
+	}
+	if len(sch.providers) > 0 || sch.bootstrap != nil || hasRefs {
+		order = append(order, SourceProvider)
+	}
+	if len(sch.remoteProvider) > 0 || sch.remote != nil {
+		order = append(order, SourceRemote)
+	}
+	if sch.hasConfig() {
+		order = append(order, SourceConfigFile)
+	}
+	if len(sch.stateFile) > 0 {
+		order = append(order, SourceStateFile)
+	}
+	order = append(order, SourceDefault)
+	if sch.precedence == nil {
+		return order
+	}
+	// Reorder the layers, the overrides and patches stay on top
+	result := []SourceKind{}
+	for _, k := range order {
+		switch k {
+		case SourceOverride, SourceSet, SourcePatch:
+			result = append(result, k)
+		}
+	}
+	for _, layer := range sch.precedence {
+		for _, k := range order {
+			if layerOf(k) == layer {
+				result = append(result, k)
+			}
+		}
+	}
+	return result
+}
+
+// layerOf returns the layer of the source, see WithPrecedence.
+// The sources merged into the config layer belong to the config file one,
+// the state file values are the defaults.
+func layerOf(k SourceKind) SourceKind {
+	switch k {
+	case SourceDotEnv, SourceSecretsDir, SourceProvider, SourceRemote:
+		return SourceConfigFile
+	case SourceStateFile:
+		return SourceDefault
+	}
+	return k
+}
+
+// precedenceLayer returns the layer the value of the field comes from
+// according to the precedence set with WithPrecedence,
+// or false if none of the layers has it.
+func (sch *SnakeCharmer) precedenceLayer(b fieldBinding) (SourceKind, bool) {
+	for _, layer := range sch.precedence {
+		switch layer {
+		case SourceFlag:
+			if flag := sch.lookupFlag(b.key); flag != nil && flag.Changed {
+				return layer, true
+			}
+		case SourceEnv:
+			if sch.envSet(b.envs) {
+				return layer, true
+			}
+		case SourceConfigFile:
+			if sch.backend.InConfig(b.key) {
+				return layer, true
+			}
+		case SourceDefault:
+			return layer, true
+		}
+	}
+	return SourceDefault, false
+}
+
+// applyPrecedence replaces the values of the fields in the settings
+// with the ones of the layers according to the precedence set
+// with WithPrecedence. The fields none of the layers has are removed.
+func (sch *SnakeCharmer) applyPrecedence(settings map[string]interface{}) error {
+	if sch.precedence == nil {
+		return nil
+	}
+	backend, ok := sch.backend.(LayeredBackend)
+	if !ok {
+		return fmt.Errorf("the backend does not implement LayeredBackend required by WithPrecedence")
+	}
+	for _, b := range sch.bindings {
+		layer, ok := sch.precedenceLayer(b)
+		if !ok {
+			deleteSetting(settings, b.key)
+			continue
+		}
+		var value interface{}
+		switch layer {
+		case SourceFlag:
+			flag := sch.lookupFlag(b.key)
+			if sv, ok := flag.Value.(pflag.SliceValue); ok {
+				value = sv.GetSlice()
+			} else {
+				value = flag.Value.String()
+			}
+		case SourceEnv:
+			for _, env := range b.envs {
+				if v, ok := sch.lookupEnv(env); ok {
+					value = v
+					break
+				}
+			}
+		case SourceConfigFile:
+			value, _ = backend.ConfigValue(b.key)
+		case SourceDefault:
+			if value, ok = backend.DefaultValue(b.key); !ok {
+				deleteSetting(settings, b.key)
+				continue
+			}
+		}
+		setSetting(settings, b.key, value)
+	}
+	return nil
+}
+
+// setLayerSource records the source of the values merged into
+// the viper config layer under the key, i.e. the key itself
+// or the nested keys of the map value.
+func (sch *SnakeCharmer) setLayerSource(key string, value interface{}, source SourceKind) {
+	if sch.layerSources == nil {
+		sch.layerSources = make(map[string]SourceKind)
+	}
+	key = strings.ToLower(key)
+	if m, ok := value.(map[string]interface{}); ok {
+		for _, k := range flattenKeys(key, m) {
+			sch.layerSources[strings.ToLower(k)] = source
+			sch.debug("key merged", slog.String("key", strings.ToLower(k)), slog.String("source", source.String()))
+		}
+		return
+	}
+	sch.layerSources[key] = source
+	sch.debug("key merged", slog.String("key", key), slog.String("source", source.String()))
+}
+
+// bindingOfKey returns the binding of the field holding the config key,
+// e.g. of "upstreams" for "upstreams[0].url", or nil if there is none.
+// The items of slices and maps belong to the field of the collection.
+func (sch *SnakeCharmer) bindingOfKey(key string) *fieldBinding {
+	field, _, _ := strings.Cut(strings.ToLower(key), "[")
+	var binding *fieldBinding
+	for i, b := range sch.bindings {
+		k := strings.ToLower(b.key)
+		if k != field && !strings.HasPrefix(field, k+".") {
+			continue
+		}
+		if binding == nil || len(b.key) > len(binding.key) {
+			binding = &sch.bindings[i]
+		}
+	}
+	return binding
+}
+
+// sourceOf returns the source of the field value
+// according to the priority of values.
+func (sch *SnakeCharmer) sourceOf(b fieldBinding) SourceKind {
+	if source, ok := sch.overrideSource(b.key); ok {
+		return source
+	}
+	if sch.precedence != nil {
+		layer, ok := sch.precedenceLayer(b)
+		if !ok || layer == SourceDefault {
+			return sch.defaultSource(b.key)
+		}
+		if layer != SourceConfigFile {
+			return layer
+		}
+		if source, ok := sch.layerSources[strings.ToLower(b.key)]; ok {
+			return source
+		}
+		return SourceConfigFile
+	}
+	if flag := sch.lookupFlag(b.key); flag != nil && flag.Changed {
+		return SourceFlag
+	}
+	if sch.envSet(b.envs) {
+		return SourceEnv
+	}
+	if source, ok := sch.layerSources[strings.ToLower(b.key)]; ok {
+		return source
+	}
+	if sch.backend.InConfig(b.key) {
+		return SourceConfigFile
+	}
+	return sch.defaultSource(b.key)
+}
+
+// defaultSource returns the source of the default value of the key,
+// i.e. the state file if the value was loaded from it.
+func (sch *SnakeCharmer) defaultSource(key string) SourceKind {
+	if sch.stateKeys[strings.ToLower(key)] {
+		return SourceStateFile
+	}
+	return SourceDefault
+}
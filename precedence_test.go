@@ -0,0 +1,123 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PrecedenceOrder(t *testing.T) {
+	f := func(expected []SourceKind, opts ...CharmingOption) {
+		t.Helper()
+		opts = append([]CharmingOption{
+			WithResultStruct(initTestStruct()),
+			WithCobraCommand(&cobra.Command{}),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.Equal(t, expected, charmer.PrecedenceOrder())
+	}
+
+	f([]SourceKind{SourceFlag, SourceEnv, SourceDefault})
+	f([]SourceKind{SourceFlag, SourceEnv, SourceConfigFile, SourceDefault},
+		WithConfigFilePath("./test-config.json"))
+	f([]SourceKind{SourceFlag, SourceConfigFile, SourceDefault},
+		WithConfigFilePaths("./test-config.json"), WithEnvDisabled(true))
+	f([]SourceKind{SourcePatch, SourceFlag, SourceEnv, SourceDotEnv, SourceProvider, SourceConfigFile, SourceDefault},
+		WithConfigFilePath("./test-config.json"),
+		WithDotEnvFile(".env"),
+		WithProvider(&testProvider{}),
+		WithConfigPatchFlag("config-patch"),
+	)
+	f([]SourceKind{SourceSet, SourceFlag, SourceEnv, SourceDefault}, WithSetFlag("set"))
+	f([]SourceKind{SourceFlag, SourceEnv, SourceStateFile, SourceDefault}, WithStateFile("state.json"))
+
+	require.Equal(t, "config file", SourceConfigFile.String())
+	require.Equal(t, "state file", SourceStateFile.String())
+	require.Equal(t, "SourceKind(42)", SourceKind(42).String())
+}
+
+func Test_WithPrecedence(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("log:\n  level: warn\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_DUMP_LOG_LEVEL", "debug")
+
+	f := func(config string, args []string, layers ...SourceKind) (*testDumpStruct, *SnakeCharmer) {
+		t.Helper()
+		result := &testDumpStruct{}
+		cmd := &cobra.Command{}
+		opts := []CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithPrecedence(layers...),
+		}
+		if len(config) > 0 {
+			opts = append(opts, WithConfigFilePath(config))
+		}
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result, charmer
+	}
+
+	// The config file wins over the ENV var
+	result, charmer := f(config, nil, SourceFlag, SourceConfigFile, SourceEnv, SourceDefault)
+	require.Equal(t, "warn", result.Log.Level)
+	require.Equal(t, 8, result.Workers)
+	require.Equal(t, []SourceKind{SourceFlag, SourceConfigFile, SourceEnv, SourceDefault}, charmer.PrecedenceOrder())
+	var out bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&out, "yaml+source"))
+	require.Contains(t, out.String(), "level: warn # source: config file\n")
+
+	result, _ = f(config, []string{"--log.level", "error", "--workers", "2"}, SourceFlag, SourceConfigFile, SourceEnv, SourceDefault)
+	require.Equal(t, "error", result.Log.Level)
+	require.Equal(t, 2, result.Workers)
+
+	// The config file wins over the flag
+	result, _ = f(config, []string{"--log.level", "error"}, SourceConfigFile, SourceFlag)
+	require.Equal(t, "warn", result.Log.Level)
+	// The defaults are ignored
+	require.Equal(t, 0, result.Workers)
+
+	// The ENV vars are ignored
+	result, _ = f("", nil, SourceFlag, SourceConfigFile, SourceDefault)
+	require.Equal(t, "info", result.Log.Level)
+
+	_, err := NewSnakeCharmer(WithPrecedence(SourceFlag, SourceFlag))
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithPrecedence(SourcePatch))
+	require.Error(t, err)
+	_, err = NewSnakeCharmer(WithPrecedence())
+	require.Error(t, err)
+}
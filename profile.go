@@ -0,0 +1,72 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// profilesKey is the top-level config key holding the profiles.
+const profilesKey = "profiles"
+
+// profile returns the name of the profile passed with the profile flag.
+func (sch *SnakeCharmer) profile() string {
+	if len(sch.profileFlag) == 0 {
+		return ""
+	}
+	flag := sch.flags().Lookup(sch.profileFlag)
+	if flag == nil {
+		return ""
+	}
+	return strings.TrimSpace(flag.Value.String())
+}
+
+// applyProfile removes the top-level profiles map from the config settings
+// and deep-merges the subtree of the selected profile (if any) over the rest.
+func (sch *SnakeCharmer) applyProfile(settings map[string]interface{}) (map[string]interface{}, error) {
+	if len(sch.profileFlag) == 0 {
+		return settings, nil
+	}
+	profiles, err := cast.ToStringMapE(settings[profilesKey])
+	if err != nil {
+		return nil, fmt.Errorf("%q must be a map of profiles: %w", profilesKey, err)
+	}
+	delete(settings, profilesKey)
+	name := sch.profile()
+	if len(name) == 0 {
+		return settings, nil
+	}
+	// viper lowercases the config keys
+	value, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not found in config", name)
+	}
+	profile, err := cast.ToStringMapE(value)
+	if err != nil {
+		return nil, fmt.Errorf("profile %q must be a map: %w", name, err)
+	}
+	merged := viper.New()
+	if err = merged.MergeConfigMap(settings); err != nil {
+		return nil, err
+	}
+	if err = merged.MergeConfigMap(profile); err != nil {
+		return nil, fmt.Errorf("while merging profile %q: %w", name, err)
+	}
+	return merged.AllSettings(), nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ProfileFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+workers: 256
+log:
+  level: info
+  json: true
+profiles:
+  dev:
+    log:
+      level: debug
+  Prod:
+    workers: 1024
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	f := func(args ...string) (*testMultiDocStruct, error) {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+			WithProfileFlag("profile"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	base, err := f()
+	require.NoError(t, err)
+	require.Equal(t, 256, base.Workers)
+	require.Equal(t, "info", base.Log.Level)
+
+	dev, err := f("--profile", "dev")
+	require.NoError(t, err)
+	require.Equal(t, 256, dev.Workers)
+	require.Equal(t, "debug", dev.Log.Level)
+	require.True(t, dev.Log.JSON)
+
+	prod, err := f("--profile", "Prod")
+	require.NoError(t, err)
+	require.Equal(t, 1024, prod.Workers)
+	require.Equal(t, "info", prod.Log.Level)
+
+	// Flags take precedence over the profile
+	prod, err = f("--profile", "prod", "--workers", "8")
+	require.NoError(t, err)
+	require.Equal(t, 8, prod.Workers)
+
+	_, err = f("--profile", "staging")
+	require.EqualError(t, err, `profile "staging" is not found in config`)
+}
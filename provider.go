@@ -0,0 +1,208 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Provider supplies config values from an external source,
+// e.g. a secret backend like HashiCorp Vault or AWS SSM.
+// Provided values are merged at the config file priority,
+// i.e. they override defaults and config file values,
+// but can be overridden by ENV vars and flags.
+type Provider interface {
+	// Load returns the values keyed by config key, e.g. "db.password".
+	Load() ([]ProvidedValue, error)
+}
+
+// ContextProvider is a Provider that can be bounded by a context,
+// e.g. the one given to UnmarshalExactContext. LoadContext is called
+// instead of Load by the unmarshal pipeline.
+type ContextProvider interface {
+	Provider
+	// LoadContext is Load, which stops when ctx is done.
+	LoadContext(ctx context.Context) ([]ProvidedValue, error)
+}
+
+// ProvidedValue is a config value returned by a Provider.
+type ProvidedValue struct {
+	// Value is the config value.
+	Value interface{}
+	// Key is the config key, e.g. "db.password".
+	Key string
+	// TTL is the lifetime of the value (e.g. a secret lease duration).
+	// Zero means the value never expires.
+	TTL time.Duration
+}
+
+// minRefreshDelay is the minimal delay between two refresh attempts.
+const minRefreshDelay = time.Second
+
+// Expirations returns the expiration time of the provided values
+// having non-zero TTL, keyed by config key.
+func (sch *SnakeCharmer) Expirations() map[string]time.Time {
+	expirations := map[string]time.Time{}
+	if v := sch.loadView(); v != nil {
+		expirations = v.expirations
+	}
+	result := make(map[string]time.Time, len(expirations))
+	for key, exp := range expirations {
+		result[key] = exp
+	}
+	return result
+}
+
+// mergeInProviders loads the values from providers,
+// merges them into viper config and tracks their expiration time.
+func (sch *SnakeCharmer) mergeInProviders() error {
+	providers := append(append([]Provider{}, sch.providers...), sch.bootstrapped...)
+	if len(providers) == 0 {
+		return nil
+	}
+	now := time.Now()
+	expirations := make(map[string]time.Time)
+	for _, p := range providers {
+		if err := sch.checkContext(); err != nil {
+			return err
+		}
+		values, err := loadProvider(sch.runContext(), p)
+		if err != nil {
+			return fmt.Errorf("while loading values from provider %T: %w", p, err)
+		}
+		for _, pv := range values {
+			if err = sch.backend.MergeConfigMap(nestedMap(pv.Key, pv.Value)); err != nil {
+				return fmt.Errorf("while merging value of %q from provider %T: %w", pv.Key, p, err)
+			}
+			sch.setLayerSource(pv.Key, pv.Value, SourceProvider)
+			if pv.TTL > 0 {
+				expirations[pv.Key] = now.Add(pv.TTL)
+			} else {
+				delete(expirations, pv.Key)
+			}
+		}
+	}
+	sch.expirations = expirations
+	sch.scheduleRefresh()
+	return nil
+}
+
+// loadProvider loads the values from the provider,
+// passing ctx to ContextProvider.
+func loadProvider(ctx context.Context, p Provider) ([]ProvidedValue, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.LoadContext(ctx)
+	}
+	return p.Load()
+}
+
+// scheduleRefresh schedules the reload before the earliest value expiration.
+// The reload is attempted refreshWindow before the expiration,
+// or halfway to the expiration if it is closer than refreshWindow.
+func (sch *SnakeCharmer) scheduleRefresh() {
+	sch.stopRefresh()
+	if len(sch.expirations) == 0 || sch.ctx.Err() != nil {
+		return
+	}
+	var earliest time.Time
+	for _, exp := range sch.expirations {
+		if earliest.IsZero() || exp.Before(earliest) {
+			earliest = exp
+		}
+	}
+	remaining := time.Until(earliest)
+	if remaining <= 0 {
+		// Already expired, nothing can be done
+		return
+	}
+	delay := remaining - sch.refreshWindow
+	if delay <= 0 {
+		delay = remaining / 2
+	}
+	if delay < minRefreshDelay && remaining > minRefreshDelay {
+		delay = minRefreshDelay
+	}
+	sch.wg.Add(1)
+	sch.refreshTimer = time.AfterFunc(delay, func() {
+		// The error handler is called once the refresh is done,
+		// since it may call Close waiting for the refresh
+		if notify := sch.refresh(); notify != nil {
+			notify()
+		}
+	})
+}
+
+// stopRefresh stops the scheduled refresh, if any.
+func (sch *SnakeCharmer) stopRefresh() {
+	if sch.refreshTimer == nil {
+		return
+	}
+	if sch.refreshTimer.Stop() {
+		// The refresh did not run, so it is not waited for
+		sch.wg.Done()
+	}
+	sch.refreshTimer = nil
+}
+
+// refresh runs the reload pipeline for the expiring values and releases
+// the slot of the scheduled refresh in sch.wg. On failure it schedules
+// a retry and returns the call of the refresh error handler, if any.
+func (sch *SnakeCharmer) refresh() (notify func()) {
+	defer sch.wg.Done()
+	sch.mu.Lock()
+	ctx := sch.ctx
+	sch.mu.Unlock()
+	if ctx.Err() != nil {
+		// Closed or the context is done
+		return nil
+	}
+	err := sch.Reload()
+	if err == nil || errors.Is(err, ErrClosed) {
+		return nil
+	}
+	sch.mu.Lock()
+	deadline := time.Now().Add(sch.refreshWindow)
+	expiring := make([]string, 0, len(sch.expirations))
+	for key, exp := range sch.expirations {
+		if !exp.After(deadline) {
+			expiring = append(expiring, key)
+		}
+	}
+	sort.Strings(expiring)
+	sch.scheduleRefresh()
+	handler := sch.refreshErrorHandler
+	sch.mu.Unlock()
+
+	if handler == nil {
+		return nil
+	}
+	return func() { handler(expiring, err) }
+}
+
+// nestedMap converts the dot separated key and the value
+// into a nested map, e.g. "db.password" -> {"db": {"password": value}}
+func nestedMap(key string, value interface{}) map[string]interface{} {
+	path := strings.Split(key, ".")
+	result := map[string]interface{}{path[len(path)-1]: value}
+	for i := len(path) - 2; i >= 0; i-- {
+		result = map[string]interface{}{path[i]: result}
+	}
+	return result
+}
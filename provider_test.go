@@ -0,0 +1,214 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testProvider struct {
+	values []ProvidedValue
+	err    error
+	calls  int
+	mu     sync.Mutex
+}
+
+func (p *testProvider) Load() ([]ProvidedValue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.calls > 1 && p.err != nil {
+		return nil, p.err
+	}
+	return p.values, nil
+}
+
+type testSecretStruct struct {
+	DB struct {
+		User     string `snakecharmer:"user" usage:"DB user" default:"admin"`
+		Password string `snakecharmer:"password" usage:"DB password"`
+	} `snakecharmer:"db"`
+}
+
+func Test_ProviderValues(t *testing.T) {
+	result := &testSecretStruct{}
+	provider := &testProvider{
+		values: []ProvidedValue{
+			{Key: "db.password", Value: "s3cr3t", TTL: time.Hour},
+		},
+	}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithProvider(provider),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, "admin", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	exp := charmer.Expirations()
+	require.Len(t, exp, 1)
+	require.WithinDuration(t, time.Now().Add(time.Hour), exp["db.password"], time.Minute)
+}
+
+func Test_ProviderRemovedValue(t *testing.T) {
+	result := &testSecretStruct{}
+	provider := &testProvider{
+		values: []ProvidedValue{
+			{Key: "db.user", Value: "app"},
+			{Key: "db.password", Value: "s3cr3t"},
+		},
+	}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithProvider(provider),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// The revoked secret is not kept by the reload
+	provider.mu.Lock()
+	provider.values = []ProvidedValue{{Key: "db.user", Value: "app"}}
+	provider.mu.Unlock()
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, "app", result.DB.User)
+	require.Equal(t, "", result.DB.Password)
+}
+
+func Test_ProviderRefreshError(t *testing.T) {
+	result := &testSecretStruct{}
+	provider := &testProvider{
+		values: []ProvidedValue{
+			{Key: "db.password", Value: "s3cr3t", TTL: 200 * time.Millisecond},
+		},
+		err: fmt.Errorf("vault is sealed"),
+	}
+	type refreshError struct {
+		err  error
+		keys []string
+	}
+	errCh := make(chan refreshError, 10)
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithProvider(provider),
+		WithRefreshWindow(100*time.Millisecond),
+		WithRefreshErrorHandler(func(keys []string, err error) {
+			errCh <- refreshError{keys: keys, err: err}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	select {
+	case re := <-errCh:
+		require.Equal(t, []string{"db.password"}, re.keys)
+		require.ErrorContains(t, re.err, "vault is sealed")
+	case <-time.After(time.Second):
+		t.Fatalf("refresh error handler was not called")
+	}
+}
+
+func Test_ProviderError(t *testing.T) {
+	f := func(opts ...CharmingOption) {
+		t.Helper()
+		_, err := NewSnakeCharmer(opts...)
+		if err == nil {
+			t.Fatalf("expecting non-nil error in NewSnakeCharmer()")
+		}
+	}
+	result := &testSecretStruct{}
+	cmd := &cobra.Command{}
+
+	f(WithResultStruct(result), WithCobraCommand(cmd), WithProvider(nil))
+	f(WithResultStruct(result), WithCobraCommand(cmd), WithRefreshWindow(0))
+}
+
+type testBootstrapStruct struct {
+	Vault struct {
+		Addr  string `snakecharmer:"addr" env:"TEST_VAULT_ADDR" usage:"Vault address"`
+		Token string `snakecharmer:"token,secret" env:"TEST_VAULT_TOKEN" usage:"Vault token"`
+	} `snakecharmer:"vault"`
+}
+
+func Test_WithBootstrap(t *testing.T) {
+	t.Setenv("TEST_VAULT_ADDR", "https://vault:8200")
+	t.Setenv("TEST_VAULT_TOKEN", "root-token")
+
+	bootstrap := &testBootstrapStruct{}
+	result := &testSecretStruct{}
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithBootstrap(bootstrap, func() ([]Provider, error) {
+			if bootstrap.Vault.Token != "root-token" {
+				return nil, fmt.Errorf("invalid token")
+			}
+			return []Provider{&testProvider{values: []ProvidedValue{
+				{Key: "db.password", Value: "from " + bootstrap.Vault.Addr},
+			}}}, nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NotNil(t, cmd.PersistentFlags().Lookup("vault.addr"))
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, "https://vault:8200", bootstrap.Vault.Addr)
+	require.Equal(t, "from https://vault:8200", result.DB.Password)
+
+	t.Setenv("TEST_VAULT_TOKEN", "bad-token")
+	require.Error(t, charmer.Reload())
+
+	_, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithBootstrap(testBootstrapStruct{}, nil),
+	)
+	require.Error(t, err)
+}
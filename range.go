@@ -0,0 +1,219 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+)
+
+// parseRangeValue converts the value of the numeric field type
+// into int64, uint64 or float64 the range bounds are compared as.
+// Durations, e.g. "5s", and byte sizes, e.g. "1MiB", are compared
+// as the number of nanoseconds and bytes.
+func parseRangeValue(t reflect.Type, value interface{}) (interface{}, error) {
+	switch t {
+	case durationType:
+		d, err := cast.ToDurationE(value)
+		return int64(d), err
+	case byteSizeType:
+		if s, ok := value.(string); ok {
+			size, err := ParseByteSize(s)
+			return int64(size), err
+		}
+		return cast.ToInt64E(value)
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cast.ToInt64E(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cast.ToUint64E(value)
+	case reflect.Float32, reflect.Float64:
+		return cast.ToFloat64E(value)
+	}
+	return nil, fmt.Errorf("non-numeric type %s", t)
+}
+
+// compareRangeValues returns -1, 0 or 1 if a is less than, equal to
+// or greater than b, both of the same type returned by parseRangeValue.
+func compareRangeValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		return compareOrdered(a, b.(int64))
+	case uint64:
+		return compareOrdered(a, b.(uint64))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	}
+	return 0
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// checkRangeTags verifies the min and max tags of the field, e.g.
+// `min:"1" max:"65535"`, parse as the values of the numeric field type.
+func checkRangeTags(t reflect.Type, minValue, maxValue string) error {
+	var bounds []interface{}
+	for _, tag := range []struct{ name, value string }{{"min", minValue}, {"max", maxValue}} {
+		if len(tag.value) == 0 {
+			continue
+		}
+		bound, err := parseRangeValue(t, tag.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag %q: %w", tag.name, tag.value, err)
+		}
+		if overflows(t, bound) {
+			return fmt.Errorf("%s tag %q overflows %s", tag.name, tag.value, t)
+		}
+		bounds = append(bounds, bound)
+	}
+	if len(minValue) > 0 && len(maxValue) > 0 && compareRangeValues(bounds[0], bounds[1]) > 0 {
+		return fmt.Errorf("min tag %q is greater than max tag %q", minValue, maxValue)
+	}
+	return nil
+}
+
+// rangeUsage describes the allowed range of the min and max tags,
+// e.g. "must be in the range [1, 65535]".
+func rangeUsage(minValue, maxValue string) string {
+	switch {
+	case len(minValue) > 0 && len(maxValue) > 0:
+		return fmt.Sprintf("must be in the range [%s, %s]", minValue, maxValue)
+	case len(minValue) > 0:
+		return "must be at least " + minValue
+	}
+	return "must be at most " + maxValue
+}
+
+// checkRanges verifies that the final values of the numeric fields
+// with the min and max tags, e.g. `min:"1" max:"65535"`, are in the range.
+// The values of the wrong type are left to the decoder to report.
+// It returns FieldError per out of range value naming the config key,
+// the flag and the ENV vars the value can be set with.
+func (sch *SnakeCharmer) checkRanges(settings map[string]interface{}) []error {
+	errs := []error{}
+	for _, b := range sch.bindings {
+		if len(b.min) == 0 && len(b.max) == 0 {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		value, ok := parent[name]
+		if !ok || value == nil {
+			continue
+		}
+		v, err := parseRangeValue(b.typ, value)
+		if err != nil {
+			continue
+		}
+		inRange := true
+		if len(b.min) > 0 {
+			bound, _ := parseRangeValue(b.typ, b.min)
+			inRange = compareRangeValues(v, bound) >= 0
+		}
+		if len(b.max) > 0 && inRange {
+			bound, _ := parseRangeValue(b.typ, b.max)
+			inRange = compareRangeValues(v, bound) <= 0
+		}
+		if inRange {
+			continue
+		}
+		s := fmt.Sprint(value)
+		if b.secret {
+			s = redacted
+		}
+		errs = append(errs, sch.newFieldError(b.key,
+			fmt.Errorf("invalid value %s of %q%s: %s", s, b.key, b.sourcesUsage(), rangeUsage(b.min, b.max))))
+	}
+	return errs
+}
+
+// sourcesUsage returns the flag and the ENV vars the value of the field
+// can be set with, e.g. ` (flag --port, env APP_PORT)`, or "" if there are none.
+func (b fieldBinding) sourcesUsage() string {
+	sources := []string{}
+	if !b.noFlag {
+		sources = append(sources, "flag --"+b.key)
+	}
+	if len(b.envs) > 0 {
+		sources = append(sources, "env "+strings.Join(b.envs, ", "))
+	}
+	if len(sources) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(sources, ", ") + ")"
+}
+
+// overflowHookFunc returns a mapstructure.DecodeHookFunc that rejects
+// the numbers overflowing the numeric field type, e.g. 300 decoded
+// into uint8 or -1 decoded into uint, which mapstructure truncates silently.
+func overflowHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if overflows(t, data) {
+			return nil, fmt.Errorf("value %v overflows %s", data, t)
+		}
+		return data, nil
+	}
+}
+
+// overflows returns true if the number cannot be represented
+// by the numeric type t. Non-numeric data and types are skipped.
+func overflows(t reflect.Type, data interface{}) bool {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		return false
+	}
+	target := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return target.OverflowInt(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return v.Uint() > 1<<63-1 || target.OverflowInt(int64(v.Uint()))
+		case reflect.Float32, reflect.Float64:
+			return v.Float() < -(1<<63) || v.Float() >= 1<<63 || target.OverflowInt(int64(v.Float()))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int() < 0 || target.OverflowUint(uint64(v.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return target.OverflowUint(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			return v.Float() < 0 || v.Float() >= 1<<64 || target.OverflowUint(uint64(v.Float()))
+		}
+	case reflect.Float32:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return target.OverflowFloat(v.Float())
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testRangeStruct struct {
+	Port    int           `snakecharmer:"port" env:"TEST_RANGE_PORT" usage:"Port to listen on" min:"1" max:"65535" default:"8080"`
+	Workers uint          `snakecharmer:"workers" usage:"Number of workers" min:"1" default:"1"`
+	Ratio   float64       `snakecharmer:"ratio" usage:"Sampling ratio" max:"1" config:"-"`
+	Timeout time.Duration `snakecharmer:"timeout" usage:"Timeout" min:"1s" max:"1m"`
+	Buffer  ByteSize      `snakecharmer:"buffer" usage:"Buffer size" max:"1MiB" default:"4KiB"`
+	Weight  uint8         `snakecharmer:"weight,noflag" usage:"Weight"`
+}
+
+func Test_Ranges(t *testing.T) {
+	f := func(config string, args ...string) (*testRangeStruct, error) {
+		t.Helper()
+		result := &testRangeStruct{Timeout: 5 * time.Second}
+		cmd := &cobra.Command{Use: "test", Run: func(cmd *cobra.Command, args []string) {}}
+		opts := []CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}
+		if len(config) > 0 {
+			opts = append(opts, WithConfigBytes([]byte(config), "yaml"))
+		}
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("")
+	require.NoError(t, err)
+	require.Equal(t, 8080, result.Port)
+	require.Equal(t, uint(1), result.Workers)
+
+	result, err = f("timeout: 1m\n", "--port", "1", "--workers", "4", "--buffer", "1MiB")
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Port)
+	require.Equal(t, uint(4), result.Workers)
+	require.Equal(t, time.Minute, result.Timeout)
+	require.Equal(t, ByteSize(1<<20), result.Buffer)
+
+	_, err = f("", "--port", "70000")
+	require.EqualError(t, err,
+		`invalid value 70000 of "port" (flag --port, env TEST_RANGE_PORT): must be in the range [1, 65535]`)
+
+	t.Setenv("TEST_RANGE_PORT", "0")
+	_, err = f("")
+	require.EqualError(t, err,
+		`invalid value 0 of "port" (flag --port, env TEST_RANGE_PORT): must be in the range [1, 65535]`)
+	t.Setenv("TEST_RANGE_PORT", "")
+
+	_, err = f("", "--ratio", "1.5")
+	require.EqualError(t, err, `invalid value 1.5 of "ratio" (flag --ratio): must be at most 1`)
+
+	_, err = f("timeout: 500ms\n")
+	require.EqualError(t, err, `invalid value 500ms of "timeout" (flag --timeout): must be in the range [1s, 1m]`)
+
+	_, err = f("", "--buffer", "2MiB")
+	require.EqualError(t, err, `invalid value 2MiB of "buffer" (flag --buffer): must be at most 1MiB`)
+
+	_, err = f("workers: 0\n")
+	require.EqualError(t, err, `invalid value 0 of "workers" (flag --workers): must be at least 1`)
+
+	// The numbers overflowing the field type are rejected
+	_, err = f("weight: 300\n")
+	require.ErrorContains(t, err, `value 300 overflows uint8`)
+
+	_, err = f("weight: -1\n")
+	require.ErrorContains(t, err, `value -1 overflows uint8`)
+
+	result, err = f("weight: 255\n")
+	require.NoError(t, err)
+	require.Equal(t, uint8(255), result.Weight)
+}
+
+func Test_RangeTags(t *testing.T) {
+	f := func(result interface{}, expected string) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		)
+		require.NoError(t, err)
+		require.PanicsWithValue(t, expected, charmer.AddFlags)
+	}
+
+	f(&struct {
+		Name string `snakecharmer:"name" usage:"Name" min:"1"`
+	}{}, `BUG: invalid range tags for field "Name": invalid min tag "1": non-numeric type string`)
+	f(&struct {
+		Port uint16 `snakecharmer:"port" usage:"Port" min:"-1"`
+	}{}, `BUG: invalid range tags for field "Port": invalid min tag "-1": unable to cast negative value`)
+	f(&struct {
+		Port uint16 `snakecharmer:"port" usage:"Port" max:"70000"`
+	}{}, `BUG: invalid range tags for field "Port": max tag "70000" overflows uint16`)
+	f(&struct {
+		Port int `snakecharmer:"port" usage:"Port" min:"10" max:"1"`
+	}{}, `BUG: invalid range tags for field "Port": min tag "10" is greater than max tag "1"`)
+}
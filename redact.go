@@ -0,0 +1,204 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// redacted replaces the values of secret fields in the output
+const redacted = "***"
+
+// flagErrorRe matches the pflag error of an invalid flag value, e.g.
+// invalid argument "abc" for "-k, --api-key" flag: ...
+var flagErrorRe = regexp.MustCompile(`^invalid argument ("(?:[^"\\]|\\.)*") for "([^"]*)" flag: `)
+
+// setFlagErrorFunc installs the cobra FlagErrorFunc that redacts
+// the values of the flags of secret fields, e.g. `snakecharmer:"api-key,secret"`,
+// in the flag parse errors. The FlagErrorFunc set before is called
+// with the redacted error.
+func (sch *SnakeCharmer) setFlagErrorFunc() {
+	hasSecrets := false
+	for _, b := range sch.bindings {
+		hasSecrets = hasSecrets || b.secret
+	}
+	if !hasSecrets || sch.cmd == nil {
+		return
+	}
+	next := sch.cmd.FlagErrorFunc()
+	sch.cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return next(cmd, sch.redactFlagError(err))
+	})
+}
+
+// redactFlagError replaces the value of the secret flag in the flag parse error.
+func (sch *SnakeCharmer) redactFlagError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	m := flagErrorRe.FindStringSubmatch(msg)
+	if m == nil || !sch.isSecretFlag(m[2]) {
+		return err
+	}
+	// The underlying error (e.g. of strconv) may contain the value as well
+	quoted, cause := m[1], msg[len(m[0]):]
+	cause = strings.ReplaceAll(cause, quoted, strconv.Quote(redacted))
+	if value, uerr := strconv.Unquote(quoted); uerr == nil && len(value) > 0 {
+		cause = strings.ReplaceAll(cause, value, redacted)
+	}
+	return fmt.Errorf("invalid argument %q for %q flag: %s", redacted, m[2], cause)
+}
+
+// isSecretFlag returns true if the flag of a secret field is named
+// in the pflag error, e.g. "-k, --api-key" or "--api-key".
+func (sch *SnakeCharmer) isSecretFlag(flagName string) bool {
+	for _, b := range sch.bindings {
+		if !b.secret {
+			continue
+		}
+		for _, name := range strings.Split(flagName, ", ") {
+			if name == "--"+b.key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RedactedSettings returns the merged config settings, like viper.AllSettings(),
+// with the values of secret fields, e.g. `snakecharmer:"password,secret"`
+// or `secret:"true"`, replaced with "***". It is safe for debug dumps.
+func (sch *SnakeCharmer) RedactedSettings() map[string]interface{} {
+	if v := sch.loadView(); v != nil {
+		return normalizeValue(v.settings).(map[string]interface{})
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.redactSettings(sch.backend.AllSettings())
+}
+
+// redactSettings returns the deep copy of the settings
+// with the values of secret fields replaced with "***".
+func (sch *SnakeCharmer) redactSettings(settings map[string]interface{}) map[string]interface{} {
+	result := normalizeValue(settings).(map[string]interface{})
+	for _, b := range sch.bindings {
+		if !b.secret {
+			continue
+		}
+		parent, name := settingsParent(result, b.key)
+		if parent == nil {
+			continue
+		}
+		if _, ok := parent[name]; ok {
+			parent[name] = redacted
+		}
+	}
+	return result
+}
+
+// minRedactLen is the min length of the secret value redacted wherever
+// it is found in the string, the shorter ones, e.g. "true", would garble
+// the message and hint at the secret, so only their quoted occurrences are redacted.
+const minRedactLen = 4
+
+// redactString replaces the values of secret fields found in the settings,
+// and their default values, with "***" in the string, e.g. in the error message.
+// The quoted values, e.g. "s3cr3t" or 's3cr3t' as mapstructure and strconv
+// errors quote them, are always redacted, and the unquoted ones
+// if they are at least minRedactLen long.
+func (sch *SnakeCharmer) redactString(s string, settings map[string]interface{}) string {
+	values := []string{}
+	for _, b := range sch.bindings {
+		if !b.secret {
+			continue
+		}
+		values = append(values, secretStrings(b.defaultValue)...)
+		if parent, name := settingsParent(settings, b.key); parent != nil {
+			values = append(values, secretStrings(parent[name])...)
+		}
+	}
+	// Replace longer values first, so their substrings do not break them
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		s = strings.ReplaceAll(s, strconv.Quote(v), strconv.Quote(redacted))
+		s = strings.ReplaceAll(s, "'"+v+"'", "'"+redacted+"'")
+		if len(v) >= minRedactLen {
+			s = strings.ReplaceAll(s, v, redacted)
+		}
+	}
+	return s
+}
+
+// redactedError is the error with the values of secret fields redacted
+// from its message. The original error is kept for errors.Is and errors.As,
+// its message must not be revealed.
+type redactedError struct {
+	msg string
+	err error
+}
+
+// Error implements the error interface.
+func (e *redactedError) Error() string { return e.msg }
+
+// Unwrap returns the original error.
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns the error with the values of secret fields found
+// in the settings redacted from its message, see redactString.
+func (sch *SnakeCharmer) redactError(err error, settings map[string]interface{}) error {
+	msg := sch.redactString(err.Error(), settings)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// secretStrings returns the string representations of the secret value,
+// including the elements of a slice. Empty and zero values are skipped.
+func secretStrings(value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	if items, ok := normalizeValue(value).([]interface{}); ok {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, secretStrings(item)...)
+		}
+		return result
+	}
+	s := fmt.Sprint(value)
+	switch s {
+	case "", "0", "false", "<nil>", "map[]":
+		return nil
+	}
+	return []string{s}
+}
+
+// settingsParent returns the nested settings map holding the dotted key
+// and the last key segment, or nil if there is no such map.
+func settingsParent(settings map[string]interface{}, key string) (map[string]interface{}, string) {
+	key = strings.ToLower(key)
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return nestedSettings(settings, key[:i]), key[i+1:]
+	}
+	return settings, key
+}
@@ -0,0 +1,138 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testRedactStruct struct {
+	Workers int    `snakecharmer:"workers" usage:"Number of workers to run"`
+	PIN     int    `snakecharmer:"pin,secret" usage:"PIN code"`
+	APIKey  string `snakecharmer:"api-key,secret" usage:"API key"`
+}
+
+func Test_FlagErrorRedaction(t *testing.T) {
+	f := func(args []string, expected string) {
+		t.Helper()
+		cmd := &cobra.Command{Use: "app", Run: func(cmd *cobra.Command, args []string) {}}
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testRedactStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		cmd.SetArgs(args)
+		err = cmd.Execute()
+		require.EqualError(t, err, expected)
+	}
+
+	f([]string{"--pin", "12ab"},
+		`invalid argument "***" for "--pin" flag: strconv.ParseInt: parsing "***": invalid syntax`)
+	f([]string{"--workers", "12ab"},
+		`invalid argument "12ab" for "--workers" flag: strconv.ParseInt: parsing "12ab": invalid syntax`)
+}
+
+func Test_SecretRedaction(t *testing.T) {
+	type testDBStruct struct {
+		User     string `snakecharmer:"user" usage:"DB user"`
+		Password string `snakecharmer:"password" env:"TEST_DB_PASSWORD" secret:"true" usage:"DB password" default:"changeme"`
+		PIN      int    `snakecharmer:"pin,secret" usage:"PIN code"`
+	}
+	result := &struct {
+		DB testDBStruct `snakecharmer:"db"`
+	}{}
+	cmd := &cobra.Command{Use: "app"}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	charmer.AttachEnvCommand(cmd)
+
+	require.Equal(t, map[string]interface{}{
+		"db": map[string]interface{}{"user": "", "password": "***", "pin": "***"},
+	}, charmer.RedactedSettings())
+
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"env"})
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.Contains(t, out.String(), "TEST_DB_PASSWORD")
+	require.NotContains(t, out.String(), "changeme")
+
+	t.Setenv("TEST_DB_PASSWORD", "s3cr3t-value")
+	require.NotContains(t, fmt.Sprint(charmer.RedactedSettings()), "s3cr3t-value")
+
+	// The invalid value of a secret field is not revealed in the decoding error
+	if err = cmd.PersistentFlags().Set("db.pin", "1234"); err != nil {
+		t.Fatalf("unexpected error in Set(): %s", err.Error())
+	}
+	err = charmer.Reload(WithDecoderConfigOption(func(dc *mapstructure.DecoderConfig) {
+		dc.DecodeHook = func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			if to.Kind() == reflect.Int {
+				return nil, fmt.Errorf("invalid value %v", data)
+			}
+			return data, nil
+		}
+	}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid value ***")
+	require.NotContains(t, err.Error(), "1234")
+}
+
+func Test_redactError(t *testing.T) {
+	sch := &SnakeCharmer{bindings: []fieldBinding{{key: "api-key", secret: true}}}
+	settings := map[string]interface{}{"api-key": "s3cr3t"}
+
+	base := errors.New(`invalid value "s3cr3t"`)
+	err := fmt.Errorf("while unmarshalling: %w", sch.redactError(base, settings))
+	require.EqualError(t, err, `while unmarshalling: invalid value "***"`)
+	require.True(t, errors.Is(err, base))
+
+	// The error without secrets is returned as is
+	base = errors.New("invalid value")
+	require.Same(t, base, sch.redactError(base, settings))
+
+	// The short secrets are redacted where quoted only
+	sch = &SnakeCharmer{bindings: []fieldBinding{{key: "db.x1x", secret: true}}}
+	settings = map[string]interface{}{"db": map[string]interface{}{"x1x": "1x"}}
+	base = errors.New(`cannot parse 'db.x1x' as int: strconv.ParseInt: parsing "1x": invalid syntax`)
+	require.EqualError(t, sch.redactError(base, settings),
+		`cannot parse 'db.x1x' as int: strconv.ParseInt: parsing "***": invalid syntax`)
+	base = errors.New(`'db.x1x' expected type 'int', got unconvertible type 'string', value: '1x'`)
+	require.EqualError(t, sch.redactError(base, settings),
+		`'db.x1x' expected type 'int', got unconvertible type 'string', value: '***'`)
+}
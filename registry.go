@@ -0,0 +1,113 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// registeredSection is the config section registered with RegisterSection.
+type registeredSection struct {
+	name   string
+	target reflect.Value
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]registeredSection{}
+)
+
+// RegisterSection registers the pointer to the struct holding the settings
+// of the config section with the given name, e.g. "cache", so that
+// BuildCharmer assembles all the registered sections into a single
+// flag and config tree: the section fields get the flags, ENV vars
+// and config keys prefixed with the section name, e.g. "cache.size".
+// It is meant to be called from init functions of the modules
+// that self-register their settings.
+// It panics if the name is empty or already registered,
+// or the target is not a pointer to a struct.
+func RegisterSection(name string, target interface{}) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		panic("snakecharmer: section name is an empty string")
+	}
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("snakecharmer: target of section %q must be a pointer to a struct, got %T", name, target))
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("snakecharmer: section %q is already registered", name))
+	}
+	registry[name] = registeredSection{name: name, target: v}
+}
+
+// BuildCharmer creates the SnakeCharmer for the sections registered
+// with RegisterSection (in the name order) and the given cobra command.
+// The result struct is assembled from the sections, the values are
+// copied into the registered targets after every unmarshal,
+// so the targets are the ones to read the settings from.
+// The options are applied as in NewSnakeCharmer, the section names are
+// written to the field tag (see WithFieldTagName), so the tag dialect
+// must be TagDialectSnakeCharmer.
+func BuildCharmer(cmd *cobra.Command, opts ...CharmingOption) (*SnakeCharmer, error) {
+	registryMu.Lock()
+	sections := make([]registeredSection, 0, len(registry))
+	for _, s := range registry {
+		sections = append(sections, s)
+	}
+	registryMu.Unlock()
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no sections are registered")
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i].name < sections[j].name })
+
+	opts = append([]CharmingOption{WithCobraCommand(cmd), WithResultStruct(&struct{}{})}, opts...)
+	sch, err := NewSnakeCharmer(opts...)
+	if err != nil {
+		return sch, err
+	}
+	if sch.tagDialect != TagDialectSnakeCharmer {
+		return sch, fmt.Errorf("registered sections require the snakecharmer tag dialect")
+	}
+
+	fields := make([]reflect.StructField, 0, len(sections))
+	for i, s := range sections {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Section%d", i),
+			Type: s.target.Elem().Type(),
+			Tag:  reflect.StructTag(fmt.Sprintf("%s:%q", sch.fieldTagName, s.name)),
+		})
+	}
+	result := reflect.New(reflect.StructOf(fields))
+	for i, s := range sections {
+		// The current values of the targets are used as defaults
+		result.Elem().Field(i).Set(s.target.Elem())
+	}
+	sch.resultStruct = result.Interface()
+	sch.afterDecode = append(sch.afterDecode, func() {
+		for i, s := range sections {
+			s.target.Elem().Set(result.Elem().Field(i))
+		}
+	})
+	return sch, nil
+}
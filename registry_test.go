@@ -0,0 +1,78 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testCacheSection struct {
+	Size int    `snakecharmer:"size" usage:"Cache size" default:"100"`
+	TTL  string `snakecharmer:"ttl" usage:"Cache TTL"`
+}
+
+type testDBSection struct {
+	DSN  string `snakecharmer:"dsn" env:"TEST_REGISTRY_DSN" usage:"DB DSN"`
+	Pool int    `snakecharmer:"pool" usage:"DB pool size"`
+}
+
+func Test_RegisterSection(t *testing.T) {
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		registry = map[string]registeredSection{}
+	})
+
+	_, err := BuildCharmer(&cobra.Command{})
+	require.Error(t, err)
+
+	cache := &testCacheSection{TTL: "1m"}
+	db := &testDBSection{Pool: 10}
+	RegisterSection("cache", cache)
+	RegisterSection("db", db)
+	require.Panics(t, func() { RegisterSection("db", &testDBSection{}) })
+	require.Panics(t, func() { RegisterSection("bad", testDBSection{}) })
+	require.Panics(t, func() { RegisterSection("", &testDBSection{}) })
+
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err = os.WriteFile(config, []byte("db:\n  pool: 20\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_REGISTRY_DSN", "postgres://localhost/app")
+
+	cmd := &cobra.Command{}
+	charmer, err := BuildCharmer(cmd,
+		WithFieldTagName("snakecharmer"),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in BuildCharmer(): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Equal(t, "1m", cmd.PersistentFlags().Lookup("cache.ttl").DefValue)
+	require.Equal(t, "10", cmd.PersistentFlags().Lookup("db.pool").DefValue)
+
+	if err = cmd.ParseFlags([]string{"--cache.size", "500"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, testCacheSection{Size: 500, TTL: "1m"}, *cache)
+	require.Equal(t, testDBSection{DSN: "postgres://localhost/app", Pool: 20}, *db)
+}
@@ -0,0 +1,92 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// resolveRelPaths resolves relative paths of the fields with the relpath modifier,
+// e.g. `mapstructure:"cert-file,relpath"`, against the directory of the config file
+// that defined them. Values provided by flags and ENV vars are kept as is,
+// i.e. relative to the process working directory.
+func (sch *SnakeCharmer) resolveRelPaths(settings map[string]interface{}, file string) error {
+	var dir string
+	for _, b := range sch.bindings {
+		if !b.relpath {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		value, ok := parent[name]
+		if !ok {
+			continue
+		}
+		if len(dir) == 0 && sch.fsys != nil {
+			// The paths are relative to the root of WithFilesystem
+			dir = filepath.Dir(file)
+		} else if len(dir) == 0 {
+			absFile, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			dir = filepath.Dir(absFile)
+		}
+		parent[name] = resolveRelPath(dir, value)
+	}
+	return nil
+}
+
+// resolveRelPath joins the directory and the path value,
+// which is a string or a list of strings. Empty and absolute paths are kept as is.
+func resolveRelPath(dir string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if len(v) == 0 || filepath.IsAbs(v) {
+			return v
+		}
+		return filepath.Join(dir, v)
+	case []string:
+		paths := make([]string, len(v))
+		for i := range v {
+			paths[i] = resolveRelPath(dir, v[i]).(string)
+		}
+		return paths
+	case []interface{}:
+		paths := make([]interface{}, len(v))
+		for i := range v {
+			paths[i] = resolveRelPath(dir, v[i])
+		}
+		return paths
+	default:
+		return value
+	}
+}
+
+// nestedSettings returns the nested settings map by the dotted key,
+// or nil if there is no such map.
+func nestedSettings(settings map[string]interface{}, key string) map[string]interface{} {
+	for _, k := range strings.Split(key, ".") {
+		m, ok := settings[k].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		settings = m
+	}
+	return settings
+}
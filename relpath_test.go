@@ -0,0 +1,84 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testRelPathStruct struct {
+	CertFile string   `snakecharmer:"cert-file,relpath" usage:"TLS cert file"`
+	KeyFile  string   `snakecharmer:"key-file,relpath" usage:"TLS key file"`
+	CAFiles  []string `snakecharmer:"ca-files,relpath" usage:"TLS CA files" default:"ca.pem"`
+	LogFile  string   `snakecharmer:"log-file" usage:"Log file"`
+	TLS      struct {
+		Include string `snakecharmer:"include,relpath" usage:"Included config"`
+	} `snakecharmer:"tls"`
+}
+
+func Test_RelPath(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(`cert-file: certs/server.pem
+key-file: /etc/ssl/server.key
+ca-files:
+- ca.pem
+- /etc/ssl/ca.pem
+log-file: app.log
+tls:
+  include: ../tls.yaml
+`)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), data, 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	f := func(args ...string) *testRelPathStruct {
+		t.Helper()
+		result := &testRelPathStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(dir),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	result := f()
+	require.Equal(t, filepath.Join(dir, "certs/server.pem"), result.CertFile)
+	require.Equal(t, "/etc/ssl/server.key", result.KeyFile)
+	require.Equal(t, []string{filepath.Join(dir, "ca.pem"), "/etc/ssl/ca.pem"}, result.CAFiles)
+	require.Equal(t, "app.log", result.LogFile)
+	require.Equal(t, filepath.Join(filepath.Dir(dir), "tls.yaml"), result.TLS.Include)
+
+	// The flag value is kept relative to the working directory
+	result = f("--cert-file", "local.pem")
+	require.Equal(t, "local.pem", result.CertFile)
+}
@@ -0,0 +1,231 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RemoteSource reads the config document from a remote key/value store,
+// e.g. Consul KV. The document is merged at the config file priority,
+// after the config files, i.e. it overrides defaults and config file values,
+// but can be overridden by providers, ENV vars and flags.
+// See WithRemoteConfig and WithRemoteSource.
+type RemoteSource interface {
+	// Read returns the config document.
+	Read(ctx context.Context) ([]byte, error)
+}
+
+// RemoteWatcher is implemented by the RemoteSource able to watch
+// the config document for changes, see WatchRemoteConfig.
+type RemoteWatcher interface {
+	// Watch blocks until the config document changes or ctx is done.
+	Watch(ctx context.Context) error
+}
+
+// remoteReadTimeout limits the time of reading the remote config document.
+const remoteReadTimeout = 30 * time.Second
+
+// remoteRetryDelay is the delay before watching again after a failed watch.
+const remoteRetryDelay = 5 * time.Second
+
+// remoteProviders are the names of the remote config stores
+// supported by WithRemoteConfig.
+var remoteProviders = []string{"consul", "etcd3"}
+
+// isRemoteProvider returns true if the remote config store is supported.
+func isRemoteProvider(name string) bool {
+	return stringsContain(remoteProviders, name)
+}
+
+// newRemoteSource returns the RemoteSource set with WithRemoteConfig.
+func (sch *SnakeCharmer) newRemoteSource() (RemoteSource, error) {
+	client := &http.Client{}
+	if sch.remoteTLS != nil {
+		client.Transport = &http.Transport{TLSClientConfig: sch.remoteTLS}
+	}
+	endpoint := strings.TrimSuffix(sch.remoteEndpoint, "/")
+	if !strings.Contains(endpoint, "://") {
+		if sch.remoteTLS != nil {
+			endpoint = "https://" + endpoint
+		} else {
+			endpoint = "http://" + endpoint
+		}
+	}
+	switch sch.remoteProvider {
+	case "consul":
+		return newConsulSource(client, endpoint, sch.remotePath, sch.consulToken()), nil
+	case "etcd3":
+		return newEtcdSource(client, endpoint, sch.remotePath), nil
+	default:
+		return nil, fmt.Errorf("unsupported remote config provider %q", sch.remoteProvider)
+	}
+}
+
+// remoteConfigType returns the format of the remote config document,
+// it is taken from the key extension (e.g. "app/config.json")
+// or the config file type, see WithConfigFileType.
+func (sch *SnakeCharmer) remoteConfigType() string {
+	ext := strings.TrimPrefix(filepath.Ext(sch.remotePath), ".")
+	if len(ext) > 0 && fileExtSupported(ext) {
+		return ext
+	}
+	return sch.configFileType
+}
+
+// mergeInRemoteConfig reads the remote config document and merges it
+// into the viper config layer over the config files.
+func (sch *SnakeCharmer) mergeInRemoteConfig() (err error) {
+	if sch.remote == nil {
+		if sch.remote, err = sch.newRemoteSource(); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(sch.runContext(), remoteReadTimeout)
+	defer cancel()
+	data, err := sch.remote.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("while reading remote config: %w", err)
+	}
+	sch.remoteData = data
+	v := viper.New()
+	v.SetConfigType(sch.remoteConfigType())
+	if err = v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("while parsing remote config: %w", err)
+	}
+	settings := v.AllSettings()
+	if err = sch.migrateConfig("remote config", settings); err != nil {
+		return err
+	}
+	settings, err = sch.applyProfile(settings)
+	if err != nil {
+		return err
+	}
+	sch.applyKeyAliases(settings)
+	if err = sch.checkNoConfig(settings); err != nil {
+		return err
+	}
+	if err = sch.backend.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("while merging remote config: %w", err)
+	}
+	for key, value := range settings {
+		sch.setLayerSource(key, value, SourceRemote)
+	}
+	return nil
+}
+
+// WatchRemoteConfig runs the reload pipeline (see Reload) every time
+// the remote config document changes, until the context is done.
+// The remote source must implement RemoteWatcher, e.g. the Consul
+// and etcd ones do, unless the polling is enabled, see WithRemotePollInterval.
+// onReload (if not nil) is called after every reload with its error,
+// as well as with the watch errors, after which watching is retried.
+// WatchRemoteConfig does not block, the changes are watched in a goroutine,
+// which also stops on Close.
+func (sch *SnakeCharmer) WatchRemoteConfig(ctx context.Context, onReload func(error)) (err error) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if sch.remote == nil {
+		if len(sch.remoteProvider) == 0 {
+			return fmt.Errorf("remote config is not set")
+		}
+		if sch.remote, err = sch.newRemoteSource(); err != nil {
+			return err
+		}
+	}
+	watch := sch.pollRemoteConfig
+	if sch.remotePollInterval <= 0 {
+		watcher, ok := sch.remote.(RemoteWatcher)
+		if !ok {
+			return fmt.Errorf("remote config source %T does not support watching", sch.remote)
+		}
+		watch = watcher.Watch
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := sch.ctx.Done()
+	started := sch.goBackground(func() {
+		defer cancel()
+		go func() {
+			// Stop the running watch on Close
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		for ctx.Err() == nil {
+			err := watch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if onReload != nil {
+					onReload(fmt.Errorf("while watching remote config: %w", err))
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(remoteRetryDelay):
+				}
+				continue
+			}
+			err = sch.Reload()
+			if onReload != nil {
+				onReload(err)
+			}
+		}
+	})
+	if !started {
+		cancel()
+		return ErrClosed
+	}
+	return nil
+}
+
+// pollRemoteConfig reads the remote config document every poll interval
+// (see WithRemotePollInterval) until it differs from the last merged one.
+func (sch *SnakeCharmer) pollRemoteConfig(ctx context.Context) error {
+	sch.mu.Lock()
+	src, interval := sch.remote, sch.remotePollInterval
+	sch.mu.Unlock()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		rctx, cancel := context.WithTimeout(ctx, remoteReadTimeout)
+		data, err := src.Read(rctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		sch.mu.Lock()
+		changed := !bytes.Equal(data, sch.remoteData)
+		sch.mu.Unlock()
+		if changed {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValueResolver resolves the references to the config values kept
+// elsewhere, e.g. "ssm:///app/db/password" (see WithValueResolver).
+type ValueResolver interface {
+	// Resolve returns the value of the reference without the prefix,
+	// e.g. "/app/db/password".
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ValueResolverFunc is an adapter to use a function as a ValueResolver.
+type ValueResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f(ctx, ref).
+func (f ValueResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// prefixedResolver is the ValueResolver of the references with the prefix.
+type prefixedResolver struct {
+	prefix   string
+	resolver ValueResolver
+}
+
+// resolveTimeout limits the time of resolving a single reference.
+const resolveTimeout = 30 * time.Second
+
+// resolverOf returns the resolver of the reference
+// and the reference without the prefix, or nil if there is none.
+// The longest matching prefix wins.
+func (sch *SnakeCharmer) resolverOf(s string) (ValueResolver, string) {
+	for _, r := range sch.resolvers {
+		if strings.HasPrefix(s, r.prefix) {
+			return r.resolver, s[len(r.prefix):]
+		}
+	}
+	return nil, ""
+}
+
+// addResolver adds the resolver keeping the longest prefixes first.
+// The resolver of the same prefix is replaced.
+func (sch *SnakeCharmer) addResolver(prefix string, r ValueResolver) {
+	for i := range sch.resolvers {
+		if sch.resolvers[i].prefix == prefix {
+			sch.resolvers[i].resolver = r
+			return
+		}
+	}
+	sch.resolvers = append(sch.resolvers, prefixedResolver{prefix: prefix, resolver: r})
+	sort.SliceStable(sch.resolvers, func(i, j int) bool {
+		return len(sch.resolvers[i].prefix) > len(sch.resolvers[j].prefix)
+	})
+}
+
+// resolveRef resolves the reference of the value of the config key,
+// the resolved values are cached for the run of the unmarshal pipeline.
+// The empty key is of the config file path, which is always trusted.
+func (sch *SnakeCharmer) resolveRef(s, key string, cache map[string]string) (string, bool, error) {
+	r, ref := sch.resolverOf(s)
+	if r == nil {
+		return s, false, nil
+	}
+	if _, ok := r.(*execResolver); ok && len(key) > 0 {
+		if source, trusted := sch.execTrusted(key, s); !trusted {
+			return "", true, fmt.Errorf("values from %s cannot run commands", source)
+		}
+	}
+	if value, ok := cache[s]; ok {
+		return value, true, nil
+	}
+	ctx, cancel := context.WithTimeout(sch.runContext(), resolveTimeout)
+	defer cancel()
+	value, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return "", true, err
+	}
+	cache[s] = value
+	return value, true, nil
+}
+
+// resolveValues replaces the references in the string values
+// of the settings, including the slice items, with the resolved values.
+func (sch *SnakeCharmer) resolveValues(settings map[string]interface{}) error {
+	if len(sch.resolvers) == 0 {
+		return nil
+	}
+	return sch.resolveMap(settings, "", map[string]string{})
+}
+
+func (sch *SnakeCharmer) resolveMap(settings map[string]interface{}, prefix string, cache map[string]string) error {
+	for name, value := range settings {
+		key := joinKey(prefix, name)
+		resolved, err := sch.resolveValue(value, key, cache)
+		if err != nil {
+			return err
+		}
+		settings[name] = resolved
+	}
+	return nil
+}
+
+func (sch *SnakeCharmer) resolveValue(value interface{}, key string, cache map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		resolved, ok, err := sch.resolveRef(v, key, cache)
+		if err != nil {
+			return nil, fmt.Errorf("while resolving %q of %q: %w", v, key, err)
+		}
+		if ok {
+			return resolved, nil
+		}
+		return v, nil
+	case map[string]interface{}:
+		return v, sch.resolveMap(v, key, cache)
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := sch.resolveValue(item, fmt.Sprintf("%s[%d]", key, i), cache)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	case []string:
+		for i, item := range v {
+			itemKey := fmt.Sprintf("%s[%d]", key, i)
+			resolved, _, err := sch.resolveRef(item, itemKey, cache)
+			if err != nil {
+				return nil, fmt.Errorf("while resolving %q of %q: %w", item, itemKey, err)
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// readConfigRef resolves the config file path which is a reference,
+// e.g. "ssm:///app/config.yaml", and reads the document into the settings map.
+// The format is taken from the reference extension or the config file type.
+func (sch *SnakeCharmer) readConfigRef(path string) (map[string]interface{}, error) {
+	data, _, err := sch.resolveRef(path, "", map[string]string{})
+	if err != nil {
+		return nil, fmt.Errorf("while resolving config %q: %w", path, err)
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if len(ext) == 0 || !fileExtSupported(ext) {
+		ext = sch.configFileType
+	}
+	return sch.readConfigBytes(path, []byte(data), ext)
+}
+
+// mergeInFieldRefs merges the references of the fields with the ref tag,
+// e.g. `ref:"ssm:///app/db/password"`, into the viper config layer,
+// so they are resolved unless overridden by ENV vars or flags.
+func (sch *SnakeCharmer) mergeInFieldRefs() error {
+	for _, b := range sch.bindings {
+		if len(b.ref) == 0 {
+			continue
+		}
+		if err := sch.backend.MergeConfigMap(nestedMap(b.key, b.ref)); err != nil {
+			return fmt.Errorf("while merging reference of %q: %w", b.key, err)
+		}
+		sch.setLayerSource(b.key, b.ref, SourceProvider)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// SchemaVersion is the version of the JSON schema shared by all
+// the machine-readable metadata documents: the bindings (see DumpBindings),
+// the provenance (see DumpEffectiveConfig with "json+source")
+// and the validation report ("config validate --format json").
+// Every document has the "schemaVersion" and "kind" fields.
+// The version is incremented on incompatible changes only,
+// new fields may be added within the same version.
+const SchemaVersion = 1
+
+// The kinds of the metadata documents.
+const (
+	KindBindings   = "bindings"
+	KindProvenance = "provenance"
+	KindValidation = "validation"
+)
+
+// BindingsDocument describes the flags, ENV vars and config keys
+// of the result struct fields.
+type BindingsDocument struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	Bindings      []Binding `json:"bindings"`
+}
+
+// Binding describes the flag, ENV vars and config key of a result struct field.
+type Binding struct {
+	Key      string      `json:"key"`
+	Flag     string      `json:"flag"`
+	Envs     []string    `json:"envs"`
+	Type     string      `json:"type"`
+	Default  interface{} `json:"default"`
+	Usage    string      `json:"usage"`
+	Required bool        `json:"required"`
+	Secret   bool        `json:"secret"`
+	OneOf    []string    `json:"oneOf,omitempty"`
+}
+
+// ProvenanceDocument is the effective config along with the sources
+// of its values (see SourceKind) by config key.
+type ProvenanceDocument struct {
+	SchemaVersion int                    `json:"schemaVersion"`
+	Kind          string                 `json:"kind"`
+	Config        map[string]interface{} `json:"config"`
+	Sources       map[string]string      `json:"sources"`
+}
+
+// ValidationReport is the result of loading and validating the config.
+type ValidationReport struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Kind          string   `json:"kind"`
+	Valid         bool     `json:"valid"`
+	Files         []string `json:"files"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// DumpBindings writes the BindingsDocument as JSON.
+// The default values of secret fields are redacted, the flag
+// is empty for the fields having no flag, e.g. `flag:"-"`.
+// Note, it must be called after AddFlags.
+func (sch *SnakeCharmer) DumpBindings(w io.Writer) error {
+	doc := BindingsDocument{
+		SchemaVersion: SchemaVersion,
+		Kind:          KindBindings,
+		Bindings:      make([]Binding, 0, len(sch.bindings)),
+	}
+	for _, b := range sch.bindings {
+		defaultValue := b.defaultValue
+		if b.secret {
+			defaultValue = redacted
+		} else if b.percent {
+			defaultValue = formatPercent(reflect.ValueOf(b.defaultValue).Float())
+		}
+		envs := b.envs
+		if envs == nil {
+			envs = []string{}
+		}
+		flagName := ""
+		if flag := sch.bindingFlag(b); flag != nil {
+			flagName = flag.Name
+		}
+		doc.Bindings = append(doc.Bindings, Binding{
+			Key:      b.key,
+			Flag:     flagName,
+			Envs:     envs,
+			Type:     b.typ.String(),
+			Default:  defaultValue,
+			Usage:    b.help,
+			Required: b.required,
+			Secret:   b.secret,
+			OneOf:    b.oneOf,
+		})
+	}
+	return writeJSON(w, doc)
+}
+
+// validationReport returns the ValidationReport for the error
+// returned by the unmarshal pipeline.
+func (sch *SnakeCharmer) validationReport(err error) ValidationReport {
+	report := ValidationReport{
+		SchemaVersion: SchemaVersion,
+		Kind:          KindValidation,
+		Valid:         err == nil,
+		Files:         sch.FilesUsed(),
+	}
+	if report.Files == nil {
+		report.Files = []string{}
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
+
+func writeJSON(w io.Writer, doc interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,119 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DumpBindings(t *testing.T) {
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	var out bytes.Buffer
+	require.NoError(t, charmer.DumpBindings(&out))
+	var doc BindingsDocument
+	require.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	require.Equal(t, SchemaVersion, doc.SchemaVersion)
+	require.Equal(t, KindBindings, doc.Kind)
+	require.Len(t, doc.Bindings, 4)
+	require.Equal(t, Binding{
+		Key:     "password",
+		Flag:    "password",
+		Envs:    []string{},
+		Type:    "string",
+		Default: "***",
+		Usage:   "Password",
+		Secret:  true,
+	}, doc.Bindings[1])
+	require.Equal(t, []string{"TEST_DUMP_LOG_LEVEL"}, doc.Bindings[2].Envs)
+	require.Equal(t, "info", doc.Bindings[2].Default)
+
+	// The fields having no flag have no flag name
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(&struct {
+			Workers int    `snakecharmer:"workers" usage:"Number of workers to run"`
+			Token   string `snakecharmer:"token,noflag" usage:"Token"`
+			Region  string `snakecharmer:"region" flag:"-" usage:"Region"`
+		}{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	out.Reset()
+	require.NoError(t, charmer.DumpBindings(&out))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	require.Len(t, doc.Bindings, 3)
+	require.Equal(t, "workers", doc.Bindings[0].Flag)
+	require.Empty(t, doc.Bindings[1].Flag)
+	require.Empty(t, doc.Bindings[2].Flag)
+}
+
+func Test_ValidationReport(t *testing.T) {
+	f := func(opts ...CharmingOption) (ValidationReport, error) {
+		t.Helper()
+		cmd := &cobra.Command{Use: "app"}
+		opts = append([]CharmingOption{
+			WithResultStruct(&testDumpStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		charmer.AttachConfigSubcommands(cmd)
+
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"config", "validate", "--format", "json"})
+		err = cmd.Execute()
+		var report ValidationReport
+		require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+		return report, err
+	}
+
+	report, err := f()
+	require.NoError(t, err)
+	require.Equal(t, ValidationReport{
+		SchemaVersion: SchemaVersion,
+		Kind:          KindValidation,
+		Valid:         true,
+		Files:         []string{},
+	}, report)
+
+	report, err = f(WithConfigFilePath(filepath.Join(t.TempDir(), "missing.yaml")))
+	require.Error(t, err)
+	require.False(t, report.Valid)
+	require.NotEmpty(t, report.Error)
+}
@@ -0,0 +1,79 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mergeInSecretsDir loads the values from the files of the Kubernetes
+// secrets directory (see WithKubernetesSecretsDir) and merges them in
+// above the config file and providers. The file name is either
+// the config key, e.g. "db.password", or one of the ENV var names
+// of the field, e.g. "DB_PASSWORD". The files not matching any field,
+// hidden ones and the "..data" directories of projected volumes
+// are skipped. A missing directory is ignored.
+func (sch *SnakeCharmer) mergeInSecretsDir() error {
+	entries, err := os.ReadDir(sch.secretsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("while reading secrets dir %q: %w", sch.secretsDir, err)
+	}
+	files := make(map[string]string, len(entries))
+	sizes := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(sch.secretsDir, entry.Name())
+		// The keys of projected volumes are symlinks into the ..data dir
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files[entry.Name()] = path
+		sizes[entry.Name()] = info.Size()
+	}
+	for _, b := range sch.bindings {
+		for _, name := range append([]string{b.key}, b.envs...) {
+			path, ok := files[name]
+			if !ok {
+				continue
+			}
+			if err = sch.checkFileSize(path, sizes[name]); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("while reading secret file %q: %w", path, err)
+			}
+			// The editors and `kubectl create secret --from-file` keep the trailing newline
+			value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+			if err = sch.backend.MergeConfigMap(nestedMap(b.key, value)); err != nil {
+				return err
+			}
+			sch.setLayerSource(b.key, value, SourceSecretsDir)
+			sch.filesUsed = append(sch.filesUsed, path)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testSecretsDirStruct struct {
+	Workers int `snakecharmer:"workers" usage:"Number of workers" default:"8"`
+	DB      struct {
+		User     string `snakecharmer:"user" env:"TEST_SECRETS_DB_USER" usage:"DB user" default:"admin"`
+		Password string `snakecharmer:"password,secret" usage:"DB password"`
+	} `snakecharmer:"db"`
+}
+
+func Test_KubernetesSecretsDir(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "..2023_01_01_00_00_00.000000000")
+	if err := os.Mkdir(data, 0o700); err != nil {
+		t.Fatalf("unexpected error in os.Mkdir(): %s", err.Error())
+	}
+	files := map[string]string{
+		"db.password":          "s3cr3t\n",
+		"TEST_SECRETS_DB_USER": "root",
+		"unknown":              "value",
+		".hidden":              "value",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(data, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		if err := os.Symlink(filepath.Join(data, name), filepath.Join(dir, name)); err != nil {
+			t.Fatalf("unexpected error in os.Symlink(): %s", err.Error())
+		}
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 4\ndb:\n  password: from-file\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	f := func(secretsDir string) *testSecretsDirStruct {
+		t.Helper()
+		result := &testSecretsDirStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(config),
+			WithKubernetesSecretsDir(secretsDir),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.NoError(t, charmer.UnmarshalExact())
+		return result
+	}
+
+	result := f(dir)
+	require.Equal(t, 4, result.Workers)
+	require.Equal(t, "root", result.DB.User)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// ENV vars take precedence
+	t.Setenv("TEST_SECRETS_DB_USER", "env")
+	result = f(dir)
+	require.Equal(t, "env", result.DB.User)
+
+	// A missing directory is ignored
+	result = f(filepath.Join(dir, "missing"))
+	require.Equal(t, "from-file", result.DB.Password)
+}
+
+func Test_KubernetesSecretsDirReload(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "db.password")
+	if err := os.WriteFile(password, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testSecretsDirStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithKubernetesSecretsDir(dir),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, "s3cr3t", result.DB.Password)
+
+	// The deleted secret file is not kept by the reload
+	if err = os.Remove(password); err != nil {
+		t.Fatalf("unexpected error in os.Remove(): %s", err.Error())
+	}
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, "", result.DB.Password)
+}
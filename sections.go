@@ -0,0 +1,122 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// section is the nested struct of the result struct
+// whose flags are registered on the specific commands.
+type section struct {
+	// The config key of the nested struct, e.g. "log"
+	key string
+	// The commands the flags are registered on
+	cmds []*cobra.Command
+}
+
+// BindSection makes AddFlags register the flags of the nested struct
+// with the given config key, e.g. "log" or "server.tls", on the given
+// commands instead of the main one. The same flag is shared by all of them,
+// and all the sections keep using one shared viper instance.
+// If sections are nested, the most specific one wins.
+// The flags are persistent unless WithLocalFlags is enabled.
+// Note, it must be called before AddFlags.
+func (sch *SnakeCharmer) BindSection(key string, cmds ...*cobra.Command) error {
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return fmt.Errorf("section key is an empty string")
+	}
+	if len(cmds) == 0 {
+		return fmt.Errorf("no commands to bind section %q to", key)
+	}
+	for _, cmd := range cmds {
+		if cmd == nil {
+			return fmt.Errorf("cmd <*cobra.Command> of section %q is nil", key)
+		}
+	}
+	for i := range sch.sections {
+		if sch.sections[i].key == key {
+			sch.sections[i].cmds = append(sch.sections[i].cmds, cmds...)
+			return nil
+		}
+	}
+	sch.sections = append(sch.sections, section{key: key, cmds: cmds})
+	return nil
+}
+
+// sectionOf returns the most specific section the config key belongs to,
+// or nil if there is none.
+func (sch *SnakeCharmer) sectionOf(key string) *section {
+	var result *section
+	for i, s := range sch.sections {
+		if key != s.key && !strings.HasPrefix(key, s.key+".") {
+			continue
+		}
+		if result == nil || len(s.key) > len(result.key) {
+			result = &sch.sections[i]
+		}
+	}
+	return result
+}
+
+// commandFlags returns the flagset of the command the flags are added to.
+func (sch *SnakeCharmer) commandFlags(cmd *cobra.Command) *pflag.FlagSet {
+	if sch.localFlags {
+		return cmd.Flags()
+	}
+	return cmd.PersistentFlags()
+}
+
+// fieldFlags returns the flagset the flag of the field is added to
+// along with the command owning it.
+func (sch *SnakeCharmer) fieldFlags(key string) (*cobra.Command, *pflag.FlagSet) {
+	if s := sch.sectionOf(key); s != nil {
+		return s.cmds[0], sch.commandFlags(s.cmds[0])
+	}
+	return sch.cmd, sch.flags()
+}
+
+// lookupFlag returns the flag of the field, or nil if there is none.
+// The flags inherited by the command from its parents are looked up as well.
+func (sch *SnakeCharmer) lookupFlag(key string) *pflag.Flag {
+	cmd, fs := sch.fieldFlags(key)
+	if flag := fs.Lookup(key); flag != nil {
+		return flag
+	}
+	if sch.flagSet == nil || sch.sectionOf(key) != nil {
+		return cmd.Flag(key)
+	}
+	return nil
+}
+
+// shareSectionFlag adds the flag of the field to the rest
+// of the commands its section is bound to.
+func (sch *SnakeCharmer) shareSectionFlag(key string) {
+	s := sch.sectionOf(key)
+	if s == nil {
+		return
+	}
+	flag := sch.lookupFlag(key)
+	for _, cmd := range s.cmds[1:] {
+		if cmd.Flag(key) == nil {
+			sch.commandFlags(cmd).AddFlag(flag)
+		}
+	}
+}
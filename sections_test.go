@@ -0,0 +1,95 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testSectionsStruct struct {
+	Workers int `snakecharmer:"workers" usage:"Number of workers" default:"4"`
+	Server  struct {
+		Addr string `snakecharmer:"addr" usage:"Addr to listen on" default:":8080"`
+		TLS  struct {
+			Cert string `snakecharmer:"cert" usage:"TLS cert file"`
+		} `snakecharmer:"tls"`
+	} `snakecharmer:"server"`
+	Log struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_BindSection(t *testing.T) {
+	f := func(args ...string) (*testSectionsStruct, *cobra.Command) {
+		t.Helper()
+		result := &testSectionsStruct{}
+		root := &cobra.Command{Use: "app"}
+		var charmer *SnakeCharmer
+		run := func(cmd *cobra.Command, args []string) {
+			if err := charmer.UnmarshalExact(); err != nil {
+				t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+			}
+		}
+		serve := &cobra.Command{Use: "serve", Run: run}
+		client := &cobra.Command{Use: "client", Run: run}
+		migrate := &cobra.Command{Use: "migrate", Run: run}
+		root.AddCommand(serve, client, migrate)
+
+		var err error
+		charmer, err = NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(root),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.NoError(t, charmer.BindSection("server", serve))
+		require.NoError(t, charmer.BindSection("server.tls", serve, client))
+		require.NoError(t, charmer.BindSection("log", serve, client, migrate))
+		require.Error(t, charmer.BindSection("log"))
+		charmer.AddFlags()
+
+		require.NotNil(t, root.PersistentFlags().Lookup("workers"))
+		require.Nil(t, root.PersistentFlags().Lookup("server.addr"))
+		require.NotNil(t, serve.PersistentFlags().Lookup("server.addr"))
+		require.Nil(t, client.Flag("server.addr"))
+		require.NotNil(t, client.Flag("server.tls.cert"))
+		require.Nil(t, migrate.Flag("server.tls.cert"))
+		require.NotNil(t, migrate.Flag("log.level"))
+
+		root.SetArgs(args)
+		if err = root.Execute(); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).Execute(): %s", err.Error())
+		}
+		return result, root
+	}
+
+	result, _ := f("serve", "--server.addr", ":9090", "--log.level", "debug", "--workers", "8")
+	require.Equal(t, ":9090", result.Server.Addr)
+	require.Equal(t, "debug", result.Log.Level)
+	require.Equal(t, 8, result.Workers)
+
+	result, _ = f("client", "--server.tls.cert", "client.pem")
+	require.Equal(t, ":8080", result.Server.Addr)
+	require.Equal(t, "client.pem", result.Server.TLS.Cert)
+	require.Equal(t, "info", result.Log.Level)
+
+	result, _ = f("migrate", "--log.level", "warn")
+	require.Equal(t, "warn", result.Log.Level)
+}
@@ -0,0 +1,56 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSIGHUP runs the reload pipeline (see Reload) every time
+// the process receives SIGHUP, until the context is done.
+// It re-reads the config files, re-loads the values from providers
+// and unmarshals them into the result struct.
+// onReload (if not nil) is called after every reload with its error.
+// HandleSIGHUP does not block, the signal is handled in a goroutine,
+// which also stops on Close.
+func (sch *SnakeCharmer) HandleSIGHUP(ctx context.Context, onReload func(error)) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	done := sch.ctx.Done()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	started := sch.goBackground(func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-sigs:
+				err := sch.Reload()
+				if onReload != nil {
+					onReload(err)
+				}
+			}
+		}
+	})
+	if !started {
+		signal.Stop(sigs)
+	}
+}
@@ -15,23 +15,57 @@
 package snakecharmer
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
+// ErrEmptyConfig is returned when the config file is empty or whitespace-only
+// and WithStrictEmptyConfig is enabled.
+var ErrEmptyConfig = errors.New("config file is empty")
+
+// ErrClosed is returned by Reload after Close is called.
+var ErrClosed = errors.New("snakecharmer is closed")
+
+// ErrConfigFileNotFound is wrapped by the error returned when the config
+// file does not exist and WithConfigFileRequired is enabled (the default).
+var ErrConfigFileNotFound = errors.New("config file not found")
+
+// configNotFoundError is the error of the missing config file,
+// it wraps ErrConfigFileNotFound.
+type configNotFoundError struct {
+	msg string
+}
+
+func (e *configNotFoundError) Error() string { return e.msg }
+
+func (e *configNotFoundError) Unwrap() error { return ErrConfigFileNotFound }
+
 // NewSnakeCharmer creates a new snakecharmer instance.
 // charmer, err = NewSnakeCharmer(
 //
 //	WithResultStruct(result),
 //	WithFieldTagName("snakecharmer"),
+//	WithDefaultTagName("default"),
 //	WithViper(vpr),
 //	WithCobraCommand(cmd),
 //	WithConfigFilePath(defaultConfigFile),
@@ -44,13 +78,25 @@ import (
 // )
 func NewSnakeCharmer(opts ...CharmingOption) (*SnakeCharmer, error) {
 	sch := SnakeCharmer{
-		fieldTagName:       "mapstructure",
-		envTagName:         "env",
-		flagHelpTagName:    "usage",
-		configFileType:     "yaml",
-		configFilePath:     "",
-		configFileBaseName: "config",
+		fieldTagName:        "mapstructure",
+		envTagName:          "env",
+		flagHelpTagName:     "usage",
+		defaultTagName:      "default",
+		configFileType:      "yaml",
+		configFilePath:      "",
+		configFileBaseName:  "config",
+		refreshWindow:       time.Minute,
+		configURLTimeout:    defaultConfigURLTimeout,
+		configURLRetryDelay: time.Second,
+		sliceSep:            ",",
+		mapEntrySep:         ",",
+		mapPairSep:          "=",
+		exit:                os.Exit,
+		configFileRequired:  true,
+		stdin:               os.Stdin,
+		usageTemplate:       defaultUsageTemplate,
 	}
+	sch.ctx, sch.cancel = context.WithCancel(context.Background())
 
 	for _, opt := range opts {
 		if err := opt(&sch); err != nil {
@@ -61,29 +107,50 @@ func NewSnakeCharmer(opts ...CharmingOption) (*SnakeCharmer, error) {
 	if sch.resultStruct == nil {
 		return &sch, fmt.Errorf("result struct <interface{}> is not set")
 	}
-	if sch.viper == nil {
-		sch.viper = viper.New()
+	if sch.plan != nil {
+		if err := sch.checkPlan(); err != nil {
+			return &sch, err
+		}
+	}
+	switch b := sch.backend.(type) {
+	case nil:
+		if sch.viper == nil {
+			sch.viper = viper.New()
+		}
+		sch.backend = &viperBackend{v: sch.viper, configType: sch.configFileType}
+	case *viperBackend:
+		if b.configType == "" {
+			b.configType = sch.configFileType
+		}
 	}
-	if sch.cmd == nil {
+	if sch.cmd == nil && sch.flagSet == nil {
 		return &sch, fmt.Errorf("cmd <*cobra.Command> is not set")
 	}
+	if sch.cmd == nil && len(sch.checkConfigFlag) > 0 {
+		return &sch, fmt.Errorf("check config flag %q requires cmd <*cobra.Command>", sch.checkConfigFlag)
+	}
 
 	return &sch, nil
 }
 
 // SnakeCharmer helps to get Cobra and Viper work together.
 // It uses a user defined Struct for reading field tags and default values.
-// Please note, that the struct must be initialized (with the default values)
-// before passing to the SnakeCharmer.
+// Default values are taken either from the default tag (if set)
+// or from the values the struct was initialized with before passing
+// to the SnakeCharmer.
+// The struct fields can be plain values (int, string, nested struct, etc.)
+// or pointers to them, nil pointers are treated as zero values.
 // It automatically creates flags and adds them to cobra PersistentFlags flagset.
 // It also creates viper's config params, and sets their default values,
 // binds viper's config param with a corresponding flag from the cobra flagset,
 // binds viper's config param with a corresponding ENV var
 // SnakeCharmer sets the following priority of values:
 // 1. flags (if passed)
-// 2. ENV variables (if env tag set)
-// 3. config file (if used)
-// 4. defaults (from user defined Struct)
+// 2. ENV variables (if env tag set or WithAutomaticEnv/WithDerivedEnvNames enabled,
+// and WithEnvDisabled is not enabled)
+// 3. dotenv file (if set with WithDotEnvFile)
+// 4. config file (if used)
+// 5. defaults (from user defined Struct)
 type SnakeCharmer struct {
 	// resultStruct is a pointer to the struct that will contain
 	// the decoded values.
@@ -101,6 +168,61 @@ type SnakeCharmer struct {
 	// This defaults to "usage"
 	flagHelpTagName string
 
+	// The tag name that snakecharmer reads for field default values.
+	// This defaults to "default"
+	defaultTagName string
+
+	// The struct tag syntax snakecharmer reads.
+	// This defaults to TagDialectSnakeCharmer
+	tagDialect TagDialect
+
+	// The prefix prepended to ENV var names, e.g. "MYAPP"
+	// makes `env:"WORKERS"` bound to MYAPP_WORKERS
+	envPrefix string
+
+	// envDisabled is true if no field is bound to an ENV var,
+	// see WithEnvDisabled
+	envDisabled bool
+
+	// automaticEnv is true if every field is bound to an ENV var
+	// derived from its config key, see WithAutomaticEnv
+	automaticEnv bool
+
+	// The replacer used for deriving ENV var names from config keys
+	envKeyReplacer *strings.Replacer
+
+	// derivedEnvNames is true if the fields without env tag are bound
+	// to ENV vars derived from their config keys, see WithDerivedEnvNames
+	derivedEnvNames bool
+
+	// The dotenv file the ENV var values are loaded from, see WithDotEnvFile
+	dotEnvFile string
+
+	// fileValues is true if the values are read from the files
+	// given as "@/path" or the "_file" sibling keys, see WithFileValues
+	fileValues bool
+
+	// The Kubernetes secrets directory the values are loaded from,
+	// see WithKubernetesSecretsDir
+	secretsDir string
+
+	// The file the values of the fields with the persist modifier
+	// are saved into, see WithStateFile
+	stateFile string
+	// The lower-cased keys of the defaults loaded from the state file
+	stateKeys map[string]bool
+
+	// The separator of slice elements in the string representation
+	// of slices, e.g. ENV var values and default tags.
+	// This defaults to ","
+	sliceSep string
+
+	// The separators of map entries and of keys from values
+	// in the string representation of maps, e.g. ENV var values.
+	// These default to "," and "="
+	mapEntrySep string
+	mapPairSep  string
+
 	// The type that will be passed to viper.SetConfigType().
 	// REQUIRED in case if the config file does not have the extension or
 	// if the config file extension is not in the list of supported extensions.
@@ -114,6 +236,66 @@ type SnakeCharmer struct {
 	// This defaults to "", which means config file won't be used.
 	configFilePath string
 
+	// The config file paths that are merged in order, later files winning.
+	// The config file path above is merged last.
+	configFilePaths []string
+
+	// The timeout of fetching the config file path which is an http(s) URL,
+	// see WithConfigURLTimeout
+	configURLTimeout time.Duration
+
+	// The number of retries of the failed config URL fetches
+	// and the delay between them, see WithConfigURLRetries
+	configURLRetries    int
+	configURLRetryDelay time.Duration
+
+	// The documents fetched from the config URLs
+	urlCache configURLCache
+
+	// The config format migrations by the version they upgrade from,
+	// see WithMigration
+	migrations map[int]MigrationFunc
+
+	// The legacy keys of the renamed ones, see WithKeyAlias
+	keyAliases []keyAlias
+
+	// How the unknown config keys are handled, see WithStrictness
+	strictness Strictness
+
+	// The function the warnings are reported with, see WithWarnFunc
+	warnFunc func(msg string)
+
+	// The logger of the binding trace debug events, see WithLogger
+	logger *slog.Logger
+
+	// configFileRequired is false if the missing config files are skipped
+	// rather than failing, see WithConfigFileRequired
+	configFileRequired bool
+
+	// The application name the config file is searched for
+	// in the standard config directories, see WithStandardConfigPaths
+	standardConfigApp string
+
+	// The config documents merged before the config files,
+	// see WithConfigBytes and WithConfigReader
+	configDocs []configDocument
+
+	// The stdin the config is read from if the config file path is "-"
+	// and the document read from it
+	stdin       io.Reader
+	stdinConfig []byte
+
+	// The files actually read by the last run of the unmarshal pipeline
+	filesUsed []string
+
+	// The settings decoded into the result struct by the last run
+	// of the unmarshal pipeline
+	settings map[string]interface{}
+
+	// strictEmptyConfig is true if an empty config file is an error
+	// rather than no config, see WithStrictEmptyConfig
+	strictEmptyConfig bool
+
 	// The base name of the config file (without extension)
 	// that will be passed to viper.SetConfigName().
 	// REQUIRED in case of the configFilePath is a directory, otherwise ignored.
@@ -123,26 +305,274 @@ type SnakeCharmer struct {
 	// The pointer to the viper.Viper instance
 	viper *viper.Viper
 
+	// The config store the values are merged into, see WithBackend.
+	// This defaults to the one based on the viper instance
+	backend Backend
+
 	// The pointer to the cobra.Command instance
 	cmd *cobra.Command
 
+	// localFlags is true if the flags are added to cmd.Flags()
+	// rather than cmd.PersistentFlags(), see WithLocalFlags
+	localFlags bool
+
+	// The flagset the flags are added to, see AddFlagsTo and WithFlagSet
+	flagSet *pflag.FlagSet
+
+	// The standard library flagset the flags are exported to, see WithGoFlagSet
+	goFlagSet *flag.FlagSet
+
+	// The callbacks called after every decode into the result struct,
+	// e.g. copying the values into the registered sections (see BuildCharmer)
+	afterDecode []func()
+
+	// strictFlags is true if AddFlags panics on the flags
+	// that are already defined rather than reusing them, see WithStrictFlags
+	strictFlags bool
+
+	// The nested structs whose flags are registered
+	// on the specific commands, see BindSection
+	sections []section
+
 	// A slice of viper.DecoderConfigOption that will be passed to viper.Unmarshal
 	// to configure mapstructure.DecoderConfig options
 	// See https://pkg.go.dev/github.com/spf13/viper@v1.17.0#DecoderConfigOption
 	decoderConfigOptions []viper.DecoderConfigOption
 
+	// The user decode hooks run before the built-in ones, see WithDecodeHook
+	decodeHooks []mapstructure.DecodeHookFunc
+
 	// ignoreUntaggedFields ignores all struct fields without explicit
 	// fieldTagName, comparable to `mapstructure:"-"` as default behaviour.
 	ignoreUntaggedFields bool
+
+	// A slice of Provider that supply config values from external sources
+	providers []Provider
+
+	// The structs instantiated for every tenant, see WithTenants
+	tenantGroups []tenantGroup
+
+	// The bootstrap struct (e.g. provider credentials) decoded
+	// before the main config, see WithBootstrap
+	bootstrap interface{}
+
+	// The function creating the providers from the bootstrap struct
+	newProviders func() ([]Provider, error)
+
+	// The config keys of the bootstrap struct fields
+	bootstrapKeys []string
+
+	// The providers created from the bootstrap struct by the last run
+	// of the unmarshal pipeline
+	bootstrapped []Provider
+
+	// The expiration time of the provided values having non-zero TTL
+	expirations map[string]time.Time
+
+	// How long before the expiration of provided values
+	// the reload pipeline is run to refresh them.
+	// This defaults to 1 minute
+	refreshWindow time.Duration
+
+	// The function that is called when the refresh of expiring values fails
+	refreshErrorHandler func(keys []string, err error)
+
+	// The timer that runs the refresh of expiring values
+	refreshTimer *time.Timer
+
+	// The context the background goroutines (the refresh timer,
+	// the SIGHUP handler) are tied to, it is canceled by Close.
+	// See WithContext
+	ctx    context.Context
+	cancel context.CancelFunc
+	// The context of the running unmarshal pipeline,
+	// see UnmarshalExactContext
+	runCtx context.Context
+	// The background goroutines Close waits for
+	wg sync.WaitGroup
+	// closed is true if Close is called
+	closed bool
+
+	// The bindings of the result struct fields created by AddFlags
+	bindings []fieldBinding
+
+	// The ENV vars holding the whole nested structs as JSON/YAML
+	structEnvs []structEnv
+
+	// The flags of the entries of the slice of structs fields,
+	// e.g. --upstreams.0.url, see the indexed tag option
+	indexedFlags []indexedFlag
+
+	// The limits enforced on the loaded config before decoding
+	limits ConfigLimits
+
+	// The name of the flag that passes a JSON patch (RFC 6902)
+	// applied to the merged config, empty if disabled
+	configPatchFlag string
+	// The name of the repeatable flag that sets the config values,
+	// e.g. --set log.level=debug, empty if disabled, see WithSetFlag
+	setFlag string
+	// The default values set with WithDefaults
+	defaultValues []keyValue
+	// The config values set with WithOverrides
+	overrideValues []keyValue
+	// The custom precedence of the layers, see WithPrecedence
+	precedence []SourceKind
+	// The overridden config values of the last run of the unmarshal pipeline
+	overrides []keyValue
+	// The name of the flag selecting the config profile, see WithProfileFlag
+	profileFlag string
+
+	// The name of the flag that makes the command load and validate
+	// the config and exit, empty if disabled, see WithCheckConfigFlag
+	checkConfigFlag string
+
+	// exit terminates the process, it is replaced in tests
+	exit func(code int)
+
+	// The key and the value that select the document
+	// of a multi-document YAML config file, see WithYAMLDocumentSelector
+	yamlSelectorKey   string
+	yamlSelectorValue string
+
+	// squashEmbedded is true if the result struct has plain embedded structs
+	// which are squashed, see isSquashed
+	squashEmbedded bool
+
+	// freeze makes the configuration frozen after
+	// the first successful unmarshal, see WithFreeze
+	freeze bool
+
+	// frozen is true when the configuration is frozen
+	frozen atomic.Bool
+
+	// The sources of the values merged into the viper config layer
+	// by the last run of the unmarshal pipeline, keyed by config key
+	layerSources map[string]SourceKind
+	// The positions of the values in the YAML config files
+	// read by the last run of the unmarshal pipeline
+	yamlPositions map[string]keyPosition
+	// The raw text of the numbers of the YAML and JSON config files
+	// read by the last run of the unmarshal pipeline, see recordNumberTexts
+	numberTexts map[string]string
+
+	// The remote config store the config document is read from
+	// and its address, see WithRemoteConfig
+	remoteProvider string
+	remoteEndpoint string
+	remotePath     string
+
+	// The TLS config of the remote config store client, see WithRemoteTLSConfig
+	remoteTLS *tls.Config
+
+	// The interval of polling the remote config for changes,
+	// see WithRemotePollInterval
+	remotePollInterval time.Duration
+
+	// The remote config source, see WithRemoteConfig and WithRemoteSource
+	remote RemoteSource
+
+	// The remote config document merged by the last run of the unmarshal pipeline
+	remoteData []byte
+
+	// The resolvers of the value references, the longest prefixes first,
+	// see WithValueResolver
+	resolvers []prefixedResolver
+
+	// The callbacks called after every unmarshal, see Subscribe
+	subscribers []subscriber
+
+	// The validator of the decoded result struct, see WithStructValidator
+	structValidator StructValidator
+	// The validators of the constraints between the fields
+	// of the decoded result struct, see WithCrossFieldValidator
+	crossFieldValidators []func(cfg interface{}) error
+
+	// The template of the suffix of the flag usage help, nil if there is none,
+	// see WithUsageTemplate
+	usageTemplate *template.Template
+
+	// The filesystem the config files are read from instead of the OS one,
+	// see WithFilesystem
+	fsys fs.FS
+
+	// The function looking up the ENV vars instead of os.LookupEnv, see WithEnvLookup
+	envLookup func(key string) (string, bool)
+
+	// The plan of the result struct compiled by CompilePlan, see WithPlan
+	plan *Plan
+	// The errors of the invalid fields collected while compiling the plan
+	planErrors *[]error
+
+	// The copy of the result struct taken after every decode, see Load
+	snapshot atomic.Value
+	// The state of the last run of the unmarshal pipeline
+	// read by the read-only accessors, see runView
+	view atomic.Pointer[runView]
+	// The copy of the result struct taken before the first decode,
+	// it is restored if the first unmarshal fails, see rollback
+	initialResult reflect.Value
+
+	// mu serializes runs of the unmarshal/reload pipeline
+	mu sync.Mutex
+}
+
+// fieldBinding describes how a result struct field is bound
+// to a flag, an ENV var and a config key.
+type fieldBinding struct {
+	// The default value
+	defaultValue interface{}
+	// The field type
+	typ reflect.Type
+	// The config key, which is the flag name as well
+	key string
+	// The ENV var names in the lookup order, empty if not bound
+	envs []string
+	// The flag usage help
+	help string
+	// required is true if the value must be provided explicitly
+	required bool
+	// relpath is true if the relative path value is resolved
+	// against the directory of the config file
+	relpath bool
+	// secret is true if the value must not be revealed
+	secret bool
+	// The allowed values, empty if any value is allowed
+	oneOf []string
+	// The bounds of the numeric value, empty if not bounded
+	min, max string
+	// noFlag is true if the value cannot be set with a flag
+	noFlag bool
+	// noConfig is true if the value must not be set in the config file
+	noConfig bool
+	// percent is true if the value is a percent normalized to the ratio
+	percent bool
+	// persist is true if the value is saved into the state file
+	persist bool
+	// The reference to the value kept elsewhere, e.g. `ref:"ssm:///app/db/password"`
+	ref string
+	// The legacy keys of the renamed key, e.g. `alias:"old.name"`
+	aliases []string
 }
 
-// Set sets the snakecharmer options
+// Set sets the snakecharmer options.
+// It returns an error if the configuration is frozen (see WithFreeze),
+// use Reload to change options of a frozen configuration.
 func (sch *SnakeCharmer) Set(opts ...CharmingOption) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if sch.frozen.Load() {
+		return fmt.Errorf("configuration is frozen, use Reload() to change it")
+	}
 	for _, opt := range opts {
 		if err := opt(sch); err != nil {
 			return err
 		}
 	}
+	if sch.loadView() != nil {
+		// e.g. the precedence order may change
+		sch.publishView(false)
+	}
 	return nil
 }
 
@@ -158,6 +588,37 @@ func (sch *SnakeCharmer) EnvTagName() string { return sch.envTagName }
 // FlagHelpTagName returns the tag name that snakecharmer reads for flag usage help.
 func (sch *SnakeCharmer) FlagHelpTagName() string { return sch.flagHelpTagName }
 
+// DefaultTagName returns the tag name that snakecharmer reads for field default values.
+func (sch *SnakeCharmer) DefaultTagName() string { return sch.defaultTagName }
+
+// TagDialect returns the struct tag syntax snakecharmer reads.
+func (sch *SnakeCharmer) TagDialect() TagDialect { return sch.tagDialect }
+
+// LocalFlags returns true if the flags are added to the local flagset
+// of the cobra command, see WithLocalFlags
+func (sch *SnakeCharmer) LocalFlags() bool { return sch.localFlags }
+
+// StrictFlags returns true if AddFlags panics on the flags
+// that are already defined, see WithStrictFlags
+func (sch *SnakeCharmer) StrictFlags() bool { return sch.strictFlags }
+
+// EnvPrefix returns the prefix prepended to ENV var names.
+func (sch *SnakeCharmer) EnvPrefix() string { return sch.envPrefix }
+
+// EnvDisabled returns true if no field is bound to an ENV var.
+func (sch *SnakeCharmer) EnvDisabled() bool { return sch.envDisabled }
+
+// AutomaticEnv returns true if every field is bound to an ENV var
+// derived from its config key.
+func (sch *SnakeCharmer) AutomaticEnv() bool { return sch.automaticEnv }
+
+// DerivedEnvNames returns true if the fields without env tag are bound
+// to ENV vars derived from their config keys.
+func (sch *SnakeCharmer) DerivedEnvNames() bool { return sch.derivedEnvNames }
+
+// DotEnvFile returns the dotenv file the ENV var values are loaded from.
+func (sch *SnakeCharmer) DotEnvFile() string { return sch.dotEnvFile }
+
 // ConfigFileType returns the type that will be passed to viper.SetConfigType().
 func (sch *SnakeCharmer) ConfigFileType() string { return sch.configFileType }
 
@@ -166,6 +627,14 @@ func (sch *SnakeCharmer) ConfigFileType() string { return sch.configFileType }
 // viper.SetConfigFile() if path is a file.
 func (sch *SnakeCharmer) ConfigFilePath() string { return sch.configFilePath }
 
+// ConfigFilePaths returns the config file paths that are merged in order,
+// later files winning. The ConfigFilePath() is merged last.
+func (sch *SnakeCharmer) ConfigFilePaths() []string { return sch.configFilePaths }
+
+// StrictEmptyConfig returns true if an empty config file is an error
+// rather than no config.
+func (sch *SnakeCharmer) StrictEmptyConfig() bool { return sch.strictEmptyConfig }
+
 // ConfigFileBaseName returns the base name of the config file (without extension)
 // that will be passed to viper.SetConfigName().
 func (sch *SnakeCharmer) ConfigFileBaseName() string { return sch.configFileBaseName }
@@ -180,17 +649,112 @@ func (sch *SnakeCharmer) DecoderConfigOptions() []viper.DecoderConfigOption {
 // that will be passed as viper.DecoderConfigOption
 func (sch *SnakeCharmer) IgnoreUntaggedFields() bool { return sch.ignoreUntaggedFields }
 
+// RefreshWindow returns how long before the expiration of provided values
+// the reload pipeline is run to refresh them.
+func (sch *SnakeCharmer) RefreshWindow() time.Duration { return sch.refreshWindow }
+
 // AddFlags creates flags from tags of a given Result Struct.
-// Adds flags to cobra PersistentFlags flagset,
+// Adds flags to cobra PersistentFlags flagset (or Flags, see WithLocalFlags),
 // creates viper's config param and sets default value (viper.SetDefault()),
 // binds viper's config param with a corresponding flag from the cobra flagset,
-// binds viper's config param with a corresponding ENV var
-func (sch *SnakeCharmer) AddFlags() { sch.addFlags(sch.resultStruct, "") }
+// binds viper's config param with a corresponding ENV var.
+// Fields with the "required" tag option, e.g. `snakecharmer:"api-key,required"`,
+// must be provided by a flag, an ENV var or a config file, this is verified
+// by UnmarshalExact. Note, such flags are not marked as required in cobra
+// (cmd.MarkPersistentFlagRequired), since cobra would reject the command
+// even if the value is provided by an ENV var or a config file, e.g. the
+// subcommands of AttachConfigSubcommands, which unmarshal in RunE, after
+// cobra validates the required flags.
+// Relative paths in fields with the "relpath" tag option,
+// e.g. `snakecharmer:"cert-file,relpath"`, are resolved against
+// the directory of the config file that defined them.
+// Float fields with the "percent" tag option, e.g. `snakecharmer:"max-cpu,percent"`,
+// accept values like "85%" or 0.85 from all the sources, which are normalized
+// to the ratio, e.g. 0.85, and must be in the range [0%, 100%].
+// Values of fields with the "persist" tag option, e.g. `snakecharmer:"project,persist"`,
+// are saved into the state file (see WithStateFile) and used as defaults next time,
+// the option panics for the secret fields and the fields with the ref tag,
+// since the state file is not encrypted.
+// Integer fields with the "count" tag option, e.g. `snakecharmer:"verbose,count" short:"v"`,
+// are registered as count flags, so -v -v -v (or -vvv) sets 3.
+// Fields with the "noflag" tag option, e.g. `snakecharmer:"api-key,noflag"`,
+// or the `flag:"-"` tag get no flag, they are set from ENV vars
+// and config files only. Similarly, fields with the `env:"-"` tag are never
+// bound to ENV vars (even with WithAutomaticEnv), and fields with
+// the `config:"-"` tag must not be set in config files, UnmarshalExact
+// fails if they are.
+// It panics on the invalid tags, with *UnsupportedFieldTypeError if the type
+// of the field is not supported; CompilePlan returns the same as errors.
+// If the flag with the same name is already defined on the command
+// (e.g. --config defined manually), it is reused: viper is bound to it
+// and the field default is set as the viper default (see WithStrictFlags).
+// Values of fields with the oneof tag, e.g. `oneof:"debug,info,warn,error"`,
+// must be among the listed ones, which are appended to the flag usage help
+// and completed by shells (see cobra.Command.RegisterFlagCompletionFunc).
+// A nested struct field with env tag, e.g. `snakecharmer:"log" env:"LOGGING_JSON,format=json"`,
+// can be set as a whole by the ENV var holding JSON (format=json) or YAML (format=yaml,
+// the default). The ENV vars of its fields take precedence over it.
+// Values of fields with the "secret" tag option, e.g. `snakecharmer:"api-key,secret"`,
+// or the `secret:"true"` tag are redacted as "***" in the flag parse errors
+// (see cobra.Command.SetFlagErrorFunc), the decoding errors, the env command output
+// and RedactedSettings.
+func (sch *SnakeCharmer) AddFlags() {
+	sch.addAllFlags()
+}
 
-func (sch *SnakeCharmer) addFlags(input interface{}, prefix string) {
-	var key, env, help string
-	var err error
+// AddFlagsTo works like AddFlags, but adds the flags to the given flagset,
+// e.g. the local flags of a subcommand or a standalone pflag.FlagSet,
+// instead of the cobra command's persistent flags.
+func (sch *SnakeCharmer) AddFlagsTo(fs *pflag.FlagSet) {
+	sch.flagSet = fs
+	sch.addAllFlags()
+}
+
+// flags returns the flagset the flags are added to.
+func (sch *SnakeCharmer) flags() *pflag.FlagSet {
+	if sch.flagSet != nil {
+		return sch.flagSet
+	}
+	if sch.localFlags {
+		return sch.cmd.Flags()
+	}
+	return sch.cmd.PersistentFlags()
+}
+
+func (sch *SnakeCharmer) addAllFlags() {
+	sch.addFlags(sch.resultStruct, "")
+	sch.addTenantFlags()
+	if sch.bootstrap != nil {
+		n := len(sch.bindings)
+		sch.addFlags(sch.bootstrap, "")
+		for _, b := range sch.bindings[n:] {
+			sch.bootstrapKeys = append(sch.bootstrapKeys, b.key)
+		}
+	}
+	sch.setDefaultValues()
+	sch.setFlagErrorFunc()
+	if len(sch.checkConfigFlag) > 0 {
+		sch.addCheckConfigFlag()
+	}
+	if len(sch.profileFlag) > 0 {
+		sch.flags().String(sch.profileFlag, "",
+			"Config profile deep-merged over the base config keys")
+	}
+	if len(sch.configPatchFlag) > 0 {
+		sch.flags().String(sch.configPatchFlag, "",
+			`JSON patch (RFC 6902) applied to the merged config, e.g. '[{"op":"replace","path":"/log/level","value":"debug"}]'`)
+	}
+	if len(sch.setFlag) > 0 {
+		sch.flags().StringArray(sch.setFlag, nil,
+			"Config value overriding all the other sources, e.g. log.level=debug or hosts={a,b}, can be repeated")
+	}
+	sch.addAliasFlags()
+	if sch.goFlagSet != nil {
+		exportGoFlags(sch.flagSet, sch.goFlagSet)
+	}
+}
 
+func (sch *SnakeCharmer) addFlags(input interface{}, prefix string) {
 	v := reflect.ValueOf(input)
 	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
 		if v.IsNil() {
@@ -201,200 +765,942 @@ func (sch *SnakeCharmer) addFlags(input interface{}, prefix string) {
 	if v.Kind() != reflect.Struct {
 		panic(fmt.Sprintf("BUG: invalid input type: %q", v.Kind().String()))
 	}
-	for i := 0; i < v.NumField(); i++ {
-		structField := v.Type().Field(i)
-		fieldValue := v.Field(i)
-		if fieldValue.Kind() == reflect.Ptr || fieldValue.Kind() == reflect.Interface {
-			if fieldValue.IsNil() {
-				panic(fmt.Sprintf("BUG: got nil for field: %s", structField.Name))
-			}
-			fieldValue = fieldValue.Elem()
+	for _, fp := range sch.structPlan(v.Type()) {
+		if !fp.skip {
+			sch.addField(v, fp, prefix)
 		}
+	}
+}
 
-		fieldTag := structField.Tag.Get(sch.fieldTagName)
-		// TODO: handle if field doesn't have fieldTag tag
-		if len(fieldTag) == 0 {
-			if sch.ignoreUntaggedFields {
-				continue
+// addField adds the flag of the field of the struct nested under the prefix
+// and binds it, or walks through the fields of the nested struct.
+// It panics on the invalid field, unless the plan is compiled.
+func (sch *SnakeCharmer) addField(v reflect.Value, fp fieldPlan, prefix string) {
+	var err error
+
+	if sch.planErrors != nil {
+		defer sch.recoverPlanError()
+	}
+	if len(fp.invalid) > 0 {
+		panic(fp.invalid)
+	}
+	if fp.embedded {
+		sch.squashEmbedded = true
+	}
+	structField := v.Type().Field(fp.index)
+	fieldValue := v.Field(fp.index)
+	ft, squash := fp.tagsAt(prefix), fp.squash
+	key := ft.key
+
+	switch fieldValue.Kind() {
+	case reflect.Ptr:
+		if fieldValue.IsNil() {
+			if elem := fieldValue.Type().Elem(); elem.Kind() == reflect.Struct && !isTextStruct(elem) && !isNetType(elem) && !isFlagValue(elem) {
+				// Allocate nested struct, so its fields can be walked through
+				if !fieldValue.CanSet() {
+					panic(fmt.Sprintf("BUG: got nil for field: %s", structField.Name))
+				}
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
 			} else {
-				panic(fmt.Sprintf("BUG: got untagged field: %s", structField.Name))
+				// Zero value is used unless the default tag is set
+				fieldValue = reflect.New(fieldValue.Type().Elem())
 			}
 		}
-		key = strings.Split(fieldTag, ",")[0]
-
-		if len(prefix) > 0 {
-			key = prefix + "." + key
+		fieldValue = fieldValue.Elem()
+	case reflect.Interface:
+		if fieldValue.IsNil() {
+			if sch.planErrors != nil {
+				// The type of the value is not known to the plan, see CompilePlan
+				return
+			}
+			panic(fmt.Sprintf("BUG: got nil for field: %s", structField.Name))
 		}
+		fieldValue = fieldValue.Elem()
+	}
 
-		if fieldValue.Kind() == reflect.Struct {
-			// Run addFlags recursively with prefix
+	if squash && fieldValue.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("BUG: cannot squash non-struct field: %s", structField.Name))
+	}
+
+	if fieldValue.Kind() == reflect.Struct && !isTextStruct(fieldValue.Type()) && !isNetType(fieldValue.Type()) && !isFlagValue(fieldValue.Type()) {
+		if len(ft.env) > 0 && !squash && sch.tagDialect == TagDialectSnakeCharmer {
+			// The whole nested struct can be set by the ENV var holding JSON/YAML
+			if env := sch.envNames(ft.env, key); len(env) > 0 {
+				sch.structEnvs = append(sch.structEnvs, structEnv{key: key, env: env[0], format: ft.envFormat})
+			}
+		}
+		// Run addFlags recursively with prefix
+		if fieldValue.CanAddr() {
+			sch.addFlags(fieldValue.Addr().Interface(), key)
+		} else {
 			sch.addFlags(fieldValue.Interface(), key)
-			continue
 		}
+		return
+	}
+
+	if isStructSlice(fieldValue.Type()) {
+		// Config-only field, there are no flags for the struct fields
+		sch.addStructSlice(structField, fieldValue, ft)
+		return
+	}
+
+	if isStructMap(fieldValue.Type()) {
+		// Config-only field, the map keys are not known beforehand
+		sch.addStructMap(structField, fieldValue, ft)
+		return
+	}
 
-		help = structField.Tag.Get(sch.flagHelpTagName)
-		if len(help) == 0 {
-			panic(fmt.Sprintf("BUG: %s tag is not specified for field: %q", sch.flagHelpTagName, structField.Name))
+	if len(ft.help) == 0 && sch.tagDialect == TagDialectSnakeCharmer {
+		panic(fmt.Sprintf("BUG: %s tag is not specified for field: %q", sch.flagHelpTagName, structField.Name))
+	}
+
+	if ft.hasDefault {
+		// The default tag takes precedence over the initialized value
+		if ft.percent {
+			var ratio float64
+			if ratio, err = parsePercent(ft.defaultValue); err == nil {
+				fieldValue = reflect.ValueOf(ratio).Convert(fieldValue.Type())
+			}
+		} else if isFlagValue(fieldValue.Type()) {
+			fieldValue, err = parseFlagValue(fieldValue.Type(), ft.defaultValue)
+		} else if isTextStruct(fieldValue.Type()) {
+			fieldValue, err = parseTextValue(fieldValue.Type(), ft.defaultValue)
+		} else if isNetType(fieldValue.Type()) {
+			fieldValue, err = parseNetValue(fieldValue.Type(), ft.defaultValue)
+		} else if fieldValue.Type() == byteSizeType {
+			var size ByteSize
+			size, err = ParseByteSize(ft.defaultValue)
+			fieldValue = reflect.ValueOf(size)
+		} else {
+			fieldValue, err = parseDefaultValue(fieldValue.Type(), ft.defaultValue, ft.sep)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("BUG: invalid default tag for field %q: %s", structField.Name, err.Error()))
 		}
+	}
 
-		// Add Flag to cobra flagset and Set default viper config param
-		if err = sch.applySetting(fieldValue, key, help); err != nil {
-			panic(err.Error())
+	if len(ft.oneOf) > 0 {
+		switch fieldValue.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Struct:
+			panic(fmt.Sprintf("BUG: oneof tag is set for non-scalar field: %q", structField.Name))
 		}
+		ft.help = oneOfUsage(ft.help, ft.oneOf)
+	}
+
+	if len(ft.min) > 0 || len(ft.max) > 0 {
+		if err = checkRangeTags(fieldValue.Type(), ft.min, ft.max); err != nil {
+			panic(fmt.Sprintf("BUG: invalid range tags for field %q: %s", structField.Name, err.Error()))
+		}
+	}
+
+	// Add Flag to cobra flagset and Set default viper config param.
+	// The flag of the field with noflag is added to the throwaway flagset.
+	flagCmd, fs := sch.fieldFlags(key)
+	existing := sch.lookupFlag(key)
+	if existing != nil && !ft.noFlag && sch.strictFlags {
+		panic(fmt.Sprintf("BUG: flag %q of field %q is already defined", key, structField.Name))
+	}
+	if ft.noFlag || existing != nil {
+		// The existing flag is reused, only the viper default is set
+		fs = pflag.NewFlagSet(key, pflag.ContinueOnError)
+	}
+	var envs []string
+	if !ft.noEnv {
+		envs = sch.envNames(ft.env, key)
+	}
+	usage := sch.flagUsage(ft.help, UsageData{Key: key, Envs: envs, Config: !ft.noConfig})
+	if ft.percent {
+		err = sch.applyPercentSetting(fs, fieldValue, key, usage)
+	} else if ft.count {
+		err = sch.applyCountSetting(fs, fieldValue, key, ft.shorthand, usage)
+	} else if isFlagValue(fieldValue.Type()) {
+		sch.applyFlagValueSetting(fs, fieldValue, key, usage)
+	} else if isTextStruct(fieldValue.Type()) {
+		sch.applyTextSetting(fs, fieldValue, key, usage)
+	} else if isNetType(fieldValue.Type()) {
+		sch.applyNetSetting(fs, fieldValue, key, usage)
+	} else if fieldValue.Type() == byteSizeType {
+		sch.applyByteSizeSetting(fs, fieldValue, key, usage)
+	} else {
+		err = sch.applySetting(fs, fieldValue, key, usage)
+	}
+	var uerr *UnsupportedFieldTypeError
+	if errors.As(err, &uerr) {
+		// The typed error is kept for CompilePlan
+		panic(uerr)
+	}
+	if err != nil {
+		panic(err.Error())
+	}
 
+	if !ft.noFlag {
 		// Bind flag to viper.
 		// This overrides viper default setting
 		// with values from cobra flags.
-		err = sch.viper.BindPFlag(key, sch.cmd.PersistentFlags().Lookup(key))
+		flag := existing
+		if flag == nil {
+			flag = fs.Lookup(key)
+		}
+		err = sch.backend.BindFlag(key, flag)
 		if err != nil {
 			panic(err.Error())
 		}
-		env = structField.Tag.Get(sch.envTagName)
-		if len(env) > 0 {
-			// Bind env var to viper.
-			// This overrides viper default setting
-			// with values from ENV vars.
-			// Note: viper treats ENV variables as case sensitive.
-			err = sch.viper.BindEnv(key, env)
-			if err != nil {
+		sch.shareSectionFlag(key)
+		if len(ft.oneOf) > 0 && existing == nil && flagCmd != nil && flagCmd.Flag(key) != nil {
+			if err = sch.registerOneOfCompletion(flagCmd, key, ft.oneOf); err != nil {
 				panic(err.Error())
 			}
 		}
 	}
+	if len(envs) > 0 && sch.envLookup == nil {
+		// Bind env vars to viper, the first one set wins.
+		// The ones of WithEnvLookup are merged in by mergeInLookupEnvs.
+		// This overrides viper default setting
+		// with values from ENV vars.
+		// Note: viper treats ENV variables as case sensitive.
+		err = sch.backend.BindEnv(key, envs...)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+	sch.bindings = append(sch.bindings, fieldBinding{
+		key:          key,
+		envs:         envs,
+		help:         ft.help,
+		typ:          fieldValue.Type(),
+		defaultValue: fieldValue.Interface(),
+		required:     ft.required,
+		relpath:      ft.relpath,
+		secret:       ft.secret,
+		percent:      ft.percent,
+		persist:      ft.persist,
+		oneOf:        ft.oneOf,
+		min:          ft.min,
+		max:          ft.max,
+		noFlag:       ft.noFlag,
+		noConfig:     ft.noConfig,
+		ref:          ft.ref,
+		aliases:      ft.aliases,
+	})
+	flagName := ""
+	if !ft.noFlag && existing == nil {
+		flagName = key
+	}
+	sch.debugBinding(sch.bindings[len(sch.bindings)-1], flagName)
 }
 
 // UnmarshalExact unmarshals the config into a Struct,
-// erroring if a field is nonexistent in the destination struct.
-func (sch *SnakeCharmer) UnmarshalExact() (err error) {
-	if len(sch.configFilePath) > 0 {
-		if err = sch.mergeInConfigFile(); err != nil {
+// erroring if a field is nonexistent in the destination struct,
+// unless the strictness is relaxed, see WithStrictness.
+func (sch *SnakeCharmer) UnmarshalExact() error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.unmarshalExact(false)
+}
+
+// Unmarshal unmarshals the config into a Struct like UnmarshalExact,
+// but tolerates the config keys that do not exist in the destination struct,
+// so the config files with new keys can run on older binaries.
+// The unknown keys are skipped silently, or with a warning
+// if WithStrictness(StrictnessWarn) is set.
+func (sch *SnakeCharmer) Unmarshal() error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	unknown, err := sch.unmarshal(true, false)
+	if err == nil && sch.strictness == StrictnessWarn {
+		sch.warnUnknownKeys(unknown)
+	}
+	return err
+}
+
+// UnmarshalWithWarnings unmarshals the config into a Struct like UnmarshalExact,
+// but the config keys that do not exist in the destination struct are skipped
+// and returned as a non-fatal report instead of failing, so newer config files
+// can run on older binaries while still surfacing the mismatch.
+func (sch *SnakeCharmer) UnmarshalWithWarnings() ([]UnknownKey, error) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.unmarshal(true, false)
+}
+
+// UnmarshalSection decodes the subtree of the config with the given key,
+// e.g. "log" or "server.tls", into the target, which must be a pointer
+// to a struct or a map, e.g. charmer.UnmarshalSection("log", &loggingCfg).
+// The same decoder options and tag name as for the result struct are used,
+// but the keys unknown to the target are ignored. The settings of the last
+// run of the unmarshal pipeline are decoded, or the merged ones before it.
+func (sch *SnakeCharmer) UnmarshalSection(key string, target interface{}) error {
+	if rv := reflect.ValueOf(target); rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	settings := sch.settings
+	if settings == nil {
+		settings = sch.backend.AllSettings()
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	section := nestedSettings(settings, key)
+	if section == nil {
+		if parent, name := settingsParent(settings, key); parent != nil && parent[name] != nil {
+			return fmt.Errorf("config key %q is not a section", key)
+		}
+		section = map[string]interface{}{}
+	}
+	if err := decode(section, target, false, sch.decoderOptions()...); err != nil {
+		return fmt.Errorf("while unmarshalling config section %q: %w", key, sch.redactError(err, settings))
+	}
+	return nil
+}
+
+// Reload is the reload pipeline. It sets the given snakecharmer options
+// (even if the configuration is frozen), re-reads the config file,
+// re-loads the values from providers and unmarshals them
+// into the result struct again. It returns ErrClosed after Close is called.
+func (sch *SnakeCharmer) Reload(opts ...CharmingOption) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if sch.closed {
+		return ErrClosed
+	}
+	for _, opt := range opts {
+		if err := opt(sch); err != nil {
 			return err
 		}
 	}
-	if sch.fieldTagName != "mapstructure" {
-		sch.decoderConfigOptions = append(sch.decoderConfigOptions,
-			func(dc *mapstructure.DecoderConfig) { dc.TagName = sch.fieldTagName },
+	return sch.unmarshalExact(false)
+}
+
+// FilesUsed returns the files actually read by the last run of
+// the unmarshal pipeline in the merge order, unlike viper.ConfigFileUsed(),
+// which returns the last one only.
+func (sch *SnakeCharmer) FilesUsed() []string {
+	if v := sch.loadView(); v != nil {
+		return append([]string(nil), v.filesUsed...)
+	}
+	return nil
+}
+
+// Frozen returns true if the configuration is frozen, i.e. Set() is rejected.
+// See WithFreeze
+func (sch *SnakeCharmer) Frozen() bool {
+	return sch.frozen.Load()
+}
+
+// unmarshalExact runs the unmarshal pipeline with the strictness
+// of UnmarshalExact, see unmarshal for dryRun.
+func (sch *SnakeCharmer) unmarshalExact(dryRun bool) error {
+	unknown, err := sch.unmarshal(sch.strictness != StrictnessStrict, dryRun)
+	if err == nil && sch.strictness == StrictnessWarn {
+		sch.warnUnknownKeys(unknown)
+	}
+	return err
+}
+
+// unmarshal runs the unmarshal pipeline. If lenient is true, the unknown
+// config keys are skipped and returned instead of failing. If dryRun is true,
+// the config is only checked, e.g. by the check config flag,
+// so the state file is not written.
+func (sch *SnakeCharmer) unmarshal(lenient, dryRun bool) (warnings []UnknownKey, err error) {
+	defer sch.publishView(false)
+	sch.filesUsed = nil
+	sch.layerSources = nil
+	sch.yamlPositions = nil
+	sch.numberTexts = nil
+	if err = sch.checkContext(); err != nil {
+		return nil, err
+	}
+	if err = sch.loadOverrides(); err != nil {
+		return nil, err
+	}
+	if len(sch.stateFile) > 0 {
+		if err = sch.loadState(); err != nil {
+			return nil, err
+		}
+	}
+	if sch.hasConfig() {
+		if err = sch.mergeInConfigFile(); err != nil {
+			return nil, err
+		}
+	} else if err = sch.backend.MergeFile("", map[string]interface{}{}); err != nil {
+		// The config layer is rebuilt on every run, so the values
+		// no longer returned by the sources merged into it are cleared
+		return nil, fmt.Errorf("while clearing config: %w", err)
+	}
+	if len(sch.remoteProvider) > 0 || sch.remote != nil {
+		if err = sch.mergeInRemoteConfig(); err != nil {
+			return nil, err
+		}
+	}
+	// The injected ENV vars are merged in before the bootstrap
+	// config is decoded, and again after the rest of the layers below them
+	if err = sch.mergeInLookupEnvs(); err != nil {
+		return nil, err
+	}
+	if err = sch.loadBootstrap(); err != nil {
+		return nil, err
+	}
+	if err = sch.mergeInProviders(); err != nil {
+		return nil, err
+	}
+	if err = sch.checkContext(); err != nil {
+		return nil, err
+	}
+	if err = sch.mergeInFieldRefs(); err != nil {
+		return nil, err
+	}
+	if len(sch.secretsDir) > 0 {
+		if err = sch.mergeInSecretsDir(); err != nil {
+			return nil, err
+		}
+	}
+	if err = sch.mergeInStructEnvs(); err != nil {
+		return nil, err
+	}
+	if len(sch.dotEnvFile) > 0 {
+		if err = sch.mergeInDotEnv(); err != nil {
+			return nil, err
+		}
+	}
+	if err = sch.mergeInLookupEnvs(); err != nil {
+		return nil, err
+	}
+	if err = sch.checkLimits(); err != nil {
+		return nil, err
+	}
+	// The type mismatches, unknown keys and failed validations
+	// are collected, so they can be fixed at once
+	errs := []error{}
+	if err = sch.checkRequiredKeys(); err != nil {
+		errs = append(errs, err)
+	}
+	settings := sch.backend.AllSettings()
+	if err = sch.applyPrecedence(settings); err != nil {
+		return nil, err
+	}
+	sch.applyIndexedFlags(settings)
+	if patch := sch.configPatch(); len(patch) > 0 {
+		patched, err := applyJSONPatch(settings, patch)
+		if err != nil {
+			return nil, sch.redactError(err, settings)
+		}
+		settings = patched
+	}
+	sch.applyOverrides(settings)
+	sch.restoreNumberTexts(settings)
+	var state map[string]interface{}
+	if len(sch.stateFile) > 0 && !dryRun {
+		state = sch.stateValues(settings)
+	}
+	if err = sch.resolveValues(settings); err != nil {
+		return nil, err
+	}
+	if sch.fileValues {
+		if err = sch.resolveFileKeys(settings); err != nil {
+			return nil, err
+		}
+	}
+	if err = sch.checkContext(); err != nil {
+		return nil, err
+	}
+	settings = sch.withoutBootstrapKeys(settings)
+	settings = sch.withoutDefaultOnlyKeys(settings)
+	errs = append(errs, sch.normalizePercents(settings)...)
+	errs = append(errs, sch.checkOneOf(settings)...)
+	errs = append(errs, sch.checkRanges(settings)...)
+	if unknown := sch.unknownKeys(settings); len(unknown) > 0 {
+		if !lenient {
+			errs = append(errs, &UnknownKeysError{Keys: unknown})
+		} else {
+			warnings = unknown
+		}
+		for _, k := range unknown {
+			deleteSetting(settings, k.Key)
+		}
+	}
+	if settings, err = sch.decodeTenants(settings); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		// The result struct is left intact, the copy is decoded
+		// to collect the type mismatches and the failed validations
+		out := reflect.New(reflect.TypeOf(sch.resultStruct).Elem()).Interface()
+		if err = decode(settings, out, true, sch.decoderOptions()...); err != nil {
+			errs = append(errs, sch.decodeErrors(err, settings, errs)...)
+		}
+		errs = append(errs, sch.validationErrors(out, errs)...)
+		return nil, joinConfigErrors(errs)
+	}
+	if sch.settings == nil && !sch.initialResult.IsValid() {
+		sch.initialResult = deepCopy(reflect.ValueOf(sch.resultStruct).Elem(), false)
+	}
+	err = sch.decodeResult(settings)
+	if err != nil {
+		// The result struct may be partially updated
+		sch.rollback()
+		errs = sch.decodeErrors(err, settings, nil)
+		// The decoding errors are collected already,
+		// the copy is decoded to validate the rest of the fields
+		out := reflect.New(reflect.TypeOf(sch.resultStruct).Elem()).Interface()
+		_ = decode(settings, out, true, sch.decoderOptions()...)
+		if errs = append(errs, sch.validationErrors(out, errs)...); len(errs) > 1 {
+			return nil, joinConfigErrors(errs)
+		}
+		return nil, fmt.Errorf("while unmarshalling config, flags, and env vars: %w", errs[0])
+	}
+	// The callbacks below may call the read-only accessors
+	sch.publishView(true)
+	if err = sch.validateResult(); err != nil {
+		// The previous config is restored, like for the rejecting subscribers
+		sch.rollback()
+		return nil, err
+	}
+	if serr := sch.notifySubscribers(); serr != nil {
+		serr.RolledBack = sch.rollback()
+		return nil, serr
+	}
+	// The snapshot is replaced only by the config which passed
+	// the validation and was accepted by the subscribers
+	sch.storeSnapshot()
+	sch.settings = settings
+	if len(sch.stateFile) > 0 && !dryRun {
+		if err = sch.saveState(state); err != nil {
+			return nil, err
+		}
+	}
+	if sch.freeze {
+		sch.frozen.Store(true)
+	}
+	return warnings, nil
+}
+
+// decodeResult decodes the settings into the result struct
+// and runs the afterDecode callbacks on success.
+func (sch *SnakeCharmer) decodeResult(settings map[string]interface{}) error {
+	if err := decode(settings, sch.resultStruct, true, sch.decoderOptions()...); err != nil {
+		return err
+	}
+	for _, fn := range sch.afterDecode {
+		fn()
+	}
+	return nil
+}
+
+// decoderOptions returns the viper.DecoderConfigOption list
+// used for decoding the config into the result struct.
+func (sch *SnakeCharmer) decoderOptions() []viper.DecoderConfigOption {
+	opts := make([]viper.DecoderConfigOption, 0, len(sch.decoderConfigOptions)+2)
+	opts = append(opts, sch.decoderConfigOptions...)
+	if sch.squashEmbedded || sch.tagDialect != TagDialectSnakeCharmer {
+		opts = append(opts,
+			func(dc *mapstructure.DecoderConfig) { dc.Squash = true },
 		)
 	}
-	err = sch.viper.UnmarshalExact(sch.resultStruct, sch.decoderConfigOptions...)
+	switch sch.tagDialect {
+	case TagDialectEnvconfig:
+		opts = append(opts,
+			func(dc *mapstructure.DecoderConfig) { dc.MatchName = matchName },
+		)
+	case TagDialectKong:
+		opts = append(opts,
+			func(dc *mapstructure.DecoderConfig) {
+				dc.TagName = "name"
+				dc.MatchName = matchName
+			},
+		)
+	default:
+		if sch.fieldTagName != "mapstructure" {
+			opts = append(opts,
+				func(dc *mapstructure.DecoderConfig) { dc.TagName = sch.fieldTagName },
+			)
+		}
+	}
+	// Values of changed slice flags (except []string and []int) come from viper
+	// as strings like "[1.5,2.5]", so they have to be converted back to slices.
+	// Values of slices and maps come from ENV vars as strings like "a,b" and "a=1,b=2".
+	// The file values, e.g. "@/run/secrets/db_password", are read first,
+	// so the other hooks convert the content of the file.
+	// The user hooks go before the built-in ones to handle the custom types.
+	hooks := []mapstructure.DecodeHookFunc{}
+	if sch.fileValues {
+		hooks = append(hooks, sch.fileValueHookFunc())
+	}
+	hooks = append(hooks, sch.decodeHooks...)
+	opts = append(opts,
+		func(dc *mapstructure.DecoderConfig) {
+			dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(append(hooks,
+				flagSliceHookFunc(),
+				flagValueHookFunc(),
+				netHookFunc(),
+				byteSizeHookFunc(),
+				textUnmarshalerHookFunc(),
+				mapstructure.StringToSliceHookFunc(sch.sliceSep),
+				stringToMapHookFunc(sch.mapEntrySep, sch.mapPairSep),
+				dc.DecodeHook,
+				overflowHookFunc(),
+			)...)
+		},
+	)
+	return opts
+}
+
+// decode decodes the input into the output the same way viper.Unmarshal does,
+// or viper.UnmarshalExact if exact is true, except that the output fields
+// are zeroed before decoding (see mapstructure.DecoderConfig.ZeroFields).
+func decode(input, output interface{}, exact bool, opts ...viper.DecoderConfigOption) error {
+	dc := &mapstructure.DecoderConfig{
+		Result:           output,
+		WeaklyTypedInput: true,
+		// Slices and maps must be replaced rather than merged with the defaults
+		ZeroFields: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	}
+	for _, opt := range opts {
+		opt(dc)
+	}
+	if exact {
+		dc.ErrorUnused = true
+	}
+	decoder, err := mapstructure.NewDecoder(dc)
 	if err != nil {
-		return fmt.Errorf("while unmarshalling config, flags, and env vars: %s", err.Error())
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// isSquashed returns true if the fields of a struct field must be registered
+// at the parent level. These are the fields with the "squash" field tag option,
+// e.g. `mapstructure:",squash"`, and the plain (untagged) embedded structs.
+// Note, if a plain embedded struct is used, all the embedded structs are squashed
+// while unmarshalling (see mapstructure.DecoderConfig.Squash), so a named field
+// must be used for a nested section.
+// Embedded structs are always squashed with non-native tag dialects.
+func (sch *SnakeCharmer) isSquashed(sf reflect.StructField) bool {
+	squash, embedded := sch.squashed(sf)
+	if embedded {
+		sch.squashEmbedded = true
+	}
+	return squash
+}
+
+// squashed works like isSquashed, but it has no side effects. The second
+// result is true if the field is the plain embedded struct squashed
+// with the native tag dialect.
+func (sch *SnakeCharmer) squashed(sf reflect.StructField) (bool, bool) {
+	t := sf.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	embedded := sf.Anonymous && t.Kind() == reflect.Struct
+	if sch.tagDialect != TagDialectSnakeCharmer {
+		return embedded, false
+	}
+	fieldTag, ok := sf.Tag.Lookup(sch.fieldTagName)
+	if !ok && embedded {
+		return true, true
+	}
+	_, opts := parseFieldTag(fieldTag)
+	return opts.Has("squash"), false
+}
+
+// checkRequiredKeys verifies that the values of required keys
+// were provided by a flag, an ENV var or a config file,
+// rather than falling back to a default value.
+func (sch *SnakeCharmer) checkRequiredKeys() error {
+	missing := []string{}
+	for _, b := range sch.bindings {
+		if !b.required {
+			continue
+		}
+		if _, ok := sch.overrideSource(b.key); ok {
+			continue
+		}
+		if sch.precedence != nil {
+			if layer, ok := sch.precedenceLayer(b); ok && layer != SourceDefault {
+				continue
+			}
+			missing = append(missing, b.key)
+			continue
+		}
+		if flag := sch.lookupFlag(b.key); flag != nil && flag.Changed {
+			continue
+		}
+		if sch.envSet(b.envs) {
+			continue
+		}
+		if sch.backend.InConfig(b.key) {
+			continue
+		}
+		missing = append(missing, b.key)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required config params are not set: %s", strings.Join(missing, ", "))
 	}
 	return nil
 }
 
+// configFiles returns the config file paths in the merge order,
+// the config file path set with WithConfigFilePath goes last.
+// If it is not set, the config file found in the standard config
+// directories goes last instead, see WithStandardConfigPaths.
+func (sch *SnakeCharmer) configFiles() []string {
+	paths := make([]string, 0, len(sch.configFilePaths)+1)
+	paths = append(paths, sch.configFilePaths...)
+	if len(sch.configFilePath) > 0 {
+		paths = append(paths, sch.configFilePath)
+	} else if len(sch.standardConfigApp) > 0 {
+		if file := sch.standardConfigFile(); len(file) > 0 {
+			paths = append(paths, file)
+		}
+	}
+	return paths
+}
+
+// mergeInConfigFile reads the config files in order, merges them,
+// later files winning, and replaces viper config with the result.
 func (sch *SnakeCharmer) mergeInConfigFile() (err error) {
-	if len(sch.configFilePath) == 0 {
+	paths := sch.configFiles()
+	if len(paths) == 0 && len(sch.configDocs) == 0 {
 		return fmt.Errorf("config file path is an empty string")
 	}
 
-	found, err := sch.findConfigFile()
-	if err != nil {
-		return fmt.Errorf("while finding config %q: %s", sch.configFilePath, err.Error())
+	merged := viper.New()
+	used := ""
+	for i, doc := range sch.configDocs {
+		name := fmt.Sprintf("config document #%d", i+1)
+		settings, err := sch.readConfigBytes(name, doc.data, doc.format)
+		if err != nil {
+			return err
+		}
+		if err = sch.migrateConfig(name, settings); err != nil {
+			return err
+		}
+		if err = merged.MergeConfigMap(settings); err != nil {
+			return fmt.Errorf("while merging config document #%d: %w", i+1, err)
+		}
+		sch.debugMergedKeys(settings, SourceConfigFile, slog.String("file", name))
+	}
+	for _, path := range paths {
+		if err = sch.checkContext(); err != nil {
+			return err
+		}
+		var settings map[string]interface{}
+		file := path
+		if path == stdinConfigPath {
+			settings, err = sch.readStdinConfig()
+		} else if isConfigURL(path) {
+			settings, err = sch.readConfigURL(path)
+		} else if r, _ := sch.resolverOf(path); r != nil {
+			settings, err = sch.readConfigRef(path)
+		} else if file, err = sch.findConfigFileAt(path); err != nil {
+			if !sch.configFileRequired && errors.Is(err, ErrConfigFileNotFound) {
+				// The optional config file, e.g. the default location
+				continue
+			}
+			return fmt.Errorf("while finding config %q: %w", path, err)
+		} else {
+			settings, err = sch.readConfigFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		if err = sch.migrateConfig(fmt.Sprintf("config %q", path), settings); err != nil {
+			return err
+		}
+		if err = merged.MergeConfigMap(settings); err != nil {
+			return fmt.Errorf("while merging config %q: %w", path, err)
+		}
+		used = file
+		sch.filesUsed = append(sch.filesUsed, file)
+		sch.debug("config file chosen", slog.String("path", file))
+		sch.debugMergedKeys(settings, SourceConfigFile, slog.String("file", file))
 	}
 
-	if !found {
-		return nil
+	settings, err := sch.applyProfile(merged.AllSettings())
+	if err != nil {
+		return err
+	}
+	sch.applyKeyAliases(settings)
+	if err = sch.checkNoConfig(settings); err != nil {
+		return err
 	}
+	return sch.backend.MergeFile(used, settings)
+}
 
-	if err = sch.viper.ReadInConfig(); err != nil {
-		return fmt.Errorf("while reading config %q: %s", sch.configFilePath, err.Error())
+// checkNoConfig returns an error if the config settings set
+// the key of a field that cannot be set in config, e.g. `config:"-"`.
+func (sch *SnakeCharmer) checkNoConfig(settings map[string]interface{}) error {
+	for _, b := range sch.bindings {
+		if !b.noConfig {
+			continue
+		}
+		if parent, name := settingsParent(settings, b.key); parent != nil {
+			if _, ok := parent[name]; ok {
+				return fmt.Errorf("config param %q cannot be set in config file", b.key)
+			}
+		}
 	}
 	return nil
 }
 
+// readConfigFile reads the config file into the settings map.
+func (sch *SnakeCharmer) readConfigFile(file string) (map[string]interface{}, error) {
+	if err := sch.checkConfigFileSize(file); err != nil {
+		return nil, err
+	}
+	data, err := sch.readFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("while reading config %q: %w", file, err)
+	}
+	fext := strings.TrimPrefix(filepath.Ext(file), ".")
+	if len(fext) == 0 || !fileExtSupported(fext) {
+		// REQUIRED since the config file does not have the extension in the name
+		// or the extension is not in the list of supported extensions
+		fext = sch.configFileType
+	}
+	// The file is read once, the documents and positions are of the same data
+	settings, err := sch.readConfigBytes(file, data, fext)
+	if err != nil {
+		return nil, err
+	}
+	if sch.isYAMLConfig(file) && len(bytes.TrimSpace(data)) > 0 {
+		sch.recordYAMLPositions(file, data)
+	}
+	sch.recordNumberTexts(data, fext)
+	if err := sch.resolveRelPaths(settings, file); err != nil {
+		return nil, fmt.Errorf("while resolving relative paths of %q: %w", file, err)
+	}
+	return settings, nil
+}
+
 func (sch *SnakeCharmer) findConfigFile() (bool, error) {
 	if len(sch.configFilePath) == 0 {
 		return false, fmt.Errorf("config file path is an empty string")
 	}
-	fileInfo, err := os.Stat(sch.configFilePath)
+	file, err := sch.findConfigFileAt(sch.configFilePath)
+	return len(file) > 0, err
+}
+
+// findConfigFileAt returns the config file path.
+// If the path is a directory, the config file is searched there
+// by the config file base name and the supported extensions.
+func (sch *SnakeCharmer) findConfigFileAt(path string) (string, error) {
+	fileInfo, err := sch.statFile(path)
 	if err == nil {
 		// path exists
-		if fileInfo.IsDir() {
-			// path is a directory
-			sch.viper.AddConfigPath(sch.configFilePath)     // path to look for the config file in
-			sch.viper.SetConfigName(sch.configFileBaseName) // name of config file (without extension)
-		} else {
+		if !fileInfo.IsDir() {
 			// path is a file
-			fext := strings.TrimPrefix(filepath.Ext(sch.configFilePath), ".")
-			if len(fext) == 0 {
-				// REQUIRED since the config file does not have the extension in the name
-				sch.viper.SetConfigType(sch.configFileType)
-				sch.viper.SetConfigFile(sch.configFilePath)
-			} else if fileExtSupported(fext) {
-				// See viper.SupportedExts for full list of supported extensions
-				sch.viper.SetConfigFile(sch.configFilePath)
-			} else {
-				// REQUIRED since the config file extension is not in the list of supported extensions
-				sch.viper.SetConfigType(sch.configFileType)
-				sch.viper.SetConfigFile(sch.configFilePath)
+			return path, nil
+		}
+		// path is a directory, look for the config file in it.
+		// The paths of WithFilesystem are relative to its root already
+		dir := path
+		if sch.fsys == nil {
+			if dir, err = filepath.Abs(path); err != nil {
+				return "", err
+			}
+		}
+		// See viper.SupportedExts for full list of supported extensions
+		for _, ext := range viper.SupportedExts {
+			file := filepath.Join(dir, sch.configFileBaseName+"."+ext)
+			if fi, err := sch.statFile(file); err == nil && !fi.IsDir() {
+				return file, nil
 			}
 		}
-		return true, nil
+		return "", &configNotFoundError{msg: fmt.Sprintf("config file %q not found in %q", sch.configFileBaseName, dir)}
 	} else if errors.Is(err, os.ErrNotExist) {
 		// path does *not* exist
-		return false, fmt.Errorf("no such file or directory: %q", sch.configFilePath)
+		return "", &configNotFoundError{msg: fmt.Sprintf("no such file or directory: %q", path)}
 	} else {
 		// Schrodinger: file may or may not exist. See err for details.
 		// Therefore, do *NOT* use !os.IsNotExist(err) to test for file existence
-		return false, fmt.Errorf("schrodinger: %q may or may not exist: %s", sch.configFilePath, err.Error())
+		return "", fmt.Errorf("schrodinger: %q may or may not exist: %w", path, err)
 	}
 }
 
 // This adds Flag to cobra flagset and sets default viper config param
-func (sch *SnakeCharmer) applySetting(rv reflect.Value, name, help string) error {
+func (sch *SnakeCharmer) applySetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) error {
 	switch rv.Kind() {
 	case reflect.Bool:
 		value := rv.Bool()
-		sch.cmd.PersistentFlags().Bool(name, value, help)
-		sch.viper.SetDefault(name, value)
+		fs.Bool(name, value, help)
+		sch.backend.SetDefault(name, value)
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		value := rv.Uint()
-		sch.cmd.PersistentFlags().Uint64(name, value, help)
-		sch.viper.SetDefault(name, value)
+		fs.Uint64(name, value, help)
+		sch.backend.SetDefault(name, value)
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		value := rv.Int()
-		sch.cmd.PersistentFlags().Int64(name, value, help)
-		sch.viper.SetDefault(name, value)
+		fs.Int64(name, value, help)
+		sch.backend.SetDefault(name, value)
 
 	case reflect.Float32, reflect.Float64:
 		value := rv.Float()
-		sch.cmd.PersistentFlags().Float64(name, value, help)
-		sch.viper.SetDefault(name, value)
+		fs.Float64(name, value, help)
+		sch.backend.SetDefault(name, value)
 
 	case reflect.String:
 		value := rv.String()
-		sch.cmd.PersistentFlags().String(name, value, help)
-		sch.viper.SetDefault(name, value)
+		fs.String(name, value, help)
+		sch.backend.SetDefault(name, value)
 
 	case reflect.Slice:
-		intf := rv.Interface()
-		value, ok := intf.([]string)
-		if !ok {
-			return fmt.Errorf("BUG: invalid type: %T for flag %q", intf, name)
+		if rv.IsNil() {
+			// The nil slice, e.g. of the nil pointer field, gets the empty flag
+			rv = reflect.MakeSlice(rv.Type(), 0, 0)
 		}
-		if len(value) == 0 {
-			return fmt.Errorf("BUG: value of flag %q (%T) is nil or empty", name, intf)
+		intf := rv.Interface()
+		switch value := intf.(type) {
+		case []string:
+			fs.StringSlice(name, value, help)
+		case []int:
+			fs.IntSlice(name, value, help)
+		case []int32:
+			fs.Int32Slice(name, value, help)
+		case []int64:
+			fs.Int64Slice(name, value, help)
+		case []uint:
+			fs.UintSlice(name, value, help)
+		case []float32:
+			fs.Float32Slice(name, value, help)
+		case []float64:
+			fs.Float64Slice(name, value, help)
+		case []bool:
+			fs.BoolSlice(name, value, help)
+		default:
+			return newUnsupportedFieldTypeError(name, rv.Type())
 		}
-		sch.cmd.PersistentFlags().StringSlice(name, value, help)
-		sch.viper.SetDefault(name, value)
+		sch.backend.SetDefault(name, intf)
 
 	case reflect.Map:
-		intf := rv.Interface()
-		value, ok := intf.(map[string]string)
-		if !ok {
-			return fmt.Errorf("BUG: invalid type: %T for flag %q", intf, name)
+		if !isScalarMap(rv.Type()) {
+			return newUnsupportedFieldTypeError(name, rv.Type())
 		}
-		if value == nil {
-			return fmt.Errorf("BUG: value of flag %q (%T) is nil or empty", name, intf)
+		if rv.IsNil() {
+			// The nil map, e.g. of the nil pointer field, gets the empty flag
+			rv = reflect.MakeMap(rv.Type())
+		}
+		intf := rv.Interface()
+		switch value := intf.(type) {
+		case map[string]string:
+			fs.StringToString(name, value, help)
+		case map[string]int:
+			fs.StringToInt(name, value, help)
+		case map[string]int64:
+			fs.StringToInt64(name, value, help)
+		default:
+			// The rest of the maps, e.g. map[string]bool, are set the same way
+			fs.Var(newMapValue(rv), name, help)
 		}
-		sch.cmd.PersistentFlags().StringToString(name, value, help)
-		sch.viper.SetDefault(name, value)
+		sch.backend.SetDefault(name, intf)
 
 	default:
-		return fmt.Errorf("BUG: unsupported type: %q", rv.Kind().String())
+		return newUnsupportedFieldTypeError(name, rv.Type())
 	}
 	return nil
 }
@@ -16,8 +16,10 @@ package snakecharmer
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -155,6 +157,16 @@ func Test_NewSnakeCharmerError(t *testing.T) {
 		WithCobraCommand(cmd),
 		WithFlagHelpTagName(" "),
 	)
+	f(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithDefaultTagName(" "),
+	)
+	f(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithTagDialect(TagDialect(42)),
+	)
 	f(
 		WithResultStruct(result),
 		WithCobraCommand(cmd),
@@ -202,6 +214,11 @@ func Test_NewSnakeCharmerOkay(t *testing.T) {
 		WithCobraCommand(cmd),
 		WithFlagHelpTagName("help"),
 	)
+	f(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithDefaultTagName("def"),
+	)
 	f(
 		WithResultStruct(result),
 		WithCobraCommand(cmd),
@@ -212,6 +229,11 @@ func Test_NewSnakeCharmerOkay(t *testing.T) {
 		WithCobraCommand(cmd),
 		WithConfigFilePath("/etc/snakecharmer"),
 	)
+	f(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithConfigFilePaths("/etc/snakecharmer/base.yaml", "./override.yaml"),
+	)
 	f(
 		WithResultStruct(result),
 		WithCobraCommand(cmd),
@@ -299,6 +321,7 @@ func Test_SetGetOkay(t *testing.T) {
 		WithFieldTagName("snakecharmer"),
 		WithEnvTagName("environment"),
 		WithFlagHelpTagName("help"),
+		WithDefaultTagName("def"),
 		WithConfigFileType("json"),
 		WithConfigFilePath("/etc/snakecharmer"),
 		WithConfigFileBaseName("conf"),
@@ -313,6 +336,7 @@ func Test_SetGetOkay(t *testing.T) {
 	require.Equal(t, "snakecharmer", charmer.FieldTagName())
 	require.Equal(t, "environment", charmer.EnvTagName())
 	require.Equal(t, "help", charmer.FlagHelpTagName())
+	require.Equal(t, "def", charmer.DefaultTagName())
 	require.Equal(t, "json", charmer.ConfigFileType())
 	require.Equal(t, "/etc/snakecharmer", charmer.ConfigFilePath())
 	require.Equal(t, "conf", charmer.ConfigFileBaseName())
@@ -778,3 +802,597 @@ func Test_WithConfigDir(t *testing.T) {
 	require.Equal(t, expectedLogErrorsLimit, *result.Logging.LogLimits.ErrorsLimit)
 	require.Equal(t, expectedLogDestinations, *result.Logging.LogDestinations)
 }
+
+func Test_SliceFlags(t *testing.T) {
+	type sliceStruct struct {
+		Ports   *[]int     `snakecharmer:"ports" usage:"List of ports"`
+		IDs     *[]int64   `snakecharmer:"ids" usage:"List of IDs"`
+		Shards  *[]uint    `snakecharmer:"shards" usage:"List of shards"`
+		Weights *[]float64 `snakecharmer:"weights" usage:"List of weights"`
+		Ratios  *[]float32 `snakecharmer:"ratios" usage:"List of ratios"`
+		Enabled *[]bool    `snakecharmer:"enabled" usage:"List of switches"`
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	var (
+		defaultPorts   = []int{80, 443}
+		defaultIDs     = []int64{1, 2}
+		defaultShards  = []uint{3}
+		defaultWeights = []float64{0.5, 0.5}
+		defaultRatios  = []float32{0.25}
+		defaultEnabled = []bool{true, false}
+	)
+	result := &sliceStruct{
+		Ports:   &defaultPorts,
+		IDs:     &defaultIDs,
+		Shards:  &defaultShards,
+		Weights: &defaultWeights,
+		Ratios:  &defaultRatios,
+		Enabled: &defaultEnabled,
+	}
+	vpr := viper.New()
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithViper(vpr),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+
+	charmer.AddFlags()
+
+	cmd.SetArgs([]string{
+		"--ports=8080,8443",
+		"--ids=10,20,30",
+		"--weights=1.5,2.5",
+		"--enabled=false,true,true",
+	})
+
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+
+	require.Equal(t, []int{8080, 8443}, *result.Ports)
+	require.Equal(t, []int64{10, 20, 30}, *result.IDs)
+	require.Equal(t, []uint{3}, *result.Shards)
+	require.Equal(t, []float64{1.5, 2.5}, *result.Weights)
+	require.Equal(t, []float32{0.25}, *result.Ratios)
+	require.Equal(t, []bool{false, true, true}, *result.Enabled)
+}
+
+func Test_DefaultTag(t *testing.T) {
+	type limitsStruct struct {
+		Warn  uint `snakecharmer:"warn" usage:"Limit warn messages per sec" default:"100"`
+		Error uint `snakecharmer:"error" usage:"Limit error messages per sec" default:"10"`
+	}
+	type defaultStruct struct {
+		Workers   int               `snakecharmer:"workers" usage:"Number of workers to run" default:"128"`
+		MaxBurst  *float64          `snakecharmer:"max-burst" usage:"Max burst allowed" default:"1.25"`
+		BindAddr  *string           `snakecharmer:"bind-addr" usage:"Addr to bind" default:"0.0.0.0"`
+		LogJSON   bool              `snakecharmer:"json" usage:"Log in JSON format" default:"true"`
+		Ports     []int             `snakecharmer:"ports" usage:"List of ports" default:"80,443"`
+		Upstreams *[]string         `snakecharmer:"upstreams" usage:"List of upstream urls" default:"http://www.foo.com/"`
+		Dst       map[string]string `snakecharmer:"dst" usage:"Log destinations" default:"error=/var/log/error.log"`
+		Limits    *limitsStruct     `snakecharmer:"limit"`
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	result := &defaultStruct{}
+	vpr := viper.New()
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithViper(vpr),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+
+	charmer.AddFlags()
+
+	cmd.SetArgs([]string{
+		"--workers=256",
+		"--limit.error=5",
+	})
+
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+
+	require.Equal(t, 256, result.Workers)
+	require.Equal(t, 1.25, *result.MaxBurst)
+	require.Equal(t, "0.0.0.0", *result.BindAddr)
+	require.Equal(t, true, result.LogJSON)
+	require.Equal(t, []int{80, 443}, result.Ports)
+	require.Equal(t, []string{"http://www.foo.com/"}, *result.Upstreams)
+	require.Equal(t, map[string]string{"error": "/var/log/error.log"}, result.Dst)
+	require.Equal(t, uint(100), result.Limits.Warn)
+	require.Equal(t, uint(5), result.Limits.Error)
+}
+
+func Test_DefaultTagEmptyCollections(t *testing.T) {
+	type emptyStruct struct {
+		Ports   *[]int             `snakecharmer:"ports" usage:"List of ports"`
+		Weights *[]float64         `snakecharmer:"weights" usage:"List of weights"`
+		Labels  *map[string]string `snakecharmer:"labels" usage:"Labels"`
+		Hosts   []string           `snakecharmer:"hosts" usage:"List of hosts" default:""`
+		Limits  map[string]int     `snakecharmer:"limits" usage:"Limits" default:""`
+	}
+	f := func(args ...string) *emptyStruct {
+		t.Helper()
+		result := &emptyStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.NotPanics(t, charmer.AddFlags)
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		require.NoError(t, charmer.UnmarshalExact())
+		return result
+	}
+
+	result := f()
+	require.Empty(t, *result.Ports)
+	require.Empty(t, *result.Weights)
+	require.Empty(t, *result.Labels)
+	require.Empty(t, result.Hosts)
+	require.Empty(t, result.Limits)
+
+	result = f("--ports", "80,443", "--weights", "0.5", "--labels", "team=core",
+		"--hosts", "a,b", "--limits", "warn=10")
+	require.Equal(t, []int{80, 443}, *result.Ports)
+	require.Equal(t, []float64{0.5}, *result.Weights)
+	require.Equal(t, map[string]string{"team": "core"}, *result.Labels)
+	require.Equal(t, []string{"a", "b"}, result.Hosts)
+	require.Equal(t, map[string]int{"warn": 10}, result.Limits)
+}
+
+func Test_DefaultTagError(t *testing.T) {
+	type invalidStruct struct {
+		Workers int `snakecharmer:"workers" usage:"Number of workers to run" default:"many"`
+	}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&invalidStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	require.Panics(t, charmer.AddFlags)
+}
+
+func Test_Freeze(t *testing.T) {
+	result := initTestStruct()
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithIgnoreUntaggedFields(true),
+		WithFreeze(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = charmer.Set(WithConfigFilePath("./test-config.json")); err != nil {
+		t.Fatalf("unexpected error in Set(opts ...Option): %s", err.Error())
+	}
+	require.False(t, charmer.Frozen())
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.True(t, charmer.Frozen())
+	require.Equal(t, "127.0.0.1", *result.BindAddr)
+
+	if err = charmer.Set(WithConfigFilePath("./test-config")); err == nil {
+		t.Fatalf("expecting non-nil error in Set(opts ...Option) of frozen configuration")
+	}
+	require.Equal(t, "./test-config.json", charmer.ConfigFilePath())
+
+	if err = charmer.Reload(WithConfigFilePath("./test-config")); err != nil {
+		t.Fatalf("unexpected error in Reload(opts ...Option): %s", err.Error())
+	}
+	require.Equal(t, "./test-config", charmer.ConfigFilePath())
+	require.Equal(t, "127.0.0.255", *result.BindAddr)
+}
+
+func Test_RequiredTag(t *testing.T) {
+	type requiredStruct struct {
+		APIKey  *string `snakecharmer:"api-key,required" env:"TEST_REQUIRED_API_KEY" usage:"API key"`
+		Workers *int    `snakecharmer:"workers,omitempty" usage:"Number of workers to run" default:"1"`
+	}
+	f := func(args []string, env string, wantErr bool) {
+		t.Helper()
+		var charmer *SnakeCharmer
+		cmd := &cobra.Command{
+			PreRunE: func(cmd *cobra.Command, args []string) error {
+				return charmer.UnmarshalExact()
+			},
+			Run:           func(cmd *cobra.Command, args []string) {},
+			SilenceErrors: true,
+			SilenceUsage:  true,
+		}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&requiredStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if len(env) > 0 {
+			t.Setenv("TEST_REQUIRED_API_KEY", env)
+		}
+		cmd.SetArgs(args)
+		err = cmd.Execute()
+		if wantErr && err == nil {
+			t.Fatalf("expecting non-nil error in cmd.Execute()")
+		}
+		if !wantErr && err != nil {
+			t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+		}
+	}
+
+	f([]string{}, "", true)
+	f([]string{"--workers=2"}, "", true)
+	f([]string{"--api-key=secret"}, "", false)
+	f([]string{}, "secret", false)
+
+	// The flag is not marked as required in cobra, so the value can come
+	// from the config file even in the subcommands unmarshalling in RunE
+	cmd := &cobra.Command{Use: "app", SilenceErrors: true, SilenceUsage: true}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&requiredStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigBytes([]byte("api-key: secret\n"), "yaml"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	charmer.AttachConfigSubcommands(cmd)
+	require.Empty(t, cmd.PersistentFlags().Lookup("api-key").Annotations[cobra.BashCompOneRequiredFlag])
+	cmd.SetOut(io.Discard)
+	cmd.SetArgs([]string{"config", "validate"})
+	require.NoError(t, cmd.Execute())
+}
+
+type TestCommonOpts struct {
+	Verbose bool   `snakecharmer:"verbose" usage:"Verbose output"`
+	Region  string `snakecharmer:"region" usage:"Region" default:"us-east-1"`
+}
+
+type testTLSOpts struct {
+	CertFile string `snakecharmer:"cert-file" usage:"TLS cert file"`
+}
+
+func Test_SquashEmbedded(t *testing.T) {
+	type squashStruct struct {
+		TestCommonOpts
+		TLS     testTLSOpts `snakecharmer:",squash"`
+		Workers int         `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	result := &squashStruct{}
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	for _, name := range []string{"verbose", "region", "cert-file", "workers"} {
+		require.NotNil(t, cmd.PersistentFlags().Lookup(name), name)
+	}
+
+	cmd.SetArgs([]string{"--verbose", "--cert-file=/etc/tls.crt", "--workers=16"})
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.True(t, result.Verbose)
+	require.Equal(t, "us-east-1", result.Region)
+	require.Equal(t, "/etc/tls.crt", result.TLS.CertFile)
+	require.Equal(t, 16, result.Workers)
+}
+
+func Test_NonPointerFields(t *testing.T) {
+	type limitsStruct struct {
+		Warn  uint `snakecharmer:"warn" usage:"Limit warn messages per sec"`
+		Error uint `snakecharmer:"error" usage:"Limit error messages per sec"`
+	}
+	type loggingStruct struct {
+		Level  string            `snakecharmer:"level" usage:"Log level"`
+		Limits limitsStruct      `snakecharmer:"limit"`
+		Dst    map[string]string `snakecharmer:"dst" usage:"Log destinations"`
+	}
+	type plainStruct struct {
+		Workers   int           `snakecharmer:"workers" usage:"Number of workers to run"`
+		MaxBurst  float64       `snakecharmer:"max-burst" usage:"Max burst allowed"`
+		Upstreams []string      `snakecharmer:"upstreams" usage:"List of upstream urls"`
+		Logging   loggingStruct `snakecharmer:"log"`
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	result := &plainStruct{
+		Workers:   128,
+		MaxBurst:  1.25,
+		Upstreams: []string{"http://www.foo.com/"},
+		Logging: loggingStruct{
+			Level:  "info",
+			Limits: limitsStruct{Warn: 100, Error: 10},
+			Dst:    map[string]string{"error": "/var/log/error.log"},
+		},
+	}
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	require.Equal(t, "128", cmd.PersistentFlags().Lookup("workers").DefValue)
+	require.Equal(t, "100", cmd.PersistentFlags().Lookup("log.limit.warn").DefValue)
+
+	cmd.SetArgs([]string{"--log.level=debug", "--log.limit.error=5"})
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.Equal(t, 128, result.Workers)
+	require.Equal(t, 1.25, result.MaxBurst)
+	require.Equal(t, []string{"http://www.foo.com/"}, result.Upstreams)
+	require.Equal(t, "debug", result.Logging.Level)
+	require.Equal(t, uint(100), result.Logging.Limits.Warn)
+	require.Equal(t, uint(5), result.Logging.Limits.Error)
+	require.Equal(t, map[string]string{"error": "/var/log/error.log"}, result.Logging.Dst)
+}
+
+func Test_WithConfigFilePaths(t *testing.T) {
+	override := filepath.Join(t.TempDir(), "override.yaml")
+	data := []byte("bind-addr: 127.0.0.2\nlog:\n  limit:\n    warn: 30\n")
+	if err := os.WriteFile(override, data, 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	result := initTestStruct()
+	vpr := viper.New()
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithViper(vpr),
+		WithCobraCommand(&cobra.Command{}),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePaths("./test-config.json", " ", override),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	require.Equal(t, []string{"./test-config.json", override}, charmer.ConfigFilePaths())
+	charmer.AddFlags()
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, override, vpr.ConfigFileUsed())
+	require.Equal(t, []string{"./test-config.json", override}, charmer.FilesUsed())
+	require.Equal(t, 3, len(*result.UpstreamURls))
+	require.Equal(t, "127.0.0.2", *result.BindAddr)
+	require.Equal(t, uint(30), *result.Logging.LogLimits.WarnsLimit)
+	require.Equal(t, uint(10), *result.Logging.LogLimits.ErrorsLimit)
+
+	// WithConfigFilePath is merged last
+	if err = charmer.Reload(WithConfigFilePath("./test-config")); err != nil {
+		t.Fatalf("unexpected error in Reload(opts ...Option): %s", err.Error())
+	}
+	require.Equal(t, "127.0.0.255", *result.BindAddr)
+	require.Equal(t, uint(20), *result.Logging.LogLimits.WarnsLimit)
+	require.Equal(t, []string{"./test-config.json", override, "./test-config"}, charmer.FilesUsed())
+
+	if err = charmer.Reload(WithConfigFilePaths("./test-config.json", "./no-such-file.yaml")); err == nil {
+		t.Fatalf("expecting non-nil error in Reload(opts ...Option) with missing config file")
+	}
+}
+
+func Test_EmptyConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(empty, []byte(" \n\t\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(strict bool) (*testStruct, error) {
+		t.Helper()
+		result := initTestStruct()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithIgnoreUntaggedFields(true),
+			WithConfigFilePath(empty),
+			WithStrictEmptyConfig(strict),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.Equal(t, strict, charmer.StrictEmptyConfig())
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f(false)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0", *result.BindAddr)
+
+	_, err = f(true)
+	require.ErrorIs(t, err, ErrEmptyConfig)
+}
+
+func Test_ConfigFileRequired(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	if err := os.WriteFile(base, []byte("workers: 4\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(path string, opts ...CharmingOption) (*testMultiDocStruct, error) {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePaths(base),
+			WithConfigFilePath(path),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	// The explicit config file is required by default
+	_, err := f(filepath.Join(dir, "missing.yaml"))
+	require.ErrorIs(t, err, ErrConfigFileNotFound)
+	_, err = f(t.TempDir())
+	require.ErrorIs(t, err, ErrConfigFileNotFound)
+
+	// The default config file is optional
+	result, err := f(filepath.Join(dir, "missing.yaml"), WithConfigFileRequired(false))
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+	result, err = f(t.TempDir(), WithConfigFileRequired(false))
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+}
+
+func Test_UnmarshalSection(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 4\nlog:\n  level: debug\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testMultiDocStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+
+	var logging struct {
+		Level string `snakecharmer:"level"`
+	}
+	require.NoError(t, charmer.UnmarshalSection("log", &logging))
+	require.Equal(t, "debug", logging.Level)
+
+	var raw map[string]interface{}
+	require.NoError(t, charmer.UnmarshalSection("LOG", &raw))
+	require.Equal(t, map[string]interface{}{"level": "debug", "json": false}, raw)
+
+	// The missing section leaves the target as is
+	logging.Level = "info"
+	require.NoError(t, charmer.UnmarshalSection("tracing", &logging))
+	require.Equal(t, "info", logging.Level)
+
+	require.Error(t, charmer.UnmarshalSection("workers", &logging))
+	require.Error(t, charmer.UnmarshalSection("log", logging))
+	require.Error(t, charmer.UnmarshalSection("log", nil))
+}
+
+type testLevel int
+
+type testDecodeHookStruct struct {
+	Level   testLevel     `snakecharmer:"level" usage:"Log level"`
+	Timeout time.Duration `snakecharmer:"timeout" usage:"Timeout"`
+}
+
+func Test_WithDecodeHook(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("level: debug\ntimeout: 5s\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	levels := map[string]testLevel{"debug": -1, "info": 0, "warn": 1}
+	hook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to != reflect.TypeOf(testLevel(0)) {
+			return data, nil
+		}
+		level, ok := levels[data.(string)]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", data)
+		}
+		return level, nil
+	}
+	result := &testDecodeHookStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+		WithDecodeHook(mapstructure.DecodeHookFuncType(hook)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, testLevel(-1), result.Level)
+	// The built-in hooks are kept
+	require.Equal(t, 5*time.Second, result.Timeout)
+
+	_, err = NewSnakeCharmer(WithDecodeHook(nil))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// resultSnapshot boxes the copy of the result struct,
+// so atomic.Value always holds the same type.
+type resultSnapshot struct {
+	value interface{}
+}
+
+// Load returns the copy of the result struct taken after the last
+// successful unmarshal (or reload), or the value given to Store after it.
+// It returns nil before the first unmarshal.
+//
+// The result struct itself is decoded in place by Unmarshal and Reload,
+// so reading it from other goroutines while a reload runs is a data race.
+// Load is safe for concurrent use instead: it returns the pointer
+// of the result struct type to the deep copy, which is swapped
+// atomically and never modified by snakecharmer. The callers must
+// not modify it either, since it is shared by all of them.
+func (sch *SnakeCharmer) Load() interface{} {
+	if s, ok := sch.snapshot.Load().(resultSnapshot); ok {
+		return s.value
+	}
+	return nil
+}
+
+// Store atomically replaces the value returned by Load, e.g. with
+// the struct built by the custom reload logic. The value must be
+// the pointer of the result struct type, and it must not be modified
+// after the call. The result struct is left as is.
+// It returns an error if the configuration is frozen (see WithFreeze).
+func (sch *SnakeCharmer) Store(v interface{}) error {
+	if sch.frozen.Load() {
+		return fmt.Errorf("configuration is frozen, use Reload() to change it")
+	}
+	if t := reflect.TypeOf(sch.resultStruct); reflect.TypeOf(v) != t || reflect.ValueOf(v).IsNil() {
+		return fmt.Errorf("value must be a non-nil %s, got %T", t, v)
+	}
+	sch.snapshot.Store(resultSnapshot{value: v})
+	return nil
+}
+
+// storeSnapshot stores the copy of the result struct for Load.
+func (sch *SnakeCharmer) storeSnapshot() {
+	sch.snapshot.Store(resultSnapshot{value: deepCopy(reflect.ValueOf(sch.resultStruct), false).Interface()})
+}
+
+// deepCopy returns the copy of the value with the pointers, slices and maps
+// copied recursively, so it shares no memory with the original.
+// The unexported struct fields (e.g. the digits of big.Int) are copied too,
+// except the pointers in them, which are shared (if unexported is true),
+// since they may be compared by identity, like *time.Location of time.Time.
+func deepCopy(v reflect.Value, unexported bool) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || unexported {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem(), false))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			f := c.Field(i)
+			if f.CanSet() {
+				f.Set(deepCopy(f, unexported))
+				continue
+			}
+			// c is addressable, so the unexported field can be set via its address
+			f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+			f.Set(deepCopy(f, true))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), unexported))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), unexported))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value(), unexported))
+		}
+		return c
+	}
+	return v
+}
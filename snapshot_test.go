@@ -0,0 +1,180 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testSnapshotStruct struct {
+	Workers int               `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Labels  map[string]string `snakecharmer:"labels" usage:"Labels" default:"team=core"`
+	Hosts   []string          `snakecharmer:"hosts" usage:"Hosts" default:"a,b"`
+	Log     *struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_LoadStore(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 4\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	result := &testSnapshotStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Nil(t, charmer.Load())
+
+	require.NoError(t, charmer.UnmarshalExact())
+	loaded, ok := charmer.Load().(*testSnapshotStruct)
+	require.True(t, ok)
+	require.Equal(t, result, loaded)
+	require.NotSame(t, result, loaded)
+	require.NotSame(t, result.Log, loaded.Log)
+
+	// The snapshot shares no memory with the result struct
+	result.Labels["team"] = "edge"
+	result.Hosts[0] = "c"
+	result.Log.Level = "debug"
+	require.Equal(t, map[string]string{"team": "core"}, loaded.Labels)
+	require.Equal(t, []string{"a", "b"}, loaded.Hosts)
+	require.Equal(t, "info", loaded.Log.Level)
+
+	// The snapshot is swapped by the reload, the readers do not race with it
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cfg := charmer.Load().(*testSnapshotStruct)
+				_ = cfg.Workers + len(cfg.Labels) + len(cfg.Hosts) + len(cfg.Log.Level)
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, charmer.Reload())
+	}
+	wg.Wait()
+	require.Equal(t, 4, charmer.Load().(*testSnapshotStruct).Workers)
+	require.NotSame(t, loaded, charmer.Load())
+
+	// Store replaces the snapshot only
+	stored := &testSnapshotStruct{Workers: 16}
+	require.NoError(t, charmer.Store(stored))
+	require.Same(t, stored, charmer.Load())
+	require.Equal(t, 4, result.Workers)
+	require.Error(t, charmer.Store(testSnapshotStruct{}))
+	require.Error(t, charmer.Store((*testSnapshotStruct)(nil)))
+	require.Error(t, charmer.Store(&testDumpStruct{}))
+	require.Same(t, stored, charmer.Load())
+}
+
+func Test_SnapshotRejectedConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(config, []byte(data), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+	}
+	write("workers: 4\n")
+	result := &testSnapshotStruct{}
+	reject := false
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(config),
+		WithCrossFieldValidator(func(cfg interface{}) error {
+			if cfg.(*testSnapshotStruct).Workers > 100 {
+				return errors.New("too many workers")
+			}
+			return nil
+		}),
+		WithFreeze(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	charmer.Subscribe("reject", func() error {
+		if reject {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	require.NoError(t, charmer.UnmarshalExact())
+	loaded := charmer.Load()
+	require.Equal(t, 4, loaded.(*testSnapshotStruct).Workers)
+
+	// The config failing the validation is not visible to Load
+	write("workers: 200\n")
+	require.Error(t, charmer.Reload())
+	require.Same(t, loaded, charmer.Load())
+
+	// Neither is the one rejected by a subscriber
+	write("workers: 16\n")
+	reject = true
+	require.Error(t, charmer.Reload())
+	require.Same(t, loaded, charmer.Load())
+
+	reject = false
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, 16, charmer.Load().(*testSnapshotStruct).Workers)
+
+	// The frozen snapshot can not be replaced by Store
+	require.EqualError(t, charmer.Store(&testSnapshotStruct{}), "configuration is frozen, use Reload() to change it")
+	require.Equal(t, 16, charmer.Load().(*testSnapshotStruct).Workers)
+}
+
+func Test_DeepCopyUnexported(t *testing.T) {
+	type value struct {
+		Int  *big.Int
+		Rat  big.Rat
+		Time time.Time
+	}
+	v := &value{Int: big.NewInt(42), Rat: *big.NewRat(1, 3), Time: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := deepCopy(reflect.ValueOf(v), false).Interface().(*value)
+	require.Equal(t, v, c)
+
+	// The digits of big.Int are not shared
+	v.Int.SetInt64(7)
+	v.Rat.Num().SetInt64(2)
+	require.Equal(t, int64(42), c.Int.Int64())
+	require.Equal(t, "1/3", c.Rat.String())
+
+	// The pointers in unexported fields are shared
+	require.Same(t, time.UTC, c.Time.Location())
+	require.True(t, c.Time.Equal(v.Time))
+}
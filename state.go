@@ -0,0 +1,133 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadState reads the values saved by the previous run into the state file
+// (see WithStateFile) and sets them as defaults of the fields with
+// the persist modifier. A missing state file is ignored.
+func (sch *SnakeCharmer) loadState() error {
+	data, err := os.ReadFile(sch.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("while reading state file %q: %w", sch.stateFile, err)
+	}
+	state := map[string]interface{}{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("while parsing state file %q: %w", sch.stateFile, err)
+	}
+	for _, b := range sch.bindings {
+		if !b.persist {
+			continue
+		}
+		if value, ok := state[b.key]; ok {
+			sch.backend.SetDefault(b.key, value)
+			if sch.stateKeys == nil {
+				sch.stateKeys = make(map[string]bool)
+			}
+			sch.stateKeys[strings.ToLower(b.key)] = true
+		}
+	}
+	return nil
+}
+
+// checkUnmarshal works like UnmarshalExact, but it is the dry run,
+// i.e. the values of the fields with the persist modifier are not saved.
+// It is used by the check config flag and the "config validate" command.
+func (sch *SnakeCharmer) checkUnmarshal() error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	return sch.unmarshalExact(true)
+}
+
+// stateValues returns the values of the fields with the persist modifier
+// to be saved into the state file. It is called before the references
+// are resolved, and the values holding references, e.g. "ssm:///app/project",
+// are skipped, so neither the resolved values nor the references,
+// which could run commands, are saved.
+func (sch *SnakeCharmer) stateValues(settings map[string]interface{}) map[string]interface{} {
+	state := map[string]interface{}{}
+	for _, b := range sch.bindings {
+		if !b.persist {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		if value, ok := parent[name]; ok && !sch.hasRef(value) {
+			state[b.key] = value
+		}
+	}
+	return state
+}
+
+// hasRef returns true if the value or any of its items is a reference
+// resolved by the value resolvers.
+func (sch *SnakeCharmer) hasRef(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		r, _ := sch.resolverOf(v)
+		return r != nil
+	case []string:
+		for _, item := range v {
+			if sch.hasRef(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if sch.hasRef(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if sch.hasRef(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// saveState writes the values of the fields with the persist modifier,
+// see stateValues, into the state file, so they are used as defaults by the next run.
+func (sch *SnakeCharmer) saveState(state map[string]interface{}) error {
+	if len(state) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(sch.stateFile), 0o700); err != nil {
+		return fmt.Errorf("while creating state file dir: %w", err)
+	}
+	if err = os.WriteFile(sch.stateFile, data, 0o600); err != nil {
+		return fmt.Errorf("while writing state file %q: %w", sch.stateFile, err)
+	}
+	return nil
+}
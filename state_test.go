@@ -0,0 +1,179 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testStateStruct struct {
+	Project string `snakecharmer:"project,persist" usage:"Project name" default:"default"`
+	Region  string `snakecharmer:"region,persist" env:"TEST_STATE_REGION" usage:"Region" default:"us-east-1"`
+	Verbose bool   `snakecharmer:"verbose" usage:"Verbose output"`
+}
+
+func Test_WithStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "state.json")
+	f := func(args ...string) *testStateStruct {
+		t.Helper()
+		result := &testStateStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithStateFile(stateFile),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	result := f()
+	require.Equal(t, "default", result.Project)
+
+	result = f("--project", "acme", "--verbose")
+	require.Equal(t, "acme", result.Project)
+	data, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"project": "acme", "region": "us-east-1"}`, string(data))
+
+	// The saved value is the default now, the flag is not persisted
+	result = f()
+	require.Equal(t, "acme", result.Project)
+	require.False(t, result.Verbose)
+
+	// ENV vars take precedence over the saved value
+	t.Setenv("TEST_STATE_REGION", "eu-west-1")
+	result = f()
+	require.Equal(t, "eu-west-1", result.Region)
+}
+
+func Test_StateFileDryRun(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	f := func(args ...string) {
+		t.Helper()
+		cmd := &cobra.Command{Use: "app", RunE: func(cmd *cobra.Command, args []string) error { return nil }}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testStateStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithStateFile(stateFile),
+			WithCheckConfigFlag("check-config"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.exit = func(int) {}
+		charmer.AddFlags()
+		charmer.AttachConfigSubcommands(cmd)
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(args)
+		require.NoError(t, cmd.Execute())
+	}
+
+	// The config checks have no side effects
+	f("config", "validate", "--project", "acme")
+	f("--check-config", "--project", "acme")
+	_, err := os.Stat(stateFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_StateFileSecret(t *testing.T) {
+	f := func(result interface{}) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithStateFile(filepath.Join(t.TempDir(), "state.json")),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.PanicsWithValue(t, `BUG: persist is set for secret field "Token", the state file is not encrypted`, charmer.AddFlags)
+	}
+	f(&struct {
+		Token string `snakecharmer:"token,persist,secret" usage:"Token"`
+	}{})
+	f(&struct {
+		Token string `snakecharmer:"token,persist" secret:"true" usage:"Token"`
+	}{})
+}
+
+func Test_StateFileRef(t *testing.T) {
+	t.Run("tag", func(t *testing.T) {
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&struct {
+				Project string `snakecharmer:"project,persist" ref:"test://project" usage:"Project name"`
+			}{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithStateFile(filepath.Join(t.TempDir(), "state.json")),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.PanicsWithValue(t, `BUG: persist is set for field "Project" with the reference, the resolved value is not saved`, charmer.AddFlags)
+	})
+
+	t.Run("value", func(t *testing.T) {
+		dir := t.TempDir()
+		stateFile := filepath.Join(dir, "state.json")
+		config := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(config, []byte("project: test://project\nregion: eu-west-1\n"), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testStateStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+			WithStateFile(stateFile),
+			WithValueResolver("test://", ValueResolverFunc(func(_ context.Context, ref string) (string, error) {
+				return "resolved-" + ref, nil
+			})),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		require.Equal(t, "resolved-project", result.Project)
+		data, err := os.ReadFile(stateFile)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"region": "eu-west-1"}`, string(data))
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// standardConfigDirs returns the standard config directories
+// of the application in the lookup order:
+// $XDG_CONFIG_HOME/app, ~/.config/app, /etc/app and the working directory,
+// or %APPDATA%\app and the working directory on Windows.
+func standardConfigDirs(app string) []string {
+	dirs := []string{}
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); len(appData) > 0 {
+			dirs = append(dirs, filepath.Join(appData, app))
+		}
+	} else {
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); len(xdg) > 0 {
+			dirs = append(dirs, filepath.Join(xdg, app))
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			dir := filepath.Join(home, ".config", app)
+			if len(dirs) == 0 || dirs[0] != dir {
+				dirs = append(dirs, dir)
+			}
+		}
+		dirs = append(dirs, filepath.Join("/etc", app))
+	}
+	return append(dirs, ".")
+}
+
+// standardConfigFile returns the first config file found in the standard
+// config directories (see WithStandardConfigPaths), or "" if there is none.
+func (sch *SnakeCharmer) standardConfigFile() string {
+	for _, dir := range standardConfigDirs(sch.standardConfigApp) {
+		if file, err := sch.findConfigFileAt(dir); err == nil {
+			return file
+		}
+	}
+	return ""
+}
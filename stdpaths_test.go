@@ -0,0 +1,75 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_StandardConfigPaths(t *testing.T) {
+	xdg, home := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("HOME", home)
+	writeConfig := func(dir, content string) string {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatalf("unexpected error in os.MkdirAll(): %s", err.Error())
+		}
+		file := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		return file
+	}
+	f := func(expected int, opts ...CharmingOption) {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithStandardConfigPaths("snakecharmer-test-app"),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.NoError(t, charmer.UnmarshalExact())
+		require.Equal(t, expected, result.Workers)
+	}
+
+	// No config file found
+	f(128)
+
+	writeConfig(filepath.Join(home, ".config", "snakecharmer-test-app"), "workers: 2\n")
+	f(2)
+
+	xdgConfig := writeConfig(filepath.Join(xdg, "snakecharmer-test-app"), "workers: 4\n")
+	f(4)
+
+	// The config file path takes precedence
+	f(8, WithConfigFilePath(writeConfig(t.TempDir(), "workers: 8\n")))
+
+	require.NoError(t, os.Remove(xdgConfig))
+	f(2)
+
+	_, err := NewSnakeCharmer(WithStandardConfigPaths(" "))
+	require.Error(t, err)
+}
@@ -0,0 +1,72 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Strictness defines how the config keys that do not exist
+// in the result struct are handled, see WithStrictness.
+type Strictness int
+
+const (
+	// StrictnessStrict fails the unmarshal with UnknownKeysError.
+	StrictnessStrict Strictness = iota
+	// StrictnessWarn skips the unknown keys and warns about them,
+	// see WithWarnFunc.
+	StrictnessWarn
+	// StrictnessIgnore silently skips the unknown keys.
+	StrictnessIgnore
+)
+
+// String returns the strictness name.
+func (s Strictness) String() string {
+	switch s {
+	case StrictnessStrict:
+		return "strict"
+	case StrictnessWarn:
+		return "warn"
+	case StrictnessIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("Strictness(%d)", int(s))
+	}
+}
+
+// warn reports the non-fatal problem of the config, e.g. the unknown keys,
+// with the warn function (see WithWarnFunc) or the standard logger.
+func (sch *SnakeCharmer) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if sch.warnFunc != nil {
+		sch.warnFunc(msg)
+		return
+	}
+	log.Printf("WARNING: %s", msg)
+}
+
+// warnUnknownKeys warns about the unknown config keys skipped.
+func (sch *SnakeCharmer) warnUnknownKeys(keys []UnknownKey) {
+	if len(keys) == 0 {
+		return
+	}
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, k.String())
+	}
+	sch.warn("unknown config keys are ignored: %s", strings.Join(items, ", "))
+}
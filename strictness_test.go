@@ -0,0 +1,78 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Strictness(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("workers: 4\nworkerz: 8\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(exact bool, strictness Strictness) ([]string, error) {
+		t.Helper()
+		warnings := []string{}
+		result := &testMultiDocStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(config),
+			WithStrictness(strictness),
+			WithWarnFunc(func(msg string) { warnings = append(warnings, msg) }),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if exact {
+			err = charmer.UnmarshalExact()
+		} else {
+			err = charmer.Unmarshal()
+		}
+		if err == nil {
+			require.Equal(t, 4, result.Workers)
+		}
+		return warnings, err
+	}
+	warning := `unknown config keys are ignored: "workerz" (did you mean "workers"?)`
+
+	_, err := f(true, StrictnessStrict)
+	require.Error(t, err)
+	warnings, err := f(true, StrictnessWarn)
+	require.NoError(t, err)
+	require.Equal(t, []string{warning}, warnings)
+	warnings, err = f(true, StrictnessIgnore)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+
+	// Unmarshal tolerates the unknown keys
+	warnings, err = f(false, StrictnessStrict)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	warnings, err = f(false, StrictnessWarn)
+	require.NoError(t, err)
+	require.Equal(t, []string{warning}, warnings)
+
+	_, err = NewSnakeCharmer(WithStrictness(Strictness(5)))
+	require.Error(t, err)
+}
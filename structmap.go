@@ -0,0 +1,47 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// isStructMap returns true if the type is a map of structs or pointers
+// to them keyed by strings, e.g. map[string]DestinationConfig.
+// The structs decoded from their text representation are not counted.
+func isStructMap(t reflect.Type) bool {
+	if t.Kind() != reflect.Map || t.Key().Kind() != reflect.String {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && !isTextStruct(elem) && !isNetType(elem) && !isFlagValue(elem)
+}
+
+// addStructMap registers the map of structs field, e.g. the destinations
+// keyed by their names. The keys are arbitrary, so there are no flags,
+// and the field is set in config files, by the ENV var holding the whole map
+// as JSON or YAML, e.g. `env:"DESTINATIONS,format=json"`, or by --set
+// entries, e.g. --set destinations.s3.path=/backup (see WithSetFlag).
+// The flag options panic rather than being dropped silently.
+func (sch *SnakeCharmer) addStructMap(sf reflect.StructField, rv reflect.Value, ft fieldTags) {
+	if ft.indexed {
+		panic(fmt.Sprintf("BUG: indexed flags are set for map of structs field: %q", sf.Name))
+	}
+	sch.addStructCollection(sf, rv, ft, "map of structs", map[string]interface{}{})
+}
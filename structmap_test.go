@@ -0,0 +1,186 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testDestinationConfig struct {
+	Path     string `snakecharmer:"path"`
+	Compress bool   `snakecharmer:"compress"`
+}
+
+type testStructMapStruct struct {
+	Workers      int                               `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Destinations *map[string]testDestinationConfig `snakecharmer:"destinations" env:"TEST_DESTINATIONS,format=json" usage:"Destinations"`
+	Sinks        map[string]*testDestinationConfig `snakecharmer:"sinks"`
+}
+
+func Test_StructMap(t *testing.T) {
+	var charmer *SnakeCharmer
+	f := func(config string, args ...string) (*testStructMapStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testStructMapStruct{}
+		cmd := &cobra.Command{}
+		var err error
+		charmer, err = NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+			WithSetFlag("set"),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// There are no flags, the map is empty by default
+	result, cmd, err := f("workers: 4\n")
+	require.NoError(t, err)
+	require.Empty(t, result.Destinations)
+	require.Empty(t, result.Sinks)
+	require.Nil(t, cmd.Flag("destinations"))
+	require.Nil(t, cmd.Flag("sinks"))
+
+	// The config file defines arbitrary keys
+	result, _, err = f(`destinations:
+  s3:
+    path: s3://bucket/backup
+    compress: true
+  local:
+    path: /var/backup
+sinks:
+  stdout:
+    path: "-"
+`, "--set", "destinations.local.compress=true")
+	require.NoError(t, err)
+	require.Equal(t, map[string]testDestinationConfig{
+		"s3":    {Path: "s3://bucket/backup", Compress: true},
+		"local": {Path: "/var/backup", Compress: true},
+	}, *result.Destinations)
+	require.Equal(t, map[string]*testDestinationConfig{"stdout": {Path: "-"}}, result.Sinks)
+
+	// The unknown keys of the values are reported
+	_, _, err = f("destinations:\n  s3:\n    pth: s3://bucket\n")
+	require.ErrorContains(t, err, "pth")
+
+	// The ENV var holds the whole map
+	t.Setenv("TEST_DESTINATIONS", `{"gcs": {"path": "gs://bucket"}}`)
+	result, _, err = f("")
+	require.NoError(t, err)
+	require.Equal(t, map[string]testDestinationConfig{"gcs": {Path: "gs://bucket"}}, *result.Destinations)
+}
+
+func Test_StructMapFlagOptions(t *testing.T) {
+	f := func(result interface{}) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.Panics(t, charmer.AddFlags)
+	}
+	f(&struct {
+		Destinations map[string]testDestinationConfig `snakecharmer:"destinations,indexed" usage:"Destinations"`
+	}{})
+	f(&struct {
+		Destinations map[string]testDestinationConfig `snakecharmer:"destinations" oneof:"a,b" usage:"Destinations"`
+	}{})
+	f(&struct {
+		Destinations map[string]struct {
+			Path string `snakecharmer:"path" env:"PATH"`
+		} `snakecharmer:"destinations" usage:"Destinations"`
+	}{})
+}
+
+func Test_StructMapRoundTrip(t *testing.T) {
+	type testSinkConfig struct {
+		MaxSize  int    `snakecharmer:"max-size"`
+		FilePath string `snakecharmer:"file-path"`
+	}
+	type testRoundTripStruct struct {
+		Dsts map[string]testSinkConfig `snakecharmer:"dsts" usage:"Destinations"`
+	}
+	f := func(path string) (*testRoundTripStruct, *cobra.Command, *SnakeCharmer) {
+		t.Helper()
+		result := &testRoundTripStruct{
+			Dsts: map[string]testSinkConfig{"local": {MaxSize: 10, FilePath: "/var/backup"}},
+		}
+		cmd := &cobra.Command{}
+		opts := []CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}
+		if len(path) > 0 {
+			opts = append(opts, WithConfigFilePath(path))
+		}
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, cmd, charmer
+	}
+
+	expected, cmd, charmer := f("")
+	require.NoError(t, charmer.UnmarshalExact())
+	var buf bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&buf, "yaml"))
+	require.Contains(t, buf.String(), "max-size: 10")
+	require.NotContains(t, buf.String(), "maxsize")
+
+	// The sample shows the entries by their keys
+	charmer.AttachConfigSubcommands(cmd)
+	buf.Reset()
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"config", "sample"})
+	require.NoError(t, cmd.Execute())
+	require.Contains(t, buf.String(), "file-path: /var/backup")
+
+	// The written config is read back into the same values
+	dir := t.TempDir()
+	effectivePath := filepath.Join(dir, "effective.yaml")
+	require.NoError(t, charmer.WriteEffectiveConfig(effectivePath))
+	defaultPath := filepath.Join(dir, "default.yaml")
+	require.NoError(t, charmer.WriteDefaultConfig(defaultPath))
+	for _, path := range []string{effectivePath, defaultPath} {
+		result, _, charmer := f(path)
+		result.Dsts = nil
+		require.NoError(t, charmer.UnmarshalExact())
+		require.Equal(t, expected, result)
+	}
+}
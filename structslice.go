@@ -0,0 +1,306 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// indexedFlag is the flag of the field of the slice of structs entry,
+// e.g. --upstreams.0.url
+type indexedFlag struct {
+	// The config key of the slice of structs field, e.g. "upstreams"
+	key string
+	// The index of the entry
+	index int
+	// The key of the field within the entry, e.g. "url"
+	field string
+	flag  *pflag.Flag
+}
+
+// isStructSlice returns true if the type is a slice of structs
+// or pointers to them, e.g. []UpstreamConfig. The structs decoded
+// from their text representation are not counted.
+func isStructSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && !isTextStruct(elem) && !isNetType(elem) && !isFlagValue(elem)
+}
+
+// addStructSlice registers the slice of structs field, which is set
+// in config files only, or by the ENV var holding the whole slice
+// as JSON or YAML, e.g. `env:"UPSTREAMS,format=json"`. It has no flag,
+// so the flag options panic rather than being dropped silently.
+// With the indexed tag option or the maxlen tag, the fields of the
+// entries get the indexed flags, e.g. --upstreams.0.url.
+func (sch *SnakeCharmer) addStructSlice(sf reflect.StructField, rv reflect.Value, ft fieldTags) {
+	elem := sch.addStructCollection(sf, rv, ft, "slice of structs", []interface{}{})
+	if ft.indexed && !ft.noFlag {
+		sch.addIndexedFlags(ft, rv, elem)
+	}
+}
+
+// addStructCollection registers the slice or map of structs field
+// having no flag of its own. The initialized value, converted to
+// the settings (see structSettings), is the default, or the empty
+// defaultValue if it is nil. It returns the struct type of the elements.
+func (sch *SnakeCharmer) addStructCollection(sf reflect.StructField, rv reflect.Value, ft fieldTags, kind string, defaultValue interface{}) reflect.Type {
+	if ft.count || len(ft.shorthand) > 0 || len(ft.oneOf) > 0 || ft.percent ||
+		len(ft.min) > 0 || len(ft.max) > 0 {
+		panic(fmt.Sprintf("BUG: flag options are set for %s field: %q", kind, sf.Name))
+	}
+	if ft.hasDefault {
+		panic(fmt.Sprintf("BUG: default tag is set for %s field: %q, initialize the field instead", kind, sf.Name))
+	}
+	elem := rv.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if sch.tagDialect == TagDialectSnakeCharmer {
+		if name := structFieldWithTag(elem, "env"); len(name) > 0 {
+			panic(fmt.Sprintf("BUG: env tag is set for field %q of %s field: %q, set it for the %s instead", name, kind, sf.Name, rv.Kind().String()))
+		}
+		if len(ft.env) > 0 {
+			if env := sch.envNames(ft.env, ft.key); len(env) > 0 {
+				sch.structEnvs = append(sch.structEnvs, structEnv{key: ft.key, env: env[0], format: ft.envFormat})
+			}
+		}
+	}
+	// The nil value is left unconverted, the default is empty
+	if !rv.IsNil() {
+		defaultValue = sch.structSettings(rv.Interface())
+	}
+	sch.backend.SetDefault(ft.key, defaultValue)
+	sch.bindings = append(sch.bindings, fieldBinding{
+		key:          ft.key,
+		help:         ft.help,
+		typ:          rv.Type(),
+		defaultValue: rv.Interface(),
+		required:     ft.required,
+		secret:       ft.secret,
+		persist:      ft.persist,
+		noConfig:     ft.noConfig,
+		aliases:      ft.aliases,
+	})
+	return elem
+}
+
+// structSettings returns the value as it is set in config files,
+// the structs are converted to maps keyed by the config keys of their
+// fields, e.g. "max-conns", including the structs in slices and maps,
+// so the defaults of the slice and map of structs fields are written
+// by WriteDefaultConfig and read back. The rest of the values are
+// converted by configValue, the nil pointers are nil.
+func (sch *SnakeCharmer) structSettings(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		if isTextStruct(t) || isNetType(t) || isFlagValue(t) {
+			return configValue(rv.Interface())
+		}
+		settings := map[string]interface{}{}
+		sch.addStructSettings(settings, rv)
+		return settings
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Interface()
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = sch.structSettings(rv.Index(i).Interface())
+		}
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = sch.structSettings(iter.Value().Interface())
+		}
+		return result
+	case reflect.Invalid:
+		return nil
+	}
+	return configValue(rv.Interface())
+}
+
+// addStructSettings adds the values of the fields of the struct
+// to the settings by their config keys.
+// The fields of the squashed structs are added at the parent level,
+// the unexported fields, the fields skipped by their tags and
+// the ones that cannot be set in config, e.g. `config:"-"`, are not added.
+func (sch *SnakeCharmer) addStructSettings(settings map[string]interface{}, v reflect.Value) {
+	for _, fp := range sch.structPlan(v.Type()) {
+		sf := v.Type().Field(fp.index)
+		if fp.skip || fp.tags.noConfig || !sf.IsExported() {
+			continue
+		}
+		fieldValue := v.Field(fp.index)
+		if fp.squash {
+			if fieldValue = reflect.Indirect(fieldValue); fieldValue.IsValid() {
+				sch.addStructSettings(settings, fieldValue)
+			}
+			continue
+		}
+		key := fp.tags.key
+		if len(fp.invalid) > 0 {
+			// The untagged field is decoded by its name
+			key = sf.Name
+		}
+		settings[key] = sch.structSettings(fieldValue.Interface())
+	}
+}
+
+// structFieldWithTag returns the name of the field of the struct type,
+// including the nested ones, which has the tag, or "" if there is none.
+func structFieldWithTag(t reflect.Type, tag string) string {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if _, ok := sf.Tag.Lookup(tag); ok {
+			return sf.Name
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			if name := structFieldWithTag(ft, tag); len(name) > 0 {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// addIndexedFlags adds the flags of the fields of the slice entries,
+// e.g. --upstreams.0.url, --upstreams.1.weight. There are flags for
+// the entries of the initialized slice, or up to the maxlen tag if it
+// is greater. The flags are not bound to viper, they are applied
+// to the merged slice by applyIndexedFlags.
+func (sch *SnakeCharmer) addIndexedFlags(ft fieldTags, rv reflect.Value, elem reflect.Type) {
+	n := rv.Len()
+	if ft.maxLen > n {
+		n = ft.maxLen
+	}
+	_, fs := sch.fieldFlags(ft.key)
+	for i := 0; i < n; i++ {
+		entry := reflect.New(elem).Elem()
+		hasDefault := i < rv.Len()
+		if hasDefault {
+			if v := reflect.Indirect(rv.Index(i)); v.IsValid() {
+				entry = v
+			}
+		}
+		sch.addIndexedEntryFlags(fs, ft, i, entry, hasDefault, "")
+	}
+}
+
+// addIndexedEntryFlags adds the string flags of the fields of the slice entry,
+// including the fields of the nested structs. The nested slices of structs
+// get no flags.
+func (sch *SnakeCharmer) addIndexedEntryFlags(fs *pflag.FlagSet, ft fieldTags, index int, entry reflect.Value, hasDefault bool, prefix string) {
+	for _, fp := range sch.structPlan(entry.Type()) {
+		if fp.skip {
+			continue
+		}
+		sf := entry.Type().Field(fp.index)
+		key := fp.keyAt(prefix)
+		fieldValue := reflect.Indirect(entry.Field(fp.index))
+		if !fieldValue.IsValid() {
+			fieldValue = reflect.New(sf.Type.Elem()).Elem()
+		}
+		t := fieldValue.Type()
+		if t.Kind() == reflect.Struct && !isTextStruct(t) && !isNetType(t) && !isFlagValue(t) {
+			sch.addIndexedEntryFlags(fs, ft, index, fieldValue, hasDefault, key)
+			continue
+		}
+		if isStructSlice(t) {
+			continue
+		}
+		name := fmt.Sprintf("%s.%d.%s", ft.key, index, key)
+		if sch.lookupFlag(name) != nil {
+			panic(fmt.Sprintf("BUG: flag %q of field %q is already defined", name, sf.Name))
+		}
+		defaultValue := ""
+		if hasDefault && !ft.secret {
+			defaultValue = indexedFlagDefault(fieldValue)
+		}
+		help := fmt.Sprintf("The %s of entry %d of --%s", key, index, ft.key)
+		if len(ft.help) > 0 {
+			help = fmt.Sprintf("The %s of entry %d of %s", key, index, ft.help)
+		}
+		fs.String(name, defaultValue, help)
+		sch.indexedFlags = append(sch.indexedFlags, indexedFlag{
+			key:   strings.ToLower(ft.key),
+			index: index,
+			field: strings.ToLower(key),
+			flag:  fs.Lookup(name),
+		})
+	}
+}
+
+// indexedFlagDefault returns the default value of the indexed flag
+// of the scalar field, or "" for the rest.
+func indexedFlagDefault(v reflect.Value) string {
+	value := reflect.ValueOf(configValue(v.Interface()))
+	switch value.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(value.Interface())
+	}
+	return ""
+}
+
+// applyIndexedFlags sets the fields of the slice entries given by the
+// indexed flags, e.g. --upstreams.1.weight=3, in the merged slice of
+// the settings. The missing entries up to the index are added empty.
+func (sch *SnakeCharmer) applyIndexedFlags(settings map[string]interface{}) {
+	for _, f := range sch.indexedFlags {
+		if !f.flag.Changed {
+			continue
+		}
+		var entries []interface{}
+		if parent, name := settingsParent(settings, f.key); parent != nil {
+			entries, _ = normalizeValue(parent[name]).([]interface{})
+		}
+		for len(entries) <= f.index {
+			entries = append(entries, map[string]interface{}{})
+		}
+		entry, ok := entries[f.index].(map[string]interface{})
+		if !ok {
+			entry = map[string]interface{}{}
+			entries[f.index] = entry
+		}
+		setSetting(entry, f.field, f.flag.Value.String())
+		setSetting(settings, f.key, entries)
+	}
+}
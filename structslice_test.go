@@ -0,0 +1,265 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testUpstreamConfig struct {
+	URL     string        `snakecharmer:"url"`
+	Weight  int           `snakecharmer:"weight"`
+	Timeout time.Duration `snakecharmer:"timeout"`
+}
+
+type testStructSliceStruct struct {
+	Workers   int                   `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+	Upstreams *[]testUpstreamConfig `snakecharmer:"upstreams" env:"TEST_UPSTREAMS,format=json" usage:"Upstreams"`
+	Backups   []*testUpstreamConfig `snakecharmer:"backups"`
+}
+
+func Test_StructSlice(t *testing.T) {
+	var charmer *SnakeCharmer
+	f := func(config string) (*testStructSliceStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testStructSliceStruct{
+			Upstreams: &[]testUpstreamConfig{{URL: "http://localhost:8080", Weight: 1, Timeout: time.Second}},
+		}
+		cmd := &cobra.Command{}
+		var err error
+		charmer, err = NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// The initialized value is the default
+	result, cmd, err := f("workers: 4\n")
+	require.NoError(t, err)
+	require.Equal(t, []testUpstreamConfig{{URL: "http://localhost:8080", Weight: 1, Timeout: time.Second}}, *result.Upstreams)
+	require.Empty(t, result.Backups)
+	require.Nil(t, cmd.Flag("upstreams"))
+	require.Nil(t, cmd.Flag("backups"))
+	path := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, charmer.WriteDefaultConfig(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `backups: []
+upstreams:
+    - timeout: 1s
+      url: http://localhost:8080
+      weight: 1
+workers: 8
+`, string(data))
+
+	result, _, err = f(`upstreams:
+  - url: http://a:8080
+    weight: 2
+    timeout: 5s
+  - url: http://b:8080
+backups:
+  - url: http://c:8080
+`)
+	require.NoError(t, err)
+	require.Equal(t, []testUpstreamConfig{
+		{URL: "http://a:8080", Weight: 2, Timeout: 5 * time.Second},
+		{URL: "http://b:8080"},
+	}, *result.Upstreams)
+	require.Equal(t, []*testUpstreamConfig{{URL: "http://c:8080"}}, result.Backups)
+
+	// The unknown keys of the elements are reported
+	_, _, err = f("upstreams:\n  - url: http://a:8080\n    wieght: 2\n")
+	require.ErrorContains(t, err, "wieght")
+
+	// The ENV var holds the whole slice
+	t.Setenv("TEST_UPSTREAMS", `[{"url": "http://env:8080", "weight": 3}]`)
+	result, _, err = f("upstreams:\n  - url: http://a:8080\n")
+	require.NoError(t, err)
+	require.Equal(t, []testUpstreamConfig{{URL: "http://env:8080", Weight: 3}}, *result.Upstreams)
+}
+
+func Test_StructSliceRoundTrip(t *testing.T) {
+	type testPoolConfig struct {
+		MaxConns int           `snakecharmer:"max-conns"`
+		Idle     time.Duration `snakecharmer:"idle-timeout"`
+	}
+	type testRoundTripStruct struct {
+		Upstreams []testPoolConfig `snakecharmer:"upstreams" usage:"Upstreams"`
+		Backups   []*struct {
+			URL  string         `snakecharmer:"url"`
+			Pool testPoolConfig `snakecharmer:"pool"`
+		} `snakecharmer:"backups"`
+	}
+	f := func(path string) (*testRoundTripStruct, *SnakeCharmer) {
+		t.Helper()
+		result := &testRoundTripStruct{
+			Upstreams: []testPoolConfig{{MaxConns: 10, Idle: time.Minute}, {MaxConns: 20}},
+		}
+		opts := []CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		}
+		if len(path) > 0 {
+			opts = append(opts, WithConfigFilePath(path))
+		}
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer
+	}
+
+	expected, charmer := f("")
+	require.NoError(t, charmer.UnmarshalExact())
+	var buf bytes.Buffer
+	require.NoError(t, charmer.DumpEffectiveConfig(&buf, "yaml"))
+	require.Contains(t, buf.String(), "max-conns: 10")
+	require.Contains(t, buf.String(), "idle-timeout: 1m0s")
+	require.NotContains(t, buf.String(), "maxconns")
+
+	// The written config is read back into the same values
+	dir := t.TempDir()
+	effectivePath := filepath.Join(dir, "effective.yaml")
+	require.NoError(t, charmer.WriteEffectiveConfig(effectivePath))
+	defaultPath := filepath.Join(dir, "default.yaml")
+	require.NoError(t, charmer.WriteDefaultConfig(defaultPath))
+	for _, path := range []string{effectivePath, defaultPath} {
+		result, charmer := f(path)
+		result.Upstreams = nil
+		require.NoError(t, charmer.UnmarshalExact())
+		require.Equal(t, expected, result)
+	}
+
+	// The nested structs of the elements are written by their keys
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`backups:
+  - url: http://a:8080
+    pool:
+      max-conns: 5
+`), 0o600))
+	expected, charmer = f(path)
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 5, expected.Backups[0].Pool.MaxConns)
+	require.NoError(t, charmer.WriteEffectiveConfig(effectivePath))
+	result, charmer := f(effectivePath)
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, expected, result)
+}
+
+func Test_StructSliceFlagOptions(t *testing.T) {
+	f := func(result interface{}) {
+		t.Helper()
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		require.Panics(t, charmer.AddFlags)
+	}
+	f(&struct {
+		Upstreams []testUpstreamConfig `snakecharmer:"upstreams,count" short:"u" usage:"Upstreams"`
+	}{})
+	f(&struct {
+		Upstreams []testUpstreamConfig `snakecharmer:"upstreams" default:"a" usage:"Upstreams"`
+	}{})
+	f(&struct {
+		Upstreams []struct {
+			URL string `snakecharmer:"url" env:"URL"`
+		} `snakecharmer:"upstreams" usage:"Upstreams"`
+	}{})
+}
+
+func Test_StructSliceIndexedFlags(t *testing.T) {
+	type testIndexedStruct struct {
+		Upstreams []testUpstreamConfig `snakecharmer:"upstreams,indexed" usage:"Upstreams"`
+		Backups   []testUpstreamConfig `snakecharmer:"backups" maxlen:"2"`
+	}
+	f := func(config string, args ...string) (*testIndexedStruct, *cobra.Command, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testIndexedStruct{
+			Upstreams: []testUpstreamConfig{{URL: "http://localhost:8080", Weight: 1, Timeout: time.Second}},
+		}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, cmd, charmer.UnmarshalExact()
+	}
+
+	// The flags are bounded by the initialized slice or the maxlen tag
+	result, cmd, err := f("")
+	require.NoError(t, err)
+	require.Equal(t, []testUpstreamConfig{{URL: "http://localhost:8080", Weight: 1, Timeout: time.Second}}, result.Upstreams)
+	require.Empty(t, result.Backups)
+	require.Equal(t, "http://localhost:8080", cmd.Flag("upstreams.0.url").DefValue)
+	require.Equal(t, "1s", cmd.Flag("upstreams.0.timeout").DefValue)
+	require.Nil(t, cmd.Flag("upstreams.1.url"))
+	require.Equal(t, "", cmd.Flag("backups.1.weight").DefValue)
+	require.Nil(t, cmd.Flag("backups.2.weight"))
+
+	// The flags override the fields of the entries of the merged slice
+	result, _, err = f(`upstreams:
+  - url: http://a:8080
+    weight: 2
+  - url: http://b:8080
+`, "--upstreams.0.weight", "5", "--upstreams.0.timeout", "3s", "--backups.1.url", "http://c:8080")
+	require.NoError(t, err)
+	require.Equal(t, []testUpstreamConfig{
+		{URL: "http://a:8080", Weight: 5, Timeout: 3 * time.Second},
+		{URL: "http://b:8080"},
+	}, result.Upstreams)
+	require.Equal(t, []testUpstreamConfig{{}, {URL: "http://c:8080"}}, result.Backups)
+
+	// The value is decoded to the type of the field
+	_, _, err = f("", "--upstreams.0.weight", "heavy")
+	require.ErrorContains(t, err, "weight")
+}
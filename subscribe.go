@@ -0,0 +1,93 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// subscriber is the named callback called after every unmarshal.
+type subscriber struct {
+	name string
+	fn   func() error
+}
+
+// SubscriberError is returned by UnmarshalExact and Reload
+// when a subscriber (see Subscribe) rejects the config.
+type SubscriberError struct {
+	// Name is the name of the subscriber that rejected the config.
+	Name string
+	// Err is the error returned by the subscriber.
+	Err error
+	// RolledBack is true if the previous config was restored.
+	RolledBack bool
+}
+
+// Error implements error interface.
+func (e *SubscriberError) Error() string {
+	if e.RolledBack {
+		return fmt.Sprintf("config rejected by subscriber %q, rolled back: %s", e.Name, e.Err.Error())
+	}
+	return fmt.Sprintf("config rejected by subscriber %q: %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the error returned by the subscriber.
+func (e *SubscriberError) Unwrap() error { return e.Err }
+
+// Subscribe registers the named callback that is called after every
+// successful unmarshal of the config into the result struct
+// (UnmarshalExact, Reload, provider refresh, SIGHUP), in the registration order.
+// If a callback returns an error, the rest are not called and the reload
+// is rolled back: the previous config is decoded into the result struct again,
+// and the *SubscriberError naming the callback is returned.
+// Note, the callbacks are called by the unmarshal pipeline holding
+// the charmer lock. They may call the read-only accessors reading the state
+// published by the pipeline without the lock: WasSet, ChangedKeys, FilesUsed,
+// Expirations, PrecedenceOrder, RedactedSettings, DumpEffectiveConfig,
+// Load, Store and Frozen. The other methods taking the lock, e.g. UnmarshalExact,
+// Reload, Set, Subscribe, WriteDefaultConfig, LintConfig or Close, wait for
+// the pipeline, so calling them from a callback deadlocks; run them
+// in another goroutine instead.
+func (sch *SnakeCharmer) Subscribe(name string, fn func() error) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	sch.subscribers = append(sch.subscribers, subscriber{name: name, fn: fn})
+}
+
+// notifySubscribers calls the subscribers in the registration order
+// and returns the *SubscriberError of the first one rejecting the config.
+func (sch *SnakeCharmer) notifySubscribers() *SubscriberError {
+	for _, s := range sch.subscribers {
+		if err := s.fn(); err != nil {
+			return &SubscriberError{Name: s.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// rollback restores the previous config in the result struct,
+// or the initial result struct if the first unmarshal fails.
+// It returns false if neither can be restored.
+func (sch *SnakeCharmer) rollback() bool {
+	if sch.settings == nil {
+		if !sch.initialResult.IsValid() {
+			return false
+		}
+		reflect.ValueOf(sch.resultStruct).Elem().Set(deepCopy(sch.initialResult, false))
+		return true
+	}
+	return sch.decodeResult(sch.settings) == nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SubscribeRollback(t *testing.T) {
+	result := initTestStruct()
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePath("./test-config.json"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	calls := []string{}
+	charmer.Subscribe("logger", func() error {
+		calls = append(calls, "logger")
+		return nil
+	})
+	charmer.Subscribe("listener", func() error {
+		calls = append(calls, "listener")
+		if *result.BindAddr != "127.0.0.1" {
+			return errors.New("cannot rebind")
+		}
+		return nil
+	})
+	charmer.Subscribe("never", func() error {
+		calls = append(calls, "never")
+		return nil
+	})
+
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, []string{"logger", "listener", "never"}, calls)
+	require.Equal(t, uint(10), *result.Logging.LogLimits.WarnsLimit)
+
+	calls = calls[:0]
+	err = charmer.Reload(WithConfigFilePath("./test-config"))
+	var serr *SubscriberError
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, "listener", serr.Name)
+	require.True(t, serr.RolledBack)
+	require.EqualError(t, serr.Err, "cannot rebind")
+	require.Equal(t, []string{"logger", "listener"}, calls)
+
+	// The previous config is restored
+	require.Equal(t, "127.0.0.1", *result.BindAddr)
+	require.Equal(t, uint(10), *result.Logging.LogLimits.WarnsLimit)
+}
+
+func Test_RollbackInitial(t *testing.T) {
+	result := &testValidateStruct{Upstreams: []testUpstreamConfig{{URL: "http://a"}}}
+	result.Workers = 2
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithDefaults(map[string]interface{}{"workers": 4}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	charmer.Subscribe("listener", func() error {
+		return errors.New("cannot listen")
+	})
+
+	err = charmer.UnmarshalExact()
+	var serr *SubscriberError
+	require.ErrorAs(t, err, &serr)
+	require.True(t, serr.RolledBack)
+	// The first decode is undone
+	require.Equal(t, &testValidateStruct{
+		TestValidateBase: TestValidateBase{Workers: 2},
+		Upstreams:        []testUpstreamConfig{{URL: "http://a"}},
+	}, result)
+}
+
+func Test_SubscribeAccessors(t *testing.T) {
+	result := initTestStruct()
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePath("./test-config.json"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	charmer.Subscribe("accessors", func() error {
+		require.True(t, charmer.WasSet("bind-addr"))
+		require.Contains(t, charmer.ChangedKeys(), "bind-addr")
+		require.Equal(t, []string{"./test-config.json"}, charmer.FilesUsed())
+		require.Empty(t, charmer.Expirations())
+		require.NotEmpty(t, charmer.PrecedenceOrder())
+		require.Equal(t, "127.0.0.1", charmer.RedactedSettings()["bind-addr"])
+		var buf bytes.Buffer
+		require.NoError(t, charmer.DumpEffectiveConfig(&buf, "yaml+source"))
+		require.Contains(t, buf.String(), "bind-addr: 127.0.0.1")
+		require.False(t, charmer.Frozen())
+		require.Nil(t, charmer.Load())
+		return charmer.Store(initTestStruct())
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- charmer.UnmarshalExact() }()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("UnmarshalExact() deadlocked calling the accessors from the subscriber")
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TagDialect defines the struct tag syntax snakecharmer reads.
+type TagDialect int
+
+const (
+	// TagDialectSnakeCharmer is the native tag syntax, e.g.
+	// `mapstructure:"workers,required" env:"WORKERS" usage:"Number of workers" default:"8"`
+	// where the tag names can be changed with WithFieldTagName, WithEnvTagName,
+	// WithFlagHelpTagName and WithDefaultTagName.
+	TagDialectSnakeCharmer TagDialect = iota
+
+	// TagDialectEnvconfig reads the tags of github.com/kelseyhightower/envconfig, e.g.
+	// `envconfig:"WORKERS" split_words:"true" required:"true" default:"8" desc:"Number of workers"`
+	// The key is the lowercased field name, or the snake_cased one if split_words is set.
+	// The ENV var name is taken from the envconfig tag or derived from the key.
+	// Fields with `ignored:"true"` are skipped.
+	TagDialectEnvconfig
+
+	// TagDialectKong reads the tags of github.com/alecthomas/kong, e.g.
+	// `name:"workers" env:"WORKERS" required:"" default:"8" sep:";" help:"Number of workers"`
+	// The key is taken from the name tag or the kebab-cased field name.
+	// Fields with `kong:"-"` are skipped.
+	TagDialectKong
+)
+
+// String returns the dialect name.
+func (d TagDialect) String() string {
+	switch d {
+	case TagDialectSnakeCharmer:
+		return "snakecharmer"
+	case TagDialectEnvconfig:
+		return "envconfig"
+	case TagDialectKong:
+		return "kong"
+	default:
+		return fmt.Sprintf("TagDialect(%d)", int(d))
+	}
+}
+
+// fieldTags holds the settings of a struct field read from its tags.
+type fieldTags struct {
+	// The config key, relative to the parent struct when read from the tags,
+	// see fieldPlan.tagsAt
+	key string
+	// The ENV var name
+	env string
+	// deriveEnv is true if the ENV var name is derived from the full key,
+	// like envconfig does for the fields without the envconfig tag
+	deriveEnv bool
+	// The format of the ENV var holding the whole nested struct,
+	// e.g. "json" for `env:"LOGGING_JSON,format=json"`
+	envFormat string
+	// The flag usage help
+	help string
+	// The default value as written in the tag
+	defaultValue string
+	// The separator of slice values in the default tag
+	sep string
+	// The field tag options, e.g. "omitempty"
+	opts tagOptions
+	// hasDefault is true if the default tag is set
+	hasDefault bool
+	// required is true if the value must be provided explicitly
+	required bool
+	// relpath is true if the relative path value is resolved
+	// against the directory of the config file
+	relpath bool
+	// secret is true if the value must not be revealed
+	secret bool
+	// percent is true if the value is a percent normalized to the ratio
+	percent bool
+	// persist is true if the value is saved into the state file
+	persist bool
+	// count is true if the flag counts its occurrences, e.g. -v -v -v
+	count bool
+	// The one-letter shorthand of the count flag, e.g. "v"
+	shorthand string
+	// The allowed values, e.g. `oneof:"debug,info,warn,error"`
+	oneOf []string
+	// noFlag is true if the field gets no flag
+	noFlag bool
+	// noEnv is true if the field is never bound to an ENV var
+	noEnv bool
+	// noConfig is true if the field must not be set in the config file
+	noConfig bool
+	// The reference to the value kept elsewhere, e.g. `ref:"ssm:///app/db/password"`
+	// or `vault:"secret/data/app#api_key"`
+	ref string
+	// The legacy keys of the renamed key, e.g. `alias:"old.name"`
+	aliases []string
+	// indexed is true if the slice of structs field gets the flags
+	// of its entries, e.g. --upstreams.0.url
+	indexed bool
+	// The number of entries of the slice of structs field getting
+	// the indexed flags, e.g. `maxlen:"4"`
+	maxLen int
+	// The bounds of the numeric value, e.g. `min:"1" max:"65535"`
+	min, max string
+}
+
+// readFieldTags reads the settings of a struct field from its tags
+// according to the tag dialect. It returns false if the field must be skipped.
+func (sch *SnakeCharmer) readFieldTags(sf reflect.StructField) (fieldTags, bool) {
+	var ft fieldTags
+	switch sch.tagDialect {
+	case TagDialectEnvconfig:
+		if !sf.IsExported() || sf.Tag.Get("ignored") == "true" {
+			return ft, false
+		}
+		ft.key = strings.ToLower(sf.Name)
+		if sf.Tag.Get("split_words") == "true" {
+			ft.key = strings.ToLower(strings.Join(splitWords(sf.Name), "_"))
+		}
+		ft.env = sf.Tag.Get("envconfig")
+		ft.deriveEnv = len(ft.env) == 0
+		ft.help = sf.Tag.Get("desc")
+		ft.defaultValue, ft.hasDefault = sf.Tag.Lookup("default")
+		ft.required = sf.Tag.Get("required") == "true"
+		ft.sep = ","
+
+	case TagDialectKong:
+		if !sf.IsExported() || sf.Tag.Get("kong") == "-" {
+			return ft, false
+		}
+		ft.key = sf.Tag.Get("name")
+		if len(ft.key) == 0 {
+			ft.key = strings.ToLower(strings.Join(splitWords(sf.Name), "-"))
+		}
+		ft.env = strings.Split(sf.Tag.Get("env"), ",")[0]
+		ft.help = sf.Tag.Get("help")
+		ft.defaultValue, ft.hasDefault = sf.Tag.Lookup("default")
+		_, ft.required = sf.Tag.Lookup("required")
+		ft.oneOf = parseOneOf(sf.Tag.Get("enum"))
+		ft.sep = ","
+		if sep, ok := sf.Tag.Lookup("sep"); ok {
+			ft.sep = sep
+		}
+
+	default:
+		fieldTag := sf.Tag.Get(sch.fieldTagName)
+		// TODO: handle if field doesn't have fieldTag tag
+		if len(fieldTag) == 0 {
+			if sch.ignoreUntaggedFields {
+				return ft, false
+			}
+			panic(fmt.Sprintf("BUG: got untagged field: %s", sf.Name))
+		}
+		ft.key, ft.opts = parseFieldTag(fieldTag)
+		ft.env, ft.envFormat = parseEnvTag(sf.Tag.Get(sch.envTagName))
+		ft.help = sf.Tag.Get(sch.flagHelpTagName)
+		ft.defaultValue, ft.hasDefault = sf.Tag.Lookup(sch.defaultTagName)
+		ft.required = ft.opts.Has("required")
+		ft.relpath = ft.opts.Has("relpath")
+		ft.secret = ft.opts.Has("secret")
+		ft.percent = ft.opts.Has("percent")
+		ft.persist = ft.opts.Has("persist")
+		ft.count = ft.opts.Has("count")
+		ft.shorthand = sf.Tag.Get("short")
+		ft.oneOf = parseOneOf(sf.Tag.Get("oneof"))
+		ft.noFlag = ft.opts.Has("noflag")
+		ft.indexed = ft.opts.Has("indexed")
+		ft.sep = sch.sliceSep
+	}
+	if sf.Tag.Get("secret") == "true" {
+		ft.secret = true
+	}
+	if sf.Tag.Get("flag") == "-" {
+		ft.noFlag = true
+	}
+	if sf.Tag.Get(sch.envTagName) == "-" || (sch.tagDialect == TagDialectKong && sf.Tag.Get("env") == "-") {
+		ft.noEnv = true
+		ft.env = ""
+		ft.deriveEnv = false
+	}
+	if sf.Tag.Get("config") == "-" {
+		ft.noConfig = true
+	}
+	if ft.persist && ft.secret {
+		panic(fmt.Sprintf("BUG: persist is set for secret field %q, the state file is not encrypted", sf.Name))
+	}
+	ft.ref = sf.Tag.Get("ref")
+	for _, alias := range strings.Split(sf.Tag.Get("alias"), ",") {
+		if alias = strings.ToLower(strings.TrimSpace(alias)); len(alias) > 0 {
+			ft.aliases = append(ft.aliases, alias)
+		}
+	}
+	if path := sf.Tag.Get("vault"); len(path) > 0 {
+		ft.ref = vaultPrefix + path
+	}
+	if ft.persist && len(ft.ref) > 0 {
+		panic(fmt.Sprintf("BUG: persist is set for field %q with the reference, the resolved value is not saved", sf.Name))
+	}
+	if maxLen, ok := sf.Tag.Lookup("maxlen"); ok {
+		n, err := strconv.Atoi(maxLen)
+		if err != nil || n <= 0 {
+			panic(fmt.Sprintf("BUG: invalid maxlen tag for field %q: %q", sf.Name, maxLen))
+		}
+		ft.maxLen = n
+		ft.indexed = true
+	}
+	ft.min = strings.TrimSpace(sf.Tag.Get("min"))
+	ft.max = strings.TrimSpace(sf.Tag.Get("max"))
+	return ft, true
+}
+
+// matchName matches the config key with the struct field name
+// ignoring case, dashes and underscores, e.g. "max-burst" matches "MaxBurst".
+// It is used as mapstructure.DecoderConfig.MatchName for non-native tag dialects.
+func matchName(mapKey, fieldName string) bool {
+	r := strings.NewReplacer("-", "", "_", "")
+	return strings.EqualFold(r.Replace(mapKey), r.Replace(fieldName))
+}
+
+// joinKey joins the prefix of the parent struct and the key
+func joinKey(prefix, key string) string {
+	if len(prefix) > 0 {
+		return prefix + "." + key
+	}
+	return key
+}
+
+// splitWords splits the CamelCased name into words,
+// keeping acronyms together, e.g. "APIKey" -> ["API", "Key"].
+func splitWords(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case unicode.IsLower(prev) && unicode.IsUpper(cur):
+			// "maxBurst" -> "max", "Burst"
+		case unicode.IsUpper(prev) && unicode.IsUpper(cur) && unicode.IsLower(next):
+			// "APIKey" -> "API", "Key"
+		case unicode.IsDigit(prev) != unicode.IsDigit(cur) && unicode.IsUpper(cur):
+			// "V2Key" -> "V2", "Key"
+		default:
+			continue
+		}
+		words = append(words, string(runes[start:i]))
+		start = i
+	}
+	return append(words, string(runes[start:]))
+}
+
+// parseEnvTag splits the env tag into the ENV var name and the format option,
+// e.g. "LOGGING_JSON,format=json" -> "LOGGING_JSON", "json".
+func parseEnvTag(tag string) (string, string) {
+	name, opts, _ := strings.Cut(tag, ",")
+	format := ""
+	for _, opt := range strings.Split(opts, ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(opt), "format="); ok {
+			format = v
+		}
+	}
+	return strings.TrimSpace(name), format
+}
@@ -0,0 +1,131 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_splitWords(t *testing.T) {
+	f := func(name string, expected ...string) {
+		t.Helper()
+		require.Equal(t, expected, splitWords(name))
+	}
+	f("Workers", "Workers")
+	f("MaxBurst", "Max", "Burst")
+	f("APIKey", "API", "Key")
+	f("BindAddrV2", "Bind", "Addr", "V2")
+	f("URL", "URL")
+}
+
+func Test_TagDialectEnvconfig(t *testing.T) {
+	type envconfigLogging struct {
+		Level string `default:"info" desc:"Log level"`
+	}
+	type envconfigStruct struct {
+		Workers  int              `envconfig:"TEST_EC_WORKERS" default:"8" desc:"Number of workers"`
+		MaxBurst float64          `split_words:"true" default:"1.25" desc:"Max burst allowed"`
+		APIKey   string           `split_words:"true" required:"true" desc:"API key"`
+		Ports    []int            `default:"80,443" desc:"List of ports"`
+		Logging  envconfigLogging `split_words:"true"`
+		Skipped  string           `ignored:"true"`
+		internal string
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	result := &envconfigStruct{}
+	vpr := viper.New()
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithViper(vpr),
+		WithCobraCommand(cmd),
+		WithTagDialect(TagDialectEnvconfig),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	for _, name := range []string{"workers", "max_burst", "api_key", "ports", "logging.level"} {
+		require.NotNil(t, cmd.PersistentFlags().Lookup(name), name)
+	}
+	require.Nil(t, cmd.PersistentFlags().Lookup("skipped"))
+
+	t.Setenv("TEST_EC_WORKERS", "16")
+	t.Setenv("API_KEY", "secret")
+	t.Setenv("LOGGING_LEVEL", "debug")
+	cmd.SetArgs([]string{"--max_burst=2.5"})
+
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, 2.5, result.MaxBurst)
+	require.Equal(t, "secret", result.APIKey)
+	require.Equal(t, []int{80, 443}, result.Ports)
+	require.Equal(t, "debug", result.Logging.Level)
+}
+
+func Test_TagDialectKong(t *testing.T) {
+	type kongStruct struct {
+		Workers  int      `name:"num-workers" env:"TEST_KONG_WORKERS" default:"8" help:"Number of workers"`
+		MaxBurst float64  `default:"1.25" help:"Max burst allowed"`
+		Hosts    []string `default:"a;b" sep:";" help:"List of hosts"`
+		Verbose  bool     `required:"" help:"Verbose output"`
+		Skipped  string   `kong:"-"`
+	}
+	var charmer *SnakeCharmer
+	var err error
+
+	result := &kongStruct{}
+	cmd := &cobra.Command{
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return charmer.UnmarshalExact()
+		},
+		Run: func(cmd *cobra.Command, args []string) {},
+	}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithCobraCommand(cmd),
+		WithTagDialect(TagDialectKong),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Nil(t, cmd.PersistentFlags().Lookup("skipped"))
+
+	t.Setenv("TEST_KONG_WORKERS", "16")
+	cmd.SetArgs([]string{"--max-burst=2.5", "--verbose"})
+
+	if err = cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error in cmd.Execute(): %s", err.Error())
+	}
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, 2.5, result.MaxBurst)
+	require.Equal(t, []string{"a", "b"}, result.Hosts)
+	require.True(t, result.Verbose)
+}
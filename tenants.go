@@ -0,0 +1,68 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tenantGroup is the same struct instantiated under the prefix
+// for every tenant name, see WithTenants.
+type tenantGroup struct {
+	// The config key prefix, e.g. "tenants"
+	prefix string
+	// The tenant names, e.g. "tenantA", "tenantB"
+	names []string
+	// The map[string]*Config the tenant configs are decoded into
+	result reflect.Value
+}
+
+// addTenantFlags creates the tenant configs, i.e. the map entries,
+// and adds flags for them under the keys like "tenants.tenantA.workers".
+func (sch *SnakeCharmer) addTenantFlags() {
+	for _, g := range sch.tenantGroups {
+		if g.result.IsNil() {
+			g.result.Set(reflect.MakeMap(g.result.Type()))
+		}
+		for _, name := range g.names {
+			tenant := reflect.New(g.result.Type().Elem().Elem())
+			g.result.SetMapIndex(reflect.ValueOf(name), tenant)
+			sch.addFlags(tenant.Interface(), joinKey(g.prefix, name))
+		}
+	}
+}
+
+// decodeTenants decodes the tenant configs from the settings
+// and removes their keys from the settings, so they are not decoded
+// into the result struct.
+func (sch *SnakeCharmer) decodeTenants(settings map[string]interface{}) (map[string]interface{}, error) {
+	for _, g := range sch.tenantGroups {
+		for _, name := range g.names {
+			key := joinKey(g.prefix, name)
+			tenant := g.result.MapIndex(reflect.ValueOf(name))
+			sub := nestedSettings(settings, strings.ToLower(key))
+			if sub == nil {
+				sub = map[string]interface{}{}
+			}
+			if err := decode(sub, tenant.Interface(), true, sch.decoderOptions()...); err != nil {
+				return nil, fmt.Errorf("while unmarshalling config of tenant %q: %w", name, sch.redactError(err, settings))
+			}
+		}
+		deleteSetting(settings, g.prefix)
+	}
+	return settings, nil
+}
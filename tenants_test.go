@@ -0,0 +1,70 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testTenantStruct struct {
+	URL     string `snakecharmer:"url" usage:"Upstream URL"`
+	Workers int    `snakecharmer:"workers" usage:"Number of workers" default:"4"`
+}
+
+func Test_WithTenants(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte("log-level: warn\ntenants:\n  tenantA:\n    url: http://a/\n  tenantB:\n    url: http://b/\n    workers: 8\n")
+	if err := os.WriteFile(config, data, 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TENANTS_TENANTB_WORKERS", "16")
+
+	result := &struct {
+		LogLevel string `snakecharmer:"log-level" usage:"Log level" default:"info"`
+	}{}
+	var tenants map[string]*testTenantStruct
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+		WithDerivedEnvNames(true),
+		WithTenants("tenants", []string{"tenantA", "tenantB"}, &tenants),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--tenants.tenantA.workers", "2"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Equal(t, "warn", result.LogLevel)
+	require.Equal(t, map[string]*testTenantStruct{
+		"tenantA": {URL: "http://a/", Workers: 2},
+		"tenantB": {URL: "http://b/", Workers: 16},
+	}, tenants)
+
+	_, err = NewSnakeCharmer(WithTenants("tenants", []string{"a"}, map[string]*testTenantStruct{}))
+	require.Error(t, err)
+}
@@ -0,0 +1,220 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isTextStruct returns true if the struct type is decoded from its
+// text representation, i.e. the pointer to it implements encoding.TextUnmarshaler,
+// e.g. big.Int, big.Float or github.com/shopspring/decimal.Decimal.
+// Such fields are registered as string flags rather than nested structs.
+func isTextStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// parseTextValue parses the text into the value of the type t,
+// the pointer to which implements encoding.TextUnmarshaler.
+func parseTextValue(t reflect.Type, text string) (reflect.Value, error) {
+	v := reflect.New(t)
+	if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// formatTextValue returns the text representation of the value.
+func formatTextValue(rv reflect.Value) string {
+	// The pointer method set includes the methods with value receivers
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	if m, ok := ptr.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+// applyTextSetting adds the string flag for the field decoded
+// from its text representation and sets the default viper config param.
+func (sch *SnakeCharmer) applyTextSetting(fs *pflag.FlagSet, rv reflect.Value, name, help string) {
+	value := formatTextValue(rv)
+	fs.String(name, value, help)
+	sch.backend.SetDefault(name, value)
+}
+
+// textUnmarshalerHookFunc returns a mapstructure.DecodeHookFunc that converts
+// strings and numbers into the struct types decoded from their text representation
+// (see isTextStruct) or pointers to them. Numbers are formatted
+// in the shortest exact representation, so e.g. 0.1 stays "0.1".
+// The numbers of the config files are decoded from their raw text,
+// see restoreNumberTexts.
+func textUnmarshalerHookFunc() mapstructure.DecodeHookFunc {
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		target, ptr := t, false
+		if target.Kind() == reflect.Ptr {
+			target, ptr = target.Elem(), true
+		}
+		if !isTextStruct(target) {
+			return data, nil
+		}
+		var text string
+		switch v := data.(type) {
+		case string:
+			text = v
+		case float64:
+			text = strconv.FormatFloat(v, 'f', -1, 64)
+		case float32:
+			text = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			text = fmt.Sprint(v)
+		default:
+			return data, nil
+		}
+		v, err := parseTextValue(target, text)
+		if err != nil {
+			return nil, err
+		}
+		if ptr {
+			return v.Addr().Interface(), nil
+		}
+		return v.Interface(), nil
+	}
+}
+
+// recordNumberTexts records the raw text of the numbers of the YAML or JSON
+// config file, which are parsed into float64 losing the precision,
+// e.g. 99999999999999999999.99, so the fields decoded from their text
+// representation get the exact value (see restoreNumberTexts).
+// The texts of the later files and documents win, like their values.
+// The file is parsed by viper before, so the parse errors are ignored.
+func (sch *SnakeCharmer) recordNumberTexts(data []byte, format string) {
+	if sch.numberTexts == nil {
+		sch.numberTexts = make(map[string]string)
+	}
+	switch format {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc yaml.Node
+			if err := dec.Decode(&doc); err != nil {
+				// io.EOF after the last document
+				return
+			}
+			if len(doc.Content) == 0 || !sch.yamlDocumentSelected(doc.Content[0]) {
+				continue
+			}
+			recordYAMLNumbers(sch.numberTexts, doc.Content[0], "")
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var settings map[string]interface{}
+		if err := dec.Decode(&settings); err == nil {
+			recordJSONNumbers(sch.numberTexts, settings, "")
+		}
+	}
+}
+
+func recordYAMLNumbers(texts map[string]string, node *yaml.Node, key string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i], node.Content[i+1]
+		k := joinKey(key, strings.ToLower(name.Value))
+		switch {
+		case value.Kind == yaml.MappingNode:
+			recordYAMLNumbers(texts, value, k)
+		case value.Kind == yaml.ScalarNode && (value.Tag == "!!int" || value.Tag == "!!float"):
+			texts[k] = value.Value
+		}
+	}
+}
+
+func recordJSONNumbers(texts map[string]string, settings map[string]interface{}, key string) {
+	for name, value := range settings {
+		k := joinKey(key, strings.ToLower(name))
+		switch v := value.(type) {
+		case map[string]interface{}:
+			recordJSONNumbers(texts, v, k)
+		case json.Number:
+			texts[k] = v.String()
+		}
+	}
+}
+
+// restoreNumberTexts replaces the numbers of the fields decoded from their
+// text representation (see isTextStruct) with their raw text recorded
+// by recordNumberTexts, if the value is read from the config file.
+func (sch *SnakeCharmer) restoreNumberTexts(settings map[string]interface{}) {
+	for _, b := range sch.bindings {
+		t := b.typ
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if !isTextStruct(t) {
+			continue
+		}
+		text, ok := sch.numberTexts[strings.ToLower(b.key)]
+		if !ok {
+			continue
+		}
+		parent, name := settingsParent(settings, b.key)
+		if parent == nil {
+			continue
+		}
+		value, ok := numberOf(parent[name])
+		if !ok {
+			continue
+		}
+		// The value may be overridden by another source
+		if parsed, err := strconv.ParseFloat(text, 64); err == nil && parsed == value {
+			parent[name] = text
+		}
+	}
+}
+
+// numberOf returns the value of the number as float64,
+// or false if it is not a number.
+func numberOf(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testDecimal mimics github.com/shopspring/decimal.Decimal,
+// which implements MarshalText with a value receiver.
+type testDecimal struct {
+	rat *big.Rat
+}
+
+func (d testDecimal) MarshalText() ([]byte, error) {
+	if d.rat == nil {
+		return []byte("0"), nil
+	}
+	return []byte(d.rat.FloatString(2)), nil
+}
+
+func (d *testDecimal) UnmarshalText(text []byte) error {
+	d.rat = new(big.Rat)
+	return d.rat.UnmarshalText(text)
+}
+
+type testBigStruct struct {
+	Supply   *big.Int    `snakecharmer:"supply" env:"TEST_BIG_SUPPLY" usage:"Total supply" default:"1000000000000000000000"`
+	Rate     big.Float   `snakecharmer:"rate" usage:"Exchange rate"`
+	Fee      testDecimal `snakecharmer:"fee" usage:"Fee" default:"0.10"`
+	MaxPrice testDecimal `snakecharmer:"max-price" usage:"Max price"`
+}
+
+func Test_TextUnmarshalerFields(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	write := func(name, data string) {
+		t.Helper()
+		config = filepath.Join(dir, name)
+		if err := os.WriteFile(config, []byte(data), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+	}
+	write("config.yaml", "rate: 1.25\nmax-price: 99999999999999999999.99\n")
+	f := func(args ...string) (*testBigStruct, error) {
+		t.Helper()
+		result := &testBigStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		require.Equal(t, "0.10", cmd.PersistentFlags().Lookup("fee").DefValue)
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f()
+	require.NoError(t, err)
+	require.Equal(t, "1000000000000000000000", result.Supply.String())
+	require.Equal(t, "1.25", result.Rate.Text('f', 2))
+	require.Equal(t, "0.10", result.Fee.rat.FloatString(2))
+	// The numbers are decoded from the raw text of the config file
+	require.Equal(t, "99999999999999999999.99", result.MaxPrice.rat.FloatString(2))
+
+	write("big.yaml", "supply: 123456789012345678901234567890\n")
+	result, err = f()
+	require.NoError(t, err)
+	require.Equal(t, "123456789012345678901234567890", result.Supply.String())
+
+	write("big.json", `{"supply": 123456789012345678901234567890, "max-price": 99999999999999999999.99}`)
+	result, err = f()
+	require.NoError(t, err)
+	require.Equal(t, "123456789012345678901234567890", result.Supply.String())
+	require.Equal(t, "99999999999999999999.99", result.MaxPrice.rat.FloatString(2))
+
+	write("config.yaml", "rate: 1.25\nmax-price: 99999999999999999999.99\n")
+	t.Setenv("TEST_BIG_SUPPLY", "123456789012345678901234567890")
+	result, err = f("--fee", "0.05")
+	require.NoError(t, err)
+	require.Equal(t, "123456789012345678901234567890", result.Supply.String())
+	require.Equal(t, "0.05", result.Fee.rat.FloatString(2))
+
+	_, err = f("--fee", "ten cents")
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import "fmt"
+
+// TypedCharmer is a type-safe wrapper of SnakeCharmer
+// for the result struct of type T.
+type TypedCharmer[T any] struct {
+	*SnakeCharmer
+}
+
+// NewTyped creates a new snakecharmer instance for the result struct of type T.
+// The result struct is allocated with new(T) unless it is set
+// with WithResultStruct, which must be passed a *T then.
+// charmer, err = NewTyped[Config](
+//
+//	WithFieldTagName("snakecharmer"),
+//	WithCobraCommand(cmd),
+//
+// )
+func NewTyped[T any](opts ...CharmingOption) (*TypedCharmer[T], error) {
+	opts = append([]CharmingOption{WithResultStruct(new(T))}, opts...)
+	sch, err := NewSnakeCharmer(opts...)
+	tc := &TypedCharmer[T]{SnakeCharmer: sch}
+	if err != nil {
+		return tc, err
+	}
+	if _, ok := sch.resultStruct.(*T); !ok {
+		return tc, fmt.Errorf("result struct must be <%T>. Got <%T>", new(T), sch.resultStruct)
+	}
+	return tc, nil
+}
+
+// Result returns the pointer to the struct that contains the decoded values.
+func (tc *TypedCharmer[T]) Result() *T {
+	result, _ := tc.resultStruct.(*T)
+	return result
+}
+
+// UnmarshalExact unmarshals the config into the result struct,
+// erroring if a field is nonexistent in the destination struct.
+// It returns the pointer to the result struct.
+func (tc *TypedCharmer[T]) UnmarshalExact() (*T, error) {
+	if err := tc.SnakeCharmer.UnmarshalExact(); err != nil {
+		return nil, err
+	}
+	return tc.Result(), nil
+}
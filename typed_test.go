@@ -0,0 +1,69 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewTyped(t *testing.T) {
+	type typedStruct struct {
+		Workers int    `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+		Level   string `snakecharmer:"level" usage:"Log level" default:"info"`
+	}
+	cmd := &cobra.Command{}
+	charmer, err := NewTyped[typedStruct](
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewTyped(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	if err = cmd.ParseFlags([]string{"--workers=16"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	result, err := charmer.UnmarshalExact()
+	if err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+	require.Same(t, charmer.Result(), result)
+	require.Equal(t, 16, result.Workers)
+	require.Equal(t, "info", result.Level)
+
+	preset := &typedStruct{}
+	charmer, err = NewTyped[typedStruct](
+		WithResultStruct(preset),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewTyped(opts ...Option): %s", err.Error())
+	}
+	require.Same(t, preset, charmer.Result())
+
+	_, err = NewTyped[typedStruct](
+		WithResultStruct(initTestStruct()),
+		WithCobraCommand(&cobra.Command{}),
+	)
+	require.Error(t, err)
+
+	_, err = NewTyped[int](WithCobraCommand(&cobra.Command{}))
+	require.Error(t, err)
+}
@@ -0,0 +1,174 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownKey is a config key that does not exist in the result struct.
+type UnknownKey struct {
+	// Key is the unknown config key
+	Key string
+	// Suggestion is the closest known key, empty if there is none
+	Suggestion string
+}
+
+// String returns the key along with the suggestion.
+func (k UnknownKey) String() string {
+	if len(k.Suggestion) > 0 {
+		return fmt.Sprintf("%q (did you mean %q?)", k.Key, k.Suggestion)
+	}
+	return fmt.Sprintf("%q", k.Key)
+}
+
+// Error implements the error interface, so the unknown key
+// can be found with errors.As in the error returned by UnmarshalExact.
+func (k UnknownKey) Error() string {
+	return "unknown config key " + k.String()
+}
+
+// UnknownKeysError is returned by UnmarshalExact when the config
+// has keys that do not exist in the result struct.
+type UnknownKeysError struct {
+	Keys []UnknownKey
+}
+
+// Error implements the error interface.
+func (e *UnknownKeysError) Error() string {
+	keys := make([]string, 0, len(e.Keys))
+	for _, k := range e.Keys {
+		keys = append(keys, k.String())
+	}
+	return "unknown config keys: " + strings.Join(keys, ", ")
+}
+
+// Unwrap returns the unknown keys for errors.As.
+func (e *UnknownKeysError) Unwrap() []error {
+	result := make([]error, 0, len(e.Keys))
+	for _, k := range e.Keys {
+		result = append(result, k)
+	}
+	return result
+}
+
+// unknownKeys returns the keys of the settings that do not exist
+// in the result struct, along with the suggestions of the closest known keys.
+// It requires AddFlags to be called, otherwise the schema is unknown.
+func (sch *SnakeCharmer) unknownKeys(settings map[string]interface{}) []UnknownKey {
+	if len(sch.bindings) == 0 {
+		return nil
+	}
+	known := make(map[string]bool, len(sch.bindings))
+	prefixes := []string{}
+	for _, b := range sch.bindings {
+		key := strings.ToLower(b.key)
+		known[key] = true
+		if b.typ.Kind() == reflect.Map {
+			// Map keys are not a part of the schema
+			prefixes = append(prefixes, key+".")
+		}
+	}
+
+	unknown := []UnknownKey{}
+	for _, key := range flattenKeys("", settings) {
+		if known[key] || hasAnyPrefix(key, prefixes) {
+			continue
+		}
+		unknown = append(unknown, UnknownKey{Key: key, Suggestion: suggestKey(key, known)})
+	}
+	return unknown
+}
+
+// flattenKeys returns the sorted dot separated keys of the nested settings.
+func flattenKeys(prefix string, settings map[string]interface{}) []string {
+	keys := []string{}
+	for name, value := range settings {
+		key := joinKey(prefix, name)
+		if m, ok := value.(map[string]interface{}); ok {
+			keys = append(keys, flattenKeys(key, m)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestKey returns the known key closest to the given one
+// by the edit distance, or empty string if none is close enough.
+func suggestKey(key string, known map[string]bool) string {
+	maxDistance := len(key) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+	suggestion := ""
+	best := maxDistance + 1
+	for k := range known {
+		d := levenshtein(key, k)
+		if d < best || (d == best && k < suggestion) {
+			best = d
+			suggestion = k
+		}
+	}
+	if best > maxDistance {
+		return ""
+	}
+	return suggestion
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_levenshtein(t *testing.T) {
+	f := func(a, b string, expected int) {
+		t.Helper()
+		require.Equal(t, expected, levenshtein(a, b))
+	}
+	f("", "", 0)
+	f("level", "level", 0)
+	f("levl", "level", 1)
+	f("max-brust", "max-burst", 2)
+	f("kitten", "sitting", 3)
+}
+
+func Test_UnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+workers: 256
+max-brust: 1.5
+log:
+  levl: debug
+  dst:
+    audit: /var/log/audit.log
+  limit: {}
+frobnicate: true
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(initTestStruct()),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePath(path),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	err = charmer.UnmarshalExact()
+	var unknownErr *UnknownKeysError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("expecting *UnknownKeysError in UnmarshalExact(), got: %v", err)
+	}
+	require.Equal(t, []UnknownKey{
+		{Key: "frobnicate"},
+		{Key: "log.levl", Suggestion: "log.level"},
+		{Key: "max-brust", Suggestion: "max-burst"},
+	}, unknownErr.Keys)
+	require.Equal(t,
+		`unknown config keys: "frobnicate", "log.levl" (did you mean "log.level"?), "max-brust" (did you mean "max-burst"?)`,
+		err.Error())
+}
+
+func Test_UnmarshalWithWarnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+max-burst: 2.5
+log:
+  levl: debug
+  rotate:
+    keep: 7
+`), 0o600)
+	if err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+
+	result := initTestStruct()
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithIgnoreUntaggedFields(true),
+		WithConfigFilePath(path),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+
+	warnings, err := charmer.UnmarshalWithWarnings()
+	require.NoError(t, err)
+	require.Equal(t, []UnknownKey{
+		{Key: "log.levl", Suggestion: "log.level"},
+		{Key: "log.rotate.keep"},
+	}, warnings)
+	require.Equal(t, 2.5, *result.MaxBurst)
+
+	var unknownErr *UnknownKeysError
+	require.ErrorAs(t, charmer.UnmarshalExact(), &unknownErr)
+}
@@ -0,0 +1,244 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultConfigURLTimeout is the default timeout of fetching the config URL.
+const defaultConfigURLTimeout = 10 * time.Second
+
+// configURLDocument is the config document fetched from the config URL.
+type configURLDocument struct {
+	etag   string
+	data   []byte
+	format string
+}
+
+// configURLCache keeps the documents fetched from the config URLs,
+// so they are re-fetched with If-None-Match when they have the ETag.
+type configURLCache struct {
+	mu   sync.Mutex
+	docs map[string]*configURLDocument
+}
+
+func (c *configURLCache) get(u string) *configURLDocument {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.docs[u]
+}
+
+func (c *configURLCache) set(u string, doc *configURLDocument) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.docs == nil {
+		c.docs = make(map[string]*configURLDocument)
+	}
+	c.docs[u] = doc
+}
+
+// isConfigURL returns true if the config file path is an http(s) URL.
+func isConfigURL(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// configURLs returns the config file paths which are http(s) URLs.
+func (sch *SnakeCharmer) configURLs() []string {
+	urls := []string{}
+	for _, path := range sch.configFiles() {
+		if isConfigURL(path) {
+			urls = append(urls, path)
+		}
+	}
+	return urls
+}
+
+// readConfigURL fetches the config document from the URL
+// and reads it into the settings map.
+func (sch *SnakeCharmer) readConfigURL(u string) (map[string]interface{}, error) {
+	doc, _, err := sch.fetchConfigURL(sch.runContext(), u)
+	if err != nil {
+		return nil, fmt.Errorf("while fetching config %q: %w", u, err)
+	}
+	return sch.readConfigBytes(u, doc.data, doc.format)
+}
+
+// fetchConfigURL fetches the config document from the URL, it returns
+// the cached one if the server responds with 304 Not Modified to the
+// request with the ETag of the cached one. changed is true if the document
+// differs from the cached one. The failed requests are retried,
+// see WithConfigURLRetries.
+func (sch *SnakeCharmer) fetchConfigURL(ctx context.Context, u string) (doc *configURLDocument, changed bool, err error) {
+	cached := sch.urlCache.get(u)
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		doc, retry, err = sch.fetchConfigURLOnce(ctx, u, cached)
+		if err == nil || !retry || attempt >= sch.configURLRetries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false, err
+		case <-time.After(sch.configURLRetryDelay):
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if doc == cached {
+		return doc, false, nil
+	}
+	sch.urlCache.set(u, doc)
+	changed = cached == nil || !bytes.Equal(cached.data, doc.data) || cached.format != doc.format
+	return doc, changed, nil
+}
+
+// fetchConfigURLOnce sends the request to the config URL, retry is true
+// if the error is temporary, i.e. a network error or a 5xx/429 response.
+func (sch *SnakeCharmer) fetchConfigURLOnce(ctx context.Context, u string, cached *configURLDocument) (*configURLDocument, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, sch.configURLTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if cached != nil && len(cached.etag) > 0 {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+	var body io.Reader = resp.Body
+	if sch.limits.MaxFileSize > 0 {
+		body = io.LimitReader(resp.Body, sch.limits.MaxFileSize+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, true, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached, false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, true, fmt.Errorf("server responded with %q", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("server responded with %q", resp.Status)
+	}
+	if sch.limits.MaxFileSize > 0 && int64(len(data)) > sch.limits.MaxFileSize {
+		return nil, false, &LimitError{Limit: "MaxFileSize", Key: u, Value: int64(len(data)), Max: sch.limits.MaxFileSize}
+	}
+	return &configURLDocument{
+		etag:   resp.Header.Get("ETag"),
+		data:   data,
+		format: sch.configURLFormat(u, resp.Header.Get("Content-Type")),
+	}, false, nil
+}
+
+// configURLFormat returns the format of the config document
+// taken from the Content-Type, the URL path extension
+// or the config file type, see WithConfigFileType.
+func (sch *SnakeCharmer) configURLFormat(u, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return "json"
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return "yaml"
+	case "application/toml", "text/toml":
+		return "toml"
+	}
+	if parsed, err := url.Parse(u); err == nil {
+		ext := strings.TrimPrefix(path.Ext(parsed.Path), ".")
+		if len(ext) > 0 && fileExtSupported(ext) {
+			return ext
+		}
+	}
+	return sch.configFileType
+}
+
+// WatchConfigURLs re-fetches the config URLs (see WithConfigFilePath)
+// every interval and runs the reload pipeline (see Reload) when any
+// of the documents changes, until the context is done. The documents
+// having the ETag are re-fetched with If-None-Match.
+// onReload (if not nil) is called after every reload with its error,
+// as well as with the fetch errors.
+// WatchConfigURLs does not block, the URLs are polled in a goroutine,
+// which also stops on Close.
+func (sch *SnakeCharmer) WatchConfigURLs(ctx context.Context, interval time.Duration, onReload func(error)) error {
+	if interval <= 0 {
+		return fmt.Errorf("config URL refresh interval must be positive: %s", interval)
+	}
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if len(sch.configURLs()) == 0 {
+		return fmt.Errorf("config file path is not an http(s) URL")
+	}
+	done := sch.ctx.Done()
+	started := sch.goBackground(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			changed, err := sch.refetchConfigURLs(ctx)
+			if err == nil && changed {
+				err = sch.Reload()
+			}
+			if (err != nil || changed) && onReload != nil {
+				onReload(err)
+			}
+		}
+	})
+	if !started {
+		return ErrClosed
+	}
+	return nil
+}
+
+// refetchConfigURLs fetches the config URLs, it returns true
+// if any of the documents changes.
+func (sch *SnakeCharmer) refetchConfigURLs(ctx context.Context) (bool, error) {
+	sch.mu.Lock()
+	urls := sch.configURLs()
+	sch.mu.Unlock()
+	result := false
+	for _, u := range urls {
+		_, changed, err := sch.fetchConfigURL(ctx, u)
+		if err != nil {
+			return false, fmt.Errorf("while fetching config %q: %w", u, err)
+		}
+		result = result || changed
+	}
+	return result, nil
+}
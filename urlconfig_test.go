@@ -0,0 +1,143 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfigServer serves the config document with the ETag,
+// the first failures requests fail with 503.
+type testConfigServer struct {
+	mu          sync.Mutex
+	body        string
+	contentType string
+	version     int
+	failures    int
+	requests    int
+	notModified int
+}
+
+func (s *testConfigServer) set(body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	s.version++
+}
+
+func (s *testConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	etag := strconv.Quote(strconv.Itoa(s.version))
+	if r.Header.Get("If-None-Match") == etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", s.contentType)
+	_, _ = w.Write([]byte(s.body))
+}
+
+func Test_ConfigURL(t *testing.T) {
+	server := &testConfigServer{
+		body:        `{"workers": 32, "log": {"json": true}}`,
+		contentType: "application/json; charset=utf-8",
+		failures:    2,
+	}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	result := &testMultiDocStruct{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(srv.URL+"/config.txt"),
+		WithConfigURLRetries(2, time.Millisecond),
+		WithConfigURLTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	defer charmer.Close()
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 32, result.Workers)
+	require.True(t, result.Log.JSON)
+	require.Equal(t, []string{srv.URL + "/config.txt"}, charmer.FilesUsed())
+	require.Equal(t, 3, server.requests)
+
+	// The unchanged document is not fetched again
+	require.NoError(t, charmer.Reload())
+	require.Equal(t, 1, server.notModified)
+	require.Equal(t, 32, result.Workers)
+
+	reloaded := make(chan error, 1)
+	require.NoError(t, charmer.WatchConfigURLs(context.Background(), 10*time.Millisecond, func(err error) {
+		reloaded <- err
+	}))
+	server.set(`{"workers": 64}`)
+	select {
+	case err = <-reloaded:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("config URL is not reloaded")
+	}
+	require.Equal(t, 64, result.Workers)
+	require.False(t, result.Log.JSON)
+}
+
+func Test_ConfigURLErrors(t *testing.T) {
+	f := func(server *testConfigServer, opts ...CharmingOption) {
+		t.Helper()
+		srv := httptest.NewServer(server)
+		defer srv.Close()
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(&testMultiDocStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(srv.URL + "/config.yaml"),
+		}, opts...)...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		defer charmer.Close()
+		charmer.AddFlags()
+		require.Error(t, charmer.UnmarshalExact())
+	}
+
+	// No retries
+	f(&testConfigServer{body: "workers: 1", failures: 1})
+	// Invalid YAML taken from the URL extension
+	f(&testConfigServer{body: "workers: ["})
+	// Size limit
+	f(&testConfigServer{body: "workers: 1"}, WithConfigLimits(ConfigLimits{MaxFileSize: 4}))
+}
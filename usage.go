@@ -0,0 +1,69 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// DefaultUsageTemplate is the template of the suffix appended to the flag
+// usage help by default, e.g. " (env: TEST_WORKERS, config: workers)",
+// see WithUsageTemplate. The parts of the unbound ENV vars and the keys
+// that cannot be set in the config file are left out.
+const DefaultUsageTemplate = `{{if .Envs}} (env: {{join .Envs ", "}}{{if .Config}}, config: {{.Key}}{{end}})` +
+	`{{else if .Config}} (config: {{.Key}}){{end}}`
+
+// UsageData is the data the usage template is executed with, see WithUsageTemplate.
+type UsageData struct {
+	// Key is the config key, which is the flag name as well, e.g. "log.level"
+	Key string
+	// Envs are the ENV var names in the lookup order, empty if not bound
+	Envs []string
+	// Config is true if the key can be set in the config file
+	Config bool
+}
+
+// defaultUsageTemplate is the parsed DefaultUsageTemplate
+var defaultUsageTemplate = template.Must(parseUsageTemplate(DefaultUsageTemplate))
+
+// parseUsageTemplate parses the usage template, the join function
+// is strings.Join. The template is executed with the zero UsageData,
+// so the references to the unknown fields fail early.
+func parseUsageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("usage").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err = tmpl.Execute(io.Discard, UsageData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// flagUsage appends the suffix of the usage template, e.g.
+// " (env: TEST_WORKERS, config: workers)", to the flag usage help.
+func (sch *SnakeCharmer) flagUsage(help string, data UsageData) string {
+	if sch.usageTemplate == nil {
+		return help
+	}
+	var suffix strings.Builder
+	if err := sch.usageTemplate.Execute(&suffix, data); err != nil {
+		panic(fmt.Sprintf("BUG: cannot execute usage template for flag %q: %s", data.Key, err.Error()))
+	}
+	return help + suffix.String()
+}
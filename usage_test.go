@@ -0,0 +1,68 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testUsageStruct struct {
+	Workers int    `snakecharmer:"workers" env:"TEST_WORKERS" usage:"Number of workers to run" default:"8"`
+	Token   string `snakecharmer:"token" env:"TEST_TOKEN" usage:"API token" config:"-"`
+	Debug   bool   `snakecharmer:"debug" usage:"Debug mode" env:"-"`
+	Local   bool   `snakecharmer:"local" usage:"Local mode" env:"-" config:"-"`
+}
+
+func Test_UsageTemplate(t *testing.T) {
+	f := func(opts []CharmingOption, expected map[string]string) {
+		t.Helper()
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(append([]CharmingOption{
+			WithResultStruct(&testUsageStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+		}, opts...)...)
+		require.NoError(t, err)
+		charmer.AddFlags()
+		for name, usage := range expected {
+			require.Equal(t, usage, cmd.PersistentFlags().Lookup(name).Usage, name)
+		}
+		// The config docs and the field descriptions get the usage help as is
+		require.Equal(t, "Number of workers to run", charmer.Fields()[0].Usage)
+	}
+
+	f(nil, map[string]string{
+		"workers": "Number of workers to run (env: TEST_WORKERS, config: workers)",
+		"token":   "API token (env: TEST_TOKEN)",
+		"debug":   "Debug mode (config: debug)",
+		"local":   "Local mode",
+	})
+	f([]CharmingOption{WithEnvPrefix("APP")}, map[string]string{
+		"workers": "Number of workers to run (env: APP_TEST_WORKERS, config: workers)",
+	})
+	f([]CharmingOption{WithUsageTemplate(` [{{.Key}}{{range .Envs}} ${{.}}{{end}}]`)}, map[string]string{
+		"workers": "Number of workers to run [workers $TEST_WORKERS]",
+		"debug":   "Debug mode [debug]",
+	})
+	f([]CharmingOption{WithUsageTemplate("")}, map[string]string{
+		"workers": "Number of workers to run",
+	})
+
+	require.Error(t, WithUsageTemplate("{{.Key")(&SnakeCharmer{}))
+	require.Error(t, WithUsageTemplate("{{.Unknown}}")(&SnakeCharmer{}))
+}
@@ -0,0 +1,190 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldViolation is the violated constraint of the result struct field
+// found by StructValidator.
+type FieldViolation struct {
+	// Field is the Go path of the field in the result struct,
+	// e.g. "DB.Port" or "Servers[0].Port"
+	Field string
+	// Message describes the violation, e.g. `failed the "min=1" validation`
+	Message string
+}
+
+// StructValidator validates the fields of the result struct after
+// it is decoded, e.g. by their validate tags (see the validation sub-package).
+// It is set with WithStructValidator.
+type StructValidator interface {
+	// ValidateStruct returns the violations of the result struct fields,
+	// or the error if the validation cannot be run.
+	ValidateStruct(result interface{}) ([]FieldViolation, error)
+}
+
+// validateResult runs the struct validator on the decoded result struct,
+// and then the cross-field validators if the fields are valid.
+func (sch *SnakeCharmer) validateResult() error {
+	if err := sch.validateStruct(sch.resultStruct); err != nil {
+		return err
+	}
+	return sch.validateCrossFields(sch.resultStruct)
+}
+
+// validationErrors runs the validators like validateResult on the copy
+// of the result struct decoded from the config having errors, so all
+// the problems are reported at once. The errors of the keys already
+// reported, e.g. of the type mismatches leaving the fields zero, are skipped.
+func (sch *SnakeCharmer) validationErrors(result interface{}, reported []error) []error {
+	// The validators may call the read-only accessors, see Subscribe
+	sch.publishView(false)
+	err := sch.validateStruct(result)
+	if err == nil {
+		err = sch.validateCrossFields(result)
+	}
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if cerr, ok := err.(*ConfigErrors); ok {
+		errs = cerr.Errors
+	}
+	seen := map[string]bool{}
+	for _, r := range reported {
+		var ferr *FieldError
+		if errors.As(r, &ferr) {
+			seen[ferr.Key] = true
+		}
+	}
+	unreported := []error{}
+	for _, err := range errs {
+		var ferr *FieldError
+		if errors.As(err, &ferr) && seen[ferr.Key] {
+			continue
+		}
+		unreported = append(unreported, err)
+	}
+	return unreported
+}
+
+// validateStruct runs the struct validator on the decoded result struct
+// or its copy. The violations are returned as FieldError of the config keys
+// of the fields, e.g. "db.port" of "DB.Port".
+func (sch *SnakeCharmer) validateStruct(result interface{}) error {
+	if sch.structValidator == nil {
+		return nil
+	}
+	violations, err := sch.structValidator.ValidateStruct(result)
+	if err != nil {
+		return fmt.Errorf("while validating config: %w", err)
+	}
+	errs := make([]error, 0, len(violations))
+	for _, v := range violations {
+		key := sch.configKeyOf(v.Field)
+		errs = append(errs, sch.newFieldError(key, fmt.Errorf("invalid value of %q: %s", key, v.Message)))
+	}
+	return joinConfigErrors(errs)
+}
+
+// configKeyOf returns the config key of the Go path of the result struct field,
+// e.g. "db.port" of "DB.Port" or "servers[0].port" of "Servers[0].Port".
+// The squashed fields have no key segment. The rest of the path
+// is lowercased if the field is not found.
+func (sch *SnakeCharmer) configKeyOf(field string) string {
+	key := ""
+	t := reflect.TypeOf(sch.resultStruct)
+	for rest := field; len(rest) > 0; {
+		var segment string
+		segment, rest, _ = strings.Cut(rest, ".")
+		name, index, _ := strings.Cut(segment, "[")
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		fp, ok := sch.fieldPlanOf(t, name)
+		if !ok {
+			return joinKey(key, strings.ToLower(strings.TrimSuffix(segment+"."+rest, ".")))
+		}
+		if !fp.squash {
+			key = joinKey(key, fp.tags.key)
+		}
+		if len(index) > 0 {
+			key += "[" + index
+		}
+		t = t.Field(fp.index).Type
+		// The elements of the slices and the maps, e.g. of "[0]" or "[0][1]"
+		for i := strings.Count(index, "]"); i > 0; i-- {
+			for t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				t = t.Elem()
+			}
+		}
+	}
+	return key
+}
+
+// fieldPlanOf returns the plan of the field of the struct by its Go name.
+// The key of the plan is relative to the struct, so it is the name of the field only.
+func (sch *SnakeCharmer) fieldPlanOf(t reflect.Type, name string) (fieldPlan, bool) {
+	if t.Kind() != reflect.Struct {
+		return fieldPlan{}, false
+	}
+	for _, fp := range sch.structPlan(t) {
+		if t.Field(fp.index).Name == name && !fp.skip && len(fp.invalid) == 0 {
+			return fp, true
+		}
+	}
+	return fieldPlan{}, false
+}
+
+// validateCrossFields runs the cross-field validators on the decoded result
+// struct or its copy in the order they are set. The joined errors, e.g. of errors.Join,
+// are split, and FieldError of a config key, e.g. "tls.key", gets the position
+// of the value in the YAML config file. The rest of errors are returned as is.
+func (sch *SnakeCharmer) validateCrossFields(result interface{}) error {
+	errs := []error{}
+	for _, validate := range sch.crossFieldValidators {
+		if err := validate(result); err != nil {
+			errs = append(errs, sch.crossFieldErrors(err)...)
+		}
+	}
+	return joinConfigErrors(errs)
+}
+
+// crossFieldErrors splits the error of the cross-field validator
+// into the errors of the config keys.
+func (sch *SnakeCharmer) crossFieldErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := []error{}
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, sch.crossFieldErrors(err)...)
+		}
+		return errs
+	}
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || len(ferr.Key) == 0 || ferr.Line > 0 {
+		return []error{err}
+	}
+	key := strings.ToLower(ferr.Key)
+	return []error{sch.newFieldError(key, fmt.Errorf("invalid value of %q: %w", key, ferr.Err))}
+}
@@ -0,0 +1,241 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testValidatorFunc func(result interface{}) ([]FieldViolation, error)
+
+func (f testValidatorFunc) ValidateStruct(result interface{}) ([]FieldViolation, error) {
+	return f(result)
+}
+
+type TestValidateBase struct {
+	Workers int `snakecharmer:"workers" usage:"Number of workers to run" default:"8"`
+}
+
+type testValidateStruct struct {
+	TestValidateBase
+	DB struct {
+		Port int `snakecharmer:"port" usage:"DB port" default:"5432"`
+	} `snakecharmer:"db"`
+	Upstreams []testUpstreamConfig `snakecharmer:"upstreams"`
+}
+
+func Test_StructValidator(t *testing.T) {
+	var violations []FieldViolation
+	validator := testValidatorFunc(func(result interface{}) ([]FieldViolation, error) {
+		cfg := result.(*testValidateStruct)
+		if cfg.Workers == 0 {
+			return nil, errors.New("broken")
+		}
+		return violations, nil
+	})
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	f := func(config string) (*testValidateStruct, error) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testValidateStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+			WithStructValidator(validator),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("workers: 4\n")
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+
+	_, err = f("workers: 0\n")
+	require.EqualError(t, err, "while validating config: broken")
+
+	violations = []FieldViolation{
+		{Field: "TestValidateBase.Workers", Message: "too many"},
+		{Field: "DB.Port", Message: "reserved"},
+		{Field: "Upstreams[1].Weight", Message: "negative"},
+		{Field: "Unknown.Field", Message: "whatever"},
+	}
+	_, err = f("workers: 4\nupstreams:\n  - url: a\n  - url: b\n    weight: -1\n")
+	keys := []string{}
+	var cerr *ConfigErrors
+	require.True(t, errors.As(err, &cerr), err)
+	for _, e := range cerr.Errors {
+		var ferr *FieldError
+		require.True(t, errors.As(e, &ferr))
+		keys = append(keys, ferr.Key)
+	}
+	require.Equal(t, []string{"workers", "db.port", "upstreams[1].weight", "unknown.field"}, keys)
+	require.ErrorContains(t, err, path+`:1:10: invalid value of "workers": too many`)
+	require.ErrorContains(t, err, `* invalid value of "db.port": reserved`)
+	require.ErrorContains(t, err, path+`:5:13: invalid value of "upstreams[1].weight": negative`)
+	require.Error(t, WithStructValidator(nil)(&SnakeCharmer{}))
+}
+
+type testCrossFieldStruct struct {
+	Limits struct {
+		Warn  int `snakecharmer:"warn" usage:"Warn limit" default:"80"`
+		Error int `snakecharmer:"error" usage:"Error limit" default:"90"`
+	} `snakecharmer:"limits"`
+	TLS struct {
+		Cert string `snakecharmer:"cert" usage:"TLS certificate file"`
+		Key  string `snakecharmer:"key" usage:"TLS key file"`
+	} `snakecharmer:"tls"`
+}
+
+func Test_CrossFieldValidator(t *testing.T) {
+	limits := func(cfg interface{}) error {
+		c := cfg.(*testCrossFieldStruct)
+		if c.Limits.Warn > c.Limits.Error {
+			return &FieldError{Key: "limits.warn", Err: errors.New("must not exceed limits.error")}
+		}
+		return nil
+	}
+	tls := func(cfg interface{}) error {
+		c := cfg.(*testCrossFieldStruct)
+		switch {
+		case len(c.TLS.Cert) > 0 && len(c.TLS.Key) == 0:
+			return &FieldError{Key: "tls.key", Err: errors.New("must be set along with tls.cert")}
+		case len(c.TLS.Key) > 0 && len(c.TLS.Cert) == 0:
+			return errors.Join(
+				&FieldError{Key: "tls.cert", Err: errors.New("must be set along with tls.key")},
+				errors.New("TLS is misconfigured"),
+			)
+		}
+		return nil
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	f := func(config string) (*testCrossFieldStruct, error) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		result := &testCrossFieldStruct{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+			WithCrossFieldValidator(limits),
+			WithCrossFieldValidator(tls),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("tls:\n  cert: a.crt\n  key: a.key\n")
+	require.NoError(t, err)
+	require.Equal(t, "a.key", result.TLS.Key)
+
+	_, err = f("limits:\n  warn: 95\n")
+	require.EqualError(t, err, path+`:2:9: invalid value of "limits.warn": must not exceed limits.error`)
+	var ferr *FieldError
+	require.True(t, errors.As(err, &ferr))
+	require.Equal(t, "limits.warn", ferr.Key)
+
+	_, err = f("limits:\n  warn: 95\ntls:\n  cert: a.crt\n")
+	require.EqualError(t, err, "2 config errors:\n"+
+		"* "+path+`:2:9: invalid value of "limits.warn": must not exceed limits.error`+"\n"+
+		`* invalid value of "tls.key": must be set along with tls.cert`)
+
+	_, err = f("tls:\n  key: a.key\n")
+	require.EqualError(t, err, "2 config errors:\n"+
+		`* invalid value of "tls.cert": must be set along with tls.key`+"\n"+
+		"* TLS is misconfigured")
+
+	// The validators run along with the other checks
+	_, err = f("limits:\n  warn: 95\ntls:\n  kye: a.key\n")
+	require.EqualError(t, err, "2 config errors:\n"+
+		`* unknown config keys: "tls.kye" (did you mean "tls.key"?)`+"\n"+
+		"* "+path+`:2:9: invalid value of "limits.warn": must not exceed limits.error`)
+	_, err = f("limits:\n  warn: x\ntls:\n  cert: a.crt\n")
+	require.EqualError(t, err, "2 config errors:\n"+
+		"* "+path+`:2:9: cannot parse 'limits.warn' as int: strconv.ParseInt: parsing "x": invalid syntax`+"\n"+
+		`* invalid value of "tls.key": must be set along with tls.cert`)
+	// The fields failing the type checks are not validated
+	_, err = f("limits:\n  warn: x\n  error: -1\n")
+	require.EqualError(t, err, "while unmarshalling config, flags, and env vars: "+
+		path+`:2:9: cannot parse 'limits.warn' as int: strconv.ParseInt: parsing "x": invalid syntax`)
+	require.Error(t, WithCrossFieldValidator(nil)(&SnakeCharmer{}))
+}
+
+func Test_CrossFieldValidatorAccessors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	f := func(config string) error {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testCrossFieldStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		err = charmer.Set(WithCrossFieldValidator(func(cfg interface{}) error {
+			if charmer.WasSet("tls") && !charmer.WasSet("tls.key") {
+				return &FieldError{Key: "tls.key", Err: errors.New("must be set along with tls.cert")}
+			}
+			require.Equal(t, []string{path}, charmer.FilesUsed())
+			require.NotEmpty(t, charmer.PrecedenceOrder())
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error in Set(): %s", err.Error())
+		}
+		charmer.AddFlags()
+
+		done := make(chan error, 1)
+		go func() { done <- charmer.UnmarshalExact() }()
+		select {
+		case err = <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("UnmarshalExact() deadlocked calling the accessors from the validator")
+		}
+		return nil
+	}
+
+	require.NoError(t, f("tls:\n  cert: a.crt\n  key: a.key\n"))
+	require.EqualError(t, f("tls:\n  cert: a.crt\n"), `invalid value of "tls.key": must be set along with tls.cert`)
+	// The validators run on the copy of the config having errors
+	require.EqualError(t, f("limits:\n  warn: x\ntls:\n  cert: a.crt\n"), "2 config errors:\n"+
+		"* "+path+`:2:9: cannot parse 'limits.warn' as int: strconv.ParseInt: parsing "x": invalid syntax`+"\n"+
+		`* invalid value of "tls.key": must be set along with tls.cert`)
+}
@@ -0,0 +1,105 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation runs the go-playground/validator `validate` tags
+// of the snakecharmer result struct after every unmarshal, e.g.
+//
+//	type Config struct {
+//		Port int `mapstructure:"port" usage:"Port to listen on" validate:"min=1,max=65535"`
+//	}
+//
+//	charmer, err := snakecharmer.NewSnakeCharmer(
+//		snakecharmer.WithResultStruct(&cfg),
+//		validation.WithStructValidation(true),
+//	)
+//
+// The violations are returned by UnmarshalExact as snakecharmer.FieldError
+// of the config keys of the fields, e.g. "port". It is a separate package,
+// so the validator dependency is linked in only if it is used.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/asokolov365/snakecharmer"
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is the snakecharmer.StructValidator checking the validate tags.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// New returns the Validator checking the validate tags.
+func New() *Validator {
+	return &Validator{validate: validator.New(validator.WithRequiredStructEnabled())}
+}
+
+// Validate returns the underlying validator, e.g. for registering
+// the custom validations with RegisterValidation.
+func (v *Validator) Validate() *validator.Validate {
+	return v.validate
+}
+
+// ValidateStruct implements snakecharmer.StructValidator.
+func (v *Validator) ValidateStruct(result interface{}) ([]snakecharmer.FieldViolation, error) {
+	err := v.validate.Struct(result)
+	if err == nil {
+		return nil, nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, err
+	}
+	violations := make([]snakecharmer.FieldViolation, 0, len(verrs))
+	for _, fe := range verrs {
+		violations = append(violations, snakecharmer.FieldViolation{
+			Field:   fieldPath(fe.StructNamespace()),
+			Message: message(fe),
+		})
+	}
+	return violations, nil
+}
+
+// WithStructValidation makes the charmer check the validate tags of
+// the result struct after every unmarshal, see snakecharmer.WithStructValidator.
+func WithStructValidation(enabled bool) snakecharmer.CharmingOption {
+	if !enabled {
+		return func(sch *snakecharmer.SnakeCharmer) error { return nil }
+	}
+	return snakecharmer.WithStructValidator(New())
+}
+
+// fieldPath returns the Go path of the field in the result struct,
+// i.e. the struct namespace without the struct type name,
+// e.g. "DB.Port" of "Config.DB.Port".
+func fieldPath(namespace string) string {
+	_, path, ok := strings.Cut(namespace, ".")
+	if !ok {
+		return namespace
+	}
+	return path
+}
+
+// message describes the violated validation, e.g. `failed the "min=1" validation`.
+// The value is not included, since it may be a secret.
+func message(fe validator.FieldError) string {
+	tag := fe.Tag()
+	if len(fe.Param()) > 0 {
+		tag += "=" + fe.Param()
+	}
+	return fmt.Sprintf("failed the %q validation", tag)
+}
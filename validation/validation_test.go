@@ -0,0 +1,109 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/asokolov365/snakecharmer"
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testUpstream struct {
+	URL    string `snakecharmer:"url" validate:"required,url"`
+	Weight int    `snakecharmer:"weight" validate:"gte=0"`
+}
+
+type testConfig struct {
+	Workers int    `snakecharmer:"workers" usage:"Number of workers to run" default:"8" validate:"min=1,max=64"`
+	Level   string `snakecharmer:"level" usage:"Log level" default:"info"`
+	DB      struct {
+		Port     int    `snakecharmer:"port" usage:"DB port" default:"5432" validate:"min=1,max=65535"`
+		Password string `snakecharmer:"password,secret" usage:"DB password" validate:"omitempty,min=8"`
+	} `snakecharmer:"db"`
+	Upstreams []testUpstream `snakecharmer:"upstreams" validate:"dive"`
+}
+
+func Test_WithStructValidation(t *testing.T) {
+	f := func(enabled bool, config string) (*testConfig, error) {
+		t.Helper()
+		result := &testConfig{}
+		charmer, err := snakecharmer.NewSnakeCharmer(
+			snakecharmer.WithResultStruct(result),
+			snakecharmer.WithFieldTagName("snakecharmer"),
+			snakecharmer.WithCobraCommand(&cobra.Command{}),
+			snakecharmer.WithConfigBytes([]byte(config), "yaml"),
+			WithStructValidation(enabled),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f(true, "workers: 4\nupstreams:\n  - url: http://localhost:8080\n")
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Workers)
+
+	_, err = f(true, "workers: 100\n")
+	var ferr *snakecharmer.FieldError
+	require.True(t, errors.As(err, &ferr), err)
+	require.Equal(t, "workers", ferr.Key)
+	require.EqualError(t, err, `invalid value of "workers": failed the "max=64" validation`)
+
+	_, err = f(true, `workers: 0
+db:
+  port: 70000
+  password: short
+upstreams:
+  - url: http://localhost:8080
+  - url: not-a-url
+    weight: -1
+`)
+	var cerr *snakecharmer.ConfigErrors
+	require.True(t, errors.As(err, &cerr), err)
+	keys := []string{}
+	for _, e := range cerr.Errors {
+		require.True(t, errors.As(e, &ferr))
+		keys = append(keys, ferr.Key)
+	}
+	require.Equal(t, []string{"workers", "db.port", "db.password", "upstreams[1].url", "upstreams[1].weight"}, keys)
+	// The secret value is not revealed
+	require.NotContains(t, err.Error(), "short")
+
+	// The validation is disabled
+	result, err = f(false, "workers: 100\n")
+	require.NoError(t, err)
+	require.Equal(t, 100, result.Workers)
+}
+
+func Test_Validate(t *testing.T) {
+	v := New()
+	require.NoError(t, v.Validate().RegisterValidation("even", func(fl validator.FieldLevel) bool {
+		return fl.Field().Int()%2 == 0
+	}))
+	violations, err := v.ValidateStruct(&struct {
+		Shards int `validate:"even"`
+	}{Shards: 3})
+	require.NoError(t, err)
+	require.Equal(t, []snakecharmer.FieldViolation{{Field: "Shards", Message: `failed the "even" validation`}}, violations)
+
+	_, err = v.ValidateStruct(42)
+	require.Error(t, err)
+}
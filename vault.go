@@ -0,0 +1,73 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// VaultClient reads the secrets of HashiCorp Vault,
+// e.g. an adapter of the api.Logical of the Vault client, see WithVault.
+type VaultClient interface {
+	// Read returns the data of the secret at the path, e.g. "secret/data/app".
+	Read(ctx context.Context, path string) (map[string]interface{}, error)
+}
+
+// vaultPrefix is the prefix of the references resolved by the Vault client.
+const vaultPrefix = "vault:"
+
+// vaultResolver resolves "vault:secret/data/app#api_key" as the field
+// "api_key" of the secret "secret/data/app", and "vault:secret/data/app"
+// as the whole secret data encoded in JSON. The data of the KV v2 secrets
+// nested under the "data" key is unwrapped.
+type vaultResolver struct {
+	client VaultClient
+}
+
+func (r *vaultResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	path, field, hasField := strings.Cut(ref, "#")
+	if len(path) == 0 {
+		return "", fmt.Errorf("vault secret path is an empty string")
+	}
+	data, err := r.client.Read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "", fmt.Errorf("vault secret %q is not found", path)
+	}
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data[field]; !ok || !hasField {
+			// KV v2 secret
+			data = nested
+		}
+	}
+	if !hasField {
+		doc, err := json.Marshal(data)
+		return string(doc), err
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no field %q", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	doc, err := json.Marshal(value)
+	return string(doc), err
+}
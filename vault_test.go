@@ -0,0 +1,89 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testVaultClient map[string]map[string]interface{}
+
+func (c testVaultClient) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	return c[path], nil
+}
+
+type testVaultStruct struct {
+	APIKey string `snakecharmer:"api-key,secret" usage:"API key" vault:"secret/data/app#api_key"`
+	DB     struct {
+		User     string `snakecharmer:"user" usage:"DB user" default:"admin"`
+		Password string `snakecharmer:"password,secret" usage:"DB password"`
+		Port     int    `snakecharmer:"port" usage:"DB port" default:"5432"`
+	} `snakecharmer:"db"`
+}
+
+func Test_VaultValueResolver(t *testing.T) {
+	vault := testVaultClient{
+		// KV v2
+		"secret/data/app": {"data": map[string]interface{}{"api_key": "k3y"}, "metadata": map[string]interface{}{}},
+		// KV v1
+		"secret/db": {"password": "s3cr3t", "port": 6432},
+	}
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("db:\n  port: vault:secret/db#port\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	f := func(args ...string) (*testVaultStruct, error) {
+		t.Helper()
+		result := &testVaultStruct{}
+		cmd := &cobra.Command{}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(cmd),
+			WithConfigFilePath(config),
+			WithVault(vault),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = cmd.ParseFlags(args); err != nil {
+			t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+		}
+		return result, charmer.UnmarshalExact()
+	}
+
+	result, err := f("--db.password", "vault:secret/db#password")
+	require.NoError(t, err)
+	require.Equal(t, "k3y", result.APIKey)
+	require.Equal(t, "s3cr3t", result.DB.Password)
+	require.Equal(t, 6432, result.DB.Port)
+
+	// The flag overrides the tag
+	result, err = f("--api-key", "plain")
+	require.NoError(t, err)
+	require.Equal(t, "plain", result.APIKey)
+
+	_, err = f("--db.password", "vault:secret/db#missing")
+	require.Error(t, err)
+	_, err = f("--db.password", "vault:secret/missing#password")
+	require.Error(t, err)
+}
@@ -0,0 +1,76 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// runView is the state of the unmarshal pipeline read by the read-only
+// accessors, e.g. ChangedKeys and FilesUsed. The pipeline publishes it
+// before it calls the validators and the subscribers, and once again
+// when it returns, so the accessors read it without sch.mu, which
+// the pipeline holds while the callbacks run. It is never modified
+// after it is published.
+type runView struct {
+	// The redacted merged settings, see RedactedSettings
+	settings map[string]interface{}
+	// The redacted values of the result struct fields, see DumpEffectiveConfig
+	effective map[string]interface{}
+	// The sources of the values by the lower-cased keys of the fields
+	sources map[string]string
+	// The sorted lower-cased keys of the fields configured explicitly, see WasSet
+	changed     []string
+	filesUsed   []string
+	expirations map[string]time.Time
+	precedence  []SourceKind
+}
+
+// loadView returns the view published by the last run of the unmarshal
+// pipeline, or nil if it has not run yet.
+func (sch *SnakeCharmer) loadView() *runView {
+	return sch.view.Load()
+}
+
+// publishView publishes the view of the current state. The caller must hold sch.mu.
+// If decoded is true, the result struct holds the values decoded by the running
+// pipeline, which are not accepted yet, i.e. the callbacks are about to be called.
+func (sch *SnakeCharmer) publishView(decoded bool) {
+	effective := sch.backend.AllSettings()
+	if decoded || sch.settings != nil {
+		effective = sch.fieldSettings(true)
+	}
+	v := &runView{
+		settings:    sch.redactSettings(sch.backend.AllSettings()),
+		effective:   sch.redactSettings(effective),
+		sources:     sch.sources(),
+		changed:     []string{},
+		filesUsed:   append([]string(nil), sch.filesUsed...),
+		expirations: make(map[string]time.Time, len(sch.expirations)),
+		precedence:  sch.precedenceOrder(),
+	}
+	for _, b := range sch.bindings {
+		if sch.wasSet(b) {
+			v.changed = append(v.changed, strings.ToLower(b.key))
+		}
+	}
+	sort.Strings(v.changed)
+	for key, exp := range sch.expirations {
+		v.expirations[key] = exp
+	}
+	sch.view.Store(v)
+}
@@ -0,0 +1,145 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// WriteEffectiveConfig writes the effective configuration, i.e. the values
+// of the result struct fields decoded by the last UnmarshalExact (or merged from
+// flags, ENV vars, config files and defaults if it was not called yet),
+// to the file, overwriting it. The format is chosen by the file extension,
+// e.g. ".json", or the config file type (see WithConfigFileType) if there is none.
+// The fields that cannot be set in config, e.g. `config:"-"`, are skipped,
+// the values of secret fields are redacted, the file is created with 0600 permissions.
+func (sch *SnakeCharmer) WriteEffectiveConfig(path string) error {
+	return sch.writeEffectiveConfig(path, false)
+}
+
+// SafeWriteEffectiveConfig works like WriteEffectiveConfig, but returns
+// viper.ConfigFileAlreadyExistsError if the file exists.
+func (sch *SnakeCharmer) SafeWriteEffectiveConfig(path string) error {
+	return sch.writeEffectiveConfig(path, true)
+}
+
+func (sch *SnakeCharmer) writeEffectiveConfig(path string, safe bool) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	return sch.writeConfig(path, sch.redactSettings(sch.effectiveSettings(false)), safe)
+}
+
+// WriteDefaultConfig writes the default configuration, i.e. the defaults
+// of the fields (see WithDefaults) without the values of flags, ENV vars
+// and config files, to the file, so the command like "app config init"
+// can scaffold the config. It returns viper.ConfigFileAlreadyExistsError
+// if the file exists. The format is chosen by the file extension, e.g. ".json",
+// or the config file type (see WithConfigFileType) if there is none.
+// The fields that cannot be set in config, e.g. `config:"-"`, are skipped,
+// the secret fields are written with zero values.
+// It requires AddFlags to be called, otherwise the fields are unknown.
+func (sch *SnakeCharmer) WriteDefaultConfig(path string) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	settings := map[string]interface{}{}
+	for _, b := range sch.bindings {
+		if b.noConfig {
+			continue
+		}
+		value := b.defaultValue
+		for _, d := range sch.defaultValues {
+			if d.key == b.key {
+				value = d.value
+			}
+		}
+		if b.secret {
+			value = reflect.Zero(b.typ).Interface()
+		} else if isStructSlice(b.typ) || isStructMap(b.typ) {
+			value = sch.structSettings(value)
+		}
+		setSetting(settings, b.key, configValue(value))
+	}
+	return sch.writeConfig(path, settings, true)
+}
+
+// configValue returns the value as it is written in config files,
+// e.g. "1m0s" of time.Duration or "512MiB" of ByteSize.
+func configValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Duration:
+		return v.String()
+	case encoding.TextMarshaler:
+		if text, err := v.MarshalText(); err == nil {
+			return string(text)
+		}
+		return value
+	}
+	rv := reflect.ValueOf(value)
+	if isFlagValue(rv.Type()) {
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface().(pflag.Value).String()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = configValue(rv.Index(i).Interface())
+		}
+		return result
+	case reflect.Map:
+		result := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			result[fmt.Sprint(iter.Key().Interface())] = configValue(iter.Value().Interface())
+		}
+		return result
+	}
+	return value
+}
+
+// writeConfig writes the settings to the config file. If safe is true,
+// it returns viper.ConfigFileAlreadyExistsError if the file exists.
+func (sch *SnakeCharmer) writeConfig(path string, settings map[string]interface{}, safe bool) error {
+	v := viper.New()
+	v.SetConfigType(sch.configFileType)
+	v.SetConfigPermissions(0o600)
+	if err := v.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	var err error
+	if safe {
+		err = v.SafeWriteConfigAs(path)
+	} else {
+		err = v.WriteConfigAs(path)
+	}
+	if err != nil {
+		return fmt.Errorf("while writing config %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteEffectiveConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(config, []byte("password: s3cr3t\nlog:\n  json: true\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+	}
+	t.Setenv("TEST_DUMP_LOG_LEVEL", "debug")
+
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithConfigFilePath(config),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--workers", "16"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	f := func(name, expected string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		require.NoError(t, charmer.WriteEffectiveConfig(path))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(data))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	f("effective.yaml", `log:
+    json: true
+    level: debug
+password: '***'
+workers: 16
+`)
+	f("effective.json", `{
+  "log": {
+    "json": true,
+    "level": "debug"
+  },
+  "password": "***",
+  "workers": 16
+}`)
+	// The config file type is used without the extension
+	f("effective", `log:
+    json: true
+    level: debug
+password: '***'
+workers: 16
+`)
+	// Overwrites the file
+	f("effective", `log:
+    json: true
+    level: debug
+password: '***'
+workers: 16
+`)
+
+	err = charmer.SafeWriteEffectiveConfig(filepath.Join(dir, "effective"))
+	var exists viper.ConfigFileAlreadyExistsError
+	require.True(t, errors.As(err, &exists))
+	require.NoError(t, charmer.SafeWriteEffectiveConfig(filepath.Join(dir, "new.yaml")))
+}
+
+func Test_WriteEffectiveConfig_Typed(t *testing.T) {
+	t.Setenv("TEST_DUMP_INTS", "1,2,3")
+	t.Setenv("TEST_DUMP_ENABLED", "a=true,b=false")
+
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDumpTypedStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--flags", "true,false", "--floats", "1.5,2.5"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	path := filepath.Join(t.TempDir(), "effective.json")
+	require.NoError(t, charmer.WriteEffectiveConfig(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "enabled": {"a": true, "b": false},
+  "flags": [true, false],
+  "floats": [1.5, 2.5],
+  "ints": [1, 2, 3]
+}`, string(data))
+}
+
+type testDefaultConfigStruct struct {
+	Workers  int           `snakecharmer:"workers" env:"TEST_DEFAULT_CONFIG_WORKERS" usage:"Number of workers to run" default:"8"`
+	Timeout  time.Duration `snakecharmer:"timeout" usage:"Timeout"`
+	MaxSize  ByteSize      `snakecharmer:"max-size" usage:"Max size" default:"512MiB"`
+	Hosts    []string      `snakecharmer:"hosts" usage:"Hosts" default:"a,b"`
+	Password string        `snakecharmer:"password,secret" usage:"Password" default:"s3cr3t"`
+	Token    string        `snakecharmer:"token" config:"-" usage:"Token"`
+	Log      struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+	} `snakecharmer:"log"`
+}
+
+func Test_WriteDefaultConfig(t *testing.T) {
+	t.Setenv("TEST_DEFAULT_CONFIG_WORKERS", "32")
+	cmd := &cobra.Command{}
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testDefaultConfigStruct{Timeout: time.Minute}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(cmd),
+		WithDefaults(map[string]interface{}{"log.level": "warn"}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	if err = cmd.ParseFlags([]string{"--log.level", "debug"}); err != nil {
+		t.Fatalf("unexpected error in (*cobra.Command).ParseFlags(): %s", err.Error())
+	}
+	if err = charmer.UnmarshalExact(); err != nil {
+		t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, charmer.WriteDefaultConfig(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `hosts:
+    - a
+    - b
+log:
+    level: warn
+max-size: 512MiB
+password: ""
+timeout: 1m0s
+workers: 8
+`, string(data))
+
+	// The written config is loaded back
+	result := &testDefaultConfigStruct{Timeout: time.Second}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath(path),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 512*MiB, result.MaxSize)
+	require.Equal(t, time.Minute, result.Timeout)
+	require.Equal(t, "warn", result.Log.Level)
+
+	err = charmer.WriteDefaultConfig(path)
+	var exists viper.ConfigFileAlreadyExistsError
+	require.True(t, errors.As(err, &exists))
+}
@@ -0,0 +1,96 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDocumentsSettings handles multi-document YAML config files,
+// which viper reads only the first document of.
+// The documents are merged in order, later documents winning,
+// or, if the document selector is set, the selected document is used.
+// It returns false if the config has a single document and no selector is set,
+// i.e. the settings read by viper can be used as is.
+func (sch *SnakeCharmer) yamlDocumentsSettings(name string, data []byte) (map[string]interface{}, bool, error) {
+	docs, err := decodeYAMLDocuments(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("while reading YAML documents of %q: %w", name, err)
+	}
+	return sch.mergeYAMLDocuments(name, docs)
+}
+
+// mergeYAMLDocuments merges the documents of the YAML config,
+// see yamlDocumentsSettings.
+func (sch *SnakeCharmer) mergeYAMLDocuments(path string, docs []map[string]interface{}) (map[string]interface{}, bool, error) {
+	if len(sch.yamlSelectorKey) == 0 && len(docs) < 2 {
+		return nil, false, nil
+	}
+	// viper is used for merging, as it makes the keys case insensitive
+	merged := viper.New()
+	found := false
+	for _, doc := range docs {
+		if len(sch.yamlSelectorKey) > 0 {
+			if fmt.Sprint(doc[sch.yamlSelectorKey]) != sch.yamlSelectorValue {
+				continue
+			}
+			delete(doc, sch.yamlSelectorKey)
+		}
+		if err := merged.MergeConfigMap(doc); err != nil {
+			return nil, false, fmt.Errorf("while merging YAML documents of %q: %w", path, err)
+		}
+		found = true
+	}
+	if !found {
+		return nil, false, fmt.Errorf("no YAML document with %s=%q in %q", sch.yamlSelectorKey, sch.yamlSelectorValue, path)
+	}
+	return merged.AllSettings(), true, nil
+}
+
+// isYAMLConfig returns true if the config file is read as YAML.
+func (sch *SnakeCharmer) isYAMLConfig(path string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if len(ext) == 0 || !fileExtSupported(ext) {
+		ext = sch.configFileType
+	}
+	return ext == "yaml" || ext == "yml"
+}
+
+// decodeYAMLDocuments decodes all non-empty documents of the YAML config.
+func decodeYAMLDocuments(r io.Reader) ([]map[string]interface{}, error) {
+	docs := []map[string]interface{}{}
+	decoder := yaml.NewDecoder(r)
+	for {
+		var doc map[string]interface{}
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+}
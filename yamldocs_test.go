@@ -0,0 +1,97 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testMultiDocStruct struct {
+	Kind     string `snakecharmer:"kind" usage:"Document kind"`
+	Workers  int    `snakecharmer:"workers" usage:"Number of workers to run" default:"128"`
+	BindAddr string `snakecharmer:"bind-addr" usage:"Addr to bind" default:"0.0.0.0"`
+	Log      struct {
+		Level string `snakecharmer:"level" usage:"Log level" default:"info"`
+		JSON  bool   `snakecharmer:"json" usage:"Log in JSON format"`
+	} `snakecharmer:"log"`
+}
+
+func Test_MultiDocumentYAML(t *testing.T) {
+	f := func(opts ...CharmingOption) *testMultiDocStruct {
+		t.Helper()
+		result := &testMultiDocStruct{}
+		opts = append([]CharmingOption{
+			WithResultStruct(result),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath("./test-config-multi.yaml"),
+		}, opts...)
+		charmer, err := NewSnakeCharmer(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		if err = charmer.UnmarshalExact(); err != nil {
+			t.Fatalf("unexpected error in UnmarshalExact(): %s", err.Error())
+		}
+		return result
+	}
+
+	merged := f()
+	require.Equal(t, "client", merged.Kind)
+	require.Equal(t, 512, merged.Workers)
+	require.Equal(t, "127.0.0.1", merged.BindAddr)
+	require.Equal(t, "warn", merged.Log.Level)
+	require.True(t, merged.Log.JSON)
+
+	server := f(WithYAMLDocumentSelector("kind", "server"))
+	require.Equal(t, "", server.Kind)
+	require.Equal(t, 512, server.Workers)
+	require.Equal(t, "0.0.0.0", server.BindAddr)
+	require.Equal(t, "info", server.Log.Level)
+	require.True(t, server.Log.JSON)
+
+	charmer, err := NewSnakeCharmer(
+		WithResultStruct(&testMultiDocStruct{}),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigFilePath("./test-config-multi.yaml"),
+		WithYAMLDocumentSelector("kind", "unknown"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.Error(t, charmer.UnmarshalExact())
+
+	// The documents of the configs which are not files are merged as well
+	result := &testMultiDocStruct{}
+	charmer, err = NewSnakeCharmer(
+		WithResultStruct(result),
+		WithFieldTagName("snakecharmer"),
+		WithCobraCommand(&cobra.Command{}),
+		WithConfigBytes([]byte("workers: 256\nlog:\n  level: warn\n---\nworkers: 512\n"), "yaml"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+	}
+	charmer.AddFlags()
+	require.NoError(t, charmer.UnmarshalExact())
+	require.Equal(t, 512, result.Workers)
+	require.Equal(t, "warn", result.Log.Level)
+}
@@ -0,0 +1,148 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyPosition is the position of the value in the YAML config file.
+type keyPosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// recordYAMLPositions records the positions of the values of the YAML
+// config file, so the decode errors point at the offending line.
+// The positions of the later files and documents win, like their values.
+func (sch *SnakeCharmer) recordYAMLPositions(file string, data []byte) {
+	if sch.yamlPositions == nil {
+		sch.yamlPositions = make(map[string]keyPosition)
+	}
+	sch.readYAMLPositions(sch.yamlPositions, file, data)
+}
+
+// readYAMLPositions reads the positions of the values of the YAML
+// config file into the map keyed by the config key, e.g. "servers[0].port".
+// The file is parsed by viper before, so the parse errors are ignored.
+func (sch *SnakeCharmer) readYAMLPositions(positions map[string]keyPosition, file string, data []byte) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			// io.EOF after the last document
+			return
+		}
+		if len(doc.Content) == 0 || !sch.yamlDocumentSelected(doc.Content[0]) {
+			continue
+		}
+		recordYAMLNode(positions, file, doc.Content[0], "")
+	}
+}
+
+// yamlDocumentSelected returns true if the document root node
+// is selected by the document selector, see WithYAMLDocumentSelector.
+func (sch *SnakeCharmer) yamlDocumentSelected(root *yaml.Node) bool {
+	if len(sch.yamlSelectorKey) == 0 {
+		return true
+	}
+	if root.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == sch.yamlSelectorKey {
+			return root.Content[i+1].Value == sch.yamlSelectorValue
+		}
+	}
+	return false
+}
+
+func recordYAMLNode(positions map[string]keyPosition, file string, node *yaml.Node, key string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			if name.Value == "<<" {
+				// The merge key, the keys of the merged map are recorded
+				// at the merge key position
+				recordYAMLMerge(positions, file, name, value, key)
+				continue
+			}
+			recordYAMLValue(positions, file, name, value, joinKey(key, strings.ToLower(name.Value)))
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			recordYAMLValue(positions, file, item, item, fmt.Sprintf("%s[%d]", key, i))
+		}
+	}
+}
+
+// recordYAMLValue records the position of the value of the key:
+// the one of the scalar itself, or the one of the key of the map or the list.
+func recordYAMLValue(positions map[string]keyPosition, file string, name, value *yaml.Node, key string) {
+	pos := value
+	if value.Kind != yaml.ScalarNode {
+		pos = name
+	}
+	positions[key] = keyPosition{file: file, line: pos.Line, column: pos.Column}
+	if value.Kind == yaml.AliasNode {
+		// The aliased nodes are not walked, they may be recursive
+		return
+	}
+	recordYAMLNode(positions, file, value, key)
+}
+
+func recordYAMLMerge(positions map[string]keyPosition, file string, name, value *yaml.Node, key string) {
+	if value.Kind == yaml.AliasNode {
+		value = value.Alias
+	}
+	if value == nil || value.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		k := joinKey(key, strings.ToLower(value.Content[i].Value))
+		positions[k] = keyPosition{file: file, line: name.Line, column: name.Column}
+	}
+}
+
+// positionOf returns the position of the value of the key, e.g. "servers[0].port",
+// in the YAML config file, or false if the value does not come from one,
+// e.g. it is overridden by a flag or an ENV var.
+func (sch *SnakeCharmer) positionOf(key string) (keyPosition, bool) {
+	key = strings.ToLower(key)
+	pos, ok := sch.yamlPositions[key]
+	if !ok {
+		return pos, false
+	}
+	if binding := sch.bindingOfKey(key); binding != nil && sch.sourceOf(*binding) != SourceConfigFile {
+		return pos, false
+	}
+	return pos, true
+}
+
+// newFieldError returns FieldError of the key with the position
+// of the value in the YAML config file, if it comes from one.
+func (sch *SnakeCharmer) newFieldError(key string, err error) *FieldError {
+	ferr := &FieldError{Key: key, Err: err}
+	if pos, ok := sch.positionOf(key); ok {
+		ferr.File, ferr.Line, ferr.Column = pos.file, pos.line, pos.column
+	}
+	return ferr
+}
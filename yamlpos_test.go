@@ -0,0 +1,92 @@
+// Copyright 2013-2023 The SnakeCharmer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snakecharmer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type testPositionStruct struct {
+	Workers int   `snakecharmer:"workers" env:"TEST_POSITION_WORKERS" usage:"Number of workers to run" default:"8"`
+	Ports   []int `snakecharmer:"ports" usage:"Ports to listen on" default:"80"`
+	DB      struct {
+		Port int `snakecharmer:"port" usage:"DB port" default:"5432"`
+	} `snakecharmer:"db"`
+}
+
+func Test_YAMLPositions(t *testing.T) {
+	f := func(config string) (string, error) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatalf("unexpected error in os.WriteFile(): %s", err.Error())
+		}
+		charmer, err := NewSnakeCharmer(
+			WithResultStruct(&testPositionStruct{}),
+			WithFieldTagName("snakecharmer"),
+			WithCobraCommand(&cobra.Command{}),
+			WithConfigFilePath(path),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error in NewSnakeCharmer(opts ...Option): %s", err.Error())
+		}
+		charmer.AddFlags()
+		return path, charmer.UnmarshalExact()
+	}
+	position := func(err error) (string, int, int) {
+		t.Helper()
+		var ferr *FieldError
+		require.True(t, errors.As(err, &ferr), err)
+		return ferr.File, ferr.Line, ferr.Column
+	}
+
+	path, err := f("workers: 4\ndb:\n  port: x\n")
+	file, line, column := position(err)
+	require.Equal(t, path, file)
+	require.Equal(t, 3, line)
+	require.Equal(t, 9, column)
+	require.ErrorContains(t, err, path+":3:9: cannot parse 'db.port' as int")
+
+	// The items of lists
+	_, err = f("ports:\n  - 80\n  - http\n")
+	_, line, column = position(err)
+	require.Equal(t, 3, line)
+	require.Equal(t, 5, column)
+
+	// The later documents win
+	_, err = f("workers: 4\n---\nworkers: many\n")
+	_, line, column = position(err)
+	require.Equal(t, 3, line)
+	require.Equal(t, 10, column)
+
+	// Both errors have the positions
+	_, err = f("workers: many\ndb:\n  port: x\n")
+	var cerr *ConfigErrors
+	require.True(t, errors.As(err, &cerr), err)
+	require.ErrorContains(t, err, ":1:10: cannot parse 'workers' as int")
+	require.ErrorContains(t, err, ":3:9: cannot parse 'db.port' as int")
+
+	// The value does not come from the config file
+	t.Setenv("TEST_POSITION_WORKERS", "many")
+	_, err = f("workers: 4\n")
+	_, line, _ = position(err)
+	require.Equal(t, 0, line)
+}